@@ -34,6 +34,7 @@ func NewApplianceCmd(f *factory.Factory) *cobra.Command {
 	cmd.AddCommand(NewMetricCmd(f))
 	cmd.AddCommand(NewResolveNameCmd(f))
 	cmd.AddCommand(NewResolveNameStatusCmd(f))
+	cmd.AddCommand(NewVerifyCmd(f))
 	cmd.AddCommand(files.NewFilesCmd(f))
 
 	return cmd
@@ -13,7 +13,9 @@ import (
 	"github.com/appgate/sdpctl/pkg/configuration"
 	"github.com/appgate/sdpctl/pkg/docs"
 	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/keyring"
 	"github.com/appgate/sdpctl/pkg/prompt"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -69,7 +71,7 @@ func backupAPIrun(cmd *cobra.Command, args []string, opts *apiOptions) error {
 		fmt.Fprintln(opts.Out, "Backup API is already enabled.")
 		return nil
 	}
-	var message string
+	var message, passphrase string
 	if opts.disable {
 		settings.SetBackupApiEnabled(false)
 		message = "backup API has been disabled."
@@ -85,6 +87,7 @@ func backupAPIrun(cmd *cobra.Command, args []string, opts *apiOptions) error {
 		}
 		settings.SetBackupApiEnabled(true)
 		settings.SetBackupPassphrase(answer)
+		passphrase = answer
 		message = "Backup API and passphrase has been updated."
 	}
 
@@ -92,6 +95,12 @@ func backupAPIrun(cmd *cobra.Command, args []string, opts *apiOptions) error {
 	if err != nil {
 		return api.HTTPErrorResponse(response, err)
 	}
+	// the passphrase is stored to decrypt the backups with 'sdpctl appliance backup inspect' and 'decrypt'
+	if h, err := opts.Config.GetHost(); err == nil && len(passphrase) > 0 {
+		if err := keyring.SetBackupPassphrase(h, passphrase); err != nil {
+			log.WithError(err).Warn("Could not store the backup passphrase in the keyring")
+		}
+	}
 	fmt.Fprintln(opts.Out, message)
 	return nil
 }
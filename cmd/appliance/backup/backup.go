@@ -5,20 +5,27 @@ import (
 
 	"github.com/appgate/sdpctl/pkg/appliance"
 	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/events"
 	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/notify"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/spf13/cobra"
 )
 
 func NewCmdBackup(f *factory.Factory) *cobra.Command {
-	var backupIDs map[string]string
+	var (
+		backupIDs          map[string]string
+		output, eventsFile string
+		retention          retentionFlags
+	)
 	opts := appliance.BackupOpts{
-		Config:      f.Config,
-		Out:         f.IOOutWriter,
-		SpinnerOut:  f.GetSpinnerOutput(),
-		Appliance:   f.Appliance,
-		Destination: appliance.DefaultBackupDestination,
+		Config:        f.Config,
+		Out:           f.IOOutWriter,
+		SpinnerOut:    f.GetSpinnerOutput(),
+		Appliance:     f.Appliance,
+		Destination:   appliance.DefaultBackupDestination,
+		SdpctlVersion: f.Version,
 	}
 	cmd := &cobra.Command{
 		Use:     "backup",
@@ -30,32 +37,65 @@ func NewCmdBackup(f *factory.Factory) *cobra.Command {
 			if opts.NoInteractive, err = cmd.Flags().GetBool("no-interactive"); err != nil {
 				return err
 			}
-			return appliance.PrepareBackup(&opts)
+			if opts.Retention, err = retention.policy(cmd, opts.Config.BackupRetention); err != nil {
+				return err
+			}
+			if opts.Events, err = events.Open(f.IOOutWriter, cmd.CommandPath(), output, eventsFile); err != nil {
+				return err
+			}
+			if output == events.OutputEvents {
+				opts.Out = f.StdErr
+				f.SetSpinnerOutput(f.StdErr)
+			}
+			opts.Events.Started("")
+			if err := appliance.PrepareBackup(&opts); err != nil {
+				opts.Events.Finished(err)
+				opts.Events.Close()
+				return err
+			}
+			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var err error
+			host, err := opts.Config.GetHost()
+			if err != nil {
+				return err
+			}
+			opts.Notifier = notify.New(opts.Config.Webhooks, host)
+			defer opts.Notifier.Close()
 			backupIDs, err = appliance.PerformBackup(cmd, args, &opts)
 			if err != nil {
+				opts.Events.Finished(err)
+				opts.Events.Close()
 				return err
 			}
 			return nil
 		},
 		PostRunE: func(cmd *cobra.Command, args []string) error {
-			return appliance.CleanupBackup(&opts, backupIDs)
+			err := appliance.CleanupBackup(&opts, backupIDs)
+			opts.Events.Finished(err)
+			opts.Events.Close()
+			return err
 		},
 	}
 
 	log.SetOutput(opts.Out)
 	flags := cmd.Flags()
-	flags.StringVarP(&opts.Destination, "destination", "d", appliance.DefaultBackupDestination, "backup destination directory")
+	flags.StringVarP(&opts.Destination, "destination", "d", appliance.DefaultBackupDestination, "backup destination directory, or URL of a remote destination (s3://, sftp://, webdav:// or webdavs://)")
 	flags.BoolVar(&opts.AllFlag, "all", false, "backup all Appliances in the Appgate SDP Collective")
 	flags.BoolVar(&opts.PrimaryFlag, "primary", false, "backup primary controller")
 	flags.BoolVar(&opts.CurrentFlag, "current", false, "backup current peer controller")
 	flags.StringSliceVar(&opts.With, "with", []string{}, "include extra data in backup (audit,logs)")
 	flags.DurationVarP(&opts.Timeout, "timeout", "t", 15*time.Minute, "time out for status check on the backups")
 	flags.BoolVar(&opts.Quiet, "quiet", false, "backup summary will not be printed if setting this flag")
+	flags.StringVar(&output, "output", "", "use 'events' to write a JSON lines event stream to stdout, the regular output is written to stderr")
+	flags.StringVar(&eventsFile, "events-file", "", "append a JSON lines event stream to this file")
+	retention.register(flags)
 
 	cmd.AddCommand(NewBackupAPICmd(f))
+	cmd.AddCommand(NewBackupPruneCmd(f))
+	cmd.AddCommand(NewBackupListCmd(f))
+	cmd.AddCommand(NewBackupInspectCmd(f))
+	cmd.AddCommand(NewBackupDecryptCmd(f))
 
 	return cmd
 }
@@ -0,0 +1,70 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/filesystem"
+	"github.com/spf13/cobra"
+)
+
+type decryptOptions struct {
+	passphraseOptions
+	Out io.Writer
+	out string
+}
+
+// NewBackupDecryptCmd return a new backup decrypt command
+func NewBackupDecryptCmd(f *factory.Factory) *cobra.Command {
+	opts := &decryptOptions{
+		passphraseOptions: passphraseOptions{
+			Config:    f.Config,
+			In:        f.Stdin,
+			CanPrompt: f.CanPrompt(),
+		},
+		Out: f.IOOutWriter,
+	}
+	cmd := &cobra.Command{
+		Use:     "decrypt <file>",
+		Short:   docs.ApplianceBackupDecryptDoc.Short,
+		Long:    docs.ApplianceBackupDecryptDoc.Long,
+		Example: docs.ApplianceBackupDecryptDoc.ExampleString(),
+		Args:    cobra.ExactArgs(1),
+		Annotations: map[string]string{
+			"skipAuthCheck": "true",
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return decryptRun(opts, args[0])
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.out, "out", "o", "", "directory to extract the backup to, defaults to the backup file name without '.bkp'")
+	opts.passphraseOptions.register(flags)
+
+	return cmd
+}
+
+func decryptRun(opts *decryptOptions, path string) error {
+	out := opts.out
+	if len(out) <= 0 {
+		out = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	out = filesystem.AbsolutePath(out)
+	r, closer, err := opts.decrypt(path)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	entries, err := appliance.ExtractBackup(r, out)
+	if err != nil {
+		return fmt.Errorf("could not extract backup to %s: %w", out, err)
+	}
+	fmt.Fprintf(opts.Out, "Extracted %d entries of %s to %s\n", len(entries), filepath.Base(path), out)
+	return nil
+}
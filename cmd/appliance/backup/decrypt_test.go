@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/cmdutil"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/spf13/cobra"
+)
+
+func writeEncryptedBackup(t *testing.T, passphrase string) string {
+	t.Helper()
+	archive := new(bytes.Buffer)
+	tw := tar.NewWriter(archive)
+	tw.WriteHeader(&tar.Header{Name: "backup/config.json", Typeflag: tar.TypeReg, Mode: 0644, Size: 2})
+	tw.Write([]byte("{}"))
+	tw.Close()
+
+	path := filepath.Join(t.TempDir(), "appgate_backup_controller_20220331_120000.bkp")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := openpgp.SymmetricallyEncrypt(f, []byte(passphrase), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(archive.Bytes())
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBackupInspectAndDecryptCmd(t *testing.T) {
+	path := writeEncryptedBackup(t, "secret")
+	out := filepath.Join(t.TempDir(), "restore")
+	tests := []struct {
+		name    string
+		cmd     func(f *factory.Factory) *cobra.Command
+		args    []string
+		stdin   string
+		wantErr error
+		wantOut string
+	}{
+		{
+			name:    "inspect",
+			cmd:     NewBackupInspectCmd,
+			args:    []string{path, "--passphrase-stdin"},
+			stdin:   "secret\n",
+			wantOut: "backup/config.json",
+		},
+		{
+			name:    "inspect wrong passphrase",
+			cmd:     NewBackupInspectCmd,
+			args:    []string{path, "--passphrase-stdin"},
+			stdin:   "wrong\n",
+			wantErr: appliance.ErrBackupPassphrase,
+		},
+		{
+			name:    "inspect without tty",
+			cmd:     NewBackupInspectCmd,
+			args:    []string{path},
+			wantErr: cmdutil.ErrMissingTTY,
+		},
+		{
+			name:    "decrypt",
+			cmd:     NewBackupDecryptCmd,
+			args:    []string{path, "--passphrase-stdin", "--out", out},
+			stdin:   "secret",
+			wantOut: "Extracted 1 entries",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SDPCTL_BACKUP_PASSPHRASE", "")
+			buf := new(bytes.Buffer)
+			f := &factory.Factory{
+				Config:      &configuration.Config{},
+				IOOutWriter: buf,
+				Stdin:       io.NopCloser(strings.NewReader(tt.stdin)),
+				StdErr:      io.Discard,
+			}
+			cmd := tt.cmd(f)
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+			err := cmd.Execute()
+			if tt.wantErr != nil {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr.Error()) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), tt.wantOut) {
+				t.Errorf("expected output to contain %q, got\n%s", tt.wantOut, buf.String())
+			}
+		})
+	}
+	content, err := os.ReadFile(filepath.Join(out, "backup", "config.json"))
+	if err != nil || string(content) != "{}" {
+		t.Errorf("got %q, %v", content, err)
+	}
+}
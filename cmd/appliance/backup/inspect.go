@@ -0,0 +1,75 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type inspectOptions struct {
+	passphraseOptions
+	Out  io.Writer
+	json bool
+}
+
+// NewBackupInspectCmd return a new backup inspect command
+func NewBackupInspectCmd(f *factory.Factory) *cobra.Command {
+	opts := &inspectOptions{
+		passphraseOptions: passphraseOptions{
+			Config:    f.Config,
+			In:        f.Stdin,
+			CanPrompt: f.CanPrompt(),
+		},
+		Out: f.IOOutWriter,
+	}
+	cmd := &cobra.Command{
+		Use:     "inspect <file>",
+		Short:   docs.ApplianceBackupInspectDoc.Short,
+		Long:    docs.ApplianceBackupInspectDoc.Long,
+		Example: docs.ApplianceBackupInspectDoc.ExampleString(),
+		Args:    cobra.ExactArgs(1),
+		Annotations: map[string]string{
+			"skipAuthCheck": "true",
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return inspectRun(opts, args[0])
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVar(&opts.json, "json", false, "Display in JSON format")
+	opts.passphraseOptions.register(flags)
+
+	return cmd
+}
+
+func inspectRun(opts *inspectOptions, path string) error {
+	r, closer, err := opts.decrypt(path)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	entries, err := appliance.InspectBackup(r)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return util.PrintJSON(opts.Out, entries)
+	}
+
+	var size int64
+	p := util.NewPrinter(opts.Out, 4)
+	p.AddHeader("Name", "Type", "Size", "Modified")
+	for _, e := range entries {
+		size += e.Size
+		p.AddLine(e.Name, e.Type, appliance.FormatByteSize(e.Size), e.ModTime.Local().Format("2006-01-02 15:04"))
+	}
+	p.Print()
+	fmt.Fprintf(opts.Out, "\nThe backup was decrypted and verified, %d entries, %s\n", len(entries), appliance.FormatByteSize(size))
+	return nil
+}
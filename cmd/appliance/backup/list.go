@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type listOptions struct {
+	Out           io.Writer
+	destination   string
+	json          bool
+	verify        bool
+	noInteractive bool
+}
+
+// backupGroup is the catalogue of one appliance in the JSON output
+type backupGroup struct {
+	Appliance string                         `json:"appliance"`
+	Backups   []appliance.BackupCatalogEntry `json:"backups"`
+}
+
+// NewBackupListCmd return a new backup list command
+func NewBackupListCmd(f *factory.Factory) *cobra.Command {
+	opts := &listOptions{
+		Out:         f.IOOutWriter,
+		destination: appliance.DefaultBackupDestination,
+	}
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   docs.ApplianceBackupListDoc.Short,
+		Long:    docs.ApplianceBackupListDoc.Long,
+		Example: docs.ApplianceBackupListDoc.ExampleString(),
+		Args:    cobra.NoArgs,
+		Annotations: map[string]string{
+			"skipAuthCheck": "true",
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if opts.noInteractive, err = cmd.Flags().GetBool("no-interactive"); err != nil {
+				return err
+			}
+			return listRun(opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.destination, "destination", "d", appliance.DefaultBackupDestination, "backup destination directory, or URL of a remote destination (s3://, sftp://, webdav:// or webdavs://)")
+	flags.BoolVar(&opts.json, "json", false, "Display in JSON format")
+	flags.BoolVar(&opts.verify, "verify", false, "compare each backup file with its sha256 checksum, which downloads the backups from a remote destination")
+
+	return cmd
+}
+
+func listRun(opts *listOptions) error {
+	sink, err := appliance.NewBackupSink(opts.destination, appliance.KeyringSinkCredentials(opts.noInteractive))
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	catalog, err := appliance.ReadBackupCatalog(context.Background(), sink, opts.verify)
+	if err != nil {
+		return err
+	}
+
+	// the catalogue is sorted by appliance
+	groups := []backupGroup{}
+	for _, e := range catalog {
+		if len(groups) <= 0 || groups[len(groups)-1].Appliance != e.Appliance {
+			groups = append(groups, backupGroup{Appliance: e.Appliance})
+		}
+		groups[len(groups)-1].Backups = append(groups[len(groups)-1].Backups, e)
+	}
+	if opts.json {
+		return util.PrintJSON(opts.Out, groups)
+	}
+	if len(groups) <= 0 {
+		fmt.Fprintf(opts.Out, "No backups in %s\n", sink)
+		return nil
+	}
+
+	problems := 0
+	p := util.NewPrinter(opts.Out, 4)
+	p.AddHeader("Appliance", "File", "Date", "Size", "Version", "Status")
+	for _, g := range groups {
+		for i, e := range g.Backups {
+			name, version, status := "", "", e.Status
+			if i == 0 {
+				name = g.Appliance
+			}
+			if e.Metadata != nil {
+				version = e.Metadata.Version
+			}
+			if len(e.Problem) > 0 {
+				status = fmt.Sprintf("%s: %s", e.Status, e.Problem)
+			}
+			if e.Status != appliance.BackupStatusOK && e.Status != appliance.BackupStatusNoMetadata {
+				problems++
+			}
+			p.AddLine(name, filepath.Base(e.File), e.Time.Local().Format("2006-01-02 15:04"), appliance.FormatByteSize(e.Size), version, status)
+		}
+	}
+	p.Print()
+	fmt.Fprintf(opts.Out, "\n%d backups of %d appliances in %s\n", len(catalog), len(groups), sink)
+	if problems > 0 {
+		return fmt.Errorf("%d backups are missing, corrupt or incomplete", problems)
+	}
+	return nil
+}
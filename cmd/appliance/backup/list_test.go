@@ -0,0 +1,87 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/factory"
+)
+
+func TestBackupListCmd(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		args    []string
+		corrupt bool
+		wantErr bool
+		wantOut []string
+	}{
+		{
+			name:    "table",
+			wantOut: []string{"controller", "gateway", "3 backups of 2 appliances"},
+		},
+		{
+			name:    "json",
+			args:    []string{"--json"},
+			wantOut: []string{`"appliance": "controller"`, `"status": "no metadata"`},
+		},
+		{
+			name:    "corrupt",
+			corrupt: true,
+			wantErr: true,
+			wantOut: []string{"corrupt: invalid metadata"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			names := []string{
+				appliance.BackupFileName("controller", now),
+				appliance.BackupFileName("controller", now.Add(-time.Hour)),
+				appliance.BackupFileName("gateway", now),
+			}
+			for _, name := range names {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("backup"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.corrupt {
+				if err := os.WriteFile(filepath.Join(dir, names[0]+".json"), []byte("{"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			buf := new(bytes.Buffer)
+			f := &factory.Factory{IOOutWriter: buf}
+			cmd := NewBackupListCmd(f)
+			cmd.Flags().Bool("no-interactive", false, "usage")
+			cmd.SetArgs(append([]string{"--destination=" + dir}, tt.args...))
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+			err := cmd.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("list error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("expected output to contain %q, got\n%s", want, buf.String())
+				}
+			}
+			if len(tt.args) > 0 && tt.args[0] == "--json" {
+				var groups []backupGroup
+				if err := json.Unmarshal(buf.Bytes(), &groups); err != nil {
+					t.Fatal(err)
+				}
+				if len(groups) != 2 || len(groups[0].Backups) != 2 {
+					t.Errorf("expected the backups grouped per appliance, got %+v", groups)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package backup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/cmdutil"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/keyring"
+	"github.com/appgate/sdpctl/pkg/prompt"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+// passphraseOptions are the options of the commands which decrypt a backup file
+type passphraseOptions struct {
+	Config    *configuration.Config
+	In        io.Reader
+	CanPrompt bool
+	stdin     bool
+}
+
+func (o *passphraseOptions) register(flags *pflag.FlagSet) {
+	flags.BoolVar(&o.stdin, "passphrase-stdin", false, "read the backup passphrase from stdin")
+}
+
+// decrypt opens the backup file and decrypts it with the passphrase from stdin, SDPCTL_BACKUP_PASSPHRASE or the
+// keyring, or prompts for it. A prompted passphrase which decrypts the backup is stored in the keyring.
+func (o *passphraseOptions) decrypt(path string) (io.Reader, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the passphrase is stored in the keyring per collective, if there is one in the configuration
+	prefix := ""
+	if o.Config != nil {
+		prefix, _ = o.Config.GetHost()
+	}
+
+	var passphrase string
+	prompted := false
+	if o.stdin {
+		line, err := bufio.NewReader(o.In).ReadString('\n')
+		if err != nil && err != io.EOF {
+			f.Close()
+			return nil, nil, fmt.Errorf("could not read input from stdin %s", err)
+		}
+		if passphrase = strings.TrimRight(line, "\r\n"); len(passphrase) <= 0 {
+			f.Close()
+			return nil, nil, errors.New("no backup passphrase on stdin")
+		}
+	} else if v, err := keyring.GetBackupPassphrase(prefix); err == nil && len(v) > 0 {
+		passphrase = v
+	} else {
+		if !o.CanPrompt {
+			f.Close()
+			return nil, nil, cmdutil.ErrMissingTTY
+		}
+		q := &survey.Password{Message: "The passphrase of the backup:"}
+		if err := prompt.SurveyAskOne(q, &passphrase, survey.WithValidator(survey.Required)); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		prompted = true
+	}
+
+	r, err := appliance.DecryptBackup(f, []byte(passphrase))
+	if err != nil {
+		f.Close()
+		if errors.Is(err, appliance.ErrBackupPassphrase) {
+			return nil, nil, fmt.Errorf("%w %s", err, path)
+		}
+		return nil, nil, err
+	}
+	if prompted && len(prefix) > 0 {
+		if err := keyring.SetBackupPassphrase(prefix, passphrase); err != nil {
+			log.WithError(err).Warn("Could not store the backup passphrase in the keyring")
+		}
+	}
+	return r, f, nil
+}
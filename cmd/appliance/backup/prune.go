@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type pruneOptions struct {
+	Config        *configuration.Config
+	Out           io.Writer
+	destination   string
+	dryRun        bool
+	noInteractive bool
+	retention     retentionFlags
+}
+
+// NewBackupPruneCmd return a new backup prune command
+func NewBackupPruneCmd(f *factory.Factory) *cobra.Command {
+	opts := &pruneOptions{
+		Config:      f.Config,
+		Out:         f.IOOutWriter,
+		destination: appliance.DefaultBackupDestination,
+	}
+	cmd := &cobra.Command{
+		Use:     "prune",
+		Short:   docs.ApplianceBackupPruneDoc.Short,
+		Long:    docs.ApplianceBackupPruneDoc.Long,
+		Example: docs.ApplianceBackupPruneDoc.ExampleString(),
+		Args:    cobra.NoArgs,
+		Annotations: map[string]string{
+			"skipAuthCheck": "true",
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			policy, err := opts.retention.policy(cmd, opts.Config.BackupRetention)
+			if err != nil {
+				return err
+			}
+			if opts.noInteractive, err = cmd.Flags().GetBool("no-interactive"); err != nil {
+				return err
+			}
+			return pruneRun(opts, policy)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.destination, "destination", "d", appliance.DefaultBackupDestination, "backup destination directory, or URL of a remote destination (s3://, sftp://, webdav:// or webdavs://)")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "list the backups which would be removed, without removing them")
+	opts.retention.register(flags)
+
+	return cmd
+}
+
+func pruneRun(opts *pruneOptions, policy appliance.RetentionPolicy) error {
+	if policy.IsZero() {
+		return fmt.Errorf("No backup retention policy. Set 'backup_retention' in the configuration file or use the retention flags")
+	}
+	sink, err := appliance.NewBackupSink(opts.destination, appliance.KeyringSinkCredentials(opts.noInteractive))
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	pruned, err := appliance.PruneBackups(context.Background(), sink, policy, opts.dryRun)
+	if len(pruned) > 0 {
+		var size int64
+		p := util.NewPrinter(opts.Out, 4)
+		p.AddHeader("File", "Appliance", "Date", "Size", "Reason")
+		for _, f := range pruned {
+			size += f.Size
+			p.AddLine(f.Path, f.Appliance, f.Time.Format("2006-01-02 15:04"), appliance.FormatByteSize(f.Size), f.Reason)
+		}
+		p.Print()
+		if opts.dryRun {
+			fmt.Fprintf(opts.Out, "\nWould remove %d backups, %s\n", len(pruned), appliance.FormatByteSize(size))
+		} else {
+			fmt.Fprintf(opts.Out, "\nRemoved %d backups, %s\n", len(pruned), appliance.FormatByteSize(size))
+		}
+	} else if err == nil {
+		fmt.Fprintf(opts.Out, "No backups to remove in %s\n", sink)
+	}
+	return err
+}
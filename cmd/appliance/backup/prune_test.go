@@ -0,0 +1,86 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/factory"
+)
+
+func TestBackupPruneCmd(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		config    configuration.BackupRetention
+		args      []string
+		wantErr   bool
+		wantFiles int
+		wantOut   string
+	}{
+		{
+			name:    "no policy",
+			wantErr: true,
+		},
+		{
+			name:      "dry run",
+			args:      []string{"--keep-last=1", "--dry-run"},
+			wantFiles: 3,
+			wantOut:   "Would remove 2 backups",
+		},
+		{
+			name:      "policy from config",
+			config:    configuration.BackupRetention{KeepLast: 2},
+			wantFiles: 2,
+			wantOut:   "Removed 1 backups",
+		},
+		{
+			name:      "flag overrides config",
+			config:    configuration.BackupRetention{KeepLast: 2},
+			args:      []string{"--keep-last=3"},
+			wantFiles: 3,
+			wantOut:   "No backups to remove",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for i := 0; i < 3; i++ {
+				name := appliance.BackupFileName("controller", now.Add(-time.Duration(i)*time.Hour))
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("backup"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			buf := new(bytes.Buffer)
+			f := &factory.Factory{
+				Config:      &configuration.Config{BackupRetention: tt.config},
+				IOOutWriter: buf,
+			}
+			cmd := NewBackupPruneCmd(f)
+			cmd.Flags().Bool("no-interactive", false, "usage")
+			cmd.SetArgs(append([]string{"--destination=" + dir}, tt.args...))
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+			err := cmd.Execute()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prune error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != tt.wantFiles {
+				t.Errorf("expected %d files left, got %d", tt.wantFiles, len(entries))
+			}
+			if !strings.Contains(buf.String(), tt.wantOut) {
+				t.Errorf("expected output to contain %q, got\n%s", tt.wantOut, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package backup
+
+import (
+	"github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// retentionFlags override the backup retention in the configuration
+type retentionFlags struct {
+	configuration.BackupRetention
+}
+
+func (r *retentionFlags) register(flags *pflag.FlagSet) {
+	flags.IntVar(&r.KeepLast, "keep-last", 0, "keep the last N backups of each appliance")
+	flags.IntVar(&r.KeepDaily, "keep-daily", 0, "keep the last backup of each of the last N days, for each appliance")
+	flags.IntVar(&r.KeepWeekly, "keep-weekly", 0, "keep the last backup of each of the last N weeks, for each appliance")
+	flags.IntVar(&r.KeepMonthly, "keep-monthly", 0, "keep the last backup of each of the last N months, for each appliance")
+	flags.StringVar(&r.MaxAge, "max-age", "", "remove backups older than this, such as 720h or 30d")
+	flags.StringVar(&r.MaxSize, "max-size", "", "remove the oldest backups until the destination is at most this size, such as 10GB")
+}
+
+// policy returns the retention policy of the configuration, with the flags which are set on the command line
+func (r *retentionFlags) policy(cmd *cobra.Command, cfg configuration.BackupRetention) (appliance.RetentionPolicy, error) {
+	flags := cmd.Flags()
+	if flags.Changed("keep-last") {
+		cfg.KeepLast = r.KeepLast
+	}
+	if flags.Changed("keep-daily") {
+		cfg.KeepDaily = r.KeepDaily
+	}
+	if flags.Changed("keep-weekly") {
+		cfg.KeepWeekly = r.KeepWeekly
+	}
+	if flags.Changed("keep-monthly") {
+		cfg.KeepMonthly = r.KeepMonthly
+	}
+	if flags.Changed("max-age") {
+		cfg.MaxAge = r.MaxAge
+	}
+	if flags.Changed("max-size") {
+		cfg.MaxSize = r.MaxSize
+	}
+	return appliance.NewRetentionPolicy(cfg)
+}
@@ -0,0 +1,114 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/cmdutil"
+	"github.com/appgate/sdpctl/pkg/prompt"
+	"github.com/appgate/sdpctl/pkg/tui"
+	"github.com/appgate/sdpctl/pkg/util"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+const canaryNote = `Batch #1 contains the canary appliances. The canary gates are checked after the batch is upgraded,
+and the upgrade stops if any of them fails.
+
+`
+
+// canaryGates checks the canary gates once the canary batch has been upgraded. The gates are checked again
+// when the upgrade is resumed, unless they already passed. If a gate fails the canaries can be rolled back.
+func canaryGates(ctx context.Context, opts *upgradeCompleteOptions, a *appliancepkg.Appliance, plan *appliancepkg.UpgradePlan, journal *appliancepkg.UpgradeJournal, canaries []openapi.Appliance) error {
+	if journal.StepDone(appliancepkg.StageCanaryGates) {
+		return nil
+	}
+	if err := journal.StartStep(appliancepkg.StageCanaryGates); err != nil {
+		return err
+	}
+	opts.events.StepStarted(appliancepkg.StageCanaryGates)
+	gates := opts.canaryGates
+	if gates == nil {
+		gates = &appliancepkg.CanaryGates{}
+	}
+	if gates.Wait > 0 {
+		fmt.Fprintf(opts.Out, "\n[%s] Waiting %s before checking the canary gates\n", time.Now().Format(time.RFC3339), gates.Wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(gates.Wait):
+		}
+	}
+	fmt.Fprintf(opts.Out, "\n[%s] Checking canary gates:\n", time.Now().Format(time.RFC3339))
+	stats, _, err := a.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	peerVersion := opts.Config.Version
+	if plan.ToVersion != nil {
+		peerVersion = a.GetPeerAPIVersion(plan.ToVersion)
+	}
+	failures := appliancepkg.CheckCanaryGates(ctx, a, *gates, canaries, *stats, peerVersion)
+	if len(failures) <= 0 {
+		fmt.Fprintln(opts.Out, "All canary gates passed")
+		opts.events.StepFinished(appliancepkg.StageCanaryGates, nil)
+		return journal.FinishStep(appliancepkg.StageCanaryGates, nil)
+	}
+
+	err = fmt.Errorf("%w: %d of the checks failed on the canary appliances", appliancepkg.ErrCanaryGateFailed, len(failures))
+	opts.events.StepFinished(appliancepkg.StageCanaryGates, err)
+	if jerr := journal.FinishStep(appliancepkg.StageCanaryGates, err); jerr != nil {
+		log.WithError(jerr).Warn("failed to update upgrade journal")
+	}
+	t := util.NewPrinter(opts.Out, 4)
+	t.AddHeader("Appliance", "Gate", "Error")
+	for _, f := range failures {
+		t.AddLine(f.Appliance, f.Check, f.Message)
+	}
+	t.Print()
+	// the controllers are already upgraded, whatever happens to the canaries
+	updatePeerAPIVersion(opts, a, plan)
+
+	rollback := opts.canaryRollback
+	if !rollback && !opts.NoInteractive {
+		fmt.Fprintln(opts.Out)
+		if perr := prompt.AskConfirmation("The canary appliances can be rolled back to their previous version by switching partition."); perr == nil {
+			rollback = true
+		} else if !errors.Is(perr, cmdutil.ErrExecutionCanceledByUser) {
+			return perr
+		}
+	}
+	if !rollback {
+		fmt.Fprintf(opts.Out, "\nThe upgrade was stopped. Use 'sdpctl appliance upgrade complete --resume' to check the canary gates again and continue the upgrade,\nor 'sdpctl appliance upgrade rollback' to roll back the upgraded appliances.\n")
+		return err
+	}
+
+	fmt.Fprintf(opts.Out, "\n[%s] Rolling back canary appliances:\n", time.Now().Format(time.RFC3339))
+	var p *tui.Progress
+	if !opts.ciMode {
+		p = tui.New(ctx, opts.SpinnerOut())
+	}
+	g, gctx := errgroup.WithContext(ctx)
+	for _, canary := range canaries {
+		i := canary
+		g.Go(func() error {
+			return switchPartition(gctx, a, i, opts.Timeout, p)
+		})
+	}
+	rerr := g.Wait()
+	if p != nil {
+		p.Wait()
+	}
+	if rerr != nil {
+		return fmt.Errorf("%s, and the rollback of the canary appliances failed: %w", err, rerr)
+	}
+	// the canaries are back on the previous version, so the upgrade can't be resumed from the journal
+	if jerr := journal.Remove(); jerr != nil {
+		log.WithError(jerr).Warn("failed to remove upgrade journal")
+	}
+	return fmt.Errorf("%w, the canary appliances were rolled back", err)
+}
@@ -12,6 +12,7 @@ import (
 	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
 	"github.com/appgate/sdpctl/pkg/configuration"
 	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/events"
 	"github.com/appgate/sdpctl/pkg/factory"
 	"github.com/appgate/sdpctl/pkg/prompt"
 	"github.com/appgate/sdpctl/pkg/queue"
@@ -34,6 +35,9 @@ type upgradeCancelOptions struct {
 	defaultfilter map[string]map[string]string
 	timeout       time.Duration
 	ciMode        bool
+	events        *events.Stream
+	output        string
+	eventsFile    string
 }
 
 // NewUpgradeCancelCmd return a new upgrade status command
@@ -58,13 +62,25 @@ func NewUpgradeCancelCmd(f *factory.Factory) *cobra.Command {
 		Long:    docs.ApplianceUpgradeCancelDoc.Long,
 		Example: docs.ApplianceUpgradeCancelDoc.ExampleString(),
 		RunE: func(c *cobra.Command, args []string) error {
-			return upgradeCancelRun(c, args, &opts)
+			stream, err := openEvents(f, c, opts.output, opts.eventsFile, &opts.Out)
+			if err != nil {
+				return err
+			}
+			defer stream.Close()
+			opts.events = stream
+			defer saveHistory(recordHistory(opts.Config, c.Name(), stream))
+			stream.Started("")
+			err = upgradeCancelRun(c, args, &opts)
+			stream.Finished(err)
+			return err
 		},
 	}
 
 	flags := upgradeCancelCmd.Flags()
 	flags.BoolVar(&opts.NoInteractive, "no-interactive", false, "suppress interactive prompt with auto accept")
 	flags.BoolVar(&opts.delete, "delete", false, "Delete all upgrade files from the controller")
+	flags.StringVar(&opts.output, "output", "", "use 'events' to write a JSON lines event stream to stdout, the regular output is written to stderr")
+	flags.StringVar(&opts.eventsFile, "events-file", "", "append a JSON lines event stream to this file")
 
 	return upgradeCancelCmd
 }
@@ -94,7 +110,7 @@ func upgradeCancelRun(cmd *cobra.Command, args []string, opts *upgradeCancelOpti
 	}
 	opts.ciMode = ciFlag
 
-	ctx := context.Background()
+	ctx := events.NewContext(context.Background(), opts.events)
 	filter := util.ParseFilteringFlags(cmd.Flags(), opts.defaultfilter)
 	stats, _, err := a.Stats(ctx)
 	if err != nil {
@@ -105,6 +121,9 @@ func upgradeCancelRun(cmd *cobra.Command, args []string, opts *upgradeCancelOpti
 		return err
 	}
 	appliances, offline, _ := appliancepkg.FilterAvailable(allAppliances, stats.GetData())
+	for _, app := range offline {
+		opts.events.ApplianceSkipped(app.GetName(), "appliance is offline")
+	}
 
 	noneIdleAppliances := make([]openapi.Appliance, 0)
 	for _, app := range appliances {
@@ -151,6 +170,16 @@ func upgradeCancelRun(cmd *cobra.Command, args []string, opts *upgradeCancelOpti
 			}, backoff.NewExponentialBackOff())
 		}
 
+		cancelAppliance := func(ctx context.Context, appliance openapi.Appliance, tracker *tui.Tracker) error {
+			if err := retryCancel(ctx, appliance); err != nil {
+				return fmt.Errorf("Upgrade cancel for %s failed, %w", appliance.GetName(), err)
+			}
+			if err := a.UpgradeStatusWorker.WaitForUpgradeStatus(ctx, appliance, wantedStatus, undesiredStatus, tracker); err != nil {
+				return err
+			}
+			return a.ApplianceStats.WaitForApplianceStatus(ctx, appliance, appliancepkg.StatusNotBusy, tracker)
+		}
+
 		type queueStruct struct {
 			appliance openapi.Appliance
 			tracker   *tui.Tracker
@@ -180,13 +209,9 @@ func upgradeCancelRun(cmd *cobra.Command, args []string, opts *upgradeCancelOpti
 			// and that the apppliance is not busy to avoid race condition When running to many operations
 			// on multiple appliances at once.
 			qs := v.(queueStruct)
-			if err := retryCancel(ctx, qs.appliance); err != nil {
-				return fmt.Errorf("Upgrade cancel for %s failed, %w", qs.appliance.GetName(), err)
-			}
-			if err := a.UpgradeStatusWorker.WaitForUpgradeStatus(ctx, qs.appliance, wantedStatus, undesiredStatus, qs.tracker); err != nil {
-				return err
-			}
-			return a.ApplianceStats.WaitForApplianceStatus(ctx, qs.appliance, appliancepkg.StatusNotBusy, qs.tracker)
+			err := cancelAppliance(ctx, qs.appliance, qs.tracker)
+			opts.events.ApplianceFinished(qs.appliance.GetName(), err)
+			return err
 		})
 		if err != nil {
 			return err
@@ -197,11 +222,14 @@ func upgradeCancelRun(cmd *cobra.Command, args []string, opts *upgradeCancelOpti
 	fmt.Fprintf(opts.Out, "[%s] Cancelling pending upgrades:\n", time.Now().Format(time.RFC3339))
 	// workers is intentionally a fixed value of 2
 	// because otherwise its a high risk of triggering failure from 1 or more appliances
+	opts.events.StepStarted("cancel")
 	if err := cancel(ctx, noneIdleAppliances, 2); err != nil {
 		return err
 	}
+	opts.events.StepFinished("cancel", nil)
 
 	if opts.delete {
+		opts.events.StepStarted("delete")
 		files, err := a.ListFiles(context.Background())
 		if err != nil {
 			return err
@@ -212,6 +240,7 @@ func upgradeCancelRun(cmd *cobra.Command, args []string, opts *upgradeCancelOpti
 				log.Warningf("Unable to delete file %q %s", f.GetName(), err)
 			}
 		}
+		opts.events.StepFinished("delete", nil)
 		return nil
 	}
 
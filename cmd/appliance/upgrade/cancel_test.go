@@ -2,14 +2,17 @@ package upgrade
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
 	"github.com/appgate/sdpctl/pkg/appliance"
 	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/events"
 	"github.com/appgate/sdpctl/pkg/factory"
 	"github.com/appgate/sdpctl/pkg/httpmock"
 	"github.com/appgate/sdpctl/pkg/prompt"
@@ -18,12 +21,13 @@ import (
 
 func TestUpgradeCancelCommand(t *testing.T) {
 	tests := []struct {
-		name       string
-		cli        string
-		httpStubs  []httpmock.Stub
-		askStubs   func(*prompt.AskStubber)
-		wantErr    bool
-		wantErrOut *regexp.Regexp
+		name        string
+		cli         string
+		httpStubs   []httpmock.Stub
+		askStubs    func(*prompt.AskStubber)
+		wantErr     bool
+		wantErrOut  *regexp.Regexp
+		checkEvents func(t *testing.T, stream []events.Event)
 	}{
 		{
 			name: "test cancel multiple appliances",
@@ -50,6 +54,52 @@ func TestUpgradeCancelCommand(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "event stream on stdout",
+			cli:  "--output=events --no-interactive",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/upgrade_status_file.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/upgrade_status_file.json"),
+				},
+			},
+			checkEvents: func(t *testing.T, stream []events.Event) {
+				if len(stream) != 6 {
+					t.Fatalf("expected 6 events, got %d", len(stream))
+				}
+				if stream[0].Type != events.TypeCommandStarted || stream[1].Type != events.TypeStepStarted || stream[1].Step != "cancel" {
+					t.Errorf("unexpected first events %+v", stream[:2])
+				}
+				for _, e := range stream[2:4] {
+					if e.Type != events.TypeApplianceFinished || e.Outcome != events.OutcomeSuccess {
+						t.Errorf("expected appliance to be cancelled, got %+v", e)
+					}
+				}
+				last := stream[len(stream)-1]
+				if last.Type != events.TypeCommandFinished || last.Outcome != events.OutcomeSuccess || last.Version != events.Version {
+					t.Errorf("unexpected last event %+v", last)
+				}
+			},
+		},
+		{
+			name:       "invalid output",
+			cli:        "--output=table",
+			httpStubs:  []httpmock.Stub{},
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`invalid output "table", the only supported output is "events"`),
+		},
 		{
 			name: "test cancel multiple appliances no acceptance",
 			httpStubs: []httpmock.Stub{
@@ -89,6 +139,7 @@ func TestUpgradeCancelCommand(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SDPCTL_DATA_DIR", t.TempDir())
 
 			registry := httpmock.NewRegistry(t)
 			for _, v := range tt.httpStubs {
@@ -154,6 +205,17 @@ func TestUpgradeCancelCommand(t *testing.T) {
 					t.Errorf("Expected output to match, got:\n%s\n expected: \n%s\n", tt.wantErrOut, err.Error())
 				}
 			}
+			if tt.checkEvents != nil {
+				stream := []events.Event{}
+				for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+					var e events.Event
+					if err := json.Unmarshal([]byte(line), &e); err != nil {
+						t.Fatalf("stdout is not a JSON lines event stream: %s\n%s", err, stdout.String())
+					}
+					stream = append(stream, e)
+				}
+				tt.checkEvents(t, stream)
+			}
 		})
 	}
 }
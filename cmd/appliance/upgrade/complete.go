@@ -3,22 +3,30 @@ package upgrade
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
 	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/cmdutil"
 	"github.com/appgate/sdpctl/pkg/configuration"
 	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/eta"
+	"github.com/appgate/sdpctl/pkg/events"
 	"github.com/appgate/sdpctl/pkg/factory"
 	"github.com/appgate/sdpctl/pkg/filesystem"
+	"github.com/appgate/sdpctl/pkg/hooks"
+	"github.com/appgate/sdpctl/pkg/notify"
 	"github.com/appgate/sdpctl/pkg/prompt"
+	schedulepkg "github.com/appgate/sdpctl/pkg/schedule"
 	"github.com/appgate/sdpctl/pkg/terminal"
 	"github.com/appgate/sdpctl/pkg/tui"
 	"github.com/appgate/sdpctl/pkg/util"
@@ -36,6 +44,7 @@ type upgradeCompleteOptions struct {
 	Config            *configuration.Config
 	Out               io.Writer
 	SpinnerOut        func() io.Writer
+	sdpctlVersion     string
 	Appliance         func(c *configuration.Config) (*appliancepkg.Appliance, error)
 	debug             bool
 	backup            bool
@@ -45,25 +54,61 @@ type upgradeCompleteOptions struct {
 	actualHostname    string
 	defaultFilter     map[string]map[string]string
 	ciMode            bool
+	resume            bool
+	planFile          string
+	canary            int
+	canaryGatesFile   string
+	canaryRollback    bool
+	canaryGates       *appliancepkg.CanaryGates
+	verifyFile        string
+	verifySpec        *appliancepkg.VerifySpec
+	maxUnavailable    appliancepkg.MaxUnavailable
+	drain             bool
+	drainOptions      appliancepkg.DrainOptions
+	continueOnError   bool
+	ignoreUpgradePath bool
+	reportFile        string
+	report            *appliancepkg.UpgradeReport
+	window            schedulepkg.Window
+	notifier          *notify.Notifier
+	hooks             *hooks.Runner
+	events            *events.Stream
+	history           *appliancepkg.UpgradeRun
+	estimator         *eta.Estimator
+	estimates         []appliancepkg.StepEstimate
+	estimatedEnd      time.Time
+	output            string
+	eventsFile        string
 }
 
-// NewUpgradeCompleteCmd return a new upgrade status command
-func NewUpgradeCompleteCmd(f *factory.Factory) *cobra.Command {
-	opts := upgradeCompleteOptions{
-		Config:     f.Config,
-		Appliance:  f.Appliance,
-		debug:      f.Config.Debug,
-		Out:        f.IOOutWriter,
-		SpinnerOut: f.GetSpinnerOutput(),
-		Timeout:    DefaultTimeout,
-		backup:     true,
+// newUpgradeCompleteOptions returns the options of upgrade complete before the flags are parsed
+func newUpgradeCompleteOptions(f *factory.Factory) upgradeCompleteOptions {
+	return upgradeCompleteOptions{
+		Config:            f.Config,
+		Appliance:         f.Appliance,
+		debug:             f.Config.Debug,
+		Out:               f.IOOutWriter,
+		SpinnerOut:        f.GetSpinnerOutput(),
+		sdpctlVersion:     f.Version,
+		Timeout:           DefaultTimeout,
+		backup:            true,
+		backupDestination: appliancepkg.DefaultBackupDestination,
 		defaultFilter: map[string]map[string]string{
 			"include": {},
 			"exclude": {
 				"active": "false",
 			},
 		},
+		drainOptions: appliancepkg.DrainOptions{Timeout: appliancepkg.DefaultDrainTimeout},
 	}
+}
+
+// NewUpgradeCompleteCmd return a new upgrade status command
+func NewUpgradeCompleteCmd(f *factory.Factory) *cobra.Command {
+	opts := newUpgradeCompleteOptions(f)
+	var startAt string
+	var hookFlags []string
+	var maxUnavailable string
 	var upgradeCompleteCmd = &cobra.Command{
 		Use:     "complete",
 		Short:   docs.ApplianceUpgradeCompleteDoc.Short,
@@ -93,37 +138,165 @@ func NewUpgradeCompleteCmd(f *factory.Factory) *cobra.Command {
 				return err
 			}
 			opts.ciMode = ciModeFlag
+			if opts.resume && len(opts.planFile) > 0 {
+				return errors.New("--plan can't be used together with --resume, the plan is read from the upgrade journal")
+			}
+			if opts.canary < 0 {
+				return errors.New("--canary can't be negative")
+			}
+			if opts.resume && (opts.canary > 0 || len(opts.canaryGatesFile) > 0) {
+				return errors.New("--canary and --canary-gates can't be used together with --resume, the canaries are read from the upgrade journal")
+			}
+			if opts.canary == 0 && len(opts.canaryGatesFile) > 0 {
+				return errors.New("--canary-gates requires --canary")
+			}
+			if opts.hooks, err = hooks.New(opts.Config.Hooks, hookFlags); err != nil {
+				return err
+			}
+			if opts.maxUnavailable, err = appliancepkg.ParseMaxUnavailable(maxUnavailable); err != nil {
+				return fmt.Errorf("--max-unavailable: %w", err)
+			}
+			if opts.drainOptions.Threshold < 0 {
+				return errors.New("--drain-threshold can't be negative")
+			}
+			if !opts.drain && (cmd.Flags().Changed("drain-threshold") || cmd.Flags().Changed("drain-timeout")) {
+				return errors.New("--drain-threshold and --drain-timeout require --drain")
+			}
 
 			return nil
 		},
 		RunE: func(c *cobra.Command, args []string) error {
+			stream, err := openEvents(f, c, opts.output, opts.eventsFile, &opts.Out)
+			if err != nil {
+				return err
+			}
+			defer stream.Close()
+			// the schedule may print a warning, which is written to stderr with --output=events
+			if err := parseSchedule(&opts, startAt); err != nil {
+				return err
+			}
+			opts.events = stream
+			opts.history = recordHistory(opts.Config, c.Name(), stream)
+			defer saveHistory(opts.history)
 			return upgradeCompleteRun(c, args, &opts)
 		},
 	}
 
 	flags := upgradeCompleteCmd.Flags()
 	flags.BoolVarP(&opts.backup, "backup", "b", opts.backup, "backup primary controller before completing upgrade")
-	flags.StringVar(&opts.backupDestination, "backup-destination", appliancepkg.DefaultBackupDestination, "specify path to download backup")
+	flags.StringVar(&opts.backupDestination, "backup-destination", opts.backupDestination, "specify path to download backup, or URL of a remote destination (s3://, sftp://, webdav:// or webdavs://)")
 	flags.String("actual-hostname", "", "If the actual hostname is different from that which you are connecting to the appliance admin API, this flag can be used for setting the actual hostname.")
+	flags.BoolVar(&opts.resume, "resume", false, "resume an interrupted upgrade from the last completed step")
+	flags.StringVar(&opts.planFile, "plan", "", "path to an upgrade plan file with ordered stages for the additional appliances")
+	flags.IntVar(&opts.canary, "canary", 0, "upgrade this many appliances of each site and function group first, and check the canary gates before upgrading the rest")
+	flags.StringVar(&opts.canaryGatesFile, "canary-gates", "", "path to a file with the metrics and resolve-name checks for the canary appliances")
+	flags.BoolVar(&opts.canaryRollback, "canary-rollback", false, "roll back the canary appliances without asking if a canary gate fails")
+	flags.StringVar(&maxUnavailable, "max-unavailable", "", "maximum number or percentage of appliances of each site and function which are upgraded at the same time, such as 1 or 25%")
+	flags.BoolVar(&opts.drain, "drain", false, "wait for the sessions on each gateway to drain before it is upgraded")
+	flags.IntVar(&opts.drainOptions.Threshold, "drain-threshold", 0, "number of sessions which may be left on a gateway when it is considered drained")
+	flags.DurationVar(&opts.drainOptions.Timeout, "drain-timeout", opts.drainOptions.Timeout, "upgrade the gateway anyway if its sessions have not drained within this time")
+	flags.BoolVar(&opts.continueOnError, "continue-on-error", false, "record appliances which fail to upgrade and continue with the rest, instead of stopping the upgrade")
+	flags.BoolVar(&opts.ignoreUpgradePath, "ignore-upgrade-path", false, "warn instead of failing when sdpctl doesn't know the upgrade to be supported directly")
+	flags.StringVar(&opts.reportFile, "report", "", "write the outcome of each appliance to this file in JSON format")
+	flags.StringVar(&opts.verifyFile, "verify", "", "path to a verification file with checks to run once the upgrade is complete")
+	flags.StringVar(&startAt, "start-at", "", "wait until this time before starting the upgrade, in RFC3339 format such as 2022-11-05T02:00:00+01:00")
+	flags.DurationVar(&opts.window.Duration, "window", 0, "length of the maintenance window, no new batch of appliances is started after the window has closed")
+	flags.StringArrayVar(&hookFlags, "hook", nil, "run a command at an event of the upgrade, in the form event=command. Can be repeated")
+	flags.StringVar(&opts.output, "output", "", "use 'events' to write a JSON lines event stream to stdout, the regular output is written to stderr")
+	flags.StringVar(&opts.eventsFile, "events-file", "", "append a JSON lines event stream to this file")
 
 	return upgradeCompleteCmd
 }
 
+// newCompleteJournal records the plan in a new journal, with one step for each stage of the upgrade
+func newCompleteJournal(p *appliancepkg.UpgradePlan, path, host string, backup []openapi.Appliance) *appliancepkg.UpgradeJournal {
+	j := appliancepkg.NewUpgradeJournal(path, host)
+	j.PrimaryControllerID = p.PrimaryController.GetId()
+	j.DisableControllers = p.DisableControllers
+	j.MaxUnavailable = p.MaxUnavailable.String()
+	if p.FromVersion != nil {
+		j.FromVersion = p.FromVersion.String()
+	}
+	if p.ToVersion != nil {
+		j.ToVersion = p.ToVersion.String()
+	}
+	if len(backup) > 0 {
+		j.AddStep(appliancepkg.StageBackup, nil)
+	}
+	if p.UpgradePrimary {
+		j.AddStep(appliancepkg.StagePrimaryController, []openapi.Appliance{*p.PrimaryController})
+	}
+	if len(p.AdditionalControllers) > 0 {
+		j.AddStep(appliancepkg.StageAdditionalControllers, p.AdditionalControllers)
+	}
+	if len(p.LogForwardersAndServers) > 0 {
+		j.AddStep(appliancepkg.StageLogForwardersServers, p.LogForwardersAndServers)
+	}
+	for i, batch := range p.Batches {
+		step := j.AddStep(appliancepkg.BatchName(i), batch)
+		o := p.Batch(i)
+		step.Label, step.MaxParallel, step.Pause, step.Canary = o.Label, o.MaxParallel, o.Pause, o.Canary
+		if o.Canary {
+			j.AddStep(appliancepkg.StageCanaryGates, nil)
+		}
+	}
+	return j
+}
+
+// pending removes the appliances which have already been upgraded according to the journal
+func pending(journal *appliancepkg.UpgradeJournal, appliances []openapi.Appliance) []openapi.Appliance {
+	result := []openapi.Appliance{}
+	for _, a := range appliances {
+		if !journal.ApplianceDone(a.GetId()) {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
 func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeCompleteOptions) error {
 	terminal.Lock()
 	defer terminal.Unlock()
+	host, err := opts.Config.GetHost()
+	if err != nil {
+		return err
+	}
+	opts.notifier = notify.New(opts.Config.Webhooks, host)
+	defer opts.notifier.Close()
+	opts.events.Started("")
+	opts.report = appliancepkg.NewUpgradeReport()
+	err = upgradeComplete(cmd, args, opts)
+	if opts.continueOnError || len(opts.reportFile) > 0 {
+		if rerr := writeReport(opts); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	opts.events.Finished(err)
+	if err != nil {
+		if !errors.Is(err, cmdutil.ErrExecutionCanceledByUser) {
+			opts.notifier.Failure("Upgrade complete failed", err)
+		}
+		return err
+	}
+	return nil
+}
 
+func upgradeComplete(cmd *cobra.Command, args []string, opts *upgradeCompleteOptions) error {
 	var err error
 	if opts.NoInteractive, err = cmd.Flags().GetBool("no-interactive"); err != nil {
 		return err
 	}
+	if len(opts.verifyFile) > 0 {
+		if opts.verifySpec, err = appliancepkg.ReadVerifySpec(opts.verifyFile); err != nil {
+			return err
+		}
+	}
 
 	cfg := opts.Config
 	a, err := opts.Appliance(cfg)
 	if err != nil {
 		return err
 	}
-	spinnerOut := opts.SpinnerOut()
 	if a.ApplianceStats == nil {
 		a.ApplianceStats = &appliancepkg.ApplianceStatus{
 			Appliance: a,
@@ -135,8 +308,42 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 		}
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(events.NewContext(context.Background(), opts.events))
 	defer cancel()
+
+	host, err := opts.Config.GetHost()
+	if err != nil {
+		return err
+	}
+	journalPath := appliancepkg.UpgradeJournalPath(host)
+	if opts.resume {
+		return resumeUpgradeComplete(ctx, cmd, opts, a, journalPath)
+	}
+	if _, err := appliancepkg.ReadUpgradeJournal(journalPath); err == nil {
+		fmt.Fprintf(opts.Out, "\nAn interrupted upgrade was found in %s\nUse 'sdpctl appliance upgrade complete --resume' to continue it.\n\n", journalPath)
+		if opts.NoInteractive {
+			return errors.New("An interrupted upgrade must be resumed or its journal removed before starting a new upgrade")
+		}
+		if err := prompt.AskConfirmation("Do you want to discard it and start a new upgrade?"); err != nil {
+			return err
+		}
+	}
+
+	var planFile *appliancepkg.UpgradePlanFile
+	if len(opts.planFile) > 0 {
+		if planFile, err = appliancepkg.ReadUpgradePlanFile(opts.planFile); err != nil {
+			return err
+		}
+	}
+	if opts.canary > 0 {
+		opts.canaryGates = &appliancepkg.CanaryGates{}
+		if len(opts.canaryGatesFile) > 0 {
+			if opts.canaryGates, err = appliancepkg.ReadCanaryGates(opts.canaryGatesFile); err != nil {
+				return err
+			}
+		}
+	}
+
 	filter := util.ParseFilteringFlags(cmd.Flags(), opts.defaultFilter)
 	rawAppliances, err := a.List(ctx, nil)
 	if err != nil {
@@ -160,7 +367,10 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 		if opts.backup {
 			destPrompt := &survey.Input{
 				Message: "Path to where backup should be saved",
-				Default: filesystem.AbsolutePath(opts.backupDestination),
+				Default: opts.backupDestination,
+			}
+			if !appliancepkg.IsRemoteBackupDestination(opts.backupDestination) {
+				destPrompt.Default = filesystem.AbsolutePath(opts.backupDestination)
 			}
 
 			if err := survey.AskOne(destPrompt, &opts.backupDestination, nil); err != nil {
@@ -174,10 +384,6 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 		}
 	}
 
-	host, err := opts.Config.GetHost()
-	if err != nil {
-		return err
-	}
 	controlHost := host
 	if len(opts.actualHostname) > 0 {
 		controlHost = opts.actualHostname
@@ -187,6 +393,10 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 		return err
 	}
 
+	retention, err := appliancepkg.NewRetentionPolicy(opts.Config.BackupRetention)
+	if err != nil {
+		return err
+	}
 	bOpts := appliancepkg.BackupOpts{
 		Config:        opts.Config,
 		Appliance:     opts.Appliance,
@@ -198,6 +408,10 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 		SpinnerOut:    opts.SpinnerOut,
 		NoInteractive: opts.NoInteractive,
 		Quiet:         true,
+		Notifier:      opts.notifier,
+		Events:        opts.events,
+		Retention:     retention,
+		SdpctlVersion: opts.sdpctlVersion,
 	}
 	if opts.backup && len(toBackup) <= 0 {
 		toBackup = append(toBackup, *primaryController)
@@ -225,10 +439,39 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 		}
 	}
 
-	currentPrimaryControllerVersion, err := appliancepkg.GetApplianceVersion(*primaryController, *initialStats)
+	plan, err := appliancepkg.NewUpgradePlan(ctx, a, appliances, *primaryController, *initialStats)
 	if err != nil {
 		return err
 	}
+	if plan.StatusErr != nil {
+		if !opts.continueOnError {
+			return plan.StatusErr
+		}
+		for _, s := range plan.SkippedBecause(appliancepkg.SkipReasonStatusFailed) {
+			log.WithField("appliance", s.GetName()).Warn("could not read the upgrade status, excluding from upgrade")
+		}
+	}
+	for _, o := range offline {
+		plan.Skip(o, appliancepkg.SkipReasonOffline)
+	}
+	// the appliances excluded by the filter are still serving, and count towards the max unavailable limits
+	plan.Online, _, _ = appliancepkg.FilterAvailable(rawAppliances, initialStats.GetData())
+	if planFile != nil {
+		if err := plan.ApplyStages(planFile); err != nil {
+			return fmt.Errorf("Could not apply upgrade plan %s: %w", opts.planFile, err)
+		}
+	}
+	plan.ApplyMaxUnavailable(opts.maxUnavailable)
+	if err := plan.ApplyCanary(opts.canary); err != nil {
+		return fmt.Errorf("Could not select canary appliances: %w", err)
+	}
+	opts.history.SetVersions(plan.FromVersion, plan.ToVersion)
+	if plan.FromVersion != nil && plan.ToVersion != nil && !appliancepkg.CanUpgradeDirectly(plan.FromVersion, plan.ToVersion) {
+		if !opts.ignoreUpgradePath {
+			return fmt.Errorf("Upgrading from %s to %s is not supported directly. Cancel the prepared upgrade and use 'sdpctl appliance upgrade prepare --multi-hop' to upgrade through the intermediate versions, or use --ignore-upgrade-path if the upgrade is known to be supported", plan.FromVersion.String(), plan.ToVersion.String())
+		}
+		fmt.Fprintf(opts.Out, "WARNING: Upgrading from %s to %s is not a supported direct upgrade according to sdpctl, continuing because of --ignore-upgrade-path\n", plan.FromVersion.String(), plan.ToVersion.String())
+	}
 	// if we have an existing config with the primary controller version, check if we need to re-authetnicate
 	// before we continue with the upgrade to update the peer API version.
 	if len(opts.Config.PrimaryControllerVersion) > 0 {
@@ -236,171 +479,295 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 		if err != nil {
 			return err
 		}
-		if !preV.Equal(currentPrimaryControllerVersion) {
+		if !preV.Equal(plan.FromVersion) {
 			return fmt.Errorf("version mismatch: run sdpctl configure signin")
 		}
 	}
-
-	f := log.Fields{
+	log.WithFields(log.Fields{
 		"appliance": primaryController.GetName(),
-		"version":   currentPrimaryControllerVersion.String(),
-	}
-	log.WithFields(f).Info("Found primary controller")
-	// We will exclude the primary controller from the others controllers
-	// since the primary controller is a special case during the upgrade process.
-	for i, appliance := range appliances {
-		if appliance.GetId() == primaryController.GetId() {
-			appliances = append(appliances[:i], appliances[i+1:]...)
-		}
-	}
+		"version":   plan.FromVersion.String(),
+	}).Info("Found primary controller")
 
-	upgradeStatuses, err := a.UpgradeStatusMap(ctx, appliances)
+	var summaryPrimary *openapi.Appliance
+	if plan.UpgradePrimary {
+		summaryPrimary = primaryController
+	}
+	msg, err := printCompleteSummary(opts.Out, summaryPrimary, plan.AdditionalControllers, plan.LogForwardersAndServers, plan.Batches, plan.SkippedBecause(appliancepkg.SkipReasonOffline), toBackup, opts.backupDestination, plan.ToVersion)
 	if err != nil {
 		return err
 	}
-	for id, result := range upgradeStatuses {
-		if !util.InSlice(result.Status, []string{appliancepkg.UpgradeStatusReady, appliancepkg.UpgradeStatusSuccess}) {
-			for i, appliance := range appliances {
-				if id == appliance.GetId() {
-					log.WithField("appliance", appliance.GetName()).Infof("Excluding from upgrade")
-					appliances = append(appliances[:i], appliances[i+1:]...)
-				}
-			}
-		}
+	fmt.Fprint(opts.Out, msg)
+	if opts.canary > 0 {
+		fmt.Fprint(opts.Out, canaryNote)
 	}
-	groups := appliancepkg.GroupByFunctions(appliances)
-
-	// isolate additional controllers
-	additionalControllers := groups[appliancepkg.FunctionController]
-	additionalAppliances := appliances
-	for _, ctrls := range additionalControllers {
-		for i, app := range additionalAppliances {
-			if ctrls.GetId() == app.GetId() {
-				additionalAppliances = append(additionalAppliances[:i], additionalAppliances[i+1:]...)
-			}
-		}
+	if !plan.MaxUnavailable.IsZero() {
+		fmt.Fprintf(opts.Out, "At most %s of the appliances of each site and function are upgraded at the same time.\n\n", plan.MaxUnavailable)
 	}
 
-	// isolate log forwarders and log servers
-	// this is only needed when upgrading to version 6.0 from 5.x, so we need to check for this particular case
-	logForwardersAndServersAll := append(groups[appliancepkg.FunctionLogServer], groups[appliancepkg.FunctionLogForwarder]...)
-	logForwardersAndServers := []openapi.Appliance{}
-	for _, lfs := range logForwardersAndServersAll {
-		upgradeStatus, err := a.UpgradeStatus(ctx, lfs.GetId())
-		if err != nil {
-			return err
-		}
-		currentVersion, err := appliancepkg.GetApplianceVersion(lfs, *initialStats)
-		if err != nil {
-			return err
-		}
-		upgradeVersion, err := appliancepkg.ParseVersionString(upgradeStatus.GetDetails())
-		if err != nil {
+	if !opts.NoInteractive {
+		if err = prompt.AskConfirmation(); err != nil {
 			return err
 		}
+	}
 
-		v6, err := version.NewConstraint(">= 6.0.0-beta")
-		if err != nil {
+	if err := waitForWindow(ctx, opts); err != nil {
+		return err
+	}
+
+	journal := newCompleteJournal(plan, journalPath, host, toBackup)
+	journal.CanaryGates = opts.canaryGates
+	if err := journal.Save(); err != nil {
+		return fmt.Errorf("Could not write upgrade journal: %w", err)
+	}
+	for _, s := range plan.Skipped {
+		applianceSkipped(opts, s.Appliance.GetName(), s.Reason)
+	}
+	log.WithField("journal", journal.Path()).Info("Recording upgrade progress")
+
+	if opts.backup {
+		if err := journal.StartStep(appliancepkg.StageBackup); err != nil {
 			return err
 		}
-		if v6.Check(upgradeVersion) && !v6.Check(currentVersion) {
-			for i, app := range additionalAppliances {
-				if lfs.GetId() == app.GetId() {
-					additionalAppliances = append(additionalAppliances[:i], additionalAppliances[i+1:]...)
-				}
+		opts.events.StepStarted(appliancepkg.StageBackup)
+		if len(toBackup) > 0 {
+			ids := []string{}
+			for _, t := range toBackup {
+				ids = append(ids, t.GetId())
 			}
-			isAlsoInControllers := false
-			for _, ctrl := range additionalControllers {
-				if lfs.GetId() == ctrl.GetId() {
-					isAlsoInControllers = true
-				}
+			bOpts.FilterFlag = map[string]map[string]string{
+				"include": {
+					"id": strings.Join(ids, appliancepkg.FilterDelimiter),
+				},
+			}
+		}
+		fmt.Fprintf(opts.Out, "\n[%s] Backing up:\n", time.Now().Format(time.RFC3339))
+		backup := func() error {
+			if err := appliancepkg.PrepareBackup(&bOpts); err != nil {
+				return err
 			}
-			if !isAlsoInControllers {
-				logForwardersAndServers = append(logForwardersAndServers, lfs)
+			backupMap, err := appliancepkg.PerformBackup(cmd, args, &bOpts)
+			if err != nil {
+				return err
 			}
+			return appliancepkg.CleanupBackup(&bOpts, backupMap)
+		}
+		err := backup()
+		if jerr := journal.FinishStep(appliancepkg.StageBackup, err); jerr != nil && err == nil {
+			err = jerr
+		}
+		opts.events.StepFinished(appliancepkg.StageBackup, err)
+		if err != nil {
+			return err
 		}
 	}
 
-	primaryControllerUpgradeStatus, err := a.UpgradeStatus(ctx, primaryController.GetId())
+	return completeUpgrade(ctx, opts, a, plan, journal)
+}
+
+// resumeUpgradeComplete continues an upgrade from the first unfinished step in the journal.
+// Each appliance which is not marked as upgraded in the journal is checked against its live
+// upgrade status, since the upgrade may have progressed after the journal was last written.
+func resumeUpgradeComplete(ctx context.Context, cmd *cobra.Command, opts *upgradeCompleteOptions, a *appliancepkg.Appliance, journalPath string) error {
+	journal, err := appliancepkg.ReadUpgradeJournal(journalPath)
 	if err != nil {
-		log.WithContext(ctx).WithError(err).Error("Failed to get upgrade status")
 		return err
 	}
-	newVersion, err := appliancepkg.ParseVersionString(primaryControllerUpgradeStatus.GetDetails())
+	host, err := opts.Config.GetHost()
 	if err != nil {
-		log.WithContext(ctx).WithError(err).Error("Failed to determine upgrade version")
+		return err
 	}
-	var newPeerAPIVersion int
-	if newVersion != nil {
-		newPeerAPIVersion = a.GetPeerAPIVersion(newVersion)
+	if journal.Host != host {
+		return fmt.Errorf("The upgrade journal belongs to %s, not %s", journal.Host, host)
 	}
 
-	if primaryControllerUpgradeStatus.GetStatus() != appliancepkg.UpgradeStatusReady && len(additionalControllers) <= 0 && len(additionalAppliances) <= 0 {
-		return fmt.Errorf("No appliances are ready to upgrade. Please run 'upgrade prepare' before trying to complete an upgrade")
+	rawAppliances, err := a.List(ctx, nil)
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]openapi.Appliance, len(rawAppliances))
+	for _, app := range rawAppliances {
+		byID[app.GetId()] = app
+	}
+	lookup := func(step *appliancepkg.JournalStep) ([]openapi.Appliance, error) {
+		result := []openapi.Appliance{}
+		if step == nil {
+			return result, nil
+		}
+		for _, ja := range step.Appliances {
+			app, ok := byID[ja.ID]
+			if !ok {
+				return nil, fmt.Errorf("%s from the upgrade journal no longer exists in the collective", ja.Name)
+			}
+			result = append(result, app)
+		}
+		return result, nil
 	}
 
-	// chunks include slices of slices, divided in chunkSize,
-	// the chunkSize represent the number of goroutines used
-	// for pararell upgrades, each chunk the slice has tried to split
-	// the appliances based on site and function to avoid downtime
-	// the chunkSize is determined by the number of active sites.
-	chunkSize := appliancepkg.ActiveSitesInAppliances(additionalAppliances)
-	chunks := appliancepkg.ChunkApplianceGroup(chunkSize, appliancepkg.SplitAppliancesByGroup(additionalAppliances))
-	chunkLength := len(chunks)
-
-	msg := ""
-	if primaryControllerUpgradeStatus.GetStatus() == appliancepkg.UpgradeStatusReady {
-		msg, err = printCompleteSummary(opts.Out, primaryController, additionalControllers, logForwardersAndServers, chunks, offline, toBackup, opts.backupDestination, newVersion)
+	primaryController, ok := byID[journal.PrimaryControllerID]
+	if !ok {
+		return fmt.Errorf("primary controller %s from the upgrade journal no longer exists in the collective", journal.PrimaryControllerID)
+	}
+	plan := &appliancepkg.UpgradePlan{
+		PrimaryController:  &primaryController,
+		UpgradePrimary:     journal.Step(appliancepkg.StagePrimaryController) != nil,
+		DisableControllers: journal.DisableControllers,
+	}
+	if plan.AdditionalControllers, err = lookup(journal.Step(appliancepkg.StageAdditionalControllers)); err != nil {
+		return err
+	}
+	if plan.LogForwardersAndServers, err = lookup(journal.Step(appliancepkg.StageLogForwardersServers)); err != nil {
+		return err
+	}
+	for _, step := range journal.Steps {
+		if !strings.HasPrefix(step.Name, appliancepkg.StageBatchPrefix) {
+			continue
+		}
+		batch, err := lookup(step)
 		if err != nil {
 			return err
 		}
-	} else {
-		msg, err = printCompleteSummary(opts.Out, nil, additionalControllers, logForwardersAndServers, chunks, offline, toBackup, opts.backupDestination, newVersion)
-		if err != nil {
+		plan.Batches = append(plan.Batches, batch)
+		plan.BatchOptions = append(plan.BatchOptions, appliancepkg.BatchOptions{
+			Label:       step.Label,
+			MaxParallel: step.MaxParallel,
+			Pause:       step.Pause,
+			Canary:      step.Canary,
+		})
+	}
+	// --max-unavailable overrides the limit the upgrade was started with
+	plan.MaxUnavailable = opts.maxUnavailable
+	if plan.MaxUnavailable.IsZero() {
+		if plan.MaxUnavailable, err = appliancepkg.ParseMaxUnavailable(journal.MaxUnavailable); err != nil {
 			return err
 		}
 	}
-	fmt.Fprint(opts.Out, msg)
-
-	if !opts.NoInteractive {
-		if err = prompt.AskConfirmation(); err != nil {
+	opts.canaryGates = journal.CanaryGates
+	if opts.canaryGates == nil {
+		opts.canaryGates = &appliancepkg.CanaryGates{}
+	}
+	if len(journal.FromVersion) > 0 {
+		if plan.FromVersion, err = version.NewVersion(journal.FromVersion); err != nil {
 			return err
 		}
 	}
+	if len(journal.ToVersion) > 0 {
+		if plan.ToVersion, err = version.NewVersion(journal.ToVersion); err != nil {
+			return err
+		}
+	}
+	opts.history.SetVersions(plan.FromVersion, plan.ToVersion)
 
-	if opts.backup {
-		if len(toBackup) > 0 {
-			ids := []string{}
-			for _, t := range toBackup {
-				ids = append(ids, t.GetId())
+	// compare the journal with the live state of the collective
+	stats, _, err := a.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	plan.Online, _, _ = appliancepkg.FilterAvailable(rawAppliances, stats.GetData())
+	toCheck := []openapi.Appliance{}
+	if plan.UpgradePrimary {
+		toCheck = append(toCheck, primaryController)
+	}
+	toCheck = pending(journal, append(toCheck, plan.Appliances()...))
+	statuses, err := a.UpgradeStatusMap(ctx, toCheck)
+	if err != nil {
+		return err
+	}
+	for _, app := range toCheck {
+		status := statuses[app.GetId()]
+		logEntry := log.WithFields(log.Fields{"appliance": app.GetName(), "status": status.Status})
+		switch status.Status {
+		case appliancepkg.UpgradeStatusReady, appliancepkg.UpgradeStatusSuccess:
+			logEntry.Info("appliance is still pending upgrade")
+			continue
+		case appliancepkg.UpgradeStatusInstalling:
+			// the upgrade was interrupted while the appliance was installing, wait for it to finish
+			logEntry.Info("waiting for upgrade in progress")
+			waitCtx, waitCancel := context.WithTimeout(ctx, opts.Timeout)
+			err := a.UpgradeStatusWorker.WaitForUpgradeStatus(waitCtx, app, []string{appliancepkg.UpgradeStatusIdle}, []string{appliancepkg.UpgradeStatusFailed}, nil)
+			waitCancel()
+			if err != nil {
+				return err
 			}
-			bOpts.FilterFlag = map[string]map[string]string{
-				"include": {
-					"id": strings.Join(ids, appliancepkg.FilterDelimiter),
-				},
+			if stats, _, err = a.Stats(ctx); err != nil {
+				return err
 			}
 		}
-		fmt.Fprintf(opts.Out, "\n[%s] Backing up:\n", time.Now().Format(time.RFC3339))
-		if err := appliancepkg.PrepareBackup(&bOpts); err != nil {
+		current, err := appliancepkg.GetApplianceVersion(app, *stats)
+		if err != nil {
 			return err
 		}
-		backupMap, err := appliancepkg.PerformBackup(cmd, args, &bOpts)
-		if err != nil {
+		if plan.ToVersion == nil || !current.Equal(plan.ToVersion) {
+			return fmt.Errorf("%s is in upgrade status %q running %s and can't be resumed, run 'sdpctl appliance upgrade prepare' on it first", app.GetName(), status.Status, current.String())
+		}
+		logEntry.Info("appliance is already upgraded")
+		if err := journal.SetApplianceStatus(app.GetId(), appliancepkg.JournalDone); err != nil {
+			return err
+		}
+	}
+	if plan.UpgradePrimary && journal.ApplianceDone(primaryController.GetId()) {
+		if err := journal.FinishStep(appliancepkg.StagePrimaryController, nil); err != nil {
 			return err
 		}
-		if err := appliancepkg.CleanupBackup(&bOpts, backupMap); err != nil {
+	}
+
+	var summaryPrimary *openapi.Appliance
+	if plan.UpgradePrimary && !journal.StepDone(appliancepkg.StagePrimaryController) {
+		summaryPrimary = plan.PrimaryController
+	}
+	batches := [][]openapi.Appliance{}
+	for _, b := range plan.Batches {
+		if p := pending(journal, b); len(p) > 0 {
+			batches = append(batches, p)
+		}
+	}
+	fmt.Fprintf(opts.Out, "\nResuming upgrade started %s\n", journal.StartedAt.Format(time.RFC3339))
+	msg, err := printCompleteSummary(opts.Out, summaryPrimary, pending(journal, plan.AdditionalControllers), pending(journal, plan.LogForwardersAndServers), batches, nil, nil, "", plan.ToVersion)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(opts.Out, msg)
+	if !opts.NoInteractive {
+		if err = prompt.AskConfirmation(); err != nil {
 			return err
 		}
 	}
+	if err := waitForWindow(ctx, opts); err != nil {
+		return err
+	}
+
+	return completeUpgrade(ctx, opts, a, plan, journal)
+}
+
+// completeUpgrade runs each step of the plan in order. Steps and appliances which are already
+// done according to the journal are skipped, and the journal is updated as the upgrade progresses.
+func completeUpgrade(ctx context.Context, opts *upgradeCompleteOptions, a *appliancepkg.Appliance, plan *appliancepkg.UpgradePlan, journal *appliancepkg.UpgradeJournal) error {
+	cfg := opts.Config
+	spinnerOut := opts.SpinnerOut()
+	primaryController := plan.PrimaryController
+	additionalControllers := plan.AdditionalControllers
+	disableAdditionalControllers := plan.DisableControllers
+	f := log.Fields{"appliance": primaryController.GetName()}
+
+	if err := runHook(ctx, opts, plan, hooks.PreComplete, nil); err != nil {
+		return err
+	}
+	if host, err := cfg.GetHost(); err == nil {
+		opts.estimator = upgradeEstimator("complete", host)
+		opts.estimates = plan.Estimate(opts.estimator.Total())
+		opts.events.SetEstimator(opts.estimator)
+	}
 
 	// 1. Disable Controller function on the following appliance
 	// we will run this sequencelly, since this is a sensitive operation
 	// so that we can leave the collective gracefully.
 	fmt.Fprintf(opts.Out, "\n[%s] Initializing upgrade:\n", time.Now().Format(time.RFC3339))
+	opts.events.StepStarted("initialize")
 	initP := mpb.NewWithContext(ctx, mpb.WithOutput(spinnerOut))
-	disableAdditionalControllers := appliancepkg.ShouldDisable(currentPrimaryControllerVersion, newVersion)
 	if disableAdditionalControllers {
 		for _, controller := range additionalControllers {
+			if journal.ApplianceDone(controller.GetId()) || journal.ControllerDisabled(controller.GetId()) {
+				continue
+			}
 			spinner := tui.AddDefaultSpinner(initP, controller.GetName(), "disabling", "disabled")
 			f := log.Fields{"appliance": controller.GetName()}
 			log.WithFields(f).Info("Disabling controller function")
@@ -409,6 +776,15 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 				log.WithFields(f).Error("Unable to disable controller")
 				return err
 			}
+			if err := journal.SetControllerDisabled(controller.GetId(), true); err != nil {
+				spinner.Abort(false)
+				return err
+			}
+			opts.notifier.Notify(notify.Event{
+				Type:      notify.EventControllerDisabled,
+				Appliance: controller.GetName(),
+				Message:   fmt.Sprintf("Disabled the controller function on %s", controller.GetName()),
+			})
 			if err := a.ApplianceStats.WaitForApplianceState(ctx, controller, appliancepkg.StatReady, nil); err != nil {
 				spinner.Abort(false)
 				log.WithFields(f).Error("never reached desired state")
@@ -427,7 +803,10 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 	log.Info("all controllers are in correct state")
 
 	if cfg.Version >= 15 && len(additionalControllers) > 0 {
-		for _, controller := range additionalControllers {
+		for _, controller := range pending(journal, additionalControllers) {
+			if journal.InMaintenanceMode(controller.GetId()) {
+				continue
+			}
 			f := log.Fields{"controller": controller.GetName()}
 			log.WithFields(f).Info("enabling maintenance mode")
 			id, err := a.EnableMaintenanceMode(ctx, controller.GetId())
@@ -435,45 +814,80 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 				log.WithFields(f).Warnf("Unable to enable maintenance mode %s", err)
 				return err
 			}
+			if err := journal.SetMaintenanceMode(controller.GetId(), true); err != nil {
+				return err
+			}
 			log.WithFields(f).Infof("id %s", id)
 		}
 	}
-	m, err := a.UpgradeStatusMap(ctx, appliances)
-	if err != nil {
+	toUpgrade := pending(journal, plan.Appliances())
+	m, err := a.UpgradeStatusMap(ctx, toUpgrade)
+	if err != nil && !opts.continueOnError {
 		log.WithError(err).Error("Upgrade status failed")
 		return err
 	}
 	notReady := make([]string, 0)
-	for _, result := range m {
+	// notReadyErrors holds the appliances which are excluded from the upgrade with --continue-on-error
+	notReadyErrors := map[string]error{}
+	for _, appliance := range toUpgrade {
+		result := m[appliance.GetId()]
+		if result.Err != nil {
+			notReady = append(notReady, appliance.GetName())
+			notReadyErrors[appliance.GetId()] = result.Err
+			continue
+		}
 		log.WithFields(log.Fields{
 			"appliance": result.Name,
 		}).Infof("Upgrade status %s", result.Status)
 		if !util.InSlice(result.Status, []string{appliancepkg.UpgradeStatusReady, appliancepkg.UpgradeStatusSuccess}) {
 			notReady = append(notReady, result.Name)
+			notReadyErrors[appliance.GetId()] = fmt.Errorf("not ready for upgrade, upgrade status is %s", result.Status)
 		}
 	}
-	if len(notReady) > 0 {
+	// controllers must always be upgraded, so the upgrade can only continue without other appliances
+	controllerNotReady := false
+	for _, ctrl := range additionalControllers {
+		if _, ok := notReadyErrors[ctrl.GetId()]; ok {
+			controllerNotReady = true
+		}
+	}
+	if len(notReady) > 0 && (!opts.continueOnError || controllerNotReady) {
 		verifyingSpinner.Abort(false)
 		log.Errorf("appliance %s is not ready for upgrade", strings.Join(notReady, ", "))
 		return fmt.Errorf("one or more appliances are not ready for upgrade.")
 	}
+	for _, appliance := range toUpgrade {
+		if err, ok := notReadyErrors[appliance.GetId()]; ok {
+			log.WithField("appliance", appliance.GetName()).WithError(err).Warn("excluding from upgrade")
+			applianceFinished(opts, appliance.GetName(), err)
+			if err := journal.SetApplianceStatus(appliance.GetId(), appliancepkg.JournalFailed); err != nil {
+				return err
+			}
+		}
+	}
 	verifyingSpinner.Increment()
 	initP.Wait()
+	opts.events.StepFinished("initialize", nil)
 
-	if primaryControllerUpgradeStatus.GetStatus() == appliancepkg.UpgradeStatusReady {
+	if plan.UpgradePrimary && !journal.StepDone(appliancepkg.StagePrimaryController) {
 		fmt.Fprintf(opts.Out, "\n[%s] Upgrading primary controller:\n", time.Now().Format(time.RFC3339))
+		printEstimate(opts, journal, appliancepkg.StagePrimaryController)
 		upgradeReadyPrimary := func(ctx context.Context, controller openapi.Appliance) error {
 			ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
 			defer cancel()
 			var primaryControllerBars *tui.Progress
 			var t *tui.Tracker
 			if !opts.ciMode {
-				primaryControllerBars = tui.New(ctx, spinnerOut)
+				primaryControllerBars = newCompleteProgress(ctx, spinnerOut, opts)
 				defer primaryControllerBars.Wait()
 				t = primaryControllerBars.AddTracker(controller.GetName(), "upgraded")
 				go t.Watch(appliancepkg.StatReady, []string{appliancepkg.UpgradeStatusFailed})
 			}
 
+			env := applianceHookEnv(plan, controller)
+			if err := runHook(ctx, opts, plan, hooks.PreApplianceUpgrade, env); err != nil {
+				return err
+			}
 			logEntry := log.WithField("appliance", controller.GetName())
 			logEntry.Info("completing upgrade and switching partition")
 			if err := a.UpgradeComplete(ctx, controller.GetId(), true); err != nil {
@@ -488,34 +902,96 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 			}
 
 			logEntry.Info("primary controller updated")
-			return nil
+			if err := journal.SetApplianceStatus(controller.GetId(), appliancepkg.JournalDone); err != nil {
+				return err
+			}
+			return runHook(ctx, opts, plan, hooks.PostApplianceUpgrade, env)
+		}
+		if err := journal.StartStep(appliancepkg.StagePrimaryController); err != nil {
+			return err
+		}
+		opts.events.StepStarted(appliancepkg.StagePrimaryController)
+		err := upgradeReadyPrimary(ctx, *primaryController)
+		applianceFinished(opts, primaryController.GetName(), err)
+		if jerr := journal.FinishStep(appliancepkg.StagePrimaryController, err); jerr != nil && err == nil {
+			err = jerr
 		}
-		if err := upgradeReadyPrimary(ctx, *primaryController); err != nil {
+		opts.events.StepFinished(appliancepkg.StagePrimaryController, err)
+		if err != nil {
 			return err
 		}
 	}
 
-	batchUpgrade := func(ctx context.Context, appliances []openapi.Appliance, SwitchPartition bool) error {
+	slots := plan.UnavailableSlots()
+	batchUpgrade := func(ctx context.Context, appliances []openapi.Appliance, SwitchPartition bool, maxParallel int) error {
 		g, ctx := errgroup.WithContext(ctx)
+		if maxParallel > 0 {
+			g.SetLimit(maxParallel)
+		}
+		groupCtx := ctx
+		var failedMu sync.Mutex
+		failed := []string{}
 		regex := regexp.MustCompile(`a reboot is required for the upgrade to go into effect`)
 		upgradeChan := make(chan openapi.Appliance, len(appliances))
 		var p *tui.Progress
 		if !opts.ciMode {
-			p = tui.New(ctx, spinnerOut)
+			p = newCompleteProgress(ctx, spinnerOut, opts)
 			defer p.Wait()
 		}
 		for _, appliance := range appliances {
 			i := appliance
-			g.Go(func() error {
-				ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
-				defer cancel()
+			g.Go(func() (err error) {
+				skipped := false
+				defer func() {
+					if skipped {
+						applianceSkipped(opts, i.GetName(), "skipped by the pre-appliance-upgrade hook")
+						return
+					}
+					applianceFinished(opts, i.GetName(), err)
+					// the failure is recorded instead of stopping the other appliances, unless the upgrade was canceled
+					if err != nil && opts.continueOnError && groupCtx.Err() == nil {
+						log.WithField("appliance", i.GetName()).WithError(err).Error("upgrade failed, continuing with the other appliances")
+						if jerr := journal.SetApplianceStatus(i.GetId(), appliancepkg.JournalFailed); jerr != nil {
+							err = jerr
+							return
+						}
+						failedMu.Lock()
+						failed = append(failed, i.GetName())
+						failedMu.Unlock()
+						err = nil
+					}
+				}()
 				logEntry := log.WithField("appliance", i.GetName())
+				// the hooks run while the appliance holds its slot, since they may take it out of service
+				release, err := slots.Acquire(ctx, i)
+				if err != nil {
+					return err
+				}
+				defer release()
+				env := applianceHookEnv(plan, i)
+				if err := runHook(ctx, opts, plan, hooks.PreApplianceUpgrade, env); err != nil {
+					if errors.Is(err, hooks.ErrSkip) {
+						logEntry.WithError(err).Warn("skipping appliance")
+						fmt.Fprintf(opts.Out, "Skipping %s: %s\n", i.GetName(), err)
+						skipped = true
+						return nil
+					}
+					return err
+				}
 				logEntry.Info("checking if ready")
 				var t *tui.Tracker
 				if !opts.ciMode {
 					t = p.AddTracker(i.GetName(), "upgraded")
 					go t.Watch(appliancepkg.StatReady, []string{appliancepkg.UpgradeStatusFailed})
 				}
+				if opts.drain && util.InSlice(appliancepkg.FunctionGateway, appliancepkg.GetActiveFunctions(i)) {
+					if err := a.DrainGateway(ctx, i, opts.drainOptions, t); err != nil {
+						return err
+					}
+				}
+				// the time spent waiting for a free slot, in the pre-appliance-upgrade hook and for the sessions to drain is not part of the upgrade timeout
+				ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+				defer cancel()
 				if err := a.UpgradeComplete(ctx, i.GetId(), SwitchPartition); err != nil {
 					return err
 				}
@@ -541,6 +1017,14 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 				if err := a.ApplianceStats.WaitForApplianceState(ctx, i, appliancepkg.StatReady, t); err != nil {
 					return err
 				}
+				if err := journal.SetApplianceStatus(i.GetId(), appliancepkg.JournalDone); err != nil {
+					return err
+				}
+				if err := runHook(ctx, opts, plan, hooks.PostApplianceUpgrade, env); err != nil {
+					return err
+				}
+				// the appliance is available again, so the next appliance of the site can start
+				release()
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
@@ -557,9 +1041,42 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 			log.WithError(err).Error(err.Error())
 			return fmt.Errorf("Error during upgrade of an appliance %w", err)
 		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%w: %s", errAppliancesFailed, strings.Join(failed, ", "))
+		}
 		return nil
 	}
 
+	// runStep upgrades the appliances in a step which are not already done according to the journal
+	runStep := func(name string, appliances []openapi.Appliance, upgrade func([]openapi.Appliance) error) error {
+		if err := journal.StartStep(name); err != nil {
+			return err
+		}
+		opts.events.StepStarted(name)
+		todo := []openapi.Appliance{}
+		excluded := []string{}
+		for _, app := range pending(journal, appliances) {
+			if _, ok := notReadyErrors[app.GetId()]; ok {
+				excluded = append(excluded, app.GetName())
+				continue
+			}
+			todo = append(todo, app)
+		}
+		var err error
+		if len(todo) > 0 {
+			err = upgrade(todo)
+		}
+		// the step is recorded as failed, so that the excluded appliances are upgraded if the upgrade is resumed
+		if err == nil && len(excluded) > 0 {
+			err = fmt.Errorf("%w: %s", errAppliancesFailed, strings.Join(excluded, ", "))
+		}
+		if jerr := journal.FinishStep(name, err); jerr != nil && err == nil {
+			err = jerr
+		}
+		opts.events.StepFinished(name, err)
+		return err
+	}
+
 	backoffEnableController := func(controller openapi.Appliance) error {
 		b := backoff.WithContext(&backoff.ExponentialBackOff{
 			InitialInterval: 10 * time.Second,
@@ -580,26 +1097,14 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 		}, b)
 	}
 
-	if len(additionalControllers) > 0 {
+	if len(additionalControllers) > 0 && !journal.StepDone(appliancepkg.StageAdditionalControllers) {
 		fmt.Fprintf(opts.Out, "\n[%s] Upgrading additional controllers:\n", time.Now().Format(time.RFC3339))
+		printEstimate(opts, journal, appliancepkg.StageAdditionalControllers)
 
-		upgradeAdditionalController := func(ctx context.Context, controller openapi.Appliance, disable bool, p *tui.Progress) error {
-			log.Infof("Upgrading controller %s", controller.GetName())
-			ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
-			defer cancel()
-			var t *tui.Tracker
-			if !opts.ciMode && p != nil {
-				t = p.AddTracker(controller.GetName(), "upgraded")
-				go t.Watch(appliancepkg.StatReady, []string{appliancepkg.UpgradeStatusFailed})
-			}
-			if err := a.UpgradeComplete(ctx, controller.GetId(), true); err != nil {
-				return err
-			}
-			if err := a.UpgradeStatusWorker.WaitForUpgradeStatus(ctx, controller, []string{appliancepkg.UpgradeStatusIdle}, []string{appliancepkg.UpgradeStatusFailed}, t); err != nil {
-				log.WithFields(f).WithError(err).Error("Controller never reached desired upgrade status")
-				return err
-			}
-			if disable {
+		// restoreController re-enables the controller function and disables maintenance mode,
+		// if the journal says that they were changed during the upgrade.
+		restoreController := func(ctx context.Context, controller openapi.Appliance) error {
+			if journal.ControllerDisabled(controller.GetId()) {
 				log.WithField("appliance", controller.GetName()).Info("re-enabling controller")
 				if err := backoffEnableController(controller); err != nil {
 					log.WithFields(f).WithError(err).Error("Failed to enable controller")
@@ -613,64 +1118,199 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 					}
 					return err
 				}
+				if err := journal.SetControllerDisabled(controller.GetId(), false); err != nil {
+					return err
+				}
+				opts.notifier.Notify(notify.Event{
+					Type:      notify.EventControllerEnabled,
+					Appliance: controller.GetName(),
+					Message:   fmt.Sprintf("Enabled the controller function on %s", controller.GetName()),
+				})
 			}
-			if err := a.ApplianceStats.WaitForApplianceState(ctx, controller, appliancepkg.StatReady, t); err != nil {
-				log.WithFields(f).WithError(err).Error("Controller never reached desired state")
-				return err
-			}
-			if cfg.Version >= 15 {
+			return nil
+		}
+		restoreMaintenanceMode := func(ctx context.Context, controller openapi.Appliance) error {
+			if journal.InMaintenanceMode(controller.GetId()) {
 				_, err := a.DisableMaintenanceMode(ctx, controller.GetId())
 				if err != nil {
 					return err
 				}
 				log.WithFields(f).Info("Disabled maintenance mode")
+				if err := journal.SetMaintenanceMode(controller.GetId(), false); err != nil {
+					return err
+				}
 			}
-			log.Infof("Upgraded controller %s", controller.GetName())
 			return nil
 		}
+
+		upgradeAdditionalController := func(ctx context.Context, controller openapi.Appliance, p *tui.Progress) error {
+			log.Infof("Upgrading controller %s", controller.GetName())
+			env := applianceHookEnv(plan, controller)
+			upgraded := journal.ApplianceDone(controller.GetId())
+			if !upgraded {
+				if err := runHook(ctx, opts, plan, hooks.PreApplianceUpgrade, env); err != nil {
+					return err
+				}
+			}
+			// the time spent in the pre-appliance-upgrade hook is not part of the upgrade timeout
+			ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+			var t *tui.Tracker
+			if !opts.ciMode && p != nil {
+				t = p.AddTracker(controller.GetName(), "upgraded")
+				go t.Watch(appliancepkg.StatReady, []string{appliancepkg.UpgradeStatusFailed})
+			}
+			if upgraded {
+				// the controller was upgraded in a previous run, which was interrupted before it was restored
+				log.WithField("appliance", controller.GetName()).Info("controller already upgraded")
+			} else {
+				if err := a.UpgradeComplete(ctx, controller.GetId(), true); err != nil {
+					return err
+				}
+				if err := a.UpgradeStatusWorker.WaitForUpgradeStatus(ctx, controller, []string{appliancepkg.UpgradeStatusIdle}, []string{appliancepkg.UpgradeStatusFailed}, t); err != nil {
+					log.WithFields(f).WithError(err).Error("Controller never reached desired upgrade status")
+					return err
+				}
+				if err := journal.SetApplianceStatus(controller.GetId(), appliancepkg.JournalDone); err != nil {
+					return err
+				}
+			}
+			if err := restoreController(ctx, controller); err != nil {
+				return err
+			}
+			if err := a.ApplianceStats.WaitForApplianceState(ctx, controller, appliancepkg.StatReady, t); err != nil {
+				log.WithFields(f).WithError(err).Error("Controller never reached desired state")
+				return err
+			}
+			if err := restoreMaintenanceMode(ctx, controller); err != nil {
+				return err
+			}
+			log.Infof("Upgraded controller %s", controller.GetName())
+			return runHook(ctx, opts, plan, hooks.PostApplianceUpgrade, env)
+		}
+		if err := journal.StartStep(appliancepkg.StageAdditionalControllers); err != nil {
+			return err
+		}
+		opts.events.StepStarted(appliancepkg.StageAdditionalControllers)
 		for _, ctrl := range additionalControllers {
+			if journal.ApplianceDone(ctrl.GetId()) && !journal.ControllerDisabled(ctrl.GetId()) && !journal.InMaintenanceMode(ctrl.GetId()) {
+				continue
+			}
 			var additionalControllerBars *tui.Progress
 			if !opts.ciMode {
-				additionalControllerBars = tui.New(ctx, spinnerOut)
+				additionalControllerBars = newCompleteProgress(ctx, spinnerOut, opts)
 
 			}
-			if err := upgradeAdditionalController(ctx, ctrl, disableAdditionalControllers, additionalControllerBars); err != nil {
+			err := upgradeAdditionalController(ctx, ctrl, additionalControllerBars)
+			applianceFinished(opts, ctrl.GetName(), err)
+			if err != nil {
+				if jerr := journal.FinishStep(appliancepkg.StageAdditionalControllers, err); jerr != nil {
+					log.WithError(jerr).Warn("failed to update upgrade journal")
+				}
 				return err
 			}
 			if !opts.ciMode {
 				additionalControllerBars.Wait()
 			}
 		}
+		if err := journal.FinishStep(appliancepkg.StageAdditionalControllers, nil); err != nil {
+			return err
+		}
+		opts.events.StepFinished(appliancepkg.StageAdditionalControllers, nil)
 		log.Info("done waiting for additional controllers upgrade")
 	}
 
-	if len(logForwardersAndServers) > 0 {
+	if len(plan.LogForwardersAndServers) > 0 && !journal.StepDone(appliancepkg.StageLogForwardersServers) {
 		fmt.Fprintf(opts.Out, "\n[%s] Upgrading LogForwarder/LogServer appliances:\n", time.Now().Format(time.RFC3339))
-		if err := batchUpgrade(ctx, logForwardersAndServers, false); err != nil {
+		printEstimate(opts, journal, appliancepkg.StageLogForwardersServers)
+		if err := runStep(appliancepkg.StageLogForwardersServers, plan.LogForwardersAndServers, func(todo []openapi.Appliance) error {
+			return batchUpgrade(ctx, todo, false, 0)
+		}); err != nil && !errors.Is(err, errAppliancesFailed) {
 			return err
 		}
 	}
 
-	for index, chunk := range chunks {
-		fmt.Fprintf(opts.Out, "\n[%s] Upgrading additional appliances (Batch %d / %d):\n", time.Now().Format(time.RFC3339), index+1, chunkLength)
-		if err := batchUpgrade(ctx, chunk, false); err != nil {
-			return fmt.Errorf("failed during upgrade of additional appliances %w", err)
+	chunkLength := len(plan.Batches)
+	for index, chunk := range plan.Batches {
+		name := appliancepkg.BatchName(index)
+		batch := plan.Batch(index)
+		if journal.StepDone(name) {
+			if batch.Canary {
+				if err := canaryGates(ctx, opts, a, plan, journal, chunk); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if opts.window.Closed(time.Now()) {
+			updatePeerAPIVersion(opts, a, plan)
+			return windowClosed(opts, plan, journal, index)
+		}
+		label := ""
+		if len(batch.Label) > 0 {
+			label = fmt.Sprintf(" - %s", batch.Label)
+		}
+		fmt.Fprintf(opts.Out, "\n[%s] Upgrading additional appliances (Batch %d / %d%s):\n", time.Now().Format(time.RFC3339), index+1, chunkLength, label)
+		printEstimate(opts, journal, name)
+		env := batchHookEnv(plan, index, chunk)
+		if err := runHook(ctx, opts, plan, hooks.PreBatch, env); err != nil {
+			if !errors.Is(err, hooks.ErrSkip) {
+				return err
+			}
+			// the rest of the appliances are only upgraded once the canaries have passed the canary gates
+			if batch.Canary {
+				return fmt.Errorf("the pre-batch hook skipped the canary batch %d, which must pass the canary gates before the rest of the appliances are upgraded: %w", index+1, err)
+			}
+			// the batch step is left pending, so the appliances are upgraded if the upgrade is resumed
+			log.WithError(err).WithField("batch", index+1).Warn("skipping batch")
+			fmt.Fprintf(opts.Out, "Skipping batch %d: %s\n", index+1, err)
+			for _, app := range pending(journal, chunk) {
+				applianceSkipped(opts, app.GetName(), "skipped by the pre-batch hook")
+			}
+			continue
+		}
+		if err := runStep(name, chunk, func(todo []openapi.Appliance) error {
+			return batchUpgrade(ctx, todo, false, batch.MaxParallel)
+		}); err != nil {
+			// the rest of the appliances are not upgraded if a canary fails
+			if !errors.Is(err, errAppliancesFailed) || batch.Canary {
+				return fmt.Errorf("failed during upgrade of additional appliances %w", err)
+			}
+			log.WithError(err).Warn("continuing with the next batch")
+		}
+		if err := runHook(ctx, opts, plan, hooks.PostBatch, env); err != nil {
+			return err
+		}
+		names := []string{}
+		for _, app := range chunk {
+			names = append(names, app.GetName())
+		}
+		opts.notifier.Notify(notify.Event{
+			Type:    notify.EventBatchDone,
+			Message: fmt.Sprintf("Batch %d / %d%s done", index+1, chunkLength, label),
+			Details: map[string]string{"appliances": strings.Join(names, ", ")},
+		})
+		if batch.Canary {
+			if err := canaryGates(ctx, opts, a, plan, journal, chunk); err != nil {
+				return err
+			}
+		}
+		if batch.Pause > 0 && index+1 < chunkLength {
+			fmt.Fprintf(opts.Out, "\n[%s] Pausing for %s before the next batch\n", time.Now().Format(time.RFC3339), batch.Pause)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(batch.Pause):
+			}
 		}
 	}
 
-	if newVersion != nil && newVersion.GreaterThan(currentPrimaryControllerVersion) {
-		cfg.PrimaryControllerVersion = newVersion.String()
-		cfg.Version = newPeerAPIVersion
-		viper.Set("primary_controller_version", newVersion.String())
-		viper.Set("api_version", newPeerAPIVersion)
-		if err := viper.WriteConfig(); err != nil {
-			log.WithFields(log.Fields{
-				"primary_controller_version": newVersion.String(),
-				"api_version":                newPeerAPIVersion,
-			}).WithError(err).Warn("failed to write config file")
-			fmt.Fprintln(opts.Out, "WARNING: Failed to write to config file. Please run 'sdpctl configure signin' to reconfigure.")
-		}
+	updatePeerAPIVersion(opts, a, plan)
+	event := notify.Event{Type: notify.EventUpgradeCompleted, Message: "Upgrade completed"}
+	if plan.ToVersion != nil {
+		event.Message = fmt.Sprintf("Upgrade to %s completed", plan.ToVersion.String())
 	}
+	opts.notifier.Notify(event)
 
 	// Check if all appliances are running the same version after upgrade complete
 	newStats, _, err := a.Stats(ctx)
@@ -685,8 +1325,63 @@ func upgradeCompleteRun(cmd *cobra.Command, args []string, opts *upgradeComplete
 		return err
 	}
 	fmt.Fprintf(opts.Out, "\n[%s] %s\n", time.Now().Format(time.RFC3339), postSummary)
+	opts.history.SetSummary(postSummary)
 
-	return nil
+	// the journal is kept if some appliances failed, so that they can be upgraded with --resume
+	partialErr := partialFailure(opts)
+	if partialErr == nil {
+		if err := journal.Remove(); err != nil {
+			log.WithError(err).Warn("failed to remove upgrade journal")
+		}
+	} else {
+		fmt.Fprintln(opts.Out, "\nSome appliances failed to upgrade. Use 'sdpctl appliance upgrade complete --resume' to retry them.")
+	}
+	if err := runHook(ctx, opts, plan, hooks.PostComplete, nil); err != nil {
+		return err
+	}
+
+	if opts.verifySpec != nil {
+		if err := verifyUpgrade(ctx, opts, a, plan, *newStats); err != nil {
+			return err
+		}
+	}
+	return partialErr
+}
+
+// verifyUpgrade runs the checks in the verification file on the appliances in the plan
+func verifyUpgrade(ctx context.Context, opts *upgradeCompleteOptions, a *appliancepkg.Appliance, plan *appliancepkg.UpgradePlan, stats openapi.StatsAppliancesList) error {
+	opts.events.StepStarted("verify")
+	fmt.Fprintf(opts.Out, "\n[%s] Verifying the upgrade:\n", time.Now().Format(time.RFC3339))
+	appliances := append([]openapi.Appliance{*plan.PrimaryController}, plan.Appliances()...)
+	results := appliancepkg.Verify(ctx, a, *opts.verifySpec, appliances, stats, opts.Config.Version)
+	appliancepkg.PrintVerifyReport(opts.Out, results)
+	var err error
+	if failures := appliancepkg.VerifyFailures(results); len(failures) > 0 {
+		err = fmt.Errorf("%w: %d of %d checks failed", cmdutil.ErrVerificationFailed, len(failures), len(results))
+	}
+	opts.events.StepFinished("verify", err)
+	return err
+}
+
+// updatePeerAPIVersion updates the config with the version of the upgraded primary controller and its peer API version
+func updatePeerAPIVersion(opts *upgradeCompleteOptions, a *appliancepkg.Appliance, plan *appliancepkg.UpgradePlan) {
+	cfg := opts.Config
+	newVersion := plan.ToVersion
+	if newVersion == nil || plan.FromVersion == nil || !newVersion.GreaterThan(plan.FromVersion) {
+		return
+	}
+	newPeerAPIVersion := a.GetPeerAPIVersion(newVersion)
+	cfg.PrimaryControllerVersion = newVersion.String()
+	cfg.Version = newPeerAPIVersion
+	viper.Set("primary_controller_version", newVersion.String())
+	viper.Set("api_version", newPeerAPIVersion)
+	if err := viper.WriteConfig(); err != nil {
+		log.WithFields(log.Fields{
+			"primary_controller_version": newVersion.String(),
+			"api_version":                newPeerAPIVersion,
+		}).WithError(err).Warn("failed to write config file")
+		fmt.Fprintln(opts.Out, "WARNING: Failed to write to config file. Please run 'sdpctl configure signin' to reconfigure.")
+	}
 }
 
 func printCompleteSummary(out io.Writer, primaryController *openapi.Appliance, additionalControllers, logForwardersServers []openapi.Appliance, chunks [][]openapi.Appliance, skipped, backup []openapi.Appliance, backupDestination string, toVersion *version.Version) (string, error) {
@@ -6,13 +6,18 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
 	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
 	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/events"
 	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/filesystem"
 	"github.com/appgate/sdpctl/pkg/httpmock"
 	"github.com/appgate/sdpctl/pkg/prompt"
 	"github.com/appgate/sdpctl/pkg/tui"
@@ -39,6 +44,16 @@ func (u *errApplianceStatus) WaitForApplianceStatus(ctx context.Context, applian
 	return fmt.Errorf("Never reached expected status %s", want)
 }
 
+// gatewayErrorUpgradeStatus fails the upgrade of every appliance except the controllers
+type gatewayErrorUpgradeStatus struct{}
+
+func (u *gatewayErrorUpgradeStatus) WaitForUpgradeStatus(ctx context.Context, appliance openapi.Appliance, desiredStatuses []string, undesiredStatuses []string, tracker *tui.Tracker) error {
+	if appliance.Controller.GetEnabled() {
+		return nil
+	}
+	return fmt.Errorf("%s never reached %s, got failed", appliance.GetName(), strings.Join(desiredStatuses, ", "))
+}
+
 func TestUpgradeCompleteCommand(t *testing.T) {
 	applianceUUID := "4c07bc67-57ea-42dd-b702-c2d6c45419fc"
 	backupUUID := "fd5ea380-496b-41eb-8bc8-2c84eb36b605"
@@ -50,6 +65,7 @@ func TestUpgradeCompleteCommand(t *testing.T) {
 		askStubs                    func(*prompt.AskStubber)
 		upgradeStatusWorker         appliancepkg.WaitForUpgradeStatus
 		upgradeApplianeStatusWorker appliancepkg.WaitForApplianceStatus
+		hooks                       []configuration.Hook
 		wantErr                     bool
 		wantErrOut                  *regexp.Regexp
 	}{
@@ -272,6 +288,47 @@ func TestUpgradeCompleteCommand(t *testing.T) {
 			wantErrOut:          regexp.MustCompile(`gateway never reached idle, got failed`),
 			wantErr:             true,
 		},
+		{
+			name: "continue on error with a failed gateway",
+			cli:  "upgrade complete --backup=false --no-interactive --continue-on-error",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL: "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+				{
+					URL: "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+			},
+			upgradeStatusWorker: &gatewayErrorUpgradeStatus{},
+			wantErrOut:          regexp.MustCompile(`upgrade partially failed: 1 appliances failed to upgrade`),
+			wantErr:             true,
+		},
 		{
 			name: "one offline controller",
 			cli:  "upgrade complete --backup=false --no-interactive",
@@ -289,9 +346,373 @@ func TestUpgradeCompleteCommand(t *testing.T) {
 			wantErrOut:          regexp.MustCompile(`Could not complete upgrade operation 1 error occurred`),
 			wantErr:             true,
 		},
+		{
+			name: "maintenance window closed",
+			cli:  "upgrade complete --backup=false --no-interactive --window 1ns",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL: "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+			},
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`the maintenance window has closed at .*, 1 appliances were not upgraded`),
+		},
+		{
+			name: "canary gates passed",
+			cli:  "upgrade complete --backup=false --no-interactive --canary 1 --canary-gates testdata/canary_gates.yml",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL: "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+				{
+					URL: "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+				{
+					URL: "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/metrics/vpn_active_sessions",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "text/plain")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, "# TYPE vpn_active_sessions gauge\nvpn_active_sessions{site=\"site1\"} 12.0\n")
+					},
+				},
+				{
+					URL: "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/test-resolver-name",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"ips": ["10.0.0.10"]}`))
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "canary batch skipped by pre-batch hook",
+			cli:  "upgrade complete --backup=false --no-interactive --canary 1 --canary-gates testdata/canary_gates.yml",
+			hooks: []configuration.Hook{
+				{Event: "pre-batch", Command: "false", OnFailure: "skip"},
+			},
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL: "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+			},
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`the pre-batch hook skipped the canary batch 1`),
+		},
+		{
+			name: "canary metric gate failed",
+			cli:  "upgrade complete --backup=false --no-interactive --canary 1 --canary-gates testdata/canary_gates.yml",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL: "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+				{
+					URL: "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+				{
+					URL: "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/metrics/vpn_active_sessions",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "text/plain")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, "# TYPE vpn_active_sessions gauge\nvpn_active_sessions{site=\"site1\"} 0\n")
+					},
+				},
+				{
+					URL: "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/test-resolver-name",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"ips": ["10.0.0.10"]}`))
+					},
+				},
+			},
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`canary gates failed: 1 of the checks failed on the canary appliances`),
+		},
+		{
+			name:       "canary gates without canary",
+			cli:        "upgrade complete --canary-gates testdata/canary_gates.yml",
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`--canary-gates requires --canary`),
+		},
+		{
+			name: "verification after complete failed",
+			cli:  "upgrade complete --backup=false --no-interactive --verify testdata/verify.yml",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL: "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+				{
+					URL: "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+			},
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`verification failed: 2 of 4 checks failed`),
+		},
+		{
+			name: "pre-complete hook failed",
+			cli:  "upgrade complete --backup=false --no-interactive --hook pre-complete=false",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+			},
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`pre-complete hook "false" failed`),
+		},
+		{
+			name:       "unknown hook event",
+			cli:        "upgrade complete --hook pre-everything=true",
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`unknown hook event "pre-everything"`),
+		},
+		{
+			name: "max unavailable per site and function",
+			cli:  "upgrade complete --backup=false --no-interactive --max-unavailable 50%",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL: "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+				{
+					URL: "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+			},
+		},
+		{
+			name: "drain gateway sessions",
+			cli:  "upgrade complete --backup=false --no-interactive --drain --drain-threshold 1",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"),
+				},
+				{
+					URL: "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+				{
+					URL: "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade/complete",
+					Responder: func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Content-Type", "application/json")
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, string(`{"id": "37bdc593-df27-49f8-9852-cb302214ee1f" }`))
+					},
+				},
+			},
+		},
+		{
+			name:       "drain timeout without drain",
+			cli:        "upgrade complete --drain-timeout 5m",
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`--drain-threshold and --drain-timeout require --drain`),
+		},
+		{
+			name:       "invalid max unavailable",
+			cli:        "upgrade complete --max-unavailable 0",
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`--max-unavailable: invalid max unavailable "0"`),
+		},
+		{
+			name:       "start time in the past",
+			cli:        "upgrade complete --start-at 2020-01-01T02:00:00Z",
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`--start-at 2020-01-01T02:00:00Z is in the past`),
+		},
+		{
+			name:       "invalid start time",
+			cli:        "upgrade complete --start-at 02:00",
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`invalid --start-at "02:00"`),
+		},
+		{
+			name:       "resume without interrupted upgrade",
+			cli:        "upgrade complete --resume",
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`No interrupted upgrade found`),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			// keep the upgrade journal of each test case isolated
+			os.Setenv(filesystem.AgDataDir, t.TempDir())
+			defer os.Unsetenv(filesystem.AgDataDir)
+
 			registry := httpmock.NewRegistry(t)
 			for _, v := range tt.httpStubs {
 				registry.Register(v.URL, v.Responder)
@@ -308,6 +729,7 @@ func TestUpgradeCompleteCommand(t *testing.T) {
 					Debug:                    false,
 					URL:                      fmt.Sprintf("http://appgate.com:%d", registry.Port),
 					PrimaryControllerVersion: "5.3.4+24950",
+					Hooks:                    tt.hooks,
 				},
 				IOOutWriter: stdout,
 				Stdin:       in,
@@ -371,10 +793,75 @@ func TestUpgradeCompleteCommand(t *testing.T) {
 					t.Errorf("Expected output to match, expected:\n%s\n got: \n%s\n", tt.wantErrOut, err.Error())
 				}
 			}
+			if !tt.wantErr {
+				runs, err := appliancepkg.ListUpgradeHistory(appliancepkg.UpgradeHistoryDir())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(runs) != 1 || runs[0].Command != "complete" || runs[0].Outcome != events.OutcomeSuccess {
+					t.Errorf("expected a successful run in the upgrade history, got %+v", runs)
+				}
+			}
 		})
 	}
 }
 
+func TestUpgradeCompleteScheduleWarningWithEvents(t *testing.T) {
+	t.Setenv(filesystem.AgDataDir, t.TempDir())
+	registry := httpmock.NewRegistry(t)
+	defer registry.Teardown()
+	registry.Serve()
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	f := &factory.Factory{
+		Config: &configuration.Config{
+			URL:                      fmt.Sprintf("http://appgate.com:%d", registry.Port),
+			PrimaryControllerVersion: "5.3.4+24950",
+			// the token is valid at the start, but expires before the maintenance window closes
+			ExpiresAt: time.Now().Add(30 * time.Minute).Round(0).String(),
+		},
+		IOOutWriter: stdout,
+		Stdin:       io.NopCloser(&bytes.Buffer{}),
+		StdErr:      stderr,
+	}
+	f.APIClient = func(c *configuration.Config) (*openapi.APIClient, error) {
+		return registry.Client, nil
+	}
+	f.Appliance = func(c *configuration.Config) (*appliancepkg.Appliance, error) {
+		api, _ := f.APIClient(c)
+		return &appliancepkg.Appliance{
+			APIClient:           api,
+			HTTPClient:          api.GetConfig().HTTPClient,
+			UpgradeStatusWorker: new(mockUpgradeStatus),
+			ApplianceStats:      new(mockApplianceStatus),
+		}, nil
+	}
+	cmd := NewApplianceCmd(f)
+	upgradeCmd := NewUpgradeCmd(f)
+	upgradeCmd.AddCommand(NewUpgradeCompleteCmd(f))
+	cmd.AddCommand(upgradeCmd)
+	cmd.Flags().BoolP("help", "x", false, "")
+	cmd.Flags().Bool("no-interactive", false, "usage")
+	cmd.PersistentFlags().String("actual-hostname", "", "")
+
+	startAt := time.Now().Add(2 * time.Second).Format(time.RFC3339)
+	cmd.SetArgs([]string{"upgrade", "complete", "--no-interactive", "--backup=false", "--output=events", "--start-at", startAt, "--window", "1h"})
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	// there are no appliances to upgrade in the registry, only the output before the upgrade starts is checked
+	cmd.ExecuteC()
+
+	if !strings.Contains(stderr.String(), "WARNING: the sign in token expires before the maintenance window closes") {
+		t.Errorf("expected the schedule warning on stderr, got:\n%s", stderr.String())
+	}
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		if len(line) > 0 && !strings.HasPrefix(line, "{") {
+			t.Errorf("expected only events on stdout, got %q", line)
+		}
+	}
+}
+
 func TestPrintCompleteSummary(t *testing.T) {
 	tests := []struct {
 		name                  string
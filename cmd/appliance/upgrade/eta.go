@@ -0,0 +1,76 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/eta"
+	"github.com/appgate/sdpctl/pkg/tui"
+	log "github.com/sirupsen/logrus"
+)
+
+// upgradeEstimator returns the estimator of the time left of each appliance in the upgrade command,
+// learned from the upgrade history of the host
+func upgradeEstimator(command, host string) *eta.Estimator {
+	runs, err := appliancepkg.ListUpgradeHistory(appliancepkg.UpgradeHistoryDir())
+	if err != nil {
+		log.WithError(err).Warn("Could not read the upgrade history, using the default time estimates")
+	}
+	return appliancepkg.NewUpgradeEstimator(command, host, runs)
+}
+
+// prepareEstimate returns the expected time to prepare n appliances. The next appliance starts downloading when
+// one of the workers has finished downloading, while the verification runs in parallel.
+func prepareEstimate(e *eta.Estimator, n, workers int) time.Duration {
+	if e == nil || n <= 0 {
+		return 0
+	}
+	if workers <= 0 || workers > n {
+		workers = n
+	}
+	rounds := time.Duration((n + workers - 1) / workers)
+	var total time.Duration
+	for _, p := range e.Phases {
+		if p.Name == appliancepkg.PhaseDownloading {
+			total += rounds * p.Duration
+			continue
+		}
+		total += p.Duration
+	}
+	return total
+}
+
+// printEstimate prints the estimated time left of the upgrade from the start of step, skipping the steps which are
+// already done, and reports it to the event stream. The progress bars count down to the estimated end.
+func printEstimate(opts *upgradeCompleteOptions, journal *appliancepkg.UpgradeJournal, step string) {
+	var remaining time.Duration
+	found := false
+	for _, s := range opts.estimates {
+		if s.Name == step {
+			found = true
+		}
+		if found && !journal.StepDone(s.Name) {
+			remaining += s.Duration
+		}
+	}
+	if !found {
+		return
+	}
+	opts.estimatedEnd = time.Now().Add(remaining)
+	fmt.Fprintf(opts.Out, "Estimated time remaining: %s\n", eta.Format(remaining))
+	opts.events.Estimate(remaining)
+}
+
+// newCompleteProgress returns the progress bars of a step, showing the estimated time left of each appliance
+// and of the whole upgrade
+func newCompleteProgress(ctx context.Context, out io.Writer, opts *upgradeCompleteOptions) *tui.Progress {
+	p := tui.New(ctx, out)
+	p.SetEstimator(opts.estimator)
+	if !opts.estimatedEnd.IsZero() {
+		p.AddCountdown("upgrade", opts.estimatedEnd)
+	}
+	return p
+}
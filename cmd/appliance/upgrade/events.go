@@ -0,0 +1,27 @@
+package upgrade
+
+import (
+	"io"
+
+	"github.com/appgate/sdpctl/pkg/events"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/spf13/cobra"
+)
+
+// openEvents opens the event stream for the --output and --events-file flags. When the events are written to
+// stdout, the human readable output and the progress bars are moved to stderr so that stdout only contains events.
+func openEvents(f *factory.Factory, cmd *cobra.Command, output, file string, out *io.Writer) (*events.Stream, error) {
+	stream, err := events.Open(f.IOOutWriter, cmd.CommandPath(), output, file)
+	if err != nil {
+		return nil, err
+	}
+	if stream == nil {
+		// the upgrade history is built from the events, so they are collected even when they are not written anywhere
+		stream = events.NewStream(io.Discard, cmd.CommandPath())
+	}
+	if output == events.OutputEvents {
+		*out = f.StdErr
+		f.SetSpinnerOutput(f.StdErr)
+	}
+	return stream, nil
+}
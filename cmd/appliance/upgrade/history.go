@@ -0,0 +1,221 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/cmdutil"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/events"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// recordHistory starts the upgrade history record of the command, which is built from the events of the stream.
+// It returns nil if there is no host to record the run for.
+func recordHistory(cfg *configuration.Config, command string, stream *events.Stream) *appliancepkg.UpgradeRun {
+	host, err := cfg.GetHost()
+	if err != nil {
+		return nil
+	}
+	run := appliancepkg.NewUpgradeRun(command, host)
+	stream.Listen(run.Record)
+	return run
+}
+
+// finishHistory records the outcome of a run which shares the event stream of another command, such as the upgrade
+// complete of an intermediate version with --multi-hop, and saves it.
+func finishHistory(run *appliancepkg.UpgradeRun, err error) {
+	e := events.Event{Type: events.TypeCommandFinished, Time: time.Now().UTC(), Outcome: events.OutcomeSuccess}
+	if err != nil {
+		e.Outcome, e.Error = events.OutcomeFailed, err.Error()
+		if errors.Is(err, context.Canceled) || errors.Is(err, cmdutil.ErrExecutionCanceledByUser) {
+			e.Outcome = events.OutcomeCanceled
+		}
+	}
+	run.Record(e)
+	saveHistory(run)
+}
+
+// saveHistory writes the record of the run to the upgrade history. A failure is logged, but doesn't fail the command.
+func saveHistory(run *appliancepkg.UpgradeRun) {
+	if run == nil {
+		return
+	}
+	if err := run.Save(appliancepkg.UpgradeHistoryDir()); err != nil {
+		log.WithError(err).Warn("Could not save the upgrade history")
+	}
+}
+
+type upgradeHistoryOptions struct {
+	Out  io.Writer
+	dir  string
+	json bool
+}
+
+// NewUpgradeHistoryCmd return a new upgrade history command
+func NewUpgradeHistoryCmd(f *factory.Factory) *cobra.Command {
+	opts := &upgradeHistoryOptions{
+		Out: f.IOOutWriter,
+		dir: appliancepkg.UpgradeHistoryDir(),
+	}
+	var historyCmd = &cobra.Command{
+		Use:     "history",
+		Short:   docs.ApplianceUpgradeHistoryDoc.Short,
+		Long:    docs.ApplianceUpgradeHistoryDoc.Long,
+		Example: docs.ApplianceUpgradeHistoryDoc.ExampleString(),
+		Args:    cobra.NoArgs,
+		Annotations: map[string]string{
+			"skipAuthCheck": "true",
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			return upgradeHistoryRun(opts)
+		},
+	}
+	historyCmd.PersistentFlags().BoolVar(&opts.json, "json", false, "Display in JSON format")
+
+	var showCmd = &cobra.Command{
+		Use:     "show <run-id>",
+		Short:   docs.ApplianceUpgradeHistoryShowDoc.Short,
+		Long:    docs.ApplianceUpgradeHistoryShowDoc.Long,
+		Example: docs.ApplianceUpgradeHistoryShowDoc.ExampleString(),
+		Args:    cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return upgradeHistoryShowRun(args[0], opts)
+		},
+	}
+	historyCmd.AddCommand(showCmd)
+
+	return historyCmd
+}
+
+func upgradeHistoryRun(opts *upgradeHistoryOptions) error {
+	runs, err := appliancepkg.ListUpgradeHistory(opts.dir)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return util.PrintJSON(opts.Out, runs)
+	}
+	p := util.NewPrinter(opts.Out, 4)
+	p.AddHeader("ID", "Command", "Host", "User", "Started", "Duration", "Outcome", "Version")
+	for _, r := range runs {
+		p.AddLine(r.ID, r.Command, r.Host, r.User, r.StartedAt.Local().Format("2006-01-02 15:04"), formatDuration(r.Duration()), r.Outcome, formatVersions(r))
+	}
+	p.Print()
+	return nil
+}
+
+func upgradeHistoryShowRun(id string, opts *upgradeHistoryOptions) error {
+	r, err := appliancepkg.ReadUpgradeHistory(opts.dir, id)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return util.PrintJSON(opts.Out, r)
+	}
+	p := util.NewPrinter(opts.Out, 4)
+	p.AddLine("ID:", r.ID)
+	p.AddLine("Command:", r.Command)
+	p.AddLine("Host:", r.Host)
+	p.AddLine("User:", r.User)
+	p.AddLine("Started:", r.StartedAt.Local().Format(time.RFC3339))
+	if r.FinishedAt != nil {
+		p.AddLine("Finished:", r.FinishedAt.Local().Format(time.RFC3339))
+		p.AddLine("Duration:", formatDuration(r.Duration()))
+	}
+	p.AddLine("Outcome:", r.Outcome)
+	if len(r.Error) > 0 {
+		p.AddLine("Error:", r.Error)
+	}
+	if v := formatVersions(r); len(v) > 0 {
+		p.AddLine("Version:", v)
+	}
+	p.Print()
+
+	if len(r.Steps) > 0 {
+		fmt.Fprintln(opts.Out, "\nSteps:")
+		p = util.NewPrinter(opts.Out, 4)
+		p.AddHeader("Step", "Outcome", "Started", "Duration", "Error")
+		for _, s := range r.Steps {
+			duration := ""
+			if s.FinishedAt != nil {
+				duration = formatDuration(s.FinishedAt.Sub(s.StartedAt))
+			}
+			p.AddLine(s.Name, s.Outcome, s.StartedAt.Local().Format("15:04:05"), duration, s.Error)
+		}
+		p.Print()
+	}
+
+	if len(r.Appliances) > 0 {
+		fmt.Fprintln(opts.Out, "\nAppliances:")
+		p = util.NewPrinter(opts.Out, 4)
+		p.AddHeader("Appliance", "Outcome", "Duration", "Reason")
+		for _, a := range r.Appliances {
+			p.AddLine(a.Name, a.Outcome, formatDuration(a.Duration()), a.Reason)
+		}
+		p.Print()
+	}
+
+	if hasStatuses(r) {
+		fmt.Fprintln(opts.Out, "\nStatus transitions:")
+		p = util.NewPrinter(opts.Out, 4)
+		p.AddHeader("Appliance", "Status", "Time", "Duration")
+		for _, a := range r.Appliances {
+			for i, s := range a.Statuses {
+				// the time in a status lasts until the next status, or until the appliance finished
+				var end *time.Time
+				if i+1 < len(a.Statuses) {
+					end = &a.Statuses[i+1].Time
+				} else {
+					end = a.FinishedAt
+				}
+				duration := ""
+				if end != nil {
+					duration = formatDuration(end.Sub(s.Time))
+				}
+				p.AddLine(a.Name, s.Status, s.Time.Local().Format("15:04:05"), duration)
+			}
+		}
+		p.Print()
+	}
+
+	if len(r.Summary) > 0 {
+		fmt.Fprintf(opts.Out, "\n%s\n", r.Summary)
+	}
+	return nil
+}
+
+func hasStatuses(r *appliancepkg.UpgradeRun) bool {
+	for _, a := range r.Appliances {
+		if len(a.Statuses) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.Round(time.Second).String()
+}
+
+func formatVersions(r *appliancepkg.UpgradeRun) string {
+	versions := []string{}
+	for _, v := range []string{r.FromVersion, r.ToVersion} {
+		if len(v) > 0 {
+			versions = append(versions, v)
+		}
+	}
+	return strings.Join(versions, " -> ")
+}
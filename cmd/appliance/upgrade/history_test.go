@@ -0,0 +1,112 @@
+package upgrade
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/events"
+	"github.com/appgate/sdpctl/pkg/factory"
+)
+
+func TestUpgradeHistoryCommand(t *testing.T) {
+	t.Setenv("SDPCTL_DATA_DIR", t.TempDir())
+	run := appliance.NewUpgradeRun("complete", "appgate.com")
+	start := time.Now()
+	for _, e := range []events.Event{
+		{Type: events.TypeStepStarted, Step: "primary-controller", Time: start},
+		{Type: events.TypeApplianceStatus, Appliance: "controller", Status: "installing", Time: start},
+		{Type: events.TypeApplianceStatus, Appliance: "controller", Status: "idle", Time: start.Add(4 * time.Minute)},
+		{Type: events.TypeApplianceFinished, Appliance: "controller", Outcome: events.OutcomeSuccess, Time: start.Add(5 * time.Minute)},
+		{Type: events.TypeStepFinished, Step: "primary-controller", Outcome: events.OutcomeSuccess, Time: start.Add(5 * time.Minute)},
+		{Type: events.TypeCommandFinished, Outcome: events.OutcomeSuccess, Time: start.Add(6 * time.Minute)},
+	} {
+		run.Record(e)
+	}
+	run.SetSummary("UPGRADE COMPLETE")
+	if err := run.Save(appliance.UpgradeHistoryDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		want     []string
+		wantJSON bool
+		wantErr  bool
+	}{
+		{
+			name: "list",
+			want: []string{"ID", run.ID, "complete", "appgate.com", "success"},
+		},
+		{
+			name:     "list json",
+			args:     []string{"--json"},
+			wantJSON: true,
+		},
+		{
+			name: "show",
+			args: []string{"show", run.ID},
+			want: []string{run.ID, "primary-controller", "controller", "installing", "4m0s", "idle", "1m0s", "UPGRADE COMPLETE"},
+		},
+		{
+			name:     "show json",
+			args:     []string{"show", run.ID, "--json"},
+			wantJSON: true,
+		},
+		{
+			name:    "show unknown run",
+			args:    []string{"show", "20200101-000000-000000"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			cmd := NewUpgradeHistoryCmd(&factory.Factory{IOOutWriter: stdout})
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+			if _, err := cmd.ExecuteC(); (err != nil) != tt.wantErr {
+				t.Fatalf("TestUpgradeHistoryCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got := stdout.String()
+			for _, w := range tt.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("expected %q in output:\n%s", w, got)
+				}
+			}
+			if tt.wantJSON && !json.Valid(stdout.Bytes()) {
+				t.Errorf("expected JSON output, got:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestFinishHistory(t *testing.T) {
+	t.Setenv("SDPCTL_DATA_DIR", t.TempDir())
+	// the upgrade complete of an intermediate version is recorded from the event stream of prepare
+	stream := events.NewStream(io.Discard, "sdpctl appliance upgrade prepare")
+	hop := appliance.NewUpgradeRun("complete", "appgate.com")
+	stream.Listen(hop.Record)
+	stream.ApplianceFinished("controller", nil)
+	finishHistory(hop, nil)
+
+	runs, err := appliance.ListUpgradeHistory(appliance.UpgradeHistoryDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(runs))
+	}
+	if runs[0].Command != "complete" || runs[0].Outcome != events.OutcomeSuccess || runs[0].FinishedAt == nil {
+		t.Errorf("unexpected run %+v", runs[0])
+	}
+	if len(runs[0].Appliances) != 1 || runs[0].Appliances[0].Outcome != events.OutcomeSuccess {
+		t.Errorf("unexpected appliances %+v", runs[0].Appliances)
+	}
+}
@@ -0,0 +1,70 @@
+package upgrade
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+)
+
+// runHook runs the hooks for the event with the upgrade versions and env in the environment
+func runHook(ctx context.Context, opts *upgradeCompleteOptions, plan *appliancepkg.UpgradePlan, event string, env map[string]string) error {
+	if opts.hooks == nil {
+		return nil
+	}
+	all := map[string]string{}
+	if host, err := opts.Config.GetHost(); err == nil {
+		all["SDPCTL_HOST"] = host
+	}
+	if plan.FromVersion != nil {
+		all["SDPCTL_FROM_VERSION"] = plan.FromVersion.String()
+	}
+	if plan.ToVersion != nil {
+		all["SDPCTL_TO_VERSION"] = plan.ToVersion.String()
+	}
+	for k, v := range env {
+		all[k] = v
+	}
+	return opts.hooks.Run(ctx, event, all)
+}
+
+// applianceHookEnv describes an appliance to the pre-appliance-upgrade and post-appliance-upgrade hooks
+func applianceHookEnv(plan *appliancepkg.UpgradePlan, appliance openapi.Appliance) map[string]string {
+	d := plan.Describe(appliance)
+	env := map[string]string{
+		"SDPCTL_APPLIANCE_ID":             d.ID,
+		"SDPCTL_APPLIANCE_NAME":           d.Name,
+		"SDPCTL_APPLIANCE_HOSTNAME":       appliance.GetHostname(),
+		"SDPCTL_APPLIANCE_SITE":           appliance.GetSite(),
+		"SDPCTL_APPLIANCE_SITE_NAME":      d.Site,
+		"SDPCTL_APPLIANCE_FUNCTIONS":      strings.Join(d.Functions, ","),
+		"SDPCTL_APPLIANCE_VERSION":        d.CurrentVersion,
+		"SDPCTL_APPLIANCE_TARGET_VERSION": d.TargetVersion,
+	}
+	if len(d.CurrentVersion) <= 0 && plan.FromVersion != nil {
+		env["SDPCTL_APPLIANCE_VERSION"] = plan.FromVersion.String()
+	}
+	if len(d.TargetVersion) <= 0 && plan.ToVersion != nil {
+		env["SDPCTL_APPLIANCE_TARGET_VERSION"] = plan.ToVersion.String()
+	}
+	return env
+}
+
+// batchHookEnv describes a batch to the pre-batch and post-batch hooks
+func batchHookEnv(plan *appliancepkg.UpgradePlan, index int, appliances []openapi.Appliance) map[string]string {
+	names := make([]string, 0, len(appliances))
+	ids := make([]string, 0, len(appliances))
+	for _, a := range appliances {
+		names = append(names, a.GetName())
+		ids = append(ids, a.GetId())
+	}
+	return map[string]string{
+		"SDPCTL_BATCH":           strconv.Itoa(index + 1),
+		"SDPCTL_BATCH_COUNT":     strconv.Itoa(len(plan.Batches)),
+		"SDPCTL_BATCH_LABEL":     plan.Batch(index).Label,
+		"SDPCTL_APPLIANCE_NAMES": strings.Join(names, ","),
+		"SDPCTL_APPLIANCE_IDS":   strings.Join(ids, ","),
+	}
+}
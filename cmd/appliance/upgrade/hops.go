@@ -0,0 +1,152 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/hooks"
+	imagepkg "github.com/appgate/sdpctl/pkg/image"
+	"github.com/appgate/sdpctl/pkg/prompt"
+	"github.com/hashicorp/go-version"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// primaryControllerVersion returns the version running on the primary controller
+func primaryControllerVersion(ctx context.Context, a *appliancepkg.Appliance, cfg *configuration.Config) (*version.Version, error) {
+	appliances, err := a.List(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	host, err := cfg.GetHost()
+	if err != nil {
+		return nil, err
+	}
+	primaryController, err := appliancepkg.FindPrimaryController(appliances, host)
+	if err != nil {
+		return nil, err
+	}
+	stats, _, err := a.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return appliancepkg.GetApplianceVersion(*primaryController, *stats)
+}
+
+func formatUpgradePath(from *version.Version, hops []*version.Version) string {
+	path := []string{from.String()}
+	for _, h := range hops {
+		path = append(path, h.String())
+	}
+	return strings.Join(path, " -> ")
+}
+
+// upgradeHops checks that the primary controller can be upgraded directly to the version of the upgrade image. If it
+// can't, and --multi-hop is used, a complete prepare and complete cycle is run for each intermediate version, using the
+// images in the image store. The appliance client is created again after each upgrade, since the config is updated with
+// the peer API version of the new primary controller version.
+func upgradeHops(ctx context.Context, cmd *cobra.Command, args []string, opts *prepareUpgradeOptions, a *appliancepkg.Appliance) (*appliancepkg.Appliance, error) {
+	target, err := appliancepkg.ParseVersionString(opts.filename)
+	if err != nil {
+		return a, nil
+	}
+	current, err := primaryControllerVersion(ctx, a, opts.Config)
+	if err != nil {
+		return nil, err
+	}
+	if appliancepkg.CanUpgradeDirectly(current, target) {
+		return a, nil
+	}
+	if opts.ignoreUpgradePath && !opts.multiHop {
+		fmt.Fprintf(opts.Out, "WARNING: Upgrading from %s to %s is not a supported direct upgrade according to sdpctl, continuing because of --ignore-upgrade-path\n", current.String(), target.String())
+		return a, nil
+	}
+
+	store, err := imagepkg.NewStore(imagepkg.DefaultStoreDir())
+	if err != nil {
+		return nil, err
+	}
+	images, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	available := []*version.Version{}
+	byVersion := map[string]imagepkg.StoreImage{}
+	for _, i := range images {
+		v, err := i.ParsedVersion()
+		if err != nil {
+			continue
+		}
+		// images are sorted with the highest build number first
+		if _, ok := byVersion[v.String()]; !ok {
+			byVersion[v.String()] = i
+			available = append(available, v)
+		}
+	}
+	hops, err := appliancepkg.PlanUpgradePath(current, target, available)
+	if err != nil {
+		return nil, fmt.Errorf("%w, use 'sdpctl image add' or 'sdpctl image pull' to add it to the image store", err)
+	}
+	path := formatUpgradePath(current, hops)
+	if !opts.multiHop {
+		return nil, fmt.Errorf("Upgrading from %s to %s is not supported directly, the upgrade path is %s. Use --multi-hop to upgrade through the intermediate versions, or --ignore-upgrade-path if the upgrade is known to be supported", current.String(), target.String(), path)
+	}
+
+	fmt.Fprintf(opts.Out, "\nUpgrading from %s to %s requires %d upgrades: %s\n", current.String(), target.String(), len(hops), path)
+	fmt.Fprintf(opts.Out, "Each intermediate upgrade will be prepared and completed before the appliances are prepared for %s\n", opts.filename)
+	if !opts.NoInteractive {
+		if err := prompt.AskConfirmation(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, hop := range hops[:len(hops)-1] {
+		image := byVersion[hop.String()]
+		hopOpts := *opts
+		hopOpts.image = store.Path(image)
+		hopOpts.verify = imagepkg.VerifyOptions{SHA256: image.SHA256, Keyring: opts.verify.Keyring, SkipSignature: opts.verify.SkipSignature}
+		hopOpts.remoteImage = false
+		hopOpts.hostOnController = false
+		hopOpts.multiHop = false
+		if err := checkImage(&hopOpts); err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(opts.Out, "\n[%s] Upgrade %d / %d: %s\n", time.Now().Format(time.RFC3339), i+1, len(hops), hop.String())
+		if err := prepareUpgrade(cmd, args, &hopOpts); err != nil {
+			return nil, fmt.Errorf("Failed to prepare the upgrade to %s: %w", hop.String(), err)
+		}
+		// the intermediate upgrade is completed with the defaults of 'upgrade complete', in the output and event stream of prepare
+		completeOpts := opts.completeOptions()
+		completeOpts.Out = opts.Out
+		completeOpts.NoInteractive = opts.NoInteractive
+		completeOpts.ciMode = opts.ciMode
+		completeOpts.notifier = opts.notifier
+		completeOpts.events = opts.events
+		completeOpts.report = appliancepkg.NewUpgradeReport()
+		if completeOpts.hooks, err = hooks.New(opts.Config.Hooks, nil); err != nil {
+			return nil, err
+		}
+		completeOpts.history = recordHistory(opts.Config, "complete", opts.events)
+		err = upgradeComplete(cmd, args, &completeOpts)
+		finishHistory(completeOpts.history, err)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to complete the upgrade to %s: %w", hop.String(), err)
+		}
+
+		// the upgrade complete has updated the primary controller version and the peer API version in the config
+		if a, err = opts.Appliance(opts.Config); err != nil {
+			return nil, err
+		}
+		log.WithFields(log.Fields{
+			"primary_controller_version": opts.Config.PrimaryControllerVersion,
+			"api_version":                opts.Config.Version,
+		}).Info("Using the peer API version of the upgraded primary controller")
+	}
+	fmt.Fprintf(opts.Out, "\n[%s] Upgrade %d / %d: %s\n", time.Now().Format(time.RFC3339), len(hops), len(hops), target.String())
+	return a, nil
+}
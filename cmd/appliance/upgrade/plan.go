@@ -0,0 +1,165 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+type upgradePlanOptions struct {
+	Config         *configuration.Config
+	Out            io.Writer
+	Appliance      func(c *configuration.Config) (*appliancepkg.Appliance, error)
+	debug          bool
+	output         string
+	actualHostname string
+	planFile       string
+	canary         int
+	maxUnavailable appliancepkg.MaxUnavailable
+	defaultFilter  map[string]map[string]string
+}
+
+// NewUpgradePlanCmd return a new upgrade plan command
+func NewUpgradePlanCmd(f *factory.Factory) *cobra.Command {
+	opts := upgradePlanOptions{
+		Config:    f.Config,
+		Appliance: f.Appliance,
+		debug:     f.Config.Debug,
+		Out:       f.IOOutWriter,
+		output:    outputJSON,
+		defaultFilter: map[string]map[string]string{
+			"include": {},
+			"exclude": {
+				"active": "false",
+			},
+		},
+	}
+	var maxUnavailable string
+	var upgradePlanCmd = &cobra.Command{
+		Use:     "plan",
+		Short:   docs.ApplianceUpgradePlanDoc.Short,
+		Long:    docs.ApplianceUpgradePlanDoc.Long,
+		Example: docs.ApplianceUpgradePlanDoc.ExampleString(),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if opts.output != outputJSON && opts.output != outputYAML {
+				return fmt.Errorf("invalid output format %q, must be one of %s or %s", opts.output, outputJSON, outputYAML)
+			}
+			if opts.canary < 0 {
+				return errors.New("--canary can't be negative")
+			}
+			var err error
+			if opts.maxUnavailable, err = appliancepkg.ParseMaxUnavailable(maxUnavailable); err != nil {
+				return fmt.Errorf("--max-unavailable: %w", err)
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			return upgradePlanRun(c, args, &opts)
+		},
+	}
+
+	flags := upgradePlanCmd.Flags()
+	flags.StringVarP(&opts.output, "output", "o", opts.output, "output format, json or yaml")
+	flags.StringVar(&opts.planFile, "plan", "", "path to an upgrade plan file with ordered stages for the additional appliances")
+	flags.IntVar(&opts.canary, "canary", 0, "number of appliances of each site and function group to upgrade first as canaries")
+	flags.StringVar(&maxUnavailable, "max-unavailable", "", "maximum number or percentage of appliances of each site and function which are upgraded at the same time, such as 1 or 25%")
+	flags.StringVar(&opts.actualHostname, "actual-hostname", "", "If the actual hostname is different from that which you are connecting to the appliance admin API, this flag can be used for setting the actual hostname.")
+
+	return upgradePlanCmd
+}
+
+func upgradePlanRun(cmd *cobra.Command, args []string, opts *upgradePlanOptions) error {
+	cfg := opts.Config
+	a, err := opts.Appliance(cfg)
+	if err != nil {
+		return err
+	}
+	var planFile *appliancepkg.UpgradePlanFile
+	if len(opts.planFile) > 0 {
+		if planFile, err = appliancepkg.ReadUpgradePlanFile(opts.planFile); err != nil {
+			return err
+		}
+	}
+	ctx := context.Background()
+	filter := util.ParseFilteringFlags(cmd.Flags(), opts.defaultFilter)
+	rawAppliances, err := a.List(ctx, nil)
+	if err != nil {
+		return err
+	}
+	host, err := cfg.GetHost()
+	if err != nil {
+		return err
+	}
+	controlHost := host
+	if len(opts.actualHostname) > 0 {
+		controlHost = opts.actualHostname
+	}
+	primaryController, err := appliancepkg.FindPrimaryController(rawAppliances, controlHost)
+	if err != nil {
+		return err
+	}
+	allAppliances := appliancepkg.FilterAppliances(rawAppliances, filter)
+	stats, _, err := a.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	appliances, offline, err := appliancepkg.FilterAvailable(allAppliances, stats.GetData())
+	if err != nil {
+		return fmt.Errorf("Could not plan upgrade %w", err)
+	}
+
+	plan, err := appliancepkg.NewUpgradePlan(ctx, a, appliances, *primaryController, *stats)
+	if err != nil {
+		return err
+	}
+	for _, o := range offline {
+		plan.Skip(o, appliancepkg.SkipReasonOffline)
+	}
+	for _, raw := range rawAppliances {
+		if raw.GetId() == primaryController.GetId() {
+			continue
+		}
+		if !util.InSlice(raw.GetId(), applianceIDs(allAppliances)) {
+			plan.Skip(raw, appliancepkg.SkipReasonFiltered)
+		}
+	}
+	if planFile != nil {
+		if err := plan.ApplyStages(planFile); err != nil {
+			return fmt.Errorf("Could not apply upgrade plan %s: %w", opts.planFile, err)
+		}
+	}
+	plan.ApplyMaxUnavailable(opts.maxUnavailable)
+	if err := plan.ApplyCanary(opts.canary); err != nil {
+		return err
+	}
+	log.WithField("batches", len(plan.Batches)).Info("computed upgrade plan")
+
+	output := plan.Output(host)
+	if opts.output == outputYAML {
+		return util.PrintYAML(opts.Out, output)
+	}
+	return util.PrintJSON(opts.Out, output)
+}
+
+func applianceIDs(appliances []openapi.Appliance) []string {
+	ids := make([]string, 0, len(appliances))
+	for _, a := range appliances {
+		ids = append(ids, a.GetId())
+	}
+	return ids
+}
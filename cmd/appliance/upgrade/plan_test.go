@@ -0,0 +1,146 @@
+package upgrade
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/httpmock"
+	"gopkg.in/yaml.v3"
+)
+
+func TestUpgradePlanCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		gatewayStatus string
+		planFile      string
+		unmarshal     func([]byte, interface{}) error
+		wantStages    []string
+		wantSkipped   []string
+		wantLabel     string
+		wantErr       bool
+	}{
+		{
+			name:          "json plan",
+			args:          []string{},
+			gatewayStatus: "../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json",
+			unmarshal:     json.Unmarshal,
+			wantStages:    []string{appliancepkg.StagePrimaryController, "batch-1"},
+			wantSkipped:   []string{},
+		},
+		{
+			name:          "yaml plan with skipped gateway",
+			args:          []string{"--output", "yaml"},
+			gatewayStatus: "../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json",
+			unmarshal:     yaml.Unmarshal,
+			wantStages:    []string{appliancepkg.StagePrimaryController},
+			wantSkipped:   []string{"upgrade status is idle"},
+		},
+		{
+			name:          "with plan file",
+			gatewayStatus: "../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json",
+			planFile: `
+stages:
+  - name: gateways
+    include:
+      function: gateway
+    max-parallel: 1
+`,
+			unmarshal:   json.Unmarshal,
+			wantStages:  []string{appliancepkg.StagePrimaryController, "batch-1"},
+			wantSkipped: []string{},
+			wantLabel:   "gateways",
+		},
+		{
+			name:    "invalid output format",
+			args:    []string{"--output", "xml"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := httpmock.NewRegistry(t)
+			if !tt.wantErr {
+				registry.Register("/appliances", httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"))
+				registry.Register("/stats/appliances", httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"))
+				registry.Register("/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade", httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_ready.json"))
+				registry.Register("/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade", httpmock.JSONResponse(tt.gatewayStatus))
+			}
+			defer registry.Teardown()
+			registry.Serve()
+
+			stdout := &bytes.Buffer{}
+			f := &factory.Factory{
+				Config: &configuration.Config{
+					Debug: false,
+					URL:   fmt.Sprintf("http://appgate.com:%d", registry.Port),
+				},
+				IOOutWriter: stdout,
+			}
+			f.APIClient = func(c *configuration.Config) (*openapi.APIClient, error) {
+				return registry.Client, nil
+			}
+			f.Appliance = func(c *configuration.Config) (*appliancepkg.Appliance, error) {
+				api, _ := f.APIClient(c)
+				return &appliancepkg.Appliance{
+					APIClient:  api,
+					HTTPClient: api.GetConfig().HTTPClient,
+				}, nil
+			}
+			cmd := NewUpgradePlanCmd(f)
+			args := tt.args
+			if len(tt.planFile) > 0 {
+				path := filepath.Join(t.TempDir(), "plan.yaml")
+				if err := os.WriteFile(path, []byte(tt.planFile), 0600); err != nil {
+					t.Fatalf("internal testing error: %s", err)
+				}
+				args = append(args, "--plan", path)
+			}
+			cmd.SetArgs(args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			_, err := cmd.ExecuteC()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TestUpgradePlanCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var got appliancepkg.UpgradePlanOutput
+			if err := tt.unmarshal(stdout.Bytes(), &got); err != nil {
+				t.Fatalf("failed to parse output %s\n%s", err, stdout.String())
+			}
+			stages := []string{}
+			for _, s := range got.Stages {
+				stages = append(stages, s.Name)
+			}
+			if fmt.Sprint(stages) != fmt.Sprint(tt.wantStages) {
+				t.Errorf("wrong stages, want %v, got %v", tt.wantStages, stages)
+			}
+			reasons := []string{}
+			for _, s := range got.Skipped {
+				reasons = append(reasons, s.Reason)
+			}
+			if fmt.Sprint(reasons) != fmt.Sprint(tt.wantSkipped) {
+				t.Errorf("wrong skip reasons, want %v, got %v", tt.wantSkipped, reasons)
+			}
+			if len(got.Stages) > 0 && got.Stages[0].Appliances[0].TargetVersion == "" {
+				t.Error("expected target version for primary controller")
+			}
+			if last := got.Stages[len(got.Stages)-1]; last.Label != tt.wantLabel {
+				t.Errorf("wrong label on last stage, want %q, got %q", tt.wantLabel, last.Label)
+			}
+		})
+	}
+}
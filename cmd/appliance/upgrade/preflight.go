@@ -0,0 +1,108 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/cmdutil"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type upgradePreflightOptions struct {
+	Config         *configuration.Config
+	Out            io.Writer
+	Appliance      func(c *configuration.Config) (*appliancepkg.Appliance, error)
+	debug          bool
+	json           bool
+	actualHostname string
+	defaultFilter  map[string]map[string]string
+}
+
+// NewUpgradePreflightCmd return a new upgrade preflight command
+func NewUpgradePreflightCmd(f *factory.Factory) *cobra.Command {
+	opts := upgradePreflightOptions{
+		Config:    f.Config,
+		Appliance: f.Appliance,
+		debug:     f.Config.Debug,
+		Out:       f.IOOutWriter,
+		defaultFilter: map[string]map[string]string{
+			"include": {},
+			"exclude": {
+				"active": "false",
+			},
+		},
+	}
+	var upgradePreflightCmd = &cobra.Command{
+		Use:     "preflight",
+		Short:   docs.ApplianceUpgradePreflightDoc.Short,
+		Long:    docs.ApplianceUpgradePreflightDoc.Long,
+		Example: docs.ApplianceUpgradePreflightDoc.ExampleString(),
+		RunE: func(c *cobra.Command, args []string) error {
+			return upgradePreflightRun(c, args, &opts)
+		},
+	}
+
+	flags := upgradePreflightCmd.Flags()
+	flags.BoolVar(&opts.json, "json", false, "Display in JSON format")
+	flags.StringVar(&opts.actualHostname, "actual-hostname", "", "If the actual hostname is different from that which you are connecting to the appliance admin API, this flag can be used for setting the actual hostname.")
+
+	return upgradePreflightCmd
+}
+
+func upgradePreflightRun(cmd *cobra.Command, args []string, opts *upgradePreflightOptions) error {
+	cfg := opts.Config
+	a, err := opts.Appliance(cfg)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	filter := util.ParseFilteringFlags(cmd.Flags(), opts.defaultFilter)
+	rawAppliances, err := a.List(ctx, nil)
+	if err != nil {
+		return err
+	}
+	host, err := cfg.GetHost()
+	if err != nil {
+		return err
+	}
+	if len(opts.actualHostname) > 0 {
+		host = opts.actualHostname
+	}
+	stats, _, err := a.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	report := appliancepkg.Preflight(rawAppliances, appliancepkg.FilterAppliances(rawAppliances, filter), stats.GetData(), host)
+	if opts.json {
+		if err := util.PrintJSON(opts.Out, report); err != nil {
+			return err
+		}
+	} else {
+		p := util.NewPrinter(opts.Out, 4)
+		p.AddHeader("Check", "Status", "Details")
+		for _, c := range report.Checks {
+			details := c.Message
+			if len(c.Appliances) > 0 {
+				details = fmt.Sprintf("%s: %s", details, strings.Join(c.Appliances, ", "))
+			}
+			p.AddLine(c.Name, strings.ToUpper(c.Status), details)
+		}
+		p.Print()
+	}
+
+	switch report.Status {
+	case appliancepkg.PreflightFail:
+		return cmdutil.ErrPreflightFailed
+	case appliancepkg.PreflightWarn:
+		return cmdutil.ErrPreflightWarning
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package upgrade
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/cmdutil"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/httpmock"
+)
+
+func TestUpgradePreflightCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		appliances  string
+		stats       string
+		wantErr     error
+		wantOut     *regexp.Regexp
+		wantResults map[string]string
+	}{
+		{
+			name:       "controller on peer interface",
+			appliances: "../../../pkg/appliance/fixtures/appliance_list.json",
+			stats:      "../../../pkg/appliance/fixtures/stats_appliance.json",
+			wantErr:    cmdutil.ErrPreflightWarning,
+			wantOut:    regexp.MustCompile(`(?s)Offline appliances\s+PASS\s+all appliances are online.*Admin interface\s+WARN\s+still using the deprecated peer port 444`),
+		},
+		{
+			name:       "offline controller in json",
+			args:       []string{"--json"},
+			appliances: "../../../pkg/appliance/fixtures/two_controller_one_offline.json",
+			stats:      "../../../pkg/appliance/fixtures/appliance_stats_offline_controller.json",
+			wantErr:    cmdutil.ErrPreflightFailed,
+			wantResults: map[string]string{
+				"Primary controller": appliancepkg.PreflightPass,
+				"Offline appliances": appliancepkg.PreflightFail,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := httpmock.NewRegistry(t)
+			registry.Register("/appliances", httpmock.JSONResponse(tt.appliances))
+			registry.Register("/stats/appliances", httpmock.JSONResponse(tt.stats))
+			defer registry.Teardown()
+			registry.Serve()
+
+			stdout := &bytes.Buffer{}
+			f := &factory.Factory{
+				Config: &configuration.Config{
+					Debug: false,
+					URL:   fmt.Sprintf("http://appgate.com:%d", registry.Port),
+				},
+				IOOutWriter: stdout,
+			}
+			f.APIClient = func(c *configuration.Config) (*openapi.APIClient, error) {
+				return registry.Client, nil
+			}
+			f.Appliance = func(c *configuration.Config) (*appliancepkg.Appliance, error) {
+				api, _ := f.APIClient(c)
+				return &appliancepkg.Appliance{
+					APIClient:  api,
+					HTTPClient: api.GetConfig().HTTPClient,
+				}, nil
+			}
+			cmd := NewUpgradePreflightCmd(f)
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			_, err := cmd.ExecuteC()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TestUpgradePreflightCommand() error = %v, wantErr %v\n%s", err, tt.wantErr, stdout.String())
+			}
+			if tt.wantOut != nil && !tt.wantOut.Match(stdout.Bytes()) {
+				t.Errorf("Expected output to match, expected:\n%s\n got: \n%s\n", tt.wantOut, stdout.String())
+			}
+			if tt.wantResults == nil {
+				return
+			}
+			var report appliancepkg.PreflightReport
+			if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+				t.Fatalf("failed to parse output %s\n%s", err, stdout.String())
+			}
+			if report.Status != appliancepkg.PreflightFail {
+				t.Errorf("expected report status %s, got %s", appliancepkg.PreflightFail, report.Status)
+			}
+			for _, c := range report.Checks {
+				if want, ok := tt.wantResults[c.Name]; ok && c.Status != want {
+					t.Errorf("check %q: want %s, got %s: %s", c.Name, want, c.Status, c.Message)
+				}
+			}
+		})
+	}
+}
@@ -7,7 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
@@ -23,12 +23,17 @@ import (
 	"github.com/appgate/sdpctl/pkg/cmdutil"
 	"github.com/appgate/sdpctl/pkg/configuration"
 	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/eta"
+	"github.com/appgate/sdpctl/pkg/events"
 	"github.com/appgate/sdpctl/pkg/factory"
+	imagepkg "github.com/appgate/sdpctl/pkg/image"
+	"github.com/appgate/sdpctl/pkg/notify"
 	"github.com/appgate/sdpctl/pkg/prompt"
 	"github.com/appgate/sdpctl/pkg/queue"
 	"github.com/appgate/sdpctl/pkg/terminal"
 	"github.com/appgate/sdpctl/pkg/tui"
 	"github.com/appgate/sdpctl/pkg/util"
+	"github.com/cenkalti/backoff/v4"
 	multierr "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-version"
 	log "github.com/sirupsen/logrus"
@@ -38,21 +43,35 @@ import (
 )
 
 type prepareUpgradeOptions struct {
-	Config           *configuration.Config
-	Out              io.Writer
-	Appliance        func(c *configuration.Config) (*appliancepkg.Appliance, error)
-	SpinnerOut       func() io.Writer
-	debug            bool
-	NoInteractive    bool
-	image            string
-	DevKeyring       bool
-	remoteImage      bool
-	filename         string
-	timeout          time.Duration
-	defaultFilter    map[string]map[string]string
-	hostOnController bool
-	forcePrepare     bool
-	ciMode           bool
+	Config            *configuration.Config
+	Out               io.Writer
+	Appliance         func(c *configuration.Config) (*appliancepkg.Appliance, error)
+	SpinnerOut        func() io.Writer
+	debug             bool
+	NoInteractive     bool
+	image             string
+	DevKeyring        bool
+	verify            imagepkg.VerifyOptions
+	version           string
+	latestPatch       bool
+	multiHop          bool
+	ignoreUpgradePath bool
+	HTTPClient        func() (*http.Client, error)
+	completeOptions   func() upgradeCompleteOptions
+	remoteImage       bool
+	filename          string
+	timeout           time.Duration
+	defaultFilter     map[string]map[string]string
+	hostOnController  bool
+	forcePrepare      bool
+	ciMode            bool
+	notifier          *notify.Notifier
+	events            *events.Stream
+	history           *appliancepkg.UpgradeRun
+	estimator         *eta.Estimator
+	estimatedEnd      time.Time
+	output            string
+	eventsFile        string
 }
 
 // NewPrepareUpgradeCmd return a new prepare upgrade command
@@ -64,7 +83,11 @@ func NewPrepareUpgradeCmd(f *factory.Factory) *cobra.Command {
 		debug:      f.Config.Debug,
 		Out:        f.IOOutWriter,
 		SpinnerOut: f.GetSpinnerOutput(),
-		timeout:    DefaultTimeout,
+		HTTPClient: f.HTTPClient,
+		completeOptions: func() upgradeCompleteOptions {
+			return newUpgradeCompleteOptions(f)
+		},
+		timeout: DefaultTimeout,
 		defaultFilter: map[string]map[string]string{
 			"include": {},
 			"exclude": {
@@ -78,8 +101,17 @@ func NewPrepareUpgradeCmd(f *factory.Factory) *cobra.Command {
 		Long:    docs.ApplianceUpgradePrepareDoc.Long,
 		Example: docs.ApplianceUpgradePrepareDoc.ExampleString(),
 		Args: func(cmd *cobra.Command, args []string) error {
-			if len(opts.image) < 1 {
-				return errors.New("--image is mandatory")
+			selected := 0
+			for _, set := range []bool{len(opts.image) > 0, len(opts.version) > 0, opts.latestPatch} {
+				if set {
+					selected++
+				}
+			}
+			if selected < 1 {
+				return errors.New("--image is mandatory, unless --version or --latest-patch is used to select an image from the image store")
+			}
+			if selected > 1 {
+				return errors.New("only one of --image, --version and --latest-patch can be used")
 			}
 			minTimeout := 15 * time.Minute
 			flagTimeout, err := cmd.Flags().GetDuration("timeout")
@@ -91,41 +123,22 @@ func NewPrepareUpgradeCmd(f *factory.Factory) *cobra.Command {
 			} else {
 				opts.timeout = flagTimeout
 			}
-			var errs error
-			opts.filename = filepath.Base(opts.image)
-			if err := checkImageFilename(opts.filename); err != nil {
-				errs = multierr.Append(errs, err)
-			}
-
-			// allow remote addr for image, such as aws s3 bucket
-			if util.IsValidURL(opts.image) {
-				opts.remoteImage = true
-				// if the file is a remote image URL, derive the filename from
-				// standard lib 'path' instead of 'filepath' to avoid trailing URI elements
-
-				// we can skip error check here since we already validated that its a url
-				u, _ := url.Parse(opts.image)
-				// remove any query string, and leave us only with the filename
-				u.RawQuery = ""
-				opts.filename = path.Base(u.String())
-			}
-			if !opts.remoteImage {
-				// if the image is a local file, make sure its readable
-				// make early return if not
-				ok, err := util.FileExists(opts.image)
+			if len(opts.version) > 0 {
+				v, err := appliancepkg.ParseVersionString(opts.version)
 				if err != nil {
-					return err
-				}
-				if !ok {
-					errs = multierr.Append(errs, fmt.Errorf("Image file not found %q", opts.image))
+					return fmt.Errorf("invalid --version %q: %w", opts.version, err)
 				}
-				if ok {
-					_, err := zip.OpenReader(opts.image)
-					if err != nil {
-						errs = multierr.Append(errs, err)
-					}
+				if err := useStoreImage(opts, func(store *imagepkg.Store) (*imagepkg.StoreImage, error) {
+					return store.Find(v)
+				}); err != nil {
+					return err
 				}
 			}
+			var errs error
+			// with --latest-patch, the image is selected and checked once the current version is known
+			if !opts.latestPatch {
+				errs = checkImage(opts)
+			}
 
 			ciModeFlag, err := cmd.Flags().GetBool("ci-mode")
 			if err != nil {
@@ -136,6 +149,14 @@ func NewPrepareUpgradeCmd(f *factory.Factory) *cobra.Command {
 			return errs
 		},
 		RunE: func(c *cobra.Command, args []string) error {
+			stream, err := openEvents(f, c, opts.output, opts.eventsFile, &opts.Out)
+			if err != nil {
+				return err
+			}
+			defer stream.Close()
+			opts.events = stream
+			opts.history = recordHistory(opts.Config, c.Name(), stream)
+			defer saveHistory(opts.history)
 			return prepareRun(c, args, opts)
 		},
 	}
@@ -143,14 +164,202 @@ func NewPrepareUpgradeCmd(f *factory.Factory) *cobra.Command {
 	flags := prepareCmd.Flags()
 	flags.BoolVar(&opts.NoInteractive, "no-interactive", false, "suppress interactive prompt with auto accept")
 	flags.StringVarP(&opts.image, "image", "", "", "Upgrade image file or URL")
+	flags.StringVar(&opts.version, "version", "", "Use the upgrade image with this version from the image store, see 'sdpctl image'")
+	flags.BoolVar(&opts.latestPatch, "latest-patch", false, "Use the latest patch release for the version of the primary controller from the image store, see 'sdpctl image'")
+	flags.BoolVar(&opts.ignoreUpgradePath, "ignore-upgrade-path", false, "warn instead of failing when sdpctl doesn't know the upgrade image to be supported directly")
+	flags.BoolVar(&opts.multiHop, "multi-hop", false, "Upgrade through the intermediate versions from the image store when the upgrade image can't be upgraded to directly")
 	flags.BoolVar(&opts.DevKeyring, "dev-keyring", false, "Use the development keyring to verify the upgrade image")
+	flags.StringVar(&opts.verify.SHA256, "sha256", "", "expected sha256 checksum of the upgrade image")
+	flags.StringVar(&opts.verify.Signature, "signature", "", "path to the detached signature of the upgrade image, defaults to <image>.sig or <image>.asc if it exists")
+	flags.StringVar(&opts.verify.Keyring, "keyring", "", "path to the keyring used to verify the signature, defaults to the release or dev keyring in the sdpctl config directory")
+	flags.BoolVar(&opts.verify.SkipSignature, "skip-signature", false, "accept an image without a detached signature, even if the keyring is installed")
 	flags.Int("throttle", 5, "Upgrade is done in batches using a throttle value. You can control the throttle using this flag.")
 	flags.BoolVar(&opts.hostOnController, "host-on-controller", false, "Use primary controller as image host when uploading from remote source.")
 	flags.BoolVar(&opts.forcePrepare, "force", false, "force prepare of upgrade on appliances even though the version uploaded is the same or lower then the version already running on the appliance")
+	flags.StringVar(&opts.output, "output", "", "use 'events' to write a JSON lines event stream to stdout, the regular output is written to stderr")
+	flags.StringVar(&opts.eventsFile, "events-file", "", "append a JSON lines event stream to this file")
 
 	return prepareCmd
 }
 
+// uploadImage streams the upgrade image to the primary controller. A failed upload is retried with a new body
+// streamed from disk, unless the controller reports that the complete file already arrived during the failed attempt.
+// This is not a resumed upload: PUT /files has no offset or range, so each retry reads and sends the whole image.
+func uploadImage(ctx context.Context, a *appliancepkg.Appliance, upload *appliancepkg.MultipartFile, spinnerOut io.Writer, ciMode bool) error {
+	headers := map[string]string{
+		"Content-Type":        upload.ContentType(),
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", upload.Name()),
+	}
+
+	var (
+		uploadProgress *mpb.Progress
+		bar            *mpb.Bar
+		waitSpinner    *mpb.Bar
+	)
+	if !ciMode {
+		uploadProgress = mpb.New(mpb.WithOutput(spinnerOut))
+		defer uploadProgress.Wait()
+		barName := upload.Name() + ":"
+		// the bar is created without a total, so that it won't complete when a failed attempt
+		// has sent the whole body. The total is set right away and the bar is completed manually.
+		bar = uploadProgress.AddBar(0,
+			mpb.BarWidth(50),
+			mpb.BarFillerOnComplete("uploaded"),
+			mpb.PrependDecorators(
+				decor.Spinner(tui.SpinnerStyle, decor.WC{W: 2}),
+				decor.Name(barName, decor.WC{W: len(barName) + 1}),
+			),
+			mpb.AppendDecorators(
+				decor.OnComplete(decor.CountersKibiByte("% .2f / % .2f"), ""),
+				decor.OnComplete(decor.Name(" | "), ""),
+				decor.OnComplete(decor.AverageSpeed(decor.UnitKiB, "% .2f"), ""),
+			),
+		)
+		bar.SetTotal(upload.ContentLength(), false)
+		waitSpinner = tui.AddDefaultSpinner(
+			uploadProgress,
+			upload.Name(),
+			"waiting for server ok",
+			"upload complete",
+			mpb.BarQueueAfter(bar, false),
+		)
+	}
+
+	attempt := 0
+	operation := func() error {
+		attempt++
+		logEntry := log.WithFields(log.Fields{"file": upload.Name(), "attempt": attempt})
+		if attempt > 1 {
+			// the controller may have received the whole file even though the request failed, such as when
+			// the connection drops while waiting for the response. There is no need to send it again in that case.
+			if existing, err := a.FileStatus(ctx, upload.Name()); err == nil && existing.GetStatus() == appliancepkg.FileReady {
+				logEntry.Info("File already uploaded, skipping retry")
+				return nil
+			}
+			logEntry.Warn("Retrying upload")
+		}
+
+		body := upload.Reader()
+		defer body.Close()
+		var r io.Reader = body
+		if bar != nil {
+			bar.SetCurrent(0)
+			r = bar.ProxyReader(body)
+		}
+		logEntry.Info("Uploading file")
+		if err := a.UploadFile(ctx, r, upload.ContentLength(), headers); err != nil {
+			logEntry.WithError(err).Warn("Upload failed")
+			if errors.Is(err, context.Canceled) {
+				return backoff.Permanent(err)
+			}
+			var uploadErr *appliancepkg.UploadError
+			if errors.As(err, &uploadErr) && !uploadErr.Temporary() {
+				return backoff.Permanent(err)
+			}
+			return err
+		}
+		return nil
+	}
+
+	b := backoff.WithContext(backoff.WithMaxRetries(&backoff.ExponentialBackOff{
+		InitialInterval:     5 * time.Second,
+		RandomizationFactor: 0.5,
+		Multiplier:          2,
+		MaxInterval:         time.Minute,
+		MaxElapsedTime:      0,
+		Stop:                backoff.Stop,
+		Clock:               backoff.SystemClock,
+	}, uploadRetries), ctx)
+	if err := backoff.Retry(operation, b); err != nil {
+		if bar != nil {
+			bar.Abort(false)
+			waitSpinner.Abort(false)
+		}
+		return err
+	}
+	if bar != nil {
+		bar.SetTotal(-1, true)
+		waitSpinner.Increment()
+	}
+	return nil
+}
+
+// uploadRetries is the number of times a failed image upload is retried
+const uploadRetries = 3
+
+// useStoreImage selects the upgrade image from the local image store
+func useStoreImage(opts *prepareUpgradeOptions, find func(store *imagepkg.Store) (*imagepkg.StoreImage, error)) error {
+	store, err := imagepkg.NewStore(imagepkg.DefaultStoreDir())
+	if err != nil {
+		return err
+	}
+	image, err := find(store)
+	if err != nil {
+		return fmt.Errorf("%w, use 'sdpctl image add' or 'sdpctl image pull' to add it", err)
+	}
+	opts.image = store.Path(*image)
+	if len(opts.verify.SHA256) <= 0 {
+		opts.verify.SHA256 = image.SHA256
+	}
+	log.WithFields(log.Fields{"image": opts.image, "version": image.Version}).Info("Using upgrade image from the image store")
+	return nil
+}
+
+// resolveLatestPatch selects the latest patch release for the version running on the primary controller from the image store
+func resolveLatestPatch(ctx context.Context, a *appliancepkg.Appliance, opts *prepareUpgradeOptions) error {
+	current, err := primaryControllerVersion(ctx, a, opts.Config)
+	if err != nil {
+		return err
+	}
+	if err := useStoreImage(opts, func(store *imagepkg.Store) (*imagepkg.StoreImage, error) {
+		return store.LatestPatch(current)
+	}); err != nil {
+		return err
+	}
+	fmt.Fprintf(opts.Out, "[%s] Using upgrade image %s from the image store\n", time.Now().Format(time.RFC3339), filepath.Base(opts.image))
+	return checkImage(opts)
+}
+
+// checkImage validates the filename of the upgrade image, and that a local image exists and is a zip archive
+func checkImage(opts *prepareUpgradeOptions) error {
+	var errs error
+	opts.filename = filepath.Base(opts.image)
+	if err := checkImageFilename(opts.filename); err != nil {
+		errs = multierr.Append(errs, err)
+	}
+
+	// allow remote addr for image, such as aws s3 bucket
+	if util.IsValidURL(opts.image) {
+		opts.remoteImage = true
+		// if the file is a remote image URL, derive the filename from
+		// standard lib 'path' instead of 'filepath' to avoid trailing URI elements
+
+		// we can skip error check here since we already validated that its a url
+		u, _ := url.Parse(opts.image)
+		// remove any query string, and leave us only with the filename
+		u.RawQuery = ""
+		opts.filename = path.Base(u.String())
+	}
+	if !opts.remoteImage {
+		// if the image is a local file, make sure its readable
+		// make early return if not
+		ok, err := util.FileExists(opts.image)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			errs = multierr.Append(errs, fmt.Errorf("Image file not found %q", opts.image))
+		}
+		if ok {
+			_, err := zip.OpenReader(opts.image)
+			if err != nil {
+				errs = multierr.Append(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
 func checkImageFilename(i string) error {
 	// Check if its a valid filename
 	if rg := regexp.MustCompile(`(.+)?\d\.\d\.\d(.+)?\.img\.zip`); !rg.MatchString(i) {
@@ -159,11 +368,75 @@ func checkImageFilename(i string) error {
 	return nil
 }
 
+// verifyImage inspects the upgrade image before it is uploaded, see 'sdpctl image inspect'. Remote images are
+// verified by the appliances after they have downloaded them, unless a checksum or signature is passed explicitly.
+func verifyImage(ctx context.Context, opts *prepareUpgradeOptions) error {
+	verify := opts.verify
+	verify.DevKeyring = opts.DevKeyring
+	imagePath := opts.image
+	if opts.remoteImage {
+		if len(verify.SHA256) <= 0 && len(verify.Signature) <= 0 {
+			log.WithField("image", opts.image).Info("Skipping verification of remote image")
+			if !verify.SkipSignature {
+				fmt.Fprintf(opts.Out, "WARNING: The remote upgrade image %s is not verified before it is prepared, use --sha256 or --signature to verify it\n", opts.filename)
+			}
+			return nil
+		}
+		client, err := opts.HTTPClient()
+		if err != nil {
+			return err
+		}
+		dir, err := os.MkdirTemp("", "sdpctl-image-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		if imagePath, err = imagepkg.Download(ctx, client, opts.image, dir); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(opts.Out, "[%s] Verifying upgrade image %s\n", time.Now().Format(time.RFC3339), opts.filename)
+	info, err := imagepkg.Inspect(imagePath, verify)
+	if err != nil {
+		return fmt.Errorf("Upgrade image verification failed: %w", err)
+	}
+	if info.Signature == nil {
+		fmt.Fprintf(opts.Out, "WARNING: The signature of the upgrade image %s was not verified\n", info.Filename)
+	}
+	log.WithFields(log.Fields{
+		"image":     info.Filename,
+		"version":   info.Version,
+		"build":     info.BuildNumber,
+		"sha256":    info.SHA256,
+		"signature": info.Signature != nil,
+	}).Info("Verified upgrade image")
+	return nil
+}
+
 var ErrPrimaryControllerVersionErr = errors.New("version mismatch: run sdpctl configure signin")
 
 func prepareRun(cmd *cobra.Command, args []string, opts *prepareUpgradeOptions) error {
 	terminal.Lock()
 	defer terminal.Unlock()
+	host, err := opts.Config.GetHost()
+	if err != nil {
+		return err
+	}
+	opts.notifier = notify.New(opts.Config.Webhooks, host)
+	defer opts.notifier.Close()
+	opts.events.Started("")
+	err = prepareUpgrade(cmd, args, opts)
+	opts.events.Finished(err)
+	if err != nil {
+		if !errors.Is(err, cmdutil.ErrExecutionCanceledByUser) {
+			opts.notifier.Failure("Upgrade prepare failed", err)
+		}
+		return err
+	}
+	return nil
+}
+
+func prepareUpgrade(cmd *cobra.Command, args []string, opts *prepareUpgradeOptions) error {
 	if appliancepkg.IsOnAppliance() {
 		return cmdutil.ErrExecutedOnAppliance
 	}
@@ -172,8 +445,19 @@ func prepareRun(cmd *cobra.Command, args []string, opts *prepareUpgradeOptions)
 		return err
 	}
 	spinnerOut := opts.SpinnerOut()
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(events.NewContext(context.Background(), opts.events))
 	defer cancel()
+	if opts.latestPatch {
+		if err := resolveLatestPatch(ctx, a, opts); err != nil {
+			return err
+		}
+	}
+	if err := verifyImage(ctx, opts); err != nil {
+		return err
+	}
+	if a, err = upgradeHops(ctx, cmd, args, opts, a); err != nil {
+		return err
+	}
 	if a.UpgradeStatusWorker == nil {
 		a.UpgradeStatusWorker = &appliancepkg.UpgradeStatus{
 			Appliance: a,
@@ -204,6 +488,9 @@ func prepareRun(cmd *cobra.Command, args []string, opts *prepareUpgradeOptions)
 	if err != nil {
 		return err
 	}
+	if currentVersion, err := appliancepkg.GetApplianceVersion(*primaryController, *initialStats); err == nil {
+		opts.history.SetVersions(currentVersion, targetVersion)
+	}
 	skipAppliances := []skipStruct{}
 	appliances, offline, _ := appliancepkg.FilterAvailable(filteredAppliances, initialStats.GetData())
 	for _, a := range offline {
@@ -303,7 +590,16 @@ func prepareRun(cmd *cobra.Command, args []string, opts *prepareUpgradeOptions)
 		}
 	}
 
+	for _, s := range skipAppliances {
+		opts.events.ApplianceSkipped(s.Appliance.GetName(), s.Reason)
+	}
+	opts.notifier.Notify(notify.Event{
+		Type:    notify.EventPrepareStarted,
+		Message: fmt.Sprintf("Preparing %d appliances for upgrade with %s", len(appliances), opts.filename),
+	})
+
 	// Step 1
+	opts.events.StepStarted("upload")
 
 	shouldUpload := false
 	fileStatusCtx, fileStatusCancel := context.WithTimeout(ctx, opts.timeout)
@@ -331,82 +627,17 @@ func prepareRun(cmd *cobra.Command, args []string, opts *prepareUpgradeOptions)
 		}
 		defer imageFile.Close()
 
-		fileStat, err := imageFile.Stat()
-		if err != nil {
-			return err
-		}
-		content, err := io.ReadAll(imageFile)
-		if err != nil {
-			return err
-		}
-		body := new(bytes.Buffer)
-		writer := multipart.NewWriter(body)
-		part, err := writer.CreateFormFile("file", fileStat.Name())
+		upload, err := appliancepkg.NewMultipartFile(imageFile)
 		if err != nil {
 			return err
 		}
-		part.Write(content)
-		if err = writer.Close(); err != nil {
-			return err
-		}
-
-		uploadWithProgress := func(ctx context.Context, body *bytes.Buffer, headers map[string]string) error {
-			uploadProgress := mpb.New(mpb.WithOutput(spinnerOut))
-			defer uploadProgress.Wait()
-			barName := fileStat.Name() + ":"
-			bar := uploadProgress.AddBar(int64(body.Len()),
-				mpb.BarWidth(50),
-				mpb.BarFillerOnComplete("uploaded"),
-				mpb.PrependDecorators(
-					decor.Spinner(tui.SpinnerStyle, decor.WC{W: 2}),
-					decor.Name(barName, decor.WC{W: len(barName) + 1}),
-				),
-				mpb.AppendDecorators(
-					decor.OnComplete(decor.CountersKibiByte("% .2f / % .2f"), ""),
-					decor.OnComplete(decor.Name(" | "), ""),
-					decor.OnComplete(decor.AverageSpeed(decor.UnitKiB, "% .2f"), ""),
-				),
-			)
-			waitSpinner := tui.AddDefaultSpinner(
-				uploadProgress,
-				fileStat.Name(),
-				"waiting for server ok",
-				"upload complete",
-				mpb.BarQueueAfter(bar, false),
-			)
-
-			reader := io.LimitReader(body, int64(body.Len()))
-			proxyReader := bar.ProxyReader(reader)
-			defer func() {
-				proxyReader.Close()
-				bar.Wait()
-				waitSpinner.Increment()
-			}()
-
-			log.WithField("file", imageFile.Name()).Info("Uploading file")
-			if err := a.UploadFile(ctx, proxyReader, headers); err != nil {
-				bar.Abort(false)
-				return err
-			}
-			return nil
-		}
-
-		headers := map[string]string{
-			"Content-Type":        writer.FormDataContentType(),
-			"Content-Disposition": fmt.Sprintf("attachment; filename=%q", fileStat.Name()),
-		}
 
 		fmt.Fprintf(opts.Out, "[%s] Uploading upgrade image:\n", time.Now().Format(time.RFC3339))
-		if !opts.ciMode {
-			err = uploadWithProgress(ctx, body, headers)
-		} else {
-			err = a.UploadFile(ctx, body, headers)
-		}
-		if err != nil {
+		if err := uploadImage(ctx, a, upload, spinnerOut, opts.ciMode); err != nil {
 			return err
 		}
 
-		log.WithField("file", imageFile.Name()).Info("Uploaded file")
+		log.WithField("file", upload.Name()).Info("Uploaded file")
 
 		remoteFile, err := a.FileStatus(ctx, opts.filename)
 		if err != nil {
@@ -464,6 +695,7 @@ func prepareRun(cmd *cobra.Command, args []string, opts *prepareUpgradeOptions)
 	}
 
 	// Step 2
+	opts.events.StepStarted("prepare")
 	primaryControllerRealHostname, err := appliancepkg.GetRealHostname(*primaryController)
 	if err != nil {
 		return err
@@ -506,6 +738,8 @@ func prepareRun(cmd *cobra.Command, args []string, opts *prepareUpgradeOptions)
 
 		if !opts.ciMode {
 			updateProgressBars = tui.New(ctx, spinnerOut)
+			updateProgressBars.SetEstimator(opts.estimator)
+			updateProgressBars.AddCountdown("prepare", opts.estimatedEnd)
 			defer updateProgressBars.Wait()
 		}
 
@@ -587,10 +821,12 @@ func prepareRun(cmd *cobra.Command, args []string, opts *prepareUpgradeOptions)
 					log.WithContext(ctx).Warning("no deadline in context")
 				}
 				if err := a.PrepareFileOn(ctx, remoteFilePath, qs.appliance.GetId(), opts.DevKeyring); err != nil {
+					opts.events.ApplianceFinished(qs.appliance.GetName(), err)
 					queueContinue <- queueStruct{err: err}
 					return err
 				}
 				if err := a.UpgradeStatusWorker.WaitForUpgradeStatus(ctx, qs.appliance, wantedStatus, unwantedStatus, qs.tracker); err != nil {
+					opts.events.ApplianceFinished(qs.appliance.GetName(), err)
 					queueContinue <- queueStruct{err: err}
 					return err
 				}
@@ -618,10 +854,17 @@ func prepareRun(cmd *cobra.Command, args []string, opts *prepareUpgradeOptions)
 				}
 				ctx, cancel := context.WithDeadline(ctx, qs.deadline)
 				defer cancel()
-				if err := a.UpgradeStatusWorker.WaitForUpgradeStatus(ctx, qs.appliance, prepareReady, unwantedStatus, qs.tracker); err != nil {
+				err := a.UpgradeStatusWorker.WaitForUpgradeStatus(ctx, qs.appliance, prepareReady, unwantedStatus, qs.tracker)
+				opts.events.ApplianceFinished(qs.appliance.GetName(), err)
+				if err != nil {
 					errChan <- err
 					return
 				}
+				opts.notifier.Notify(notify.Event{
+					Type:      notify.EventApplianceReady,
+					Appliance: qs.appliance.GetName(),
+					Message:   fmt.Sprintf("%s is ready to upgrade with %s", qs.appliance.GetName(), opts.filename),
+				})
 
 			}(&wg, qs)
 		}
@@ -646,12 +889,20 @@ func prepareRun(cmd *cobra.Command, args []string, opts *prepareUpgradeOptions)
 		workers = len(appliances)
 	}
 	fmt.Fprintf(opts.Out, "\n[%s] Preparing image on appliances:\n", time.Now().Format(time.RFC3339))
+	opts.estimator = upgradeEstimator("prepare", host)
+	opts.events.SetEstimator(opts.estimator)
+	remaining := prepareEstimate(opts.estimator, len(appliances), workers)
+	opts.estimatedEnd = time.Now().Add(remaining)
+	fmt.Fprintf(opts.Out, "Estimated time remaining: %s\n", eta.Format(remaining))
+	opts.events.Estimate(remaining)
 	if err := prepare(ctx, remoteFilePath, appliances, workers); err != nil {
 		return err
 	}
+	opts.events.StepFinished("prepare", nil)
 
 	if !opts.remoteImage || opts.hostOnController {
 		// Step 3
+		opts.events.StepStarted("cleanup")
 		log.Infof("3. Delete upgrade image %s from Controller", opts.filename)
 		deleteCtx, deleteCancel := context.WithTimeout(ctx, opts.timeout)
 		defer deleteCancel()
@@ -659,8 +910,13 @@ func prepareRun(cmd *cobra.Command, args []string, opts *prepareUpgradeOptions)
 			log.Warnf("Failed to delete %s from controller %s", opts.filename, err)
 		}
 		log.Infof("File %s deleted from Controller", opts.filename)
+		opts.events.StepFinished("cleanup", nil)
 	}
 	fmt.Fprintf(opts.Out, "\n[%s] PREPARE COMPLETE\n", time.Now().Format(time.RFC3339))
+	opts.notifier.Notify(notify.Event{
+		Type:    notify.EventPrepareCompleted,
+		Message: fmt.Sprintf("Prepared %d appliances for upgrade with %s", len(appliances), opts.filename),
+	})
 	return nil
 }
 
@@ -16,6 +16,7 @@ import (
 	"github.com/appgate/sdpctl/pkg/configuration"
 	"github.com/appgate/sdpctl/pkg/factory"
 	"github.com/appgate/sdpctl/pkg/httpmock"
+	imagepkg "github.com/appgate/sdpctl/pkg/image"
 	"github.com/appgate/sdpctl/pkg/prompt"
 	"github.com/appgate/sdpctl/pkg/tui"
 	"github.com/google/shlex"
@@ -61,6 +62,7 @@ func TestUpgradePrepareCommand(t *testing.T) {
 		name                     string
 		cli                      string
 		primaryControllerVersion string
+		storeImages              []string
 		askStubs                 func(*prompt.AskStubber)
 		httpStubs                []httpmock.Stub
 		upgradeStatusWorker      appliancepkg.WaitForUpgradeStatus
@@ -281,6 +283,57 @@ func TestUpgradePrepareCommand(t *testing.T) {
 			wantErr:                  true,
 			wantErrOut:               regexp.MustCompile(`--image is mandatory`),
 		},
+		{
+			name:                     "image and version",
+			cli:                      "upgrade prepare --image './testdata/appgate-5.5.1-9876.img.zip' --version 5.5.1",
+			primaryControllerVersion: "5.3.4+24950",
+			httpStubs:                []httpmock.Stub{},
+			wantErr:                  true,
+			wantErrOut:               regexp.MustCompile(`only one of --image, --version and --latest-patch can be used`),
+		},
+		{
+			name:                     "version not in image store",
+			cli:                      "upgrade prepare --version 5.5.1",
+			primaryControllerVersion: "5.3.4+24950",
+			httpStubs:                []httpmock.Stub{},
+			wantErr:                  true,
+			wantErrOut:               regexp.MustCompile(`image not found in the image store: version 5.5.1, use 'sdpctl image add'`),
+		},
+		{
+			name:                     "missing intermediate upgrade image",
+			cli:                      "upgrade prepare --image './testdata/appgate-6.1.0-29983.img.zip'",
+			primaryControllerVersion: "5.3.4+24950",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+			},
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`no supported upgrade path from 5.3.4\+24950 to 6.1.0\+29983, it requires an upgrade image for 5.5`),
+		},
+		{
+			name:                     "upgrade path without multi-hop",
+			cli:                      "upgrade prepare --image './testdata/appgate-6.1.0-29983.img.zip'",
+			primaryControllerVersion: "5.3.4+24950",
+			storeImages:              []string{"./testdata/appgate-5.5.1-9876.img.zip"},
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+			},
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`the upgrade path is 5.3.4\+24950 -> 5.5.1\+9876 -> 6.1.0\+29983. Use --multi-hop`),
+		},
 		{
 			name:                     "timeout flag",
 			cli:                      "upgrade prepare --image './testdata/appgate-5.5.1-9876.img.zip' --timeout 0s",
@@ -391,6 +444,13 @@ func TestUpgradePrepareCommand(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name:                     "unsigned image with keyring",
+			cli:                      "upgrade prepare --image './testdata/appgate-5.5.1-9876.img.zip' --keyring './testdata/release.gpg'",
+			primaryControllerVersion: "5.3.4+24950",
+			wantErr:                  true,
+			wantErrOut:               regexp.MustCompile(`no detached signature found for appgate-5.5.1-9876.img.zip`),
+		},
 		{
 			name:                     "image file not found",
 			cli:                      "upgrade prepare --image 'abc123456'",
@@ -499,6 +559,18 @@ func TestUpgradePrepareCommand(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SDPCTL_DATA_DIR", t.TempDir())
+			if len(tt.storeImages) > 0 {
+				store, err := imagepkg.NewStore(imagepkg.DefaultStoreDir())
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, i := range tt.storeImages {
+					if _, err := store.Add(i, imagepkg.VerifyOptions{}); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
 
 			registry := httpmock.NewRegistry(t)
 			for _, v := range tt.httpStubs {
@@ -0,0 +1,55 @@
+package upgrade
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/cmdutil"
+	"github.com/appgate/sdpctl/pkg/events"
+)
+
+// errAppliancesFailed is returned by a step in which some appliances failed, when the upgrade continues on errors
+var errAppliancesFailed = errors.New("appliances failed to upgrade")
+
+// applianceFinished reports the outcome of an appliance to the event stream and the upgrade report
+func applianceFinished(opts *upgradeCompleteOptions, appliance string, err error) {
+	opts.events.ApplianceFinished(appliance, err)
+	opts.report.Finished(appliance, err)
+}
+
+// applianceSkipped reports a skipped appliance to the event stream and the upgrade report
+func applianceSkipped(opts *upgradeCompleteOptions, appliance, reason string) {
+	opts.events.ApplianceSkipped(appliance, reason)
+	opts.report.Skipped(appliance, reason)
+}
+
+// writeReport prints the outcome of each appliance, and writes the report as JSON if --report is set
+func writeReport(opts *upgradeCompleteOptions) error {
+	if opts.report == nil || len(opts.report.Appliances) <= 0 {
+		return nil
+	}
+	fmt.Fprintf(opts.Out, "\n[%s] Upgrade report:\n\n", time.Now().Format(time.RFC3339))
+	opts.report.Print(opts.Out)
+	if len(opts.reportFile) <= 0 {
+		return nil
+	}
+	content, err := json.MarshalIndent(opts.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(opts.reportFile, content, 0600); err != nil {
+		return fmt.Errorf("Could not write upgrade report: %w", err)
+	}
+	return nil
+}
+
+// partialFailure returns an error with the number of failed appliances, or nil if none failed
+func partialFailure(opts *upgradeCompleteOptions) error {
+	if failed := opts.report.Count(events.OutcomeFailed); failed > 0 {
+		return fmt.Errorf("%w: %d appliances failed to upgrade", cmdutil.ErrPartialFailure, failed)
+	}
+	return nil
+}
@@ -0,0 +1,462 @@
+package upgrade
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/prompt"
+	"github.com/appgate/sdpctl/pkg/terminal"
+	"github.com/appgate/sdpctl/pkg/tui"
+	"github.com/appgate/sdpctl/pkg/util"
+	"github.com/hashicorp/go-version"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/errgroup"
+)
+
+type upgradeRollbackOptions struct {
+	Config         *configuration.Config
+	Out            io.Writer
+	SpinnerOut     func() io.Writer
+	Appliance      func(c *configuration.Config) (*appliancepkg.Appliance, error)
+	debug          bool
+	NoInteractive  bool
+	Timeout        time.Duration
+	actualHostname string
+	fromVersion    string
+	defaultFilter  map[string]map[string]string
+	ciMode         bool
+	force          bool
+	historyDir     string
+}
+
+// NewUpgradeRollbackCmd return a new upgrade rollback command
+func NewUpgradeRollbackCmd(f *factory.Factory) *cobra.Command {
+	opts := upgradeRollbackOptions{
+		Config:     f.Config,
+		Appliance:  f.Appliance,
+		debug:      f.Config.Debug,
+		Out:        f.IOOutWriter,
+		SpinnerOut: f.GetSpinnerOutput(),
+		Timeout:    DefaultTimeout,
+		historyDir: appliancepkg.UpgradeHistoryDir(),
+		defaultFilter: map[string]map[string]string{
+			"include": {},
+			"exclude": {
+				"active": "false",
+			},
+		},
+	}
+	var upgradeRollbackCmd = &cobra.Command{
+		Use:     "rollback",
+		Short:   docs.ApplianceUpgradeRollbackDoc.Short,
+		Long:    docs.ApplianceUpgradeRollbackDoc.Long,
+		Example: docs.ApplianceUpgradeRollbackDoc.ExampleString(),
+		Args: func(cmd *cobra.Command, args []string) error {
+			flagTimeout, err := cmd.Flags().GetDuration("timeout")
+			if err != nil {
+				return err
+			}
+			opts.Timeout = flagTimeout
+			ciModeFlag, err := cmd.Flags().GetBool("ci-mode")
+			if err != nil {
+				return err
+			}
+			opts.ciMode = ciModeFlag
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			return upgradeRollbackRun(c, args, &opts)
+		},
+	}
+
+	flags := upgradeRollbackCmd.Flags()
+	flags.StringVar(&opts.fromVersion, "from-version", "", "roll back appliances running this version, defaults to the version of the primary controller")
+	flags.BoolVar(&opts.force, "force", false, "roll back appliances even if the version on their other partition is unknown, or the controllers would run different versions during the rollback")
+	flags.StringVar(&opts.actualHostname, "actual-hostname", "", "If the actual hostname is different from that which you are connecting to the appliance admin API, this flag can be used for setting the actual hostname.")
+
+	return upgradeRollbackCmd
+}
+
+func upgradeRollbackRun(cmd *cobra.Command, args []string, opts *upgradeRollbackOptions) error {
+	terminal.Lock()
+	defer terminal.Unlock()
+
+	var err error
+	if opts.NoInteractive, err = cmd.Flags().GetBool("no-interactive"); err != nil {
+		return err
+	}
+	cfg := opts.Config
+	a, err := opts.Appliance(cfg)
+	if err != nil {
+		return err
+	}
+	spinnerOut := opts.SpinnerOut()
+	if a.ApplianceStats == nil {
+		a.ApplianceStats = &appliancepkg.ApplianceStatus{
+			Appliance: a,
+		}
+	}
+	if a.UpgradeStatusWorker == nil {
+		a.UpgradeStatusWorker = &appliancepkg.UpgradeStatus{
+			Appliance: a,
+		}
+	}
+
+	ctx := context.Background()
+	filter := util.ParseFilteringFlags(cmd.Flags(), opts.defaultFilter)
+	rawAppliances, err := a.List(ctx, nil)
+	if err != nil {
+		return err
+	}
+	host, err := cfg.GetHost()
+	if err != nil {
+		return err
+	}
+	controlHost := host
+	if len(opts.actualHostname) > 0 {
+		controlHost = opts.actualHostname
+	}
+	primaryController, err := appliancepkg.FindPrimaryController(rawAppliances, controlHost)
+	if err != nil {
+		return err
+	}
+	stats, _, err := a.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	appliances, offline, err := appliancepkg.FilterAvailable(appliancepkg.FilterAppliances(rawAppliances, filter), stats.GetData())
+	if err != nil {
+		return fmt.Errorf("Could not roll back upgrade %w", err)
+	}
+	for _, o := range offline {
+		log.Warnf("%q is offline and will be excluded from rollback.", o.GetName())
+	}
+
+	var fromVersion *version.Version
+	if len(opts.fromVersion) > 0 {
+		if fromVersion, err = version.NewVersion(opts.fromVersion); err != nil {
+			return err
+		}
+	} else if fromVersion, err = appliancepkg.GetApplianceVersion(*primaryController, *stats); err != nil {
+		return err
+	}
+
+	// an appliance is considered upgraded if it runs the version we roll back from, and has no upgrade in progress.
+	upgradeStatuses, err := a.UpgradeStatusMap(ctx, appliances)
+	if err != nil {
+		return err
+	}
+	// the API doesn't tell which version is on the other partition, so it is looked up in the local upgrade history
+	history, err := appliancepkg.ListUpgradeHistory(opts.historyDir)
+	if err != nil {
+		log.WithError(err).Warn("Could not read the upgrade history, the versions on the other partitions are unknown")
+	}
+	upgraded := []openapi.Appliance{}
+	previousVersions := map[string]*version.Version{}
+	skipped := []string{}
+	for _, o := range offline {
+		skipped = append(skipped, fmt.Sprintf("%s: offline", o.GetName()))
+	}
+	for _, app := range appliances {
+		current, err := appliancepkg.GetApplianceVersion(app, *stats)
+		if err != nil {
+			return err
+		}
+		logEntry := log.WithFields(log.Fields{"appliance": app.GetName(), "version": current.String()})
+		if appliancepkg.CompareVersionsAndBuildNumber(current, fromVersion) != 0 {
+			logEntry.Info("not running the version to roll back from, excluding from rollback")
+			continue
+		}
+		if status := upgradeStatuses[app.GetId()].Status; status != appliancepkg.UpgradeStatusIdle {
+			logEntry.WithField("status", status).Info("upgrade in progress, excluding from rollback")
+			continue
+		}
+		previous := appliancepkg.PreviousVersion(history, host, app.GetName(), current)
+		if previous == nil && !opts.force {
+			logEntry.Warn("the version on the other partition is unknown, excluding from rollback")
+			skipped = append(skipped, fmt.Sprintf("%s: the version on the other partition is unknown, use --force to roll back anyway", app.GetName()))
+			continue
+		}
+		if previous != nil && !previous.LessThan(current) {
+			logEntry.WithField("previous", previous.String()).Warn("the other partition is not an older version, excluding from rollback")
+			skipped = append(skipped, fmt.Sprintf("%s: the other partition has version %s, which is not older", app.GetName(), previous.String()))
+			continue
+		}
+		previousVersions[app.GetId()] = previous
+		upgraded = append(upgraded, app)
+	}
+
+	var rollbackPrimary *openapi.Appliance
+	others := []openapi.Appliance{}
+	for _, app := range upgraded {
+		if app.GetId() == primaryController.GetId() {
+			p := app
+			rollbackPrimary = &p
+			continue
+		}
+		others = append(others, app)
+	}
+	groups := appliancepkg.GroupByFunctions(others)
+	additionalControllers := groups[appliancepkg.FunctionController]
+	additionalAppliances := []openapi.Appliance{}
+	for _, app := range others {
+		if !util.InSlice(app.GetId(), applianceIDs(additionalControllers)) {
+			additionalAppliances = append(additionalAppliances, app)
+		}
+	}
+	chunks := appliancepkg.ChunkApplianceGroup(appliancepkg.ActiveSitesInAppliances(additionalAppliances), appliancepkg.SplitAppliancesByGroup(additionalAppliances))
+	// an upgrade between these versions disables the controller function on the additional controllers, since the
+	// controllers can't run different versions in the collective. The rollback switches the controllers one at a time
+	// without doing so, which leaves a collective of controllers with different versions until the primary is rolled back.
+	if len(additionalControllers) > 0 && !opts.force {
+		for _, controller := range additionalControllers {
+			if previous := previousVersions[controller.GetId()]; previous != nil && appliancepkg.ShouldDisable(previous, fromVersion) {
+				return fmt.Errorf("Rolling back the controllers from %s to %s requires the controller function to be disabled on the additional controllers. Disable the controller function on the additional controllers first, or use --force to roll back anyway", fromVersion.String(), previous.String())
+			}
+		}
+	}
+	if rollbackPrimary == nil && len(additionalControllers) <= 0 && len(chunks) <= 0 {
+		if len(skipped) > len(offline) {
+			return fmt.Errorf("No appliances running version %s can be rolled back:\n  - %s", fromVersion.String(), strings.Join(skipped[len(offline):], "\n  - "))
+		}
+		return fmt.Errorf("No appliances running version %s were found to roll back", fromVersion.String())
+	}
+
+	msg, err := printRollbackSummary(chunks, additionalControllers, rollbackPrimary, skipped, fromVersion)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(opts.Out, msg)
+	if !opts.NoInteractive {
+		if err := prompt.AskConfirmation(); err != nil {
+			return err
+		}
+	}
+
+	newProgress := func(ctx context.Context) *tui.Progress {
+		if opts.ciMode {
+			return nil
+		}
+		return tui.New(ctx, spinnerOut)
+	}
+
+	for index, chunk := range chunks {
+		fmt.Fprintf(opts.Out, "\n[%s] Rolling back additional appliances (Batch %d / %d):\n", time.Now().Format(time.RFC3339), index+1, len(chunks))
+		p := newProgress(ctx)
+		g, gctx := errgroup.WithContext(ctx)
+		for _, appliance := range chunk {
+			i := appliance
+			g.Go(func() error {
+				return switchPartition(gctx, a, i, opts.Timeout, p)
+			})
+		}
+		err := g.Wait()
+		if p != nil {
+			p.Wait()
+		}
+		if err != nil {
+			return fmt.Errorf("failed during rollback of additional appliances %w", err)
+		}
+	}
+
+	if len(additionalControllers) > 0 {
+		fmt.Fprintf(opts.Out, "\n[%s] Rolling back additional controllers:\n", time.Now().Format(time.RFC3339))
+		for _, controller := range additionalControllers {
+			p := newProgress(ctx)
+			err := switchPartition(ctx, a, controller, opts.Timeout, p)
+			if p != nil {
+				p.Wait()
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if rollbackPrimary != nil {
+		fmt.Fprintf(opts.Out, "\n[%s] Rolling back primary controller:\n", time.Now().Format(time.RFC3339))
+		p := newProgress(ctx)
+		err := switchPartition(ctx, a, *rollbackPrimary, opts.Timeout, p)
+		if p != nil {
+			p.Wait()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	newStats, _, err := a.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	primaryVersion, err := appliancepkg.GetApplianceVersion(*primaryController, *newStats)
+	if err != nil {
+		return err
+	}
+	peerAPIVersion := a.GetPeerAPIVersion(primaryVersion)
+	cfg.PrimaryControllerVersion = primaryVersion.String()
+	cfg.Version = peerAPIVersion
+	viper.Set("primary_controller_version", primaryVersion.String())
+	viper.Set("api_version", peerAPIVersion)
+	if err := viper.WriteConfig(); err != nil {
+		log.WithFields(log.Fields{
+			"primary_controller_version": primaryVersion.String(),
+			"api_version":                peerAPIVersion,
+		}).WithError(err).Warn("failed to write config file")
+		fmt.Fprintln(opts.Out, "WARNING: Failed to write to config file. Please run 'sdpctl configure signin' to reconfigure.")
+	}
+
+	hasDiff, versionList := appliancepkg.HasDiffVersions(newStats.GetData())
+	postSummary, err := printPostRollbackSummary(versionList, hasDiff)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(opts.Out, "\n[%s] %s\n", time.Now().Format(time.RFC3339), postSummary)
+
+	return nil
+}
+
+const rollbackSummaryTpl = `
+UPGRADE ROLLBACK SUMMARY
+
+Appliances running version {{ .Version }} will be switched back to their previous partition:
+{{ range $i, $s := .Steps }}
+ {{ sum $i 1 }}. {{ $s.Description }}
+
+{{ $s.TableString }}
+{{ end }}{{ if .Skipped }}
+Appliances that will be skipped:{{ range .Skipped }}
+  - {{ . }}{{ end }}
+{{ end }}`
+
+func printRollbackSummary(chunks [][]openapi.Appliance, additionalControllers []openapi.Appliance, primaryController *openapi.Appliance, skipped []string, fromVersion *version.Version) (string, error) {
+	type step struct {
+		Description string
+		TableString string
+	}
+	type tplStub struct {
+		Steps   []step
+		Skipped []string
+		Version string
+	}
+	steps := []step{}
+	if len(chunks) > 0 {
+		tb := &bytes.Buffer{}
+		for i, c := range chunks {
+			fmt.Fprintf(tb, "Batch #%d:\n", i+1)
+			t := util.NewPrinter(tb, 4)
+			for _, a := range c {
+				t.AddLine(fmt.Sprintf("- %s", a.GetName()))
+			}
+			t.Print()
+		}
+		steps = append(steps, step{
+			Description: "Additional appliances will be rolled back in batches.",
+			TableString: util.PrefixStringLines(tb.String(), " ", 4),
+		})
+	}
+	if len(additionalControllers) > 0 {
+		tb := &bytes.Buffer{}
+		t := util.NewPrinter(tb, 4)
+		for _, a := range additionalControllers {
+			t.AddLine(fmt.Sprintf("- %s", a.GetName()))
+		}
+		t.Print()
+		steps = append(steps, step{
+			Description: "Additional controllers will be rolled back one at a time.",
+			TableString: util.PrefixStringLines(tb.String(), " ", 4),
+		})
+	}
+	if primaryController != nil {
+		tb := &bytes.Buffer{}
+		t := util.NewPrinter(tb, 4)
+		t.AddLine(fmt.Sprintf("- %s", primaryController.GetName()))
+		t.Print()
+		steps = append(steps, step{
+			Description: "The primary controller will be rolled back.\n    This will result in the API being unreachable while the primary controller reboots.",
+			TableString: util.PrefixStringLines(tb.String(), " ", 4),
+		})
+	}
+	data := tplStub{
+		Steps:   steps,
+		Skipped: skipped,
+		Version: fromVersion.String(),
+	}
+	t := template.Must(template.New("").Funcs(util.TPLFuncMap).Parse(rollbackSummaryTpl))
+	var tpl bytes.Buffer
+	if err := t.Execute(&tpl, data); err != nil {
+		return "", err
+	}
+	return tpl.String(), nil
+}
+
+func printPostRollbackSummary(applianceVersions map[string]string, hasDiff bool) (string, error) {
+	keys := make([]string, 0, len(applianceVersions))
+	for k := range applianceVersions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	type tplStub struct {
+		VersionTable string
+		HasDiff      bool
+	}
+
+	tpl := `UPGRADE ROLLBACK COMPLETE
+
+{{ .VersionTable }}{{ if .HasDiff }}
+WARNING: Rollback was completed, but not all appliances are running the same version.{{ end }}
+`
+
+	tb := &bytes.Buffer{}
+	tp := util.NewPrinter(tb, 4)
+	tp.AddHeader("Appliance", "Running version")
+	for _, k := range keys {
+		tp.AddLine(k, applianceVersions[k])
+	}
+	tp.Print()
+
+	t := template.Must(template.New("").Parse(tpl))
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, tplStub{VersionTable: tb.String(), HasDiff: hasDiff}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// switchPartition boots the appliance from the other partition, which holds the version it ran before the upgrade
+func switchPartition(ctx context.Context, a *appliancepkg.Appliance, appliance openapi.Appliance, timeout time.Duration, p *tui.Progress) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var t *tui.Tracker
+	if p != nil {
+		t = p.AddTracker(appliance.GetName(), "rolled back")
+		go t.Watch(appliancepkg.StatReady, []string{appliancepkg.UpgradeStatusFailed})
+	}
+	logEntry := log.WithField("appliance", appliance.GetName())
+	logEntry.Info("switching partition")
+	if err := a.UpgradeSwitchPartition(ctx, appliance.GetId()); err != nil {
+		return fmt.Errorf("Could not switch partition on %s %w", appliance.GetName(), err)
+	}
+	if err := a.UpgradeStatusWorker.WaitForUpgradeStatus(ctx, appliance, []string{appliancepkg.UpgradeStatusIdle}, []string{appliancepkg.UpgradeStatusFailed}, t); err != nil {
+		return err
+	}
+	if err := a.ApplianceStats.WaitForApplianceState(ctx, appliance, appliancepkg.StatReady, t); err != nil {
+		return err
+	}
+	logEntry.Info("switched partition")
+	return nil
+}
@@ -0,0 +1,361 @@
+package upgrade
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/events"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/httpmock"
+	"github.com/google/shlex"
+)
+
+const (
+	secondControllerID   = "b1f9f45c-6a7d-4b9e-9c2f-3e0a8a1d5b21"
+	secondControllerName = "controller2-da0375f6-0b28-4248-bd54-a933c4c39008-site1"
+)
+
+// withSecondController responds with the appliances or stats of the fixture, and a copy of the primary controller
+// as an additional controller
+func withSecondController(t *testing.T, filename string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var list map[string]interface{}
+		if err := json.Unmarshal(content, &list); err != nil {
+			t.Fatal(err)
+		}
+		data := list["data"].([]interface{})
+		controller := map[string]interface{}{}
+		for k, v := range data[0].(map[string]interface{}) {
+			controller[k] = v
+		}
+		controller["id"] = secondControllerID
+		controller["name"] = secondControllerName
+		for _, field := range []string{"hostname", "peerInterface", "adminInterface"} {
+			switch v := controller[field].(type) {
+			case string:
+				controller[field] = "controller2.appgate.com"
+			case map[string]interface{}:
+				iface := map[string]interface{}{}
+				for k, value := range v {
+					iface[k] = value
+				}
+				iface["hostname"] = "controller2.appgate.com"
+				controller[field] = iface
+			}
+		}
+		list["data"] = append(data, controller)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(list); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpgradeRollbackCommand(t *testing.T) {
+	switchPartition := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+	tests := []struct {
+		name      string
+		cli       string
+		httpStubs []httpmock.Stub
+		// upgradedFrom is recorded in the upgrade history as the version the appliances were upgraded from
+		upgradedFrom string
+		wantErr      bool
+		wantErrOut   *regexp.Regexp
+		wantOut      *regexp.Regexp
+	}{
+		{
+			name: "rollback gateway and primary controller",
+			cli:  "upgrade rollback --no-interactive",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade/switch-partition",
+					Responder: switchPartition,
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade/switch-partition",
+					Responder: switchPartition,
+				},
+			},
+			upgradedFrom: "5.3.1",
+			wantOut:      regexp.MustCompile(`(?s)Rolling back additional appliances.*Rolling back primary controller.*UPGRADE ROLLBACK COMPLETE`),
+		},
+		{
+			name: "force rollback without upgrade history",
+			cli:  "upgrade rollback --no-interactive --force",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade/switch-partition",
+					Responder: switchPartition,
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade/switch-partition",
+					Responder: switchPartition,
+				},
+			},
+			wantOut: regexp.MustCompile(`(?s)Rolling back additional appliances.*Rolling back primary controller.*UPGRADE ROLLBACK COMPLETE`),
+		},
+		{
+			name: "unknown version on the other partition",
+			cli:  "upgrade rollback --no-interactive",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+			},
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`(?s)can be rolled back.*controller-da0375f6-0b28-4248-bd54-a933c4c39008-site1: the version on the other partition is unknown`),
+		},
+		{
+			name: "other partition is not older",
+			cli:  "upgrade rollback --no-interactive --force",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+			},
+			upgradedFrom: "5.3.4",
+			wantErr:      true,
+			wantErrOut:   regexp.MustCompile(`other partition has version 5.3.4, which is not older`),
+		},
+		{
+			name: "refuse rollback of additional controllers across versions",
+			cli:  "upgrade rollback --no-interactive",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: withSecondController(t, "../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: withSecondController(t, "../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+				{
+					URL:       "/appliances/" + secondControllerID + "/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+			},
+			upgradedFrom: "5.2.5",
+			wantErr:      true,
+			wantErrOut:   regexp.MustCompile(`requires the controller function to be disabled on the additional controllers`),
+		},
+		{
+			name: "force rollback of additional controllers across versions",
+			cli:  "upgrade rollback --no-interactive --force",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: withSecondController(t, "../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: withSecondController(t, "../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+				{
+					URL:       "/appliances/" + secondControllerID + "/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade/switch-partition",
+					Responder: switchPartition,
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade/switch-partition",
+					Responder: switchPartition,
+				},
+				{
+					URL:       "/appliances/" + secondControllerID + "/upgrade/switch-partition",
+					Responder: switchPartition,
+				},
+			},
+			upgradedFrom: "5.2.5",
+			wantOut:      regexp.MustCompile(`(?s)Rolling back additional appliances.*Rolling back additional controllers.*Rolling back primary controller.*UPGRADE ROLLBACK COMPLETE`),
+		},
+		{
+			name: "no appliances running version",
+			cli:  "upgrade rollback --no-interactive --from-version 6.0.0",
+			httpStubs: []httpmock.Stub{
+				{
+					URL:       "/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_list.json"),
+				},
+				{
+					URL:       "/stats/appliances",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/stats_appliance.json"),
+				},
+				{
+					URL:       "/appliances/4c07bc67-57ea-42dd-b702-c2d6c45419fc/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+				{
+					URL:       "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/upgrade",
+					Responder: httpmock.JSONResponse("../../../pkg/appliance/fixtures/appliance_upgrade_status_idle.json"),
+				},
+			},
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`No appliances running version 6.0.0 were found to roll back`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := httpmock.NewRegistry(t)
+			for _, v := range tt.httpStubs {
+				registry.Register(v.URL, v.Responder)
+			}
+			defer registry.Teardown()
+			registry.Serve()
+
+			t.Setenv("SDPCTL_DATA_DIR", t.TempDir())
+			if len(tt.upgradedFrom) > 0 {
+				run := appliancepkg.NewUpgradeRun("complete", "appgate.com")
+				run.FromVersion = tt.upgradedFrom
+				run.ToVersion = "5.3.4"
+				for _, name := range []string{"controller-da0375f6-0b28-4248-bd54-a933c4c39008-site1", "gateway-da0375f6-0b28-4248-bd54-a933c4c39008-site1", secondControllerName} {
+					run.Record(events.Event{Type: events.TypeApplianceFinished, Appliance: name, Outcome: events.OutcomeSuccess})
+				}
+				if err := run.Save(appliancepkg.UpgradeHistoryDir()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stdout := &bytes.Buffer{}
+			f := &factory.Factory{
+				Config: &configuration.Config{
+					Debug: false,
+					URL:   fmt.Sprintf("http://appgate.com:%d", registry.Port),
+				},
+				IOOutWriter: stdout,
+				Stdin:       io.NopCloser(&bytes.Buffer{}),
+				StdErr:      &bytes.Buffer{},
+			}
+			f.APIClient = func(c *configuration.Config) (*openapi.APIClient, error) {
+				return registry.Client, nil
+			}
+			f.Appliance = func(c *configuration.Config) (*appliancepkg.Appliance, error) {
+				api, _ := f.APIClient(c)
+				return &appliancepkg.Appliance{
+					APIClient:           api,
+					HTTPClient:          api.GetConfig().HTTPClient,
+					UpgradeStatusWorker: new(mockUpgradeStatus),
+					ApplianceStats:      new(mockApplianceStatus),
+				}, nil
+			}
+			cmd := NewApplianceCmd(f)
+			upgradeCmd := NewUpgradeCmd(f)
+			upgradeCmd.AddCommand(NewUpgradeRollbackCmd(f))
+			cmd.AddCommand(upgradeCmd)
+			cmd.Flags().BoolP("help", "x", false, "")
+			cmd.Flags().Bool("no-interactive", false, "usage")
+
+			argv, err := shlex.Split(tt.cli)
+			if err != nil {
+				panic("Internal testing error, failed to split args")
+			}
+			cmd.SetArgs(argv)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			_, err = cmd.ExecuteC()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TestUpgradeRollbackCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && tt.wantErrOut != nil && !tt.wantErrOut.MatchString(err.Error()) {
+				t.Errorf("Expected output to match, expected:\n%s\n got: \n%s\n", tt.wantErrOut, err.Error())
+			}
+			if tt.wantOut != nil && !tt.wantOut.Match(stdout.Bytes()) {
+				t.Errorf("Expected output to match, expected:\n%s\n got: \n%s\n", tt.wantOut, stdout.String())
+			}
+		})
+	}
+}
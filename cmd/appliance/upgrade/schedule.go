@@ -0,0 +1,68 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	schedulepkg "github.com/appgate/sdpctl/pkg/schedule"
+	"github.com/appgate/sdpctl/pkg/util"
+)
+
+// parseSchedule validates the --start-at and --window flags, and that the sign in token is valid at the start time
+func parseSchedule(opts *upgradeCompleteOptions, startAt string) error {
+	if opts.window.Duration < 0 {
+		return errors.New("--window can't be negative")
+	}
+	if len(startAt) <= 0 {
+		return nil
+	}
+	start, err := time.Parse(time.RFC3339, startAt)
+	if err != nil {
+		return fmt.Errorf("invalid --start-at %q, expected a time in RFC3339 format such as 2022-11-05T02:00:00+01:00", startAt)
+	}
+	if !start.After(time.Now()) {
+		return fmt.Errorf("--start-at %s is in the past", startAt)
+	}
+	if err := schedulepkg.CheckTokenLifetime(opts.Config, start); err != nil {
+		return fmt.Errorf("%w. Sign in again with 'sdpctl configure signin' closer to the start time", err)
+	}
+	opts.window.Start = start
+	if end := opts.window.End(); !end.IsZero() {
+		if err := schedulepkg.CheckTokenLifetime(opts.Config, end); err != nil {
+			fmt.Fprintf(opts.Out, "WARNING: the sign in token expires before the maintenance window closes at %s\n", end.Local().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// waitForWindow waits until the scheduled start of the upgrade. Without --start-at, the maintenance window starts now.
+func waitForWindow(ctx context.Context, opts *upgradeCompleteOptions) error {
+	if opts.window.Start.IsZero() {
+		opts.window.Start = time.Now()
+		return nil
+	}
+	fmt.Fprintf(opts.Out, "\n[%s] Waiting until %s to start the upgrade\n", time.Now().Format(time.RFC3339), opts.window.Start.Local().Format(time.RFC3339))
+	return schedulepkg.Wait(ctx, opts.window.Start)
+}
+
+// windowClosed prints the appliances which were not upgraded because the maintenance window closed before the batch
+// with the given index. The journal is kept, so that the upgrade can be continued with --resume.
+func windowClosed(opts *upgradeCompleteOptions, plan *appliancepkg.UpgradePlan, journal *appliancepkg.UpgradeJournal, index int) error {
+	fmt.Fprintf(opts.Out, "\n[%s] MAINTENANCE WINDOW CLOSED\n\nThe following appliances were not upgraded:\n\n", time.Now().Format(time.RFC3339))
+	p := util.NewPrinter(opts.Out, 4)
+	p.AddHeader("Batch", "Appliance")
+	remaining := 0
+	for i := index; i < len(plan.Batches); i++ {
+		for _, app := range pending(journal, plan.Batches[i]) {
+			p.AddLine(i+1, app.GetName())
+			applianceSkipped(opts, app.GetName(), "maintenance window closed")
+			remaining++
+		}
+	}
+	p.Print()
+	fmt.Fprintln(opts.Out, "\nUse 'sdpctl appliance upgrade complete --resume' to upgrade the remaining appliances.")
+	return fmt.Errorf("%w at %s, %d appliances were not upgraded", schedulepkg.ErrWindowClosed, opts.window.End().Local().Format(time.RFC3339), remaining)
+}
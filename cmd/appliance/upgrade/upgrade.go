@@ -25,6 +25,10 @@ func NewUpgradeCmd(f *factory.Factory) *cobra.Command {
 	upgradeCmd.AddCommand(NewPrepareUpgradeCmd(f))
 	upgradeCmd.AddCommand(NewUpgradeCancelCmd(f))
 	upgradeCmd.AddCommand(NewUpgradeCompleteCmd(f))
+	upgradeCmd.AddCommand(NewUpgradePlanCmd(f))
+	upgradeCmd.AddCommand(NewUpgradePreflightCmd(f))
+	upgradeCmd.AddCommand(NewUpgradeRollbackCmd(f))
+	upgradeCmd.AddCommand(NewUpgradeHistoryCmd(f))
 
 	flags := upgradeCmd.PersistentFlags()
 	flags.DurationP("timeout", "t", DefaultTimeout, "Timeout for the upgrade operation. The timeout applies to each appliance which is being operated on.")
@@ -0,0 +1,94 @@
+package appliance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/cmdutil"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type verifyOptions struct {
+	Config        *configuration.Config
+	Out           io.Writer
+	Appliance     func(c *configuration.Config) (*appliancepkg.Appliance, error)
+	debug         bool
+	json          bool
+	file          string
+	defaultFilter map[string]map[string]string
+}
+
+// NewVerifyCmd return a new appliance verify command
+func NewVerifyCmd(f *factory.Factory) *cobra.Command {
+	opts := verifyOptions{
+		Config:    f.Config,
+		Appliance: f.Appliance,
+		debug:     f.Config.Debug,
+		Out:       f.IOOutWriter,
+		defaultFilter: map[string]map[string]string{
+			"include": {},
+			"exclude": {
+				"active": "false",
+			},
+		},
+	}
+	var verifyCmd = &cobra.Command{
+		Use:     "verify",
+		Short:   docs.ApplianceVerifyDoc.Short,
+		Long:    docs.ApplianceVerifyDoc.Long,
+		Example: docs.ApplianceVerifyDoc.ExampleString(),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(opts.file) <= 0 {
+				return errors.New("--file is required")
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			return verifyRun(c, args, &opts)
+		},
+	}
+	verifyCmd.Flags().StringVarP(&opts.file, "file", "f", "", "path to the verification file")
+	verifyCmd.Flags().BoolVar(&opts.json, "json", false, "Display in JSON format")
+	return verifyCmd
+}
+
+func verifyRun(cmd *cobra.Command, args []string, opts *verifyOptions) error {
+	spec, err := appliancepkg.ReadVerifySpec(opts.file)
+	if err != nil {
+		return err
+	}
+	cfg := opts.Config
+	a, err := opts.Appliance(cfg)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	filter := util.ParseFilteringFlags(cmd.Flags(), opts.defaultFilter)
+	appliances, err := a.List(ctx, filter)
+	if err != nil {
+		return err
+	}
+	stats, _, err := a.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	results := appliancepkg.Verify(ctx, a, *spec, appliances, *stats, cfg.Version)
+	if opts.json {
+		if err := util.PrintJSON(opts.Out, results); err != nil {
+			return err
+		}
+	} else {
+		appliancepkg.PrintVerifyReport(opts.Out, results)
+	}
+	if failures := appliancepkg.VerifyFailures(results); len(failures) > 0 {
+		return fmt.Errorf("%w: %d of %d checks failed", cmdutil.ErrVerificationFailed, len(failures), len(results))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package appliance
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	"github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/cmdutil"
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/appgate/sdpctl/pkg/httpmock"
+)
+
+func TestVerifyCmd(t *testing.T) {
+	resolver := httpmock.Stub{
+		URL: "/appliances/ee639d70-e075-4f01-596b-930d5f24f569/test-resolver-name",
+		Responder: func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusOK)
+			fmt.Fprint(rw, string(`{"ips": ["10.0.0.10"]}`))
+		},
+	}
+	tests := []struct {
+		name       string
+		spec       string
+		httpStubs  []httpmock.Stub
+		wantErr    bool
+		wantErrOut *regexp.Regexp
+		wantOut    *regexp.Regexp
+	}{
+		{
+			name: "all checks pass",
+			spec: "version: 5.3.4\nhealthy: true\nmax-disk: 50\nresolve-names:\n  - dns://intranet.company.com\n",
+			httpStubs: []httpmock.Stub{
+				resolver,
+			},
+			wantOut: regexp.MustCompile(`7 checks passed, 0 failed`),
+		},
+		{
+			name:       "version and disk ceiling fail",
+			spec:       "version: 5.5.0\nappliances:\n  gateway-da0375f6-0b28-4248-bd54-a933c4c39008-site1:\n    version: 5.3.4+24950\nmax-disk: 2\n",
+			wantErr:    true,
+			wantErrOut: regexp.MustCompile(`verification failed: 2 of 4 checks failed`),
+			wantOut:    regexp.MustCompile(`controller-da0375f6-0b28-4248-bd54-a933c4c39008-site1\s+version\s+FAIL\s+running 5.3.4\+24950, expected 5.5.0`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := httpmock.NewRegistry(t)
+			registry.Register("/appliances", httpmock.JSONResponse("../../pkg/appliance/fixtures/appliance_list.json"))
+			registry.Register("/stats/appliances", httpmock.JSONResponse("../../pkg/appliance/fixtures/stats_appliance.json"))
+			for _, v := range tt.httpStubs {
+				registry.Register(v.URL, v.Responder)
+			}
+			defer registry.Teardown()
+			registry.Serve()
+
+			file := filepath.Join(t.TempDir(), "verify.yaml")
+			if err := os.WriteFile(file, []byte(tt.spec), 0600); err != nil {
+				t.Fatal(err)
+			}
+			stdout := &bytes.Buffer{}
+			f := &factory.Factory{
+				Config: &configuration.Config{
+					Debug: false,
+					URL:   fmt.Sprintf("http://localhost:%d", registry.Port),
+				},
+				IOOutWriter: stdout,
+				Stdin:       io.NopCloser(&bytes.Buffer{}),
+				StdErr:      &bytes.Buffer{},
+			}
+			f.APIClient = func(c *configuration.Config) (*openapi.APIClient, error) {
+				return registry.Client, nil
+			}
+			f.Appliance = func(c *configuration.Config) (*appliance.Appliance, error) {
+				api, _ := f.APIClient(c)
+				return &appliance.Appliance{
+					APIClient:  api,
+					HTTPClient: api.GetConfig().HTTPClient,
+					Token:      "",
+				}, nil
+			}
+			cmd := NewVerifyCmd(f)
+			cmd.SetArgs([]string{"--file", file})
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			_, err := cmd.ExecuteC()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewVerifyCmd() error = %v, wantErr %v\n%s", err, tt.wantErr, stdout.String())
+			}
+			if err != nil {
+				if !errors.Is(err, cmdutil.ErrVerificationFailed) {
+					t.Errorf("expected ErrVerificationFailed, got %s", err)
+				}
+				if tt.wantErrOut != nil && !tt.wantErrOut.MatchString(err.Error()) {
+					t.Errorf("Expected output to match, got:\n%s\n expected: \n%s\n", err.Error(), tt.wantErrOut)
+				}
+			}
+			if tt.wantOut != nil && !tt.wantOut.MatchString(stdout.String()) {
+				t.Errorf("Expected report to match %s, got:\n%s", tt.wantOut, stdout.String())
+			}
+		})
+	}
+}
@@ -83,6 +83,12 @@ Available Variables:
     Description: username for local identity provider, can be used instead of SDPCTL_BEARER in combination with SDPCTL_PASSWORD.
   SDPCTL_PASSWORD:
     Description: password for local identity provider, can be used instead of SDPCTL_BEARER in combination with SDPCTL_USERNAME.
+  SDPCTL_BACKUP_USERNAME:
+    Description: username or access key for a remote backup destination, used instead of the keyring.
+  SDPCTL_BACKUP_SECRET:
+    Description: password or secret key for a remote backup destination, used instead of the keyring.
+  SDPCTL_BACKUP_PASSPHRASE:
+    Description: passphrase of the appliance backups, used by backup inspect and decrypt instead of the keyring.
   SDPCTL_DEVICE_ID:
     Description: UUID to distinguish the Client device making the request. It is supposed to be same for every sign in request from the same server.
     Default: /etc/machine-id on Linux
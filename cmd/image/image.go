@@ -0,0 +1,28 @@
+package image
+
+import (
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/spf13/cobra"
+)
+
+// NewImageCmd return a new image command
+func NewImageCmd(f *factory.Factory) *cobra.Command {
+	var imageCmd = &cobra.Command{
+		Use:     "image",
+		Short:   docs.ImageDoc.Short,
+		Long:    docs.ImageDoc.Long,
+		Example: docs.ImageDoc.ExampleString(),
+		Annotations: map[string]string{
+			"skipAuthCheck": "true",
+		},
+	}
+
+	imageCmd.AddCommand(NewImageInspectCmd(f))
+	imageCmd.AddCommand(NewImageAddCmd(f))
+	imageCmd.AddCommand(NewImageListCmd(f))
+	imageCmd.AddCommand(NewImageRemoveCmd(f))
+	imageCmd.AddCommand(NewImagePullCmd(f))
+
+	return imageCmd
+}
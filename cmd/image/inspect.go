@@ -0,0 +1,102 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/factory"
+	imagepkg "github.com/appgate/sdpctl/pkg/image"
+	"github.com/appgate/sdpctl/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+type imageInspectOptions struct {
+	Out        io.Writer
+	HTTPClient func() (*http.Client, error)
+	json       bool
+	verify     imagepkg.VerifyOptions
+}
+
+// NewImageInspectCmd return a new image inspect command
+func NewImageInspectCmd(f *factory.Factory) *cobra.Command {
+	opts := imageInspectOptions{
+		Out:        f.IOOutWriter,
+		HTTPClient: f.HTTPClient,
+	}
+	var inspectCmd = &cobra.Command{
+		Use:     "inspect <file|url>",
+		Short:   docs.ImageInspectDoc.Short,
+		Long:    docs.ImageInspectDoc.Long,
+		Example: docs.ImageInspectDoc.ExampleString(),
+		Args:    cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return imageInspectRun(c, args, &opts)
+		},
+	}
+
+	flags := inspectCmd.Flags()
+	flags.BoolVar(&opts.json, "json", false, "Display in JSON format")
+	flags.StringVar(&opts.verify.SHA256, "sha256", "", "expected sha256 checksum of the image")
+	flags.StringVar(&opts.verify.Signature, "signature", "", "path to the detached signature of the image, defaults to <image>.sig or <image>.asc if it exists")
+	flags.StringVar(&opts.verify.Keyring, "keyring", "", "path to the keyring used to verify the signature, defaults to the release or dev keyring in the sdpctl config directory")
+	flags.BoolVar(&opts.verify.DevKeyring, "dev-keyring", false, "Use the development keyring to verify the upgrade image")
+	flags.BoolVar(&opts.verify.SkipSignature, "skip-signature", false, "accept an image without a detached signature, even if the keyring is installed")
+
+	return inspectCmd
+}
+
+func imageInspectRun(cmd *cobra.Command, args []string, opts *imageInspectOptions) error {
+	path := args[0]
+	if util.IsValidURL(path) {
+		client, err := opts.HTTPClient()
+		if err != nil {
+			return err
+		}
+		dir, err := os.MkdirTemp("", "sdpctl-image-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		fmt.Fprintf(cmd.ErrOrStderr(), "Downloading %s\n", path)
+		if path, err = imagepkg.Download(context.Background(), client, path, dir); err != nil {
+			return err
+		}
+	}
+
+	info, err := imagepkg.Inspect(path, opts.verify)
+	if err != nil {
+		return err
+	}
+	if info.Signature == nil {
+		fmt.Fprintf(cmd.ErrOrStderr(), "WARNING: the signature of %s was not verified\n", info.Filename)
+	}
+	if opts.json {
+		return util.PrintJSON(opts.Out, info)
+	}
+
+	signature := "not verified"
+	if info.Signature != nil {
+		signature = fmt.Sprintf("verified, signed by %s", info.Signature.SignedBy)
+	}
+	p := util.NewPrinter(opts.Out, 4)
+	p.AddLine("Filename:", info.Filename)
+	p.AddLine("Version:", info.Version)
+	p.AddLine("Build number:", info.BuildNumber)
+	p.AddLine("Size:", info.Size)
+	p.AddLine("SHA256:", info.SHA256)
+	p.AddLine("Signature:", signature)
+	p.Print()
+
+	fmt.Fprintln(opts.Out)
+	p = util.NewPrinter(opts.Out, 4)
+	p.AddHeader("File", "Size", "CRC32")
+	for _, e := range info.Entries {
+		p.AddLine(e.Name, e.Size, e.CRC32)
+	}
+	p.Print()
+	return nil
+}
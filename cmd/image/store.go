@@ -0,0 +1,277 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/factory"
+	imagepkg "github.com/appgate/sdpctl/pkg/image"
+	"github.com/appgate/sdpctl/pkg/util"
+	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/cobra"
+)
+
+type imageStoreOptions struct {
+	Out        io.Writer
+	HTTPClient func() (*http.Client, error)
+	json       bool
+	all        bool
+	version    string
+	verify     imagepkg.VerifyOptions
+}
+
+func newImageStoreOptions(f *factory.Factory) *imageStoreOptions {
+	return &imageStoreOptions{
+		Out:        f.IOOutWriter,
+		HTTPClient: f.HTTPClient,
+	}
+}
+
+// NewImageAddCmd return a new image add command
+func NewImageAddCmd(f *factory.Factory) *cobra.Command {
+	opts := newImageStoreOptions(f)
+	var addCmd = &cobra.Command{
+		Use:     "add <file>...",
+		Short:   docs.ImageAddDoc.Short,
+		Long:    docs.ImageAddDoc.Long,
+		Example: docs.ImageAddDoc.ExampleString(),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) <= 0 {
+				return errors.New("requires at least 1 arg(s), only received 0")
+			}
+			if len(args) > 1 && len(opts.verify.SHA256) > 0 {
+				return errors.New("--sha256 can only be used when adding a single image")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := imagepkg.NewStore(imagepkg.DefaultStoreDir())
+			if err != nil {
+				return err
+			}
+			var errs error
+			for _, arg := range args {
+				image, err := store.Add(arg, opts.verify)
+				if err != nil {
+					errs = multierror.Append(errs, err)
+					continue
+				}
+				fmt.Fprintf(opts.Out, "%s: added version %s\n", image.Filename, image.Version)
+				warnUnsigned(opts.Out, image)
+			}
+			return errs
+		},
+	}
+
+	flags := addCmd.Flags()
+	flags.StringVar(&opts.verify.SHA256, "sha256", "", "expected sha256 checksum of the image")
+	flags.StringVar(&opts.verify.Keyring, "keyring", "", "path to the keyring used to verify the signature, defaults to the release or dev keyring in the sdpctl config directory")
+	flags.BoolVar(&opts.verify.DevKeyring, "dev-keyring", false, "Use the development keyring to verify the upgrade image")
+	flags.BoolVar(&opts.verify.SkipSignature, "skip-signature", false, "accept an image without a detached signature, even if the keyring is installed")
+
+	return addCmd
+}
+
+// NewImageListCmd return a new image list command
+func NewImageListCmd(f *factory.Factory) *cobra.Command {
+	opts := newImageStoreOptions(f)
+	var listCmd = &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   docs.ImageListDoc.Short,
+		Long:    docs.ImageListDoc.Long,
+		Example: docs.ImageListDoc.ExampleString(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := imagepkg.NewStore(imagepkg.DefaultStoreDir())
+			if err != nil {
+				return err
+			}
+			images, err := store.List()
+			if err != nil {
+				return err
+			}
+			if opts.json {
+				return util.PrintJSON(opts.Out, images)
+			}
+			p := util.NewPrinter(opts.Out, 4)
+			p.AddHeader("Version", "Build", "Filename", "Size", "Added")
+			for _, i := range images {
+				p.AddLine(i.Version, i.BuildNumber, i.Filename, i.Size, i.Added.Local().Format("2006-01-02 15:04"))
+			}
+			p.Print()
+			return nil
+		},
+	}
+
+	listCmd.Flags().BoolVar(&opts.json, "json", false, "Display in JSON format")
+
+	return listCmd
+}
+
+// NewImageRemoveCmd return a new image remove command
+func NewImageRemoveCmd(f *factory.Factory) *cobra.Command {
+	opts := newImageStoreOptions(f)
+	var removeCmd = &cobra.Command{
+		Use:     "remove <filename|version>...",
+		Aliases: []string{"rm", "delete"},
+		Short:   docs.ImageRemoveDoc.Short,
+		Long:    docs.ImageRemoveDoc.Long,
+		Example: docs.ImageRemoveDoc.ExampleString(),
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := imagepkg.NewStore(imagepkg.DefaultStoreDir())
+			if err != nil {
+				return err
+			}
+			var errs error
+			for _, arg := range args {
+				removed, err := store.Remove(arg)
+				if err != nil {
+					errs = multierror.Append(errs, err)
+					continue
+				}
+				for _, i := range removed {
+					fmt.Fprintf(opts.Out, "%s: removed\n", i.Filename)
+				}
+			}
+			return errs
+		},
+	}
+
+	return removeCmd
+}
+
+// NewImagePullCmd return a new image pull command
+func NewImagePullCmd(f *factory.Factory) *cobra.Command {
+	opts := newImageStoreOptions(f)
+	var pullCmd = &cobra.Command{
+		Use:     "pull <mirror-url>",
+		Short:   docs.ImagePullDoc.Short,
+		Long:    docs.ImagePullDoc.Long,
+		Example: docs.ImagePullDoc.ExampleString(),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("accepts 1 arg(s), received %d", len(args))
+			}
+			if !util.IsValidURL(args[0]) {
+				return fmt.Errorf("invalid mirror URL %q", args[0])
+			}
+			if opts.all && len(opts.version) > 0 {
+				return errors.New("--all and --version can't be used together")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return imagePullRun(cmd, args, opts)
+		},
+	}
+
+	flags := pullCmd.Flags()
+	flags.StringVar(&opts.version, "version", "", "pull the image with this version, instead of the latest version in the mirror")
+	flags.BoolVar(&opts.all, "all", false, "pull all the images in the mirror which are not in the image store")
+	flags.StringVar(&opts.verify.Keyring, "keyring", "", "path to the keyring used to verify the signature, defaults to the release or dev keyring in the sdpctl config directory")
+	flags.BoolVar(&opts.verify.DevKeyring, "dev-keyring", false, "Use the development keyring to verify the upgrade image")
+	flags.BoolVar(&opts.verify.SkipSignature, "skip-signature", false, "accept an image without a detached signature, even if the keyring is installed")
+
+	return pullCmd
+}
+
+func imagePullRun(cmd *cobra.Command, args []string, opts *imageStoreOptions) error {
+	client, err := opts.HTTPClient()
+	if err != nil {
+		return err
+	}
+	store, err := imagepkg.NewStore(imagepkg.DefaultStoreDir())
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	index, indexURL, err := imagepkg.ReadMirrorIndex(ctx, client, args[0])
+	if err != nil {
+		return err
+	}
+	images, err := selectMirrorImages(index, opts)
+	if err != nil {
+		return err
+	}
+	existing, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, mi := range images {
+		if inStore(existing, mi) {
+			fmt.Fprintf(opts.Out, "%s: already in the image store\n", mi.Filename)
+			continue
+		}
+		fmt.Fprintf(opts.Out, "%s: pulling\n", mi.Filename)
+		image, err := store.Pull(ctx, client, indexURL, mi, opts.verify)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %w", mi.Filename, err))
+			continue
+		}
+		fmt.Fprintf(opts.Out, "%s: added version %s\n", image.Filename, image.Version)
+		warnUnsigned(opts.Out, image)
+	}
+	return errs
+}
+
+// warnUnsigned prints a warning if the image was added to the store without verifying its signature
+func warnUnsigned(out io.Writer, image *imagepkg.StoreImage) {
+	if !image.Signed {
+		fmt.Fprintf(out, "WARNING: the signature of %s was not verified\n", image.Filename)
+	}
+}
+
+// selectMirrorImages returns the images to pull from the mirror, which is the latest version unless --all or --version is used
+func selectMirrorImages(index *imagepkg.MirrorIndex, opts *imageStoreOptions) ([]imagepkg.MirrorImage, error) {
+	if opts.all {
+		return index.Images, nil
+	}
+	var want *imagepkg.MirrorImage
+	for i, mi := range index.Images {
+		v, err := appliance.ParseVersionString(mi.Filename)
+		if err != nil {
+			continue
+		}
+		if len(opts.version) > 0 {
+			wv, err := appliance.ParseVersionString(opts.version)
+			if err != nil {
+				return nil, err
+			}
+			if !v.Core().Equal(wv.Core()) || (len(wv.Metadata()) > 0 && wv.Metadata() != v.Metadata()) {
+				continue
+			}
+		}
+		if want == nil {
+			want = &index.Images[i]
+			continue
+		}
+		current, _ := appliance.ParseVersionString(want.Filename)
+		if imagepkg.CompareVersions(v, current) > 0 {
+			want = &index.Images[i]
+		}
+	}
+	if want == nil {
+		if len(opts.version) > 0 {
+			return nil, fmt.Errorf("version %s was not found in the mirror", opts.version)
+		}
+		return nil, errors.New("no images found in the mirror")
+	}
+	return []imagepkg.MirrorImage{*want}, nil
+}
+
+func inStore(images []imagepkg.StoreImage, mi imagepkg.MirrorImage) bool {
+	for _, i := range images {
+		if i.Filename == mi.Filename && (len(mi.SHA256) <= 0 || i.SHA256 == mi.SHA256) {
+			return true
+		}
+	}
+	return false
+}
@@ -17,6 +17,8 @@ import (
 
 	appliancecmd "github.com/appgate/sdpctl/cmd/appliance"
 	cfgcmd "github.com/appgate/sdpctl/cmd/configure"
+	imagecmd "github.com/appgate/sdpctl/cmd/image"
+	schedulecmd "github.com/appgate/sdpctl/cmd/schedule"
 	"github.com/appgate/sdpctl/pkg/auth"
 	"github.com/appgate/sdpctl/pkg/cmdutil"
 	"github.com/appgate/sdpctl/pkg/configuration"
@@ -94,6 +96,8 @@ func NewCmdRoot() *cobra.Command {
 	f := factory.New(version, cfg)
 	rootCmd.AddCommand(cfgcmd.NewCmdConfigure(f))
 	rootCmd.AddCommand(appliancecmd.NewApplianceCmd(f))
+	rootCmd.AddCommand(imagecmd.NewImageCmd(f))
+	rootCmd.AddCommand(schedulecmd.NewScheduleCmd(f))
 	rootCmd.AddCommand(token.NewTokenCmd(f))
 	rootCmd.AddCommand(NewCmdCompletion())
 	rootCmd.AddCommand(NewHelpCmd(f))
@@ -136,6 +140,12 @@ const (
 	exitError  exitCode = 1
 	exitCancel exitCode = 2
 	exitAuth   exitCode = 4
+
+	exitPreflightWarning exitCode = 5
+	exitPreflightFailed  exitCode = 6
+
+	exitVerificationFailed exitCode = 7
+	exitPartialFailure     exitCode = 8
 )
 
 func Execute() exitCode {
@@ -166,6 +176,18 @@ func Execute() exitCode {
 		if errors.Is(err, cmdutil.ErrExecutionCanceledByUser) {
 			return exitCancel
 		}
+		if errors.Is(err, cmdutil.ErrPreflightWarning) {
+			return exitPreflightWarning
+		}
+		if errors.Is(err, cmdutil.ErrPreflightFailed) {
+			return exitPreflightFailed
+		}
+		if errors.Is(err, cmdutil.ErrVerificationFailed) {
+			return exitVerificationFailed
+		}
+		if errors.Is(err, cmdutil.ErrPartialFailure) {
+			return exitPartialFailure
+		}
 		// only show usage prompt if we get invalid args / flags
 		if strings.Contains(errorString, "arg(s)") || strings.Contains(errorString, "flag") || strings.Contains(errorString, "command") {
 			fmt.Fprintln(os.Stderr)
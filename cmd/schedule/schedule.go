@@ -0,0 +1,158 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/docs"
+	"github.com/appgate/sdpctl/pkg/factory"
+	schedulepkg "github.com/appgate/sdpctl/pkg/schedule"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type scheduleOptions struct {
+	Config     *configuration.Config
+	Out        io.Writer
+	StdErr     io.Writer
+	Stdin      io.Reader
+	window     time.Duration
+	runs       int
+	cron       *schedulepkg.Cron
+	command    []string
+	executable func() (string, error)
+}
+
+// NewScheduleCmd return a new schedule command
+func NewScheduleCmd(f *factory.Factory) *cobra.Command {
+	opts := &scheduleOptions{
+		Config:     f.Config,
+		Out:        f.IOOutWriter,
+		StdErr:     f.StdErr,
+		Stdin:      f.Stdin,
+		runs:       1,
+		executable: os.Executable,
+	}
+	var scheduleCmd = &cobra.Command{
+		Use:     "schedule <cron-expression> -- <command>",
+		Short:   docs.ScheduleDoc.Short,
+		Long:    docs.ScheduleDoc.Long,
+		Example: docs.ScheduleDoc.ExampleString(),
+		Annotations: map[string]string{
+			"skipAuthCheck": "true",
+		},
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errors.New("requires a cron expression and a command, such as: sdpctl schedule \"0 2 * * 6\" -- appliance upgrade complete")
+			}
+			if opts.runs < 0 {
+				return errors.New("--runs can't be negative")
+			}
+			if opts.window < 0 {
+				return errors.New("--window can't be negative")
+			}
+			var err error
+			if opts.cron, err = schedulepkg.ParseCron(args[0]); err != nil {
+				return err
+			}
+			opts.command = args[1:]
+			return validateCommand(cmd, opts)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return scheduleRun(cmd, opts)
+		},
+	}
+
+	flags := scheduleCmd.Flags()
+	flags.DurationVar(&opts.window, "window", 0, "length of the maintenance window, passed on to the command with its --window flag")
+	flags.IntVar(&opts.runs, "runs", opts.runs, "number of times to run the command, 0 runs it each time the cron expression matches until stopped")
+
+	return scheduleCmd
+}
+
+// validateCommand checks that the scheduled command and its flags are valid, and that it will be able to sign in
+func validateCommand(cmd *cobra.Command, opts *scheduleOptions) error {
+	c, rest, err := cmd.Root().Find(opts.command)
+	if err != nil {
+		return err
+	}
+	if c == cmd.Root() || c == cmd || !c.Runnable() {
+		return fmt.Errorf("%q is not a command that can be scheduled", opts.command[0])
+	}
+	if err := c.ParseFlags(rest); err != nil {
+		return fmt.Errorf("invalid scheduled command '%s': %w", c.CommandPath(), err)
+	}
+	if opts.window > 0 && c.Flags().Lookup("window") == nil {
+		return fmt.Errorf("--window is not supported by '%s'", c.CommandPath())
+	}
+	if !configuration.IsAuthCheckEnabled(c) {
+		return nil
+	}
+	next, err := opts.cron.Next(time.Now())
+	if err != nil {
+		return err
+	}
+	if err := schedulepkg.CheckTokenLifetime(opts.Config, next); err != nil && !canSignin(opts.Config) {
+		return fmt.Errorf("%w, and there are no stored credentials to sign in again. Sign in with 'sdpctl configure signin' using the local identity provider, or set SDPCTL_USERNAME and SDPCTL_PASSWORD", err)
+	}
+	return nil
+}
+
+// canSignin returns true if the scheduled command can sign in again without prompting
+func canSignin(cfg *configuration.Config) bool {
+	if len(os.Getenv("SDPCTL_USERNAME")) > 0 && len(os.Getenv("SDPCTL_PASSWORD")) > 0 {
+		return true
+	}
+	creds, err := cfg.LoadCredentials()
+	if err != nil {
+		return false
+	}
+	return len(creds.Username) > 0 && len(creds.Password) > 0
+}
+
+func scheduleRun(cmd *cobra.Command, opts *scheduleOptions) error {
+	executable, err := opts.executable()
+	if err != nil {
+		return err
+	}
+	args := append([]string{}, opts.command...)
+	args = append(args, "--no-interactive")
+	if opts.window > 0 {
+		args = append(args, fmt.Sprintf("--window=%s", opts.window))
+	}
+
+	ctx := context.Background()
+	var lastErr error
+	for run := 1; opts.runs == 0 || run <= opts.runs; run++ {
+		next, err := opts.cron.Next(time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(opts.Out, "[%s] Next run of 'sdpctl %s' at %s\n", time.Now().Format(time.RFC3339), strings.Join(opts.command, " "), next.Format(time.RFC3339))
+		if err := schedulepkg.Wait(ctx, next); err != nil {
+			return err
+		}
+		fmt.Fprintf(opts.Out, "[%s] Running 'sdpctl %s'\n", time.Now().Format(time.RFC3339), strings.Join(opts.command, " "))
+		c := exec.CommandContext(ctx, executable, args...)
+		c.Stdin, c.Stdout, c.Stderr = opts.Stdin, opts.Out, opts.StdErr
+		lastErr = c.Run()
+		logEntry := log.WithFields(log.Fields{"command": strings.Join(opts.command, " "), "run": run})
+		if lastErr != nil {
+			logEntry.WithError(lastErr).Error("scheduled run failed")
+			fmt.Fprintf(opts.Out, "[%s] Scheduled run failed: %s\n", time.Now().Format(time.RFC3339), lastErr)
+			continue
+		}
+		logEntry.Info("scheduled run completed")
+	}
+	if lastErr != nil {
+		return fmt.Errorf("the last scheduled run failed: %w", lastErr)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package schedule
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/factory"
+	"github.com/google/shlex"
+	"github.com/spf13/cobra"
+)
+
+func TestScheduleValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		cli        string
+		wantErrOut *regexp.Regexp
+	}{
+		{
+			name:       "missing command",
+			cli:        `schedule "0 2 * * *"`,
+			wantErrOut: regexp.MustCompile(`requires a cron expression and a command`),
+		},
+		{
+			name:       "invalid cron expression",
+			cli:        `schedule "0 2 * *" -- complete`,
+			wantErrOut: regexp.MustCompile(`invalid cron expression "0 2 \* \*": expected 5 fields, got 4`),
+		},
+		{
+			name:       "unknown command",
+			cli:        `schedule "0 2 * * *" -- schedule`,
+			wantErrOut: regexp.MustCompile(`"schedule" is not a command that can be scheduled`),
+		},
+		{
+			name:       "unknown flag",
+			cli:        `schedule "0 2 * * *" -- complete --unknown`,
+			wantErrOut: regexp.MustCompile(`invalid scheduled command 'sdpctl complete': unknown flag: --unknown`),
+		},
+		{
+			name:       "window not supported",
+			cli:        `schedule "0 2 * * *" --window 3h -- list`,
+			wantErrOut: regexp.MustCompile(`--window is not supported by 'sdpctl list'`),
+		},
+		{
+			name:       "token expires before the first run",
+			cli:        `schedule "0 2 * * *" -- complete --window 3h`,
+			wantErrOut: regexp.MustCompile(`the sign in token expires before the scheduled start.*there are no stored credentials`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SDPCTL_USERNAME", "")
+			f := &factory.Factory{
+				Config: &configuration.Config{
+					URL:       "http://appgate.com:8443",
+					ExpiresAt: "2001-01-01 08:15:39.137584 +0000 UTC",
+				},
+				IOOutWriter: &bytes.Buffer{},
+				StdErr:      &bytes.Buffer{},
+			}
+			root := &cobra.Command{Use: "sdpctl", SilenceErrors: true, SilenceUsage: true}
+			complete := &cobra.Command{Use: "complete", RunE: func(cmd *cobra.Command, args []string) error { return nil }}
+			complete.Flags().Duration("window", 0, "")
+			list := &cobra.Command{Use: "list", RunE: func(cmd *cobra.Command, args []string) error { return nil }}
+			root.AddCommand(complete, list, NewScheduleCmd(f))
+
+			argv, err := shlex.Split(tt.cli)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root.SetArgs(argv)
+			root.SetOut(io.Discard)
+			root.SetErr(io.Discard)
+			_, err = root.ExecuteC()
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !tt.wantErrOut.MatchString(err.Error()) {
+				t.Errorf("Expected error to match %s, got %s", tt.wantErrOut, err)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 
 	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
 	"github.com/appgate/sdpctl/pkg/api"
@@ -58,51 +59,42 @@ func (a *Appliance) UpgradeStatus(ctx context.Context, applianceID string) (*ope
 
 type UpgradeStatusResult struct {
 	Status, Details, Name string
+	// Err is set if the upgrade status of the appliance could not be read
+	Err error
 }
 
-// UpgradeStatusMap return a map with appliance.id, UpgradeStatusResult
+// UpgradeStatusMap return a map with appliance.id, UpgradeStatusResult.
+// If the status of some appliances could not be read, the map still holds the result of every appliance,
+// with Err set for the failed ones, and the first error is returned.
 func (a *Appliance) UpgradeStatusMap(ctx context.Context, appliances []openapi.Appliance) (map[string]UpgradeStatusResult, error) {
-	type result struct {
-		id, status, details, name string
-	}
-	g, ctx := errgroup.WithContext(ctx)
-	c := make(chan result)
+	var (
+		mu       sync.Mutex
+		g        errgroup.Group
+		firstErr error
+	)
+	m := make(map[string]UpgradeStatusResult)
 	for _, appliance := range appliances {
 		i := appliance
 		g.Go(func() error {
+			r := UpgradeStatusResult{Name: i.GetName()}
 			status, err := a.UpgradeStatus(ctx, i.GetId())
 			if err != nil {
-				return fmt.Errorf("Could not read status of %s %w", i.GetId(), err)
+				r.Err = fmt.Errorf("Could not read status of %s %w", i.GetId(), err)
+			} else {
+				r.Status = status.GetStatus()
+				r.Details = status.GetDetails()
 			}
-			select {
-			case c <- result{
-				id:      i.GetId(),
-				status:  status.GetStatus(),
-				details: status.GetDetails(),
-				name:    i.GetName(),
-			}:
-			case <-ctx.Done():
-				return ctx.Err()
+			mu.Lock()
+			defer mu.Unlock()
+			m[i.GetId()] = r
+			if r.Err != nil && firstErr == nil {
+				firstErr = r.Err
 			}
 			return nil
 		})
 	}
-	go func() {
-		g.Wait()
-		close(c)
-	}()
-	m := make(map[string]UpgradeStatusResult)
-	for r := range c {
-		m[r.id] = UpgradeStatusResult{
-			Status:  r.status,
-			Details: r.details,
-			Name:    r.name,
-		}
-	}
-	if err := g.Wait(); err != nil {
-		return nil, err
-	}
-	return m, nil
+	g.Wait()
+	return m, firstErr
 }
 
 func (a *Appliance) UpgradeCancel(ctx context.Context, applianceID string) error {
@@ -136,17 +128,19 @@ func (a *Appliance) FileStatus(ctx context.Context, filename string) (*openapi.F
 }
 
 // UploadFile directly to the current Controller. Note that the File is stored only on the current Controller, not synced between Controllers.
-func (a *Appliance) UploadFile(ctx context.Context, r io.Reader, headers map[string]string) error {
+// contentLength is the exact size of r in bytes, which lets the body be streamed instead of sent with chunked encoding.
+func (a *Appliance) UploadFile(ctx context.Context, r io.Reader, contentLength int64, headers map[string]string) error {
 	httpClient := a.HTTPClient
 	cfg := a.APIClient.GetConfig()
 	url, err := cfg.ServerURLWithContext(ctx, "ApplianceUpgradeApiService.FilesPut")
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest(http.MethodPut, url+"/files", r)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url+"/files", r)
 	if err != nil {
 		return err
 	}
+	req.ContentLength = contentLength
 	for k, v := range cfg.DefaultHeader {
 		req.Header.Add(k, v)
 	}
@@ -166,9 +160,38 @@ func (a *Appliance) UploadFile(ctx context.Context, r io.Reader, headers map[str
 		return api.HTTPErrorResponse(response, err)
 	}
 	defer response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		if response.StatusCode == http.StatusConflict {
+			return &UploadError{StatusCode: response.StatusCode, Err: fmt.Errorf("already exists %s", response.Status)}
+		}
+		return &UploadError{StatusCode: response.StatusCode, Err: api.HTTPErrorResponse(response, fmt.Errorf("upload failed %s", response.Status))}
+	}
 	return nil
 }
 
+// UploadError is returned by UploadFile when the controller answers the upload with an error status
+type UploadError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *UploadError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether the upload can succeed if it is sent again. Client errors other than
+// 408 Request Timeout and 429 Too Many Requests, such as an expired token, fail the same way every time.
+func (e *UploadError) Temporary() bool {
+	if e.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+	return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
+
 func (a *Appliance) UploadToController(ctx context.Context, url, filename string) error {
 	response, err := a.APIClient.ApplianceUpgradeApi.FilesPost(ctx).Authorization(a.Token).FilesGetRequest1(openapi.FilesGetRequest1{
 		Url:      url,
@@ -284,6 +307,31 @@ func (a *Appliance) UpgradeSwitchPartition(ctx context.Context, id string) error
 	return nil
 }
 
+// Metric returns a metric of the appliance in the Prometheus text exposition format
+func (a *Appliance) Metric(ctx context.Context, id, name string, peerVersion int) (string, error) {
+	ctx = context.WithValue(ctx, openapi.ContextAcceptHeader, fmt.Sprintf("application/vnd.appgate.peer-v%d+text", peerVersion))
+	data, response, err := a.APIClient.ApplianceMetricsApi.AppliancesIdMetricsNameGet(ctx, id, name).Authorization(a.Token).Execute()
+	if err != nil {
+		return "", api.HTTPErrorResponse(response, err)
+	}
+	return data, nil
+}
+
+// ResolveName resolves a resource name through the gateway function of the appliance
+func (a *Appliance) ResolveName(ctx context.Context, id, name string) ([]string, error) {
+	body := openapi.AppliancesIdTestResolverNamePostRequest{
+		ResourceName: openapi.PtrString(name),
+	}
+	result, response, err := a.APIClient.AppliancesApi.AppliancesIdTestResolverNamePost(ctx, id).AppliancesIdTestResolverNamePostRequest(body).Authorization(a.Token).Execute()
+	if err != nil {
+		return nil, api.HTTPErrorResponse(response, err)
+	}
+	if msg := result.GetError(); len(msg) > 0 {
+		return nil, errors.New(msg)
+	}
+	return result.GetIps(), nil
+}
+
 func (a *Appliance) GetPeerAPIVersion(applianceVersion *version.Version) int {
 	versionMap := map[string]int{
 		"5.1": 12,
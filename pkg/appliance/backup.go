@@ -3,11 +3,11 @@ package appliance
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"io"
-	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -19,7 +19,9 @@ import (
 	"github.com/appgate/sdpctl/pkg/api"
 	"github.com/appgate/sdpctl/pkg/appliance/backup"
 	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/events"
 	"github.com/appgate/sdpctl/pkg/filesystem"
+	"github.com/appgate/sdpctl/pkg/notify"
 	"github.com/appgate/sdpctl/pkg/prompt"
 	"github.com/appgate/sdpctl/pkg/tui"
 	"github.com/appgate/sdpctl/pkg/util"
@@ -50,6 +52,14 @@ type BackupOpts struct {
 	FilterFlag    map[string]map[string]string
 	Quiet         bool
 	CiMode        bool
+	Notifier      *notify.Notifier
+	Events        *events.Stream
+	// Retention is applied to the destination after a successful backup
+	Retention RetentionPolicy
+	// Sink is where the backup files are written, opened from Destination by PrepareBackup
+	Sink BackupSink
+	// SdpctlVersion is recorded in the metadata of the backup files
+	SdpctlVersion string
 }
 
 func PrepareBackup(opts *BackupOpts) error {
@@ -59,10 +69,12 @@ func PrepareBackup(opts *BackupOpts) error {
 		return fmt.Errorf("This should not be executed on an appliance")
 	}
 
-	opts.Destination = filesystem.AbsolutePath(opts.Destination)
-	if err := os.MkdirAll(opts.Destination, 0700); err != nil {
+	sink, err := NewBackupSink(opts.Destination, KeyringSinkCredentials(opts.NoInteractive))
+	if err != nil {
 		return err
 	}
+	opts.Sink = sink
+	opts.Destination = sink.String()
 
 	return nil
 }
@@ -72,6 +84,7 @@ func PerformBackup(cmd *cobra.Command, args []string, opts *BackupOpts) (map[str
 	backupIDs := make(map[string]string)
 	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
 	defer cancel()
+	defer opts.Sink.Close()
 
 	var err error
 	opts.CiMode, err = cmd.Flags().GetBool("ci-mode")
@@ -180,6 +193,7 @@ func PerformBackup(cmd *cobra.Command, args []string, opts *BackupOpts) (map[str
 
 	for _, v := range offline {
 		log.WithField("appliance", v.GetName()).Info("Skipping appliance. Appliance is offline.")
+		opts.Events.ApplianceSkipped(v.GetName(), "appliance is offline")
 	}
 
 	if len(toBackup) <= 0 {
@@ -196,7 +210,7 @@ func PerformBackup(cmd *cobra.Command, args []string, opts *BackupOpts) (map[str
 	}
 
 	type backedUp struct {
-		applianceID, backupID, destination string
+		applianceID, applianceName, backupID, destination, sha256 string
 	}
 
 	var (
@@ -228,32 +242,58 @@ func PerformBackup(cmd *cobra.Command, args []string, opts *BackupOpts) (map[str
 	}
 
 	b := func(appliance openapi.Appliance) (backedUp, error) {
-		b := backedUp{applianceID: appliance.GetId()}
+		b := backedUp{applianceID: appliance.GetId(), applianceName: appliance.GetName()}
 		b.backupID, err = backupAPI.Initiate(ctx, b.applianceID, logs, audit)
 		if err != nil {
 			return b, err
 		}
+		opts.Events.Status(b.applianceName, backup.Processing)
 		if err := retryStatus(ctx, b.applianceID, b.backupID); err != nil {
 			return b, err
 		}
-		file, err := backupAPI.Download(ctx, b.applianceID, b.backupID)
+		opts.Events.Status(b.applianceName, "downloading")
+		download, err := backupAPI.Download(ctx, b.applianceID, b.backupID)
 		if err != nil {
 			return b, err
 		}
+		defer download.Close()
 
-		b.destination = filepath.Join(opts.Destination, fmt.Sprintf("appgate_backup_%s_%s.bkp", strings.ReplaceAll(appliance.GetName(), " ", "_"), time.Now().Format("20060102_150405")))
-		out, err := os.Create(b.destination)
-		if err != nil {
-			return b, err
+		var r io.Reader = download
+		var bar *mpb.Bar
+		if !opts.CiMode {
+			bar = tui.AddDownloadBar(progressBars, b.applianceName, download.Size)
+			r = bar.ProxyReader(download)
 		}
-		if _, err := io.Copy(out, file); err != nil {
+		name := BackupFileName(appliance.GetName(), time.Now())
+		b.destination = opts.Sink.Location(name)
+		if err := opts.Sink.Write(ctx, name, r, download.Size); err != nil {
+			if bar != nil {
+				bar.Abort(true)
+			}
 			return b, err
 		}
-		file.Close()
-		out.Close()
-		if err := os.Remove(file.Name()); err != nil {
+		if bar != nil {
+			bar.SetTotal(-1, true)
+		}
+		b.sha256 = download.SHA256()
+		checksum := fmt.Sprintf("%s  %s\n", b.sha256, name)
+		if err := opts.Sink.Write(ctx, name+checksumSuffix, strings.NewReader(checksum), int64(len(checksum))); err != nil {
+			return b, fmt.Errorf("could not write the checksum of the backup: %w", err)
+		}
+		metadata := NewBackupMetadata(appliance, *initialStats)
+		metadata.File = name
+		metadata.Logs, metadata.Audit = logs, audit
+		metadata.BackupID = b.backupID
+		metadata.SdpctlVersion = opts.SdpctlVersion
+		metadata.SHA256, metadata.Size = b.sha256, download.Len()
+		metadata.CreatedAt = time.Now().UTC()
+		content, err := json.MarshalIndent(metadata, "", "  ")
+		if err != nil {
 			return b, err
 		}
+		if err := opts.Sink.Write(ctx, name+metadataSuffix, bytes.NewReader(content), int64(len(content))); err != nil {
+			return b, fmt.Errorf("could not write the metadata of the backup: %w", err)
+		}
 		return b, nil
 	}
 
@@ -265,6 +305,7 @@ func PerformBackup(cmd *cobra.Command, args []string, opts *BackupOpts) (map[str
 				bar = tui.AddDefaultSpinner(progressBars, appliance.GetName(), backup.Processing, backup.Done)
 			}
 			backedUp, err := b(appliance)
+			opts.Events.ApplianceFinished(appliance.GetName(), err)
 			if err != nil {
 				if !opts.CiMode {
 					bar.Abort(false)
@@ -287,17 +328,46 @@ func PerformBackup(cmd *cobra.Command, args []string, opts *BackupOpts) (map[str
 
 	for b := range backups {
 		backupIDs[b.applianceID] = b.backupID
-		log.WithField("file", b.destination).Info("Wrote backup file")
+		log.WithFields(log.Fields{"file": b.destination, "sha256": b.sha256}).Info("Wrote backup file")
+		opts.Notifier.Notify(notify.Event{
+			Type:      notify.EventBackupWritten,
+			Appliance: b.applianceName,
+			Message:   fmt.Sprintf("Backup of %s written to %s", b.applianceName, b.destination),
+			Details:   map[string]string{"file": b.destination, "sha256": b.sha256},
+		})
 	}
 	var result error
 	for err := range errorChannel {
 		log.Error(err)
+		opts.Notifier.Failure("Backup failed", err)
 		result = multierror.Append(err)
 	}
+	if result == nil {
+		applyRetention(ctx, opts)
+	}
 
 	return backupIDs, result
 }
 
+// applyRetention removes the backup files in the destination which the retention policy does not keep.
+// A failure is only logged, since the backup itself succeeded.
+func applyRetention(ctx context.Context, opts *BackupOpts) {
+	if opts.Retention.IsZero() {
+		return
+	}
+	pruned, err := PruneBackups(ctx, opts.Sink, opts.Retention, false)
+	if err != nil {
+		log.WithError(err).WithField("destination", opts.Sink.String()).Warn("Failed to apply the backup retention policy")
+		fmt.Fprintf(opts.Out, "WARNING: failed to apply the backup retention policy to %s: %s\n", opts.Sink, err)
+	}
+	for _, f := range pruned {
+		log.WithFields(log.Fields{"file": f.Path, "reason": f.Reason}).Info("Removed backup file")
+	}
+	if len(pruned) > 0 {
+		fmt.Fprintf(opts.Out, "Removed %d backups by the retention policy\n", len(pruned))
+	}
+}
+
 func CleanupBackup(opts *BackupOpts, IDs map[string]string) error {
 	if IDs == nil || len(IDs) <= 0 {
 		return errors.New("Command finished, but no appliances were backed up. See log for more details")
@@ -2,8 +2,16 @@ package backup
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"os"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
 	"github.com/appgate/sdpctl/pkg/api"
@@ -37,14 +45,94 @@ func (b *Backup) Initiate(ctx context.Context, applianceID string, logs, audit b
 	return status.GetId(), nil
 }
 
-// Download a completed Appliance Backup with the given ID of an Appliance
-func (b *Backup) Download(ctx context.Context, applianceID, backupID string) (*os.File, error) {
-	ctxWithGPGAccept := context.WithValue(ctx, openapi.ContextAcceptHeader, fmt.Sprintf("application/vnd.appgate.peer-v%d+gpg", b.Version))
-	file, response, err := b.APIClient.ApplianceBackupApi.AppliancesIdBackupBackupIdGet(ctxWithGPGAccept, applianceID, backupID).Authorization(b.Token).Execute()
+// ErrDownloadMismatch is returned when the downloaded backup doesn't match the size or digest sent by the appliance
+var ErrDownloadMismatch = errors.New("downloaded backup does not match")
+
+// Download is a completed Appliance Backup which is streamed from the appliance. The size and the SHA-256 digest
+// sent by the appliance are verified when the whole backup has been read, and a mismatch is returned instead of io.EOF.
+type Download struct {
+	// Size is the length of the backup in bytes, or -1 if it is unknown
+	Size int64
+
+	response *http.Response
+	hash     hash.Hash
+	read     int64
+}
+
+// Download a completed Appliance Backup with the given ID of an Appliance. The caller must close the download.
+func (b *Backup) Download(ctx context.Context, applianceID, backupID string) (*Download, error) {
+	cfg := b.APIClient.GetConfig()
+	base, err := cfg.ServerURLWithContext(ctx, "ApplianceBackupApiService.AppliancesIdBackupBackupIdGet")
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/appliances/%s/backup/%s", base, url.PathEscape(applianceID), url.PathEscape(backupID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range cfg.DefaultHeader {
+		req.Header.Add(k, v)
+	}
+	req.Header.Set("Accept", fmt.Sprintf("application/vnd.appgate.peer-v%d+gpg", b.Version))
+	req.Header.Set("Authorization", b.Token)
+	response, err := cfg.HTTPClient.Do(req)
 	if err != nil {
 		return nil, api.HTTPErrorResponse(response, err)
 	}
-	return *file, nil
+	if response.StatusCode >= http.StatusMultipleChoices {
+		defer response.Body.Close()
+		return nil, api.HTTPErrorResponse(response, fmt.Errorf("download failed %s", response.Status))
+	}
+	return &Download{Size: response.ContentLength, response: response, hash: sha256.New()}, nil
+}
+
+func (d *Download) Read(p []byte) (int, error) {
+	n, err := d.response.Body.Read(p)
+	d.hash.Write(p[:n])
+	d.read += int64(n)
+	if err == io.EOF {
+		if verr := d.verify(); verr != nil {
+			return n, verr
+		}
+	}
+	return n, err
+}
+
+func (d *Download) Close() error {
+	return d.response.Body.Close()
+}
+
+// Len returns the number of bytes of the backup read so far
+func (d *Download) Len() int64 {
+	return d.read
+}
+
+// SHA256 returns the hex encoded SHA-256 digest of the backup, which is complete once the whole backup has been read
+func (d *Download) SHA256() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// verify compares the backup with the size and the sha-256 in the Digest header or trailer sent by the appliance
+func (d *Download) verify() error {
+	if d.Size >= 0 && d.read != d.Size {
+		return fmt.Errorf("%w: got %d bytes, expected %d", ErrDownloadMismatch, d.read, d.Size)
+	}
+	digest := d.response.Trailer.Get("Digest")
+	if len(digest) <= 0 {
+		digest = d.response.Header.Get("Digest")
+	}
+	for _, v := range strings.Split(digest, ",") {
+		v = strings.TrimSpace(v)
+		if !strings.HasPrefix(strings.ToLower(v), "sha-256=") {
+			continue
+		}
+		want, err := base64.StdEncoding.DecodeString(v[len("sha-256="):])
+		if err != nil || hex.EncodeToString(want) != d.SHA256() {
+			return fmt.Errorf("%w: sha-256 is %s, expected %x", ErrDownloadMismatch, d.SHA256(), want)
+		}
+	}
+	return nil
 }
 
 const (
@@ -0,0 +1,99 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/appgate/sdpctl/pkg/httpmock"
+)
+
+func TestDownload(t *testing.T) {
+	content := []byte("encrypted backup")
+	sum := sha256.Sum256(content)
+	digest := "sha-256=" + base64.StdEncoding.EncodeToString(sum[:])
+	wrongSum := sha256.Sum256([]byte("something else"))
+
+	tests := []struct {
+		name    string
+		header  map[string]string
+		trailer map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "content length",
+			header: map[string]string{"Content-Length": strconv.Itoa(len(content))},
+		},
+		{
+			name:   "digest header",
+			header: map[string]string{"Digest": digest},
+		},
+		{
+			name:    "digest trailer",
+			trailer: map[string]string{"Digest": digest},
+		},
+		{
+			name:    "digest mismatch",
+			trailer: map[string]string{"Digest": "sha-256=" + base64.StdEncoding.EncodeToString(wrongSum[:])},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := httpmock.NewRegistry(t)
+			defer registry.Teardown()
+			registry.Register("/appliances/a1/backup/b1", func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Accept") != "application/vnd.appgate.peer-v17+gpg" {
+					w.WriteHeader(http.StatusNotAcceptable)
+					return
+				}
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				for k := range tt.trailer {
+					w.Header().Add("Trailer", k)
+				}
+				w.Write(content)
+				for k, v := range tt.trailer {
+					w.Header().Set(k, v)
+				}
+			})
+			registry.Serve()
+
+			download, err := New(registry.Client, "", 17).Download(context.Background(), "a1", "b1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer download.Close()
+			got, err := io.ReadAll(download)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("read error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrDownloadMismatch) {
+					t.Errorf("expected ErrDownloadMismatch, got %v", err)
+				}
+				return
+			}
+			if string(got) != string(content) {
+				t.Errorf("got %q", got)
+			}
+			if download.SHA256() != hex.EncodeToString(sum[:]) {
+				t.Errorf("got sha256 %s", download.SHA256())
+			}
+		})
+	}
+}
+
+func TestDownloadSizeMismatch(t *testing.T) {
+	d := &Download{Size: 10, read: 4, response: &http.Response{}}
+	if err := d.verify(); !errors.Is(err, ErrDownloadMismatch) {
+		t.Errorf("expected ErrDownloadMismatch, got %v", err)
+	}
+}
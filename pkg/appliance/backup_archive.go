@@ -0,0 +1,184 @@
+package appliance
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrBackupPassphrase is returned when the backup can't be decrypted with the passphrase
+var ErrBackupPassphrase = errors.New("the backup can't be decrypted with the passphrase")
+
+// BackupEntry is a file in the archive of a decrypted backup
+type BackupEntry struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Size    int64     `json:"size"`
+	Mode    int64     `json:"mode"`
+	ModTime time.Time `json:"modified"`
+}
+
+// DecryptBackup returns the decrypted content of a backup, which is encrypted by the appliance with OpenPGP using the
+// backup passphrase of the collective. The integrity of the backup is checked when the whole content has been read,
+// and a modified backup is returned as an error instead of io.EOF.
+func DecryptBackup(r io.Reader, passphrase []byte) (io.Reader, error) {
+	tried := false
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if !symmetric {
+			return nil, errors.New("the backup is not encrypted with a passphrase")
+		}
+		// the prompt is called again as long as the passphrase is incorrect
+		if tried {
+			return nil, ErrBackupPassphrase
+		}
+		tried = true
+		return passphrase, nil
+	}
+	md, err := openpgp.ReadMessage(r, openpgp.EntityList{}, prompt, nil)
+	if err != nil {
+		if errors.Is(err, ErrBackupPassphrase) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("could not decrypt backup: %w", err)
+	}
+	return &stickyReader{r: md.UnverifiedBody}, nil
+}
+
+// stickyReader returns the first error of r on every following read, since the integrity of an openpgp message is
+// checked again on each read after io.EOF, and fails the second time
+type stickyReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *stickyReader) Read(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.r.Read(p)
+	s.err = err
+	return n, err
+}
+
+// ReadBackupArchive calls fn with each entry of the tar archive in a decrypted backup, which may be gzip compressed.
+// The rest of the backup is read after the archive, so that its integrity is checked.
+func ReadBackupArchive(r io.Reader, fn func(header *tar.Header, content io.Reader) error) error {
+	br := bufio.NewReader(r)
+	var content io.Reader = br
+	if magic, err := br.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("could not decompress backup: %w", err)
+		}
+		defer gz.Close()
+		content = gz
+	}
+	tr := tar.NewReader(content)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read backup archive: %w", err)
+		}
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+	if _, err := io.Copy(io.Discard, br); err != nil {
+		return fmt.Errorf("could not read backup archive: %w", err)
+	}
+	return nil
+}
+
+// InspectBackup returns the entries of the archive in a decrypted backup
+func InspectBackup(r io.Reader) ([]BackupEntry, error) {
+	entries := []BackupEntry{}
+	err := ReadBackupArchive(r, func(header *tar.Header, content io.Reader) error {
+		entries = append(entries, newBackupEntry(header))
+		return nil
+	})
+	return entries, err
+}
+
+// ExtractBackup writes the directories and regular files of the archive in a decrypted backup to dir, and returns
+// the entries which were extracted. Existing files are not overwritten, and other entries, such as links, are skipped.
+func ExtractBackup(r io.Reader, dir string) ([]BackupEntry, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	entries := []BackupEntry{}
+	err := ReadBackupArchive(r, func(header *tar.Header, content io.Reader) error {
+		path, err := archivePath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				return err
+			}
+			if err := extractFile(path, os.FileMode(header.Mode).Perm()|0600, content); err != nil {
+				return err
+			}
+		default:
+			log.WithField("entry", header.Name).Warn("Skipping backup archive entry which is not a file or directory")
+			return nil
+		}
+		entries = append(entries, newBackupEntry(header))
+		return nil
+	})
+	return entries, err
+}
+
+// archivePath returns the path of the archive entry name in dir, and an error if it would be outside dir
+func archivePath(dir, name string) (string, error) {
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if path != filepath.Clean(dir) && !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("the backup archive entry %s is outside the destination directory", name)
+	}
+	return path, nil
+}
+
+func extractFile(path string, mode os.FileMode, content io.Reader) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func newBackupEntry(header *tar.Header) BackupEntry {
+	e := BackupEntry{Name: header.Name, Size: header.Size, Mode: header.Mode, ModTime: header.ModTime}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		e.Type = "directory"
+	case tar.TypeReg:
+		e.Type = "file"
+	case tar.TypeSymlink, tar.TypeLink:
+		e.Type = "link"
+	default:
+		e.Type = "other"
+	}
+	return e
+}
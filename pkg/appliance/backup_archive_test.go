@@ -0,0 +1,105 @@
+package appliance
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// encryptedBackup returns a tar.gz archive with the files, encrypted like the backups of the appliance
+func encryptedBackup(t *testing.T, passphrase string, files map[string]string) []byte {
+	t.Helper()
+	archive := new(bytes.Buffer)
+	gz := gzip.NewWriter(archive)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "backup/", Typeflag: tar.TypeDir, Mode: 0755})
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+
+	encrypted := new(bytes.Buffer)
+	w, err := openpgp.SymmetricallyEncrypt(encrypted, []byte(passphrase), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(archive.Bytes())
+	w.Close()
+	return encrypted.Bytes()
+}
+
+func TestInspectBackup(t *testing.T) {
+	backup := encryptedBackup(t, "secret", map[string]string{"backup/config.json": "{}"})
+
+	r, err := DecryptBackup(bytes.NewReader(backup), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := InspectBackup(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Type != "directory" || entries[1].Name != "backup/config.json" || entries[1].Size != 2 {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+
+	if _, err := DecryptBackup(bytes.NewReader(backup), []byte("wrong")); !errors.Is(err, ErrBackupPassphrase) {
+		t.Errorf("expected ErrBackupPassphrase, got %v", err)
+	}
+
+	// modify a byte of the encrypted archive
+	backup[len(backup)-30] ^= 0xff
+	r, err = DecryptBackup(bytes.NewReader(backup), []byte("secret"))
+	if err == nil {
+		_, err = InspectBackup(r)
+	}
+	if err == nil {
+		t.Error("expected error for a modified backup")
+	}
+}
+
+func TestExtractBackup(t *testing.T) {
+	dir := t.TempDir()
+	backup := encryptedBackup(t, "secret", map[string]string{"backup/config.json": "{}", "backup/db/dump.sql": "dump"})
+	r, err := DecryptBackup(bytes.NewReader(backup), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ExtractBackup(r, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected 3 entries, got %d", len(entries))
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "backup", "db", "dump.sql"))
+	if err != nil || string(content) != "dump" {
+		t.Errorf("got %q, %v", content, err)
+	}
+
+	// extracting again doesn't overwrite the files
+	r, _ = DecryptBackup(bytes.NewReader(backup), []byte("secret"))
+	if _, err := ExtractBackup(r, dir); err == nil {
+		t.Error("expected error for existing files")
+	}
+
+	evil := new(bytes.Buffer)
+	tw := tar.NewWriter(evil)
+	tw.WriteHeader(&tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4})
+	tw.Write([]byte("evil"))
+	tw.Close()
+	if _, err := ExtractBackup(evil, filepath.Join(dir, "evil")); err == nil {
+		t.Error("expected error for an entry outside the directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil")); err != nil {
+		t.Errorf("expected the destination directory, %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package appliance
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+)
+
+// metadataSuffix is added to the name of a backup file for the file with its BackupMetadata
+const metadataSuffix = ".json"
+
+// backupSidecarSuffixes are the files written next to each backup file
+var backupSidecarSuffixes = []string{checksumSuffix, metadataSuffix}
+
+// BackupMetadata describes a backup file, and is written next to it as JSON
+type BackupMetadata struct {
+	File          string    `json:"file"`
+	ApplianceID   string    `json:"appliance_id"`
+	Appliance     string    `json:"appliance"`
+	Site          string    `json:"site,omitempty"`
+	SiteName      string    `json:"site_name,omitempty"`
+	Functions     []string  `json:"functions"`
+	Version       string    `json:"version,omitempty"`
+	Logs          bool      `json:"logs"`
+	Audit         bool      `json:"audit"`
+	BackupID      string    `json:"backup_id"`
+	SdpctlVersion string    `json:"sdpctl_version,omitempty"`
+	SHA256        string    `json:"sha256"`
+	Size          int64     `json:"size"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// NewBackupMetadata returns the metadata of the backup of appliance, with its version from stats
+func NewBackupMetadata(appliance openapi.Appliance, stats openapi.StatsAppliancesList) *BackupMetadata {
+	m := &BackupMetadata{
+		ApplianceID: appliance.GetId(),
+		Appliance:   appliance.GetName(),
+		Site:        appliance.GetSite(),
+		SiteName:    appliance.GetSiteName(),
+		Functions:   GetActiveFunctions(appliance),
+	}
+	if v, err := GetApplianceVersion(appliance, stats); err == nil && v != nil {
+		m.Version = v.String()
+	}
+	return m
+}
+
+// Backup statuses in the catalogue of a backup destination
+const (
+	BackupStatusOK         = "ok"
+	BackupStatusCorrupt    = "corrupt"
+	BackupStatusMissing    = "missing"
+	BackupStatusIncomplete = "incomplete"
+	BackupStatusNoMetadata = "no metadata"
+)
+
+// BackupCatalogEntry is a backup in the catalogue of a backup destination
+type BackupCatalogEntry struct {
+	File      string          `json:"file"`
+	Appliance string          `json:"appliance"`
+	Time      time.Time       `json:"time"`
+	Size      int64           `json:"size"`
+	Status    string          `json:"status"`
+	Problem   string          `json:"problem,omitempty"`
+	Metadata  *BackupMetadata `json:"metadata,omitempty"`
+}
+
+// maxMetadataSize is the largest metadata file which is read from a backup destination
+const maxMetadataSize = 1024 * 1024
+
+// ReadBackupCatalog returns the backups in the destination, sorted by appliance and the most recent first. Backup files
+// are compared with the size in their metadata, and with their checksum if verify is set, which downloads each backup
+// from a remote destination. The catalogue also has the backups whose file is missing, and the downloads which never
+// completed.
+func ReadBackupCatalog(ctx context.Context, sink BackupSink, verify bool) ([]BackupCatalogEntry, error) {
+	entries, err := sink.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, entry := range entries {
+		names[entry.Name] = true
+	}
+	catalog := []BackupCatalogEntry{}
+	found := map[string]bool{}
+	for _, f := range backupFiles(sink, entries) {
+		found[f.Name] = true
+		catalog = append(catalog, catalogEntry(ctx, sink, f, names, verify))
+	}
+	for _, entry := range entries {
+		name := entry.Name
+		switch {
+		case strings.HasSuffix(name, metadataSuffix) && !found[strings.TrimSuffix(name, metadataSuffix)]:
+			e, ok := sidecarEntry(sink, strings.TrimSuffix(name, metadataSuffix), BackupStatusMissing, "the backup file is missing")
+			if !ok {
+				continue
+			}
+			if m, err := readBackupMetadata(ctx, sink, name); err == nil {
+				e.Metadata, e.Size = m, m.Size
+			} else {
+				e.Problem = err.Error()
+			}
+			catalog = append(catalog, e)
+		case strings.HasSuffix(name, partSuffix):
+			e, ok := sidecarEntry(sink, strings.TrimSuffix(name, partSuffix), BackupStatusIncomplete, "the download did not complete")
+			if !ok {
+				continue
+			}
+			e.File = sink.Location(name)
+			e.Size = entry.Size
+			catalog = append(catalog, e)
+		}
+	}
+	sort.SliceStable(catalog, func(i, j int) bool {
+		if catalog[i].Appliance != catalog[j].Appliance {
+			return catalog[i].Appliance < catalog[j].Appliance
+		}
+		return catalog[i].Time.After(catalog[j].Time)
+	})
+	return catalog, nil
+}
+
+// sidecarEntry returns the catalogue entry of the backup file name, which is not in the destination itself
+func sidecarEntry(sink BackupSink, name, status, problem string) (BackupCatalogEntry, bool) {
+	m := backupFilePattern.FindStringSubmatch(name)
+	if m == nil {
+		return BackupCatalogEntry{}, false
+	}
+	t, err := time.ParseInLocation(backupFileTimeFormat, m[2], time.Local)
+	if err != nil {
+		return BackupCatalogEntry{}, false
+	}
+	return BackupCatalogEntry{File: sink.Location(name), Appliance: m[1], Time: t, Status: status, Problem: problem}, true
+}
+
+// catalogEntry returns the catalogue entry of the backup file f, names are the files in the destination
+func catalogEntry(ctx context.Context, sink BackupSink, f BackupFile, names map[string]bool, verify bool) BackupCatalogEntry {
+	e := BackupCatalogEntry{File: f.Path, Appliance: f.Appliance, Time: f.Time, Size: f.Size, Status: BackupStatusOK}
+	var m *BackupMetadata
+	if names[f.Name+metadataSuffix] {
+		var err error
+		if m, err = readBackupMetadata(ctx, sink, f.Name+metadataSuffix); err != nil {
+			e.Status, e.Problem = BackupStatusCorrupt, err.Error()
+			return e
+		}
+		e.Metadata = m
+		if m.Size != f.Size {
+			e.Status, e.Problem = BackupStatusCorrupt, fmt.Sprintf("the size is %d bytes, expected %d", f.Size, m.Size)
+			return e
+		}
+	} else {
+		e.Status = BackupStatusNoMetadata
+	}
+	if !verify {
+		return e
+	}
+	want := ""
+	if m != nil {
+		want = m.SHA256
+	} else if names[f.Name+checksumSuffix] {
+		if content, err := readSinkFile(ctx, sink, f.Name+checksumSuffix, maxMetadataSize); err == nil {
+			want = strings.Fields(string(content) + " ")[0]
+		}
+	}
+	if len(want) <= 0 {
+		return e
+	}
+	got, err := sinkSHA256(ctx, sink, f.Name)
+	if err != nil {
+		e.Status, e.Problem = BackupStatusCorrupt, err.Error()
+	} else if got != want {
+		e.Status, e.Problem = BackupStatusCorrupt, fmt.Sprintf("the sha256 is %s, expected %s", got, want)
+	}
+	return e
+}
+
+func readBackupMetadata(ctx context.Context, sink BackupSink, name string) (*BackupMetadata, error) {
+	content, err := readSinkFile(ctx, sink, name, maxMetadataSize)
+	if err != nil {
+		return nil, err
+	}
+	m := &BackupMetadata{}
+	if err := json.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("invalid metadata %s: %w", name, err)
+	}
+	return m, nil
+}
+
+// readSinkFile returns the content of the file name in the destination, which is at most limit bytes
+func readSinkFile(ctx context.Context, sink BackupSink, name string, limit int64) ([]byte, error) {
+	r, err := sink.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	content, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%s is larger than %s", name, FormatByteSize(limit))
+	}
+	return content, nil
+}
+
+func sinkSHA256(ctx context.Context, sink BackupSink, name string) (string, error) {
+	r, err := sink.Open(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
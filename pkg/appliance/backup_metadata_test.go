@@ -0,0 +1,159 @@
+package appliance
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestNewBackupMetadata(t *testing.T) {
+	a := openapi.Appliance{
+		Id:         openapi.PtrString("4c07bc67-57ea-42dd-b702-c2d6c45419fc"),
+		Name:       "controller",
+		Site:       openapi.PtrString("8a4add9e-0e99-4bb1-949c-c9faf9a49ad4"),
+		SiteName:   openapi.PtrString("Default Site"),
+		Controller: &openapi.ApplianceAllOfController{Enabled: openapi.PtrBool(true)},
+	}
+	stats := openapi.StatsAppliancesList{Data: []openapi.StatsAppliancesListAllOfData{
+		{Id: openapi.PtrString("4c07bc67-57ea-42dd-b702-c2d6c45419fc"), Version: openapi.PtrString("5.5.1-27812-release")},
+	}}
+	m := NewBackupMetadata(a, stats)
+	if m.ApplianceID != a.GetId() || m.Appliance != "controller" || m.SiteName != "Default Site" {
+		t.Errorf("unexpected metadata %+v", m)
+	}
+	if len(m.Functions) != 1 || m.Functions[0] != FunctionController {
+		t.Errorf("got functions %v", m.Functions)
+	}
+	if m.Version != "5.5.1+27812" {
+		t.Errorf("got version %s", m.Version)
+	}
+}
+
+func TestReadBackupCatalog(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().Truncate(time.Second)
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeBackup := func(appliance string, at time.Time, content string, m *BackupMetadata) string {
+		t.Helper()
+		name := BackupFileName(appliance, at)
+		write(name, content)
+		if m != nil {
+			m.File, m.Appliance, m.CreatedAt = name, appliance, at
+			b, _ := json.Marshal(m)
+			write(name+metadataSuffix, string(b))
+		}
+		return name
+	}
+	checksum := sha256Hex([]byte("backup"))
+
+	ok := writeBackup("controller", now, "backup", &BackupMetadata{Size: 6, SHA256: checksum})
+	wrongSize := writeBackup("controller", now.Add(-time.Hour), "backup", &BackupMetadata{Size: 10, SHA256: checksum})
+	wrongChecksum := writeBackup("controller", now.Add(-2*time.Hour), "backup", &BackupMetadata{Size: 6, SHA256: sha256Hex([]byte("other"))})
+	noMetadata := writeBackup("gateway", now, "backup", nil)
+	invalid := writeBackup("gateway", now.Add(-time.Hour), "backup", nil)
+	write(invalid+metadataSuffix, "{")
+	missing := writeBackup("portal", now.Add(-time.Hour), "backup", &BackupMetadata{Size: 6})
+	os.Remove(filepath.Join(dir, missing))
+	incomplete := BackupFileName("portal", now) + partSuffix
+	write(incomplete, "bac")
+	write("notes.txt", "notes")
+
+	tests := []struct {
+		verify bool
+		want   map[string]string
+	}{
+		{
+			verify: false,
+			want: map[string]string{
+				ok:            BackupStatusOK,
+				wrongSize:     BackupStatusCorrupt,
+				wrongChecksum: BackupStatusOK,
+				noMetadata:    BackupStatusNoMetadata,
+				invalid:       BackupStatusCorrupt,
+				missing:       BackupStatusMissing,
+				incomplete:    BackupStatusIncomplete,
+			},
+		},
+		{
+			verify: true,
+			want: map[string]string{
+				ok:            BackupStatusOK,
+				wrongSize:     BackupStatusCorrupt,
+				wrongChecksum: BackupStatusCorrupt,
+				noMetadata:    BackupStatusNoMetadata,
+				invalid:       BackupStatusCorrupt,
+				missing:       BackupStatusMissing,
+				incomplete:    BackupStatusIncomplete,
+			},
+		},
+	}
+	for _, tt := range tests {
+		catalog, err := ReadBackupCatalog(context.Background(), &LocalBackupSink{Dir: dir}, tt.verify)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(catalog) != len(tt.want) {
+			t.Fatalf("verify=%t: expected %d backups, got %d", tt.verify, len(tt.want), len(catalog))
+		}
+		for _, e := range catalog {
+			if want := tt.want[filepath.Base(e.File)]; e.Status != want {
+				t.Errorf("verify=%t: %s has status %q, want %q (%s)", tt.verify, filepath.Base(e.File), e.Status, want, e.Problem)
+			}
+		}
+		if catalog[0].File != filepath.Join(dir, ok) || catalog[len(catalog)-1].Appliance != "portal" {
+			t.Errorf("verify=%t: unexpected order of the catalogue", tt.verify)
+		}
+	}
+}
+
+func TestReadRemoteBackupCatalog(t *testing.T) {
+	sink := newMemorySFTPSink(t, "sftp://backup@host/backups")
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	write := func(name, content string) {
+		t.Helper()
+		if err := sink.Write(ctx, name, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ok := BackupFileName("controller", now)
+	write(ok, "backup")
+	write(ok+checksumSuffix, sha256Hex([]byte("backup"))+"  "+ok+"\n")
+	b, _ := json.Marshal(&BackupMetadata{File: ok, Appliance: "controller", Size: 6, SHA256: sha256Hex([]byte("backup"))})
+	write(ok+metadataSuffix, string(b))
+	corrupt := BackupFileName("gateway", now)
+	write(corrupt, "corrupt")
+	write(corrupt+checksumSuffix, sha256Hex([]byte("backup"))+"  "+corrupt+"\n")
+
+	catalog, err := ReadBackupCatalog(ctx, sink, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog) != 2 {
+		t.Fatalf("expected 2 backups, got %+v", catalog)
+	}
+	if e := catalog[0]; e.File != "sftp://host/backups/"+ok || e.Status != BackupStatusOK || e.Metadata == nil {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if e := catalog[1]; e.Status != BackupStatusCorrupt {
+		t.Errorf("expected the checksum of %s to differ, got %+v", corrupt, e)
+	}
+}
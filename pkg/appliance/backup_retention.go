@@ -0,0 +1,292 @@
+package appliance
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/configuration"
+)
+
+// backupFileTimeFormat is the format of the time in the name of a backup file
+const backupFileTimeFormat = "20060102_150405"
+
+// checksumSuffix is added to the name of a backup file for the file with its SHA-256 checksum, in the sha256sum format
+const checksumSuffix = ".sha256"
+
+var backupFilePattern = regexp.MustCompile(`^appgate_backup_(.+)_(\d{8}_\d{6})\.bkp$`)
+
+// BackupFileName returns the name of the backup file of an appliance taken at t
+func BackupFileName(appliance string, t time.Time) string {
+	return fmt.Sprintf("appgate_backup_%s_%s.bkp", strings.ReplaceAll(appliance, " ", "_"), t.Format(backupFileTimeFormat))
+}
+
+// BackupFile is a backup file in the backup destination
+type BackupFile struct {
+	// Name is the name of the file in the destination, and Path where it is stored
+	Name      string
+	Path      string
+	Appliance string
+	Time      time.Time
+	Size      int64
+}
+
+// ListBackupFiles returns the backup files in the destination, the most recent first.
+// Files which are not named like the backup files written by sdpctl are ignored.
+func ListBackupFiles(ctx context.Context, sink BackupSink) ([]BackupFile, error) {
+	entries, err := sink.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return backupFiles(sink, entries), nil
+}
+
+// backupFiles returns the backup files of the entries in the destination of sink, the most recent first
+func backupFiles(sink BackupSink, entries []SinkFile) []BackupFile {
+	files := []BackupFile{}
+	for _, entry := range entries {
+		m := backupFilePattern.FindStringSubmatch(entry.Name)
+		if m == nil {
+			continue
+		}
+		t, err := time.ParseInLocation(backupFileTimeFormat, m[2], time.Local)
+		if err != nil {
+			continue
+		}
+		files = append(files, BackupFile{
+			Name:      entry.Name,
+			Path:      sink.Location(entry.Name),
+			Appliance: m[1],
+			Time:      t,
+			Size:      entry.Size,
+		})
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Time.After(files[j].Time)
+	})
+	return files
+}
+
+// RetentionPolicy decides which backup files are kept in the backup destination.
+//
+// The keep rules are counted per appliance and a file is kept if any of them keeps it: the KeepLast most recent
+// backups, and the most recent backup of each of the KeepDaily last days, KeepWeekly last weeks and KeepMonthly last
+// months which have backups. If no keep rule is set, all files are kept by them.
+// MaxAge and MaxSize are applied to the kept files after that, the oldest files are removed first until the total size
+// of the destination is at most MaxSize. The most recent backup of each appliance is never removed.
+type RetentionPolicy struct {
+	KeepLast    int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	MaxAge      time.Duration
+	MaxSize     int64
+}
+
+// NewRetentionPolicy returns the policy of the backup retention in the configuration
+func NewRetentionPolicy(r configuration.BackupRetention) (RetentionPolicy, error) {
+	p := RetentionPolicy{
+		KeepLast:    r.KeepLast,
+		KeepDaily:   r.KeepDaily,
+		KeepWeekly:  r.KeepWeekly,
+		KeepMonthly: r.KeepMonthly,
+	}
+	for _, n := range []int{p.KeepLast, p.KeepDaily, p.KeepWeekly, p.KeepMonthly} {
+		if n < 0 {
+			return p, fmt.Errorf("backup retention can't keep a negative number of backups, got %d", n)
+		}
+	}
+	var err error
+	if len(r.MaxAge) > 0 {
+		if p.MaxAge, err = ParseRetentionAge(r.MaxAge); err != nil {
+			return p, err
+		}
+	}
+	if len(r.MaxSize) > 0 {
+		if p.MaxSize, err = ParseByteSize(r.MaxSize); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// IsZero reports whether the policy keeps all backup files
+func (p RetentionPolicy) IsZero() bool {
+	return p == RetentionPolicy{}
+}
+
+func (p RetentionPolicy) hasKeepRules() bool {
+	return p.KeepLast > 0 || p.KeepDaily > 0 || p.KeepWeekly > 0 || p.KeepMonthly > 0
+}
+
+// PrunedBackup is a backup file which is removed by the retention policy
+type PrunedBackup struct {
+	BackupFile
+	Reason string
+}
+
+// Prune returns the files which the policy removes at now. files must be sorted with the most recent first,
+// as returned by ListBackupFiles.
+func (p RetentionPolicy) Prune(files []BackupFile, now time.Time) []PrunedBackup {
+	pruned := []PrunedBackup{}
+	if p.IsZero() {
+		return pruned
+	}
+	byAppliance := map[string][]int{}
+	for i, f := range files {
+		byAppliance[f.Appliance] = append(byAppliance[f.Appliance], i)
+	}
+	removed := make([]string, len(files))
+	latest := map[int]bool{}
+	for _, indexes := range byAppliance {
+		latest[indexes[0]] = true
+		if !p.hasKeepRules() {
+			continue
+		}
+		keep := map[int]bool{}
+		for n, i := range indexes {
+			if n < p.KeepLast {
+				keep[i] = true
+			}
+		}
+		keepBuckets(files, indexes, p.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }, keep)
+		keepBuckets(files, indexes, p.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}, keep)
+		keepBuckets(files, indexes, p.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }, keep)
+		for _, i := range indexes {
+			if !keep[i] {
+				removed[i] = "not kept by the keep rules"
+			}
+		}
+	}
+	if p.MaxAge > 0 {
+		for i, f := range files {
+			if len(removed[i]) <= 0 && !latest[i] && now.Sub(f.Time) > p.MaxAge {
+				removed[i] = fmt.Sprintf("older than %s", p.MaxAge)
+			}
+		}
+	}
+	if p.MaxSize > 0 {
+		var total int64
+		for i, f := range files {
+			if len(removed[i]) <= 0 {
+				total += f.Size
+			}
+		}
+		for i := len(files) - 1; i >= 0 && total > p.MaxSize; i-- {
+			if len(removed[i]) <= 0 && !latest[i] {
+				removed[i] = fmt.Sprintf("total size is over %s", FormatByteSize(p.MaxSize))
+				total -= files[i].Size
+			}
+		}
+	}
+	for i, f := range files {
+		if len(removed[i]) > 0 {
+			pruned = append(pruned, PrunedBackup{BackupFile: f, Reason: removed[i]})
+		}
+	}
+	return pruned
+}
+
+// keepBuckets keeps the most recent file in each of the n most recent buckets
+func keepBuckets(files []BackupFile, indexes []int, n int, bucket func(time.Time) string, keep map[int]bool) {
+	last := ""
+	for _, i := range indexes {
+		if n <= 0 {
+			return
+		}
+		if b := bucket(files[i].Time); b != last {
+			keep[i] = true
+			last = b
+			n--
+		}
+	}
+}
+
+// PruneBackups removes the backup files in the destination which the policy does not keep, and their checksum and
+// metadata files, and returns the removed backup files.
+// Nothing is removed if dryRun is true, and the files which would be removed are returned.
+func PruneBackups(ctx context.Context, sink BackupSink, policy RetentionPolicy, dryRun bool) ([]PrunedBackup, error) {
+	files, err := ListBackupFiles(ctx, sink)
+	if err != nil {
+		return nil, err
+	}
+	pruned := policy.Prune(files, time.Now())
+	if dryRun {
+		return pruned, nil
+	}
+	for i, f := range pruned {
+		if err := sink.Remove(ctx, f.Name); err != nil {
+			return pruned[:i], fmt.Errorf("Could not remove backup file: %w", err)
+		}
+		for _, suffix := range backupSidecarSuffixes {
+			if err := sink.Remove(ctx, f.Name+suffix); err != nil {
+				return pruned[:i+1], fmt.Errorf("Could not remove backup file %s: %w", f.Name+suffix, err)
+			}
+		}
+	}
+	return pruned, nil
+}
+
+// ParseRetentionAge parses a duration, such as 720h, which may also be given in days or weeks, such as 30d or 4w
+func ParseRetentionAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid backup retention age %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid backup retention age %q", s)
+	}
+	return d, nil
+}
+
+var byteSizeUnits = []string{"B", "KB", "MB", "GB", "TB"}
+
+// ParseByteSize parses a size in bytes, such as 500MB or 10GB. The units are powers of 1024.
+func ParseByteSize(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	for i := len(byteSizeUnits) - 1; i >= 0; i-- {
+		unit := byteSizeUnits[i]
+		if !strings.HasSuffix(upper, unit) {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(upper, unit)), 64)
+		if err != nil || n < 0 {
+			break
+		}
+		return int64(n * math.Pow(1024, float64(i))), nil
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a size such as 500MB or 10GB", s)
+	}
+	return n, nil
+}
+
+// FormatByteSize formats a size in bytes, such as 1.5GB
+func FormatByteSize(size int64) string {
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(byteSizeUnits)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", size)
+	}
+	return strings.TrimSuffix(strconv.FormatFloat(value, 'f', 1, 64), ".0") + byteSizeUnits[i]
+}
@@ -0,0 +1,168 @@
+package appliance
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/configuration"
+)
+
+func TestRetentionPolicyPrune(t *testing.T) {
+	now := time.Date(2022, 3, 31, 12, 0, 0, 0, time.Local)
+	// one backup of the controller each day for 60 days, and two backups of the log server
+	files := []BackupFile{}
+	for i := 0; i < 60; i++ {
+		files = append(files, BackupFile{Appliance: "controller", Time: now.AddDate(0, 0, -i), Size: 100})
+	}
+	files = append(files,
+		BackupFile{Appliance: "logserver", Time: now.AddDate(0, 0, -1), Size: 100},
+		BackupFile{Appliance: "logserver", Time: now.AddDate(0, 0, -90), Size: 100},
+	)
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Time.After(files[j].Time) })
+
+	kept := func(policy RetentionPolicy) map[string]int {
+		removed := map[BackupFile]bool{}
+		for _, p := range policy.Prune(files, now) {
+			removed[p.BackupFile] = true
+		}
+		count := map[string]int{}
+		for _, f := range files {
+			if !removed[f] {
+				count[f.Appliance]++
+			}
+		}
+		return count
+	}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   map[string]int
+	}{
+		{
+			name:   "no policy",
+			policy: RetentionPolicy{},
+			want:   map[string]int{"controller": 60, "logserver": 2},
+		},
+		{
+			name:   "keep last",
+			policy: RetentionPolicy{KeepLast: 3},
+			want:   map[string]int{"controller": 3, "logserver": 2},
+		},
+		{
+			name:   "keep daily and monthly",
+			policy: RetentionPolicy{KeepDaily: 7, KeepMonthly: 3},
+			// 7 days in march, and the last backup of february and january
+			want: map[string]int{"controller": 9, "logserver": 2},
+		},
+		{
+			name:   "keep weekly",
+			policy: RetentionPolicy{KeepWeekly: 2},
+			want:   map[string]int{"controller": 2, "logserver": 2},
+		},
+		{
+			name:   "max age keeps the latest backup",
+			policy: RetentionPolicy{MaxAge: 10 * 24 * time.Hour},
+			want:   map[string]int{"controller": 11, "logserver": 1},
+		},
+		{
+			name:   "max size",
+			policy: RetentionPolicy{MaxSize: 500},
+			want:   map[string]int{"controller": 4, "logserver": 1},
+		},
+		{
+			name:   "max size keeps the latest backup of each appliance",
+			policy: RetentionPolicy{MaxSize: 10},
+			want:   map[string]int{"controller": 1, "logserver": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := kept(tt.policy)
+			for appliance, want := range tt.want {
+				if got[appliance] != want {
+					t.Errorf("kept %d backups of %s, want %d", got[appliance], appliance, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	names := []string{
+		BackupFileName("primary controller", now),
+		BackupFileName("primary controller", now.Add(-time.Hour)),
+		BackupFileName("primary controller", now.Add(-2*time.Hour)),
+		BackupFileName("gateway_site1", now.Add(-3*time.Hour)),
+		BackupFileName("primary controller", now.Add(-2*time.Hour)) + checksumSuffix,
+		BackupFileName("primary controller", now.Add(-2*time.Hour)) + metadataSuffix,
+		"notes.txt",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("backup"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sink := &LocalBackupSink{Dir: dir}
+	files, err := ListBackupFiles(context.Background(), sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("expected 4 backup files, got %d", len(files))
+	}
+	if files[0].Appliance != "primary_controller" || files[3].Appliance != "gateway_site1" {
+		t.Errorf("unexpected order of backup files %+v", files)
+	}
+
+	policy := RetentionPolicy{KeepLast: 1}
+	pruned, err := PruneBackups(context.Background(), sink, policy, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 {
+		t.Fatalf("expected 2 backups to prune, got %d", len(pruned))
+	}
+	if _, err := os.Stat(pruned[0].Path); err != nil {
+		t.Errorf("dry run removed %s", pruned[0].Path)
+	}
+
+	if _, err := PruneBackups(context.Background(), sink, policy, false); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Errorf("expected 3 files left, got %d", len(entries))
+	}
+}
+
+func TestNewRetentionPolicy(t *testing.T) {
+	p, err := NewRetentionPolicy(configuration.BackupRetention{KeepDaily: 7, MaxAge: "30d", MaxSize: "1.5GB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RetentionPolicy{KeepDaily: 7, MaxAge: 30 * 24 * time.Hour, MaxSize: 1536 * 1024 * 1024}
+	if p != want {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+	for _, r := range []configuration.BackupRetention{{KeepLast: -1}, {MaxAge: "a month"}, {MaxSize: "10XB"}} {
+		if _, err := NewRetentionPolicy(r); err == nil {
+			t.Errorf("expected error for %+v", r)
+		}
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	for size, want := range map[int64]string{0: "0B", 1023: "1023B", 1024: "1KB", 1536 * 1024 * 1024: "1.5GB"} {
+		if got := FormatByteSize(size); got != want {
+			t.Errorf("FormatByteSize(%d) = %s, want %s", size, got, want)
+		}
+	}
+}
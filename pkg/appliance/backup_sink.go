@@ -0,0 +1,220 @@
+package appliance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/appgate/sdpctl/pkg/filesystem"
+	"github.com/appgate/sdpctl/pkg/keyring"
+	"github.com/appgate/sdpctl/pkg/prompt"
+	log "github.com/sirupsen/logrus"
+)
+
+// BackupSink is the destination the backup files are written to
+type BackupSink interface {
+	// Write stores the content of r as the backup file name. size is the length of the content, or -1 if it is unknown.
+	// The file is written to a temporary name first, and only appears as name once it has been completely written.
+	Write(ctx context.Context, name string, r io.Reader, size int64) error
+	// List returns the files in the destination, an empty list if the destination doesn't exist yet
+	List(ctx context.Context) ([]SinkFile, error)
+	// Remove removes the file name from the destination, it is not an error if the file doesn't exist
+	Remove(ctx context.Context, name string) error
+	// Open returns the content of the file name in the destination
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// Location returns where the backup file name is stored, for the output of the commands
+	Location(name string) string
+	// String returns the destination, for the output of the commands
+	String() string
+	// Close closes the connection to a remote destination
+	Close() error
+}
+
+// SinkFile is a file in a backup destination
+type SinkFile struct {
+	Name string
+	Size int64
+}
+
+// remoteBackupSchemes are the URL schemes of the remote backup destinations
+var remoteBackupSchemes = []string{"s3", "sftp", "webdav", "webdavs"}
+
+// IsRemoteBackupDestination reports whether the destination is the URL of a remote backup destination
+func IsRemoteBackupDestination(destination string) bool {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return false
+	}
+	for _, scheme := range remoteBackupSchemes {
+		if u.Scheme == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// SinkCredentials returns the username and the password or secret key of a remote backup destination
+type SinkCredentials func(u *url.URL) (username, secret string, err error)
+
+// KeyringSinkCredentials returns the credentials of a remote backup destination from SDPCTL_BACKUP_USERNAME and
+// SDPCTL_BACKUP_SECRET, or the keyring. Missing credentials are prompted for and stored in the keyring, unless
+// noInteractive is set.
+func KeyringSinkCredentials(noInteractive bool) SinkCredentials {
+	return func(u *url.URL) (string, string, error) {
+		prefix := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+		username := u.User.Username()
+		if len(username) <= 0 {
+			username, _ = keyring.GetBackupUsername(prefix)
+		}
+		secret, _ := keyring.GetBackupSecret(prefix)
+		if len(username) > 0 && len(secret) > 0 {
+			return username, secret, nil
+		}
+		if noInteractive {
+			return "", "", fmt.Errorf("No credentials for %s, set SDPCTL_BACKUP_USERNAME and SDPCTL_BACKUP_SECRET or run the backup without '--no-interactive' to store them in the keyring", prefix)
+		}
+		if len(username) <= 0 {
+			q := &survey.Input{Message: fmt.Sprintf("Username or access key for %s:", prefix)}
+			if err := prompt.SurveyAskOne(q, &username, survey.WithValidator(survey.Required)); err != nil {
+				return "", "", err
+			}
+		}
+		if len(secret) <= 0 {
+			q := &survey.Password{Message: fmt.Sprintf("Password or secret key for %s:", prefix)}
+			if err := prompt.SurveyAskOne(q, &secret, survey.WithValidator(survey.Required)); err != nil {
+				return "", "", err
+			}
+		}
+		if err := keyring.SetBackupUsername(prefix, username); err != nil {
+			log.WithError(err).Warn("Could not store the backup username in the keyring")
+		}
+		if err := keyring.SetBackupSecret(prefix, secret); err != nil {
+			log.WithError(err).Warn("Could not store the backup secret in the keyring")
+		}
+		return username, secret, nil
+	}
+}
+
+// NewBackupSink returns the sink of the backup destination, which is either a local directory or the URL
+// s3://bucket/prefix, sftp://[user@]host[:port]/path, webdav://host/path or webdavs://host/path.
+// A local directory is created if it doesn't exist.
+func NewBackupSink(destination string, credentials SinkCredentials) (BackupSink, error) {
+	if !IsRemoteBackupDestination(destination) {
+		dir := filesystem.AbsolutePath(destination)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		return &LocalBackupSink{Dir: dir}, nil
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "s3":
+		return newS3Sink(u, credentials)
+	case "sftp":
+		return newSFTPSink(u, credentials)
+	case "webdav", "webdavs":
+		return newWebDAVSink(u, credentials)
+	}
+	return nil, fmt.Errorf("unsupported backup destination %q", destination)
+}
+
+// LocalBackupSink writes the backup files to a directory on the local filesystem
+type LocalBackupSink struct {
+	Dir string
+}
+
+func (s *LocalBackupSink) Write(ctx context.Context, name string, r io.Reader, size int64) error {
+	path := filepath.Join(s.Dir, name)
+	part := path + partSuffix
+	out, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(part, path)
+	}
+	if err != nil {
+		os.Remove(part)
+		return err
+	}
+	return nil
+}
+
+func (s *LocalBackupSink) List(ctx context.Context) ([]SinkFile, error) {
+	files := []SinkFile{}
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return files, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, SinkFile{Name: entry.Name(), Size: info.Size()})
+	}
+	return files, nil
+}
+
+func (s *LocalBackupSink) Remove(ctx context.Context, name string) error {
+	if err := os.Remove(filepath.Join(s.Dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalBackupSink) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.Dir, name))
+}
+
+func (s *LocalBackupSink) Close() error {
+	return nil
+}
+
+func (s *LocalBackupSink) Location(name string) string {
+	return filepath.Join(s.Dir, name)
+}
+
+func (s *LocalBackupSink) String() string {
+	return s.Dir
+}
+
+// remoteLocation returns the URL of the file name in the remote destination u, without credentials
+func remoteLocation(u *url.URL, name string) string {
+	l := *u
+	l.User = nil
+	l.RawQuery = ""
+	l.Path = path.Join("/", u.Path, name)
+	return l.String()
+}
+
+// partSuffix is added to the name of a backup file while it is written
+const partSuffix = ".part"
+
+// cleanPrefix returns the path of the remote destination without leading and trailing slashes
+func cleanPrefix(p string) string {
+	return strings.Trim(path.Clean("/"+p), "/")
+}
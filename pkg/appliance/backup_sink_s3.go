@@ -0,0 +1,130 @@
+package appliance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3PartSize is the size of each part of a multipart upload. Backups larger than one part, or of unknown size,
+// are uploaded in parts, which are buffered in memory.
+const s3PartSize = 16 * 1024 * 1024
+
+// s3Sink writes the backup files to a bucket of Amazon S3 or an S3 compatible storage, such as MinIO.
+// The destination is s3://bucket/prefix, with the optional query parameters 'endpoint', for storage other than
+// Amazon S3, and 'region', which defaults to AWS_REGION or us-east-1. Temporary credentials also need the session
+// token in AWS_SESSION_TOKEN.
+type s3Sink struct {
+	url    *url.URL
+	bucket string
+	prefix string
+	client *minio.Client
+}
+
+func newS3Sink(u *url.URL, sinkCredentials SinkCredentials) (*s3Sink, error) {
+	s := &s3Sink{
+		url:    u,
+		bucket: u.Host,
+		prefix: cleanPrefix(u.Path),
+	}
+	if len(s.bucket) <= 0 {
+		return nil, fmt.Errorf("no bucket in the backup destination %s", u.Redacted())
+	}
+	region := u.Query().Get("region")
+	if len(region) <= 0 {
+		region = os.Getenv("AWS_REGION")
+	}
+	if len(region) <= 0 {
+		region = "us-east-1"
+	}
+	opts := &minio.Options{Region: region, Secure: true, BucketLookup: minio.BucketLookupDNS}
+	host := fmt.Sprintf("s3.%s.amazonaws.com", region)
+	if endpoint := u.Query().Get("endpoint"); len(endpoint) > 0 {
+		e, err := url.Parse(endpoint)
+		if err != nil || len(e.Host) <= 0 {
+			return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+		}
+		// a custom endpoint is addressed in the path style, /bucket/key
+		host, opts.Secure, opts.BucketLookup = e.Host, e.Scheme != "http", minio.BucketLookupPath
+	}
+	accessKey, secretKey, err := sinkCredentials(u)
+	if err != nil {
+		return nil, err
+	}
+	opts.Creds = credentials.NewStaticV4(accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN"))
+	if s.client, err = minio.New(host, opts); err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %w", host, err)
+	}
+	return s, nil
+}
+
+func (s *s3Sink) key(name string) string {
+	return strings.TrimPrefix(s.prefix+"/"+name, "/")
+}
+
+func (s *s3Sink) Write(ctx context.Context, name string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, s.key(name), r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    s3PartSize,
+	})
+	if err != nil {
+		return fmt.Errorf("could not upload backup to %s: %w", s.Location(name), err)
+	}
+	return nil
+}
+
+func (s *s3Sink) List(ctx context.Context) ([]SinkFile, error) {
+	files := []SinkFile{}
+	prefix := s.key("")
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("could not list %s: %w", s.String(), object.Err)
+		}
+		name := strings.TrimPrefix(object.Key, prefix)
+		// the objects in sub directories of the prefix are returned as common prefixes ending with a slash
+		if len(name) <= 0 || strings.Contains(name, "/") {
+			continue
+		}
+		files = append(files, SinkFile{Name: name, Size: object.Size})
+	}
+	return files, nil
+}
+
+func (s *s3Sink) Remove(ctx context.Context, name string) error {
+	// S3 doesn't return an error for an object which doesn't exist
+	if err := s.client.RemoveObject(ctx, s.bucket, s.key(name), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("could not remove %s: %w", s.Location(name), err)
+	}
+	return nil
+}
+
+func (s *s3Sink) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, s.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not download %s: %w", s.Location(name), err)
+	}
+	// the object is only requested when it is read or its info is read
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, fmt.Errorf("could not download %s: %w", s.Location(name), err)
+	}
+	return object, nil
+}
+
+func (s *s3Sink) Close() error {
+	return nil
+}
+
+func (s *s3Sink) Location(name string) string {
+	return remoteLocation(s.url, name)
+}
+
+func (s *s3Sink) String() string {
+	return remoteLocation(s.url, "")
+}
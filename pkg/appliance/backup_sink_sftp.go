@@ -0,0 +1,236 @@
+package appliance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpDialTimeout is how long the connection to the SFTP server and the SSH handshake can take
+const sftpDialTimeout = 30 * time.Second
+
+// sftpSink writes the backup files to a directory on an SFTP server, sftp://[user@]host[:port]/path.
+// The user defaults to the current user. The host key must be in ~/.ssh/known_hosts, and the keys of the SSH agent
+// are tried before the password from the keyring.
+type sftpSink struct {
+	url         *url.URL
+	dir         string
+	credentials SinkCredentials
+	mu          sync.Mutex
+	conn        *ssh.Client
+	client      *sftp.Client
+}
+
+func newSFTPSink(u *url.URL, credentials SinkCredentials) (*sftpSink, error) {
+	return &sftpSink{url: u, dir: path.Clean("/" + u.Path), credentials: credentials}, nil
+}
+
+// connect opens the SFTP session on first use, and creates the destination directory
+func (s *sftpSink) connect(ctx context.Context) (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+	username := s.url.User.Username()
+	if len(username) <= 0 {
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read the known SSH host keys, the host key of %s must be in ~/.ssh/known_hosts: %w", s.url.Hostname(), err)
+	}
+	auth := []ssh.AuthMethod{}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); len(sock) > 0 {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	auth = append(auth, ssh.PasswordCallback(func() (string, error) {
+		_, secret, err := s.credentials(s.url)
+		return secret, err
+	}))
+	addr := s.url.Host
+	if len(s.url.Port()) <= 0 {
+		addr = net.JoinHostPort(s.url.Hostname(), "22")
+	}
+	conn, err := dialSSH(ctx, addr, &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         sftpDialTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", addr, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not start SFTP on %s: %w", addr, err)
+	}
+	if err := client.MkdirAll(s.dir); err != nil {
+		client.Close()
+		conn.Close()
+		return nil, fmt.Errorf("could not create directory %s: %w", s.dir, err)
+	}
+	s.conn = conn
+	s.client = client
+	return client, nil
+}
+
+// dialSSH connects to the SSH server at addr. The connection and the handshake are stopped when ctx is done,
+// or after the timeout of the config.
+func dialSSH(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// the handshake has no context, closing the connection stops it
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func (s *sftpSink) Write(ctx context.Context, name string, r io.Reader, size int64) error {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	p := path.Join(s.dir, name)
+	if err := sftpWriteFile(ctx, client, p+partSuffix, r); err != nil {
+		client.Remove(p + partSuffix)
+		return err
+	}
+	// a plain SFTP rename fails if the file exists, so a backup written again replaces the old one with the posix extension
+	if err := client.PosixRename(p+partSuffix, p); err != nil {
+		if err := client.Rename(p+partSuffix, p); err != nil {
+			return fmt.Errorf("could not rename %s: %w", p+partSuffix, err)
+		}
+	}
+	return nil
+}
+
+// sftpWriteFile writes the content of r to the file name, and stops when ctx is done
+func sftpWriteFile(ctx context.Context, client *sftp.Client, name string, r io.Reader) error {
+	f, err := client.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %w", name, err)
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.ReadFrom(&contextReader{ctx: ctx, r: r}); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write %s: %w", name, err)
+	}
+	return f.Close()
+}
+
+// contextReader returns the error of ctx once it is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+func (s *sftpSink) List(ctx context.Context) ([]SinkFile, error) {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := client.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not list %s: %w", s.dir, err)
+	}
+	files := []SinkFile{}
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() {
+			files = append(files, SinkFile{Name: entry.Name(), Size: entry.Size()})
+		}
+	}
+	return files, nil
+}
+
+func (s *sftpSink) Remove(ctx context.Context, name string) error {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := client.Remove(path.Join(s.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not remove %s: %w", path.Join(s.dir, name), err)
+	}
+	return nil
+}
+
+func (s *sftpSink) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.Open(path.Join(s.dir, name))
+}
+
+func (s *sftpSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	s.client.Close()
+	err := s.conn.Close()
+	s.conn, s.client = nil, nil
+	return err
+}
+
+func (s *sftpSink) Location(name string) string {
+	return remoteLocation(s.url, name)
+}
+
+func (s *sftpSink) String() string {
+	return remoteLocation(s.url, "")
+}
@@ -0,0 +1,494 @@
+package appliance
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func staticCredentials(username, secret string) SinkCredentials {
+	return func(u *url.URL) (string, string, error) {
+		return username, secret, nil
+	}
+}
+
+func TestIsRemoteBackupDestination(t *testing.T) {
+	for destination, want := range map[string]bool{
+		"/tmp/backup":                false,
+		"~/Downloads/appgate/backup": false,
+		"s3://bucket/prefix":         true,
+		"sftp://backup@host/backups": true,
+		"webdavs://host/backups":     true,
+		`C:\Users\admin\backup`:      false,
+	} {
+		if got := IsRemoteBackupDestination(destination); got != want {
+			t.Errorf("IsRemoteBackupDestination(%q) = %t, want %t", destination, got, want)
+		}
+	}
+}
+
+func TestLocalBackupSink(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "appgate", "backup")
+	sink, err := NewBackupSink(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(context.Background(), "backup.bkp", strings.NewReader("content"), 7); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(sink.Location("backup.bkp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "content" {
+		t.Errorf("got %q", content)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the backup file, got %d files", len(entries))
+	}
+
+	failing := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("connection reset")))
+	if err := sink.Write(context.Background(), "failed.bkp", failing, -1); err == nil {
+		t.Fatal("expected error")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected the failed backup to be removed, got %d files", len(entries))
+	}
+}
+
+// fakeS3 stores the objects which are uploaded with a single PUT, or with a multipart upload
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	parts   map[string]map[int][]byte
+	tokens  map[string]bool
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") || !strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/s3/aws4_request") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	f.tokens[r.Header.Get("X-Amz-Security-Token")] = true
+	q := r.URL.Query()
+	id := q.Get("uploadId")
+	_, initiate := q["uploads"]
+	switch {
+	case r.Method == http.MethodPost && initiate:
+		id = fmt.Sprintf("upload-%d", len(f.parts)+1)
+		f.parts[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && len(id) > 0:
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		body, _ := io.ReadAll(r.Body)
+		f.parts[id][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n))
+	case r.Method == http.MethodPost && len(id) > 0:
+		content := []byte{}
+		for n := 1; n <= len(f.parts[id]); n++ {
+			content = append(content, f.parts[id][n]...)
+		}
+		f.objects[r.URL.Path] = content
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>backups</Bucket><ETag>"multipart"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodGet && q.Get("list-type") == "2":
+		// ListObjectsV2 of the bucket, without the objects in sub directories of the prefix
+		prefix := "/backups/" + q.Get("prefix")
+		fmt.Fprint(w, "<ListBucketResult><Name>backups</Name><IsTruncated>false</IsTruncated>")
+		for p, content := range f.objects {
+			if strings.HasPrefix(p, prefix) && !strings.Contains(strings.TrimPrefix(p, prefix), "/") {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", strings.TrimPrefix(p, "/backups/"), len(content))
+			}
+		}
+		fmt.Fprint(w, "</ListBucketResult>")
+	case r.Method == http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		content, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+			return
+		}
+		w.Header().Set("ETag", `"object"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	case r.Method == http.MethodPut:
+		var body []byte
+		if r.Header.Get("X-Amz-Content-Sha256") == "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+			body = decodeAWSChunked(r.Body)
+		} else {
+			body, _ = io.ReadAll(r.Body)
+		}
+		f.objects[r.URL.Path] = body
+		w.Header().Set("ETag", `"single"`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// decodeAWSChunked returns the payload of a body signed with the streaming signature, which is sent in chunks of
+// <hex size>;chunk-signature=<signature>\r\n<data>\r\n
+func decodeAWSChunked(r io.Reader) []byte {
+	br := bufio.NewReader(r)
+	payload := []byte{}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return payload
+		}
+		n, err := strconv.ParseInt(strings.SplitN(line, ";", 2)[0], 16, 64)
+		if err != nil || n == 0 {
+			return payload
+		}
+		chunk := make([]byte, n+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return payload
+		}
+		payload = append(payload, chunk[:n]...)
+	}
+}
+
+func TestS3Sink(t *testing.T) {
+	t.Setenv("AWS_SESSION_TOKEN", "session-token")
+	fake := &fakeS3{objects: map[string][]byte{}, parts: map[string]map[int][]byte{}, tokens: map[string]bool{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	sink, err := NewBackupSink("s3://backups/appgate/sdp?region=eu-west-1&endpoint="+url.QueryEscape(server.URL), staticCredentials("access", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if want := "s3://backups/appgate/sdp/backup.bkp"; sink.Location("backup.bkp") != want {
+		t.Errorf("got location %s, want %s", sink.Location("backup.bkp"), want)
+	}
+
+	large := bytes.Repeat([]byte("backup"), s3PartSize/6+1000)
+	tests := []struct {
+		name    string
+		content []byte
+		size    int64
+	}{
+		{name: "small.bkp", content: []byte("content"), size: 7},
+		{name: "unknown-size.bkp", content: []byte("content"), size: -1},
+		{name: "multipart.bkp", content: large, size: int64(len(large))},
+		{name: "multipart-unknown-size.bkp", content: large, size: -1},
+	}
+	for _, tt := range tests {
+		if err := sink.Write(context.Background(), tt.name, bytes.NewReader(tt.content), tt.size); err != nil {
+			t.Fatalf("Write(%s) error = %s", tt.name, err)
+		}
+		if got := fake.objects["/backups/appgate/sdp/"+tt.name]; !bytes.Equal(got, tt.content) {
+			t.Errorf("Write(%s) got %d bytes, want %d", tt.name, len(got), len(tt.content))
+		}
+	}
+	if len(fake.parts) < 3 {
+		t.Errorf("expected multipart uploads for the large backups and the backups of unknown size, got %d", len(fake.parts))
+	}
+	fake.objects["/backups/appgate/sdp/old/backup.bkp"] = []byte("in a sub directory")
+	fake.objects["/backups/appgate/other.bkp"] = []byte("outside of the prefix")
+	if err := sink.Remove(context.Background(), "small.bkp"); err != nil {
+		t.Fatal(err)
+	}
+	files, err := sink.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := map[string]int64{}
+	for _, f := range files {
+		sizes[f.Name] = f.Size
+	}
+	want := map[string]int64{"unknown-size.bkp": 7, "multipart.bkp": int64(len(large)), "multipart-unknown-size.bkp": int64(len(large))}
+	if len(sizes) != len(want) {
+		t.Errorf("List() got %v, want %v", sizes, want)
+	}
+	for name, size := range want {
+		if sizes[name] != size {
+			t.Errorf("List() got %v, want %v", sizes, want)
+		}
+	}
+	r, err := sink.Open(context.Background(), "unknown-size.bkp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(r)
+	r.Close()
+	if string(content) != "content" {
+		t.Errorf("Open() got %q", content)
+	}
+	if _, err := sink.Open(context.Background(), "small.bkp"); err == nil {
+		t.Error("expected error for a removed backup")
+	}
+	if len(fake.tokens) != 1 || !fake.tokens["session-token"] {
+		t.Errorf("expected the session token in all requests, got %v", fake.tokens)
+	}
+}
+
+func TestWebDAVSink(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		collections = map[string]bool{"/dav": true}
+		files       = map[string]string{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		p := strings.TrimSuffix(r.URL.Path, "/")
+		switch r.Method {
+		case "MKCOL":
+			if collections[p] {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			collections[p] = true
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodPut:
+			if !collections[filepath.Dir(p)] {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			files[p] = string(body)
+			w.WriteHeader(http.StatusCreated)
+		case "MOVE":
+			destination, _ := url.Parse(r.Header.Get("Destination"))
+			files[destination.Path] = files[p]
+			delete(files, p)
+			w.WriteHeader(http.StatusCreated)
+		case "PROPFIND":
+			if r.Header.Get("Depth") != "1" || !collections[p] {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+			fmt.Fprintf(w, `<d:response><d:href>%s/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop></d:propstat></d:response>`, p)
+			for c := range collections {
+				if filepath.Dir(c) == p {
+					fmt.Fprintf(w, `<d:response><d:href>%s/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop></d:propstat></d:response>`, c)
+				}
+			}
+			for name, content := range files {
+				if filepath.Dir(name) == p {
+					fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:getcontentlength>%d</d:getcontentlength><d:resourcetype/></d:prop></d:propstat></d:response>`, (&url.URL{Path: name}).EscapedPath(), len(content))
+				}
+			}
+			fmt.Fprint(w, `</d:multistatus>`)
+		case http.MethodGet:
+			content, ok := files[p]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, content)
+		case http.MethodDelete:
+			if _, ok := files[p]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(files, p)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	sink, err := NewBackupSink("webdav://"+u.Host+"/dav/appgate/backup", staticCredentials("admin", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	for _, name := range []string{"one.bkp", "two.bkp"} {
+		if err := sink.Write(context.Background(), name, strings.NewReader(name), int64(len(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(files) != 2 || files["/dav/appgate/backup/one.bkp"] != "one.bkp" || files["/dav/appgate/backup/two.bkp"] != "two.bkp" {
+		t.Errorf("got files %v", files)
+	}
+
+	collections["/dav/appgate/backup/old"] = true
+	files["/dav/appgate/backup/with space.bkp"] = "space"
+	for _, name := range []string{"one.bkp", "missing.bkp"} {
+		if err := sink.Remove(context.Background(), name); err != nil {
+			t.Fatalf("Remove(%s) error = %s", name, err)
+		}
+	}
+	listed, err := sink.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 2 || listed[0].Name == listed[1].Name {
+		t.Fatalf("List() got %+v", listed)
+	}
+	for _, f := range listed {
+		if want := int64(len(files["/dav/appgate/backup/"+f.Name])); f.Size != want || want == 0 {
+			t.Errorf("List() got %+v, want size %d", f, want)
+		}
+	}
+	r, err := sink.Open(context.Background(), "with space.bkp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(r)
+	r.Close()
+	if string(content) != "space" {
+		t.Errorf("Open() got %q", content)
+	}
+	if _, err := sink.Open(context.Background(), "one.bkp"); err == nil {
+		t.Error("expected error for a removed backup")
+	}
+}
+
+// newMemorySFTPSink returns a sink connected to an SFTP server with a file system in memory
+func newMemorySFTPSink(t *testing.T, destination string) *sftpSink {
+	t.Helper()
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+	server := sftp.NewRequestServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverReader, serverWriter}, sftp.InMemHandler())
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientReader, clientWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// the client waits for the server to close its side of the connection
+		serverWriter.Close()
+		client.Close()
+		server.Close()
+	})
+	u, _ := url.Parse(destination)
+	sink, _ := newSFTPSink(u, nil)
+	if err := client.MkdirAll(sink.dir); err != nil {
+		t.Fatal(err)
+	}
+	sink.client = client
+	return sink
+}
+
+func TestSFTPSink(t *testing.T) {
+	sink := newMemorySFTPSink(t, "sftp://backup@host/home/backup/appgate")
+	content := bytes.Repeat([]byte("backup"), 20000)
+	for _, size := range []int64{int64(len(content)), -1} {
+		if err := sink.Write(context.Background(), "backup.bkp", bytes.NewReader(content), size); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := sink.client.Open("/home/backup/appgate/backup.bkp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(f)
+	f.Close()
+	if !bytes.Equal(got, content) {
+		t.Errorf("file content differs, got %d bytes", len(got))
+	}
+	if _, err := sink.client.Stat("/home/backup/appgate/backup.bkp" + partSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the part file to be renamed, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sink.Write(ctx, "cancelled.bkp", bytes.NewReader(content), -1); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelled write, got %v", err)
+	}
+	if _, err := sink.client.Stat("/home/backup/appgate/cancelled.bkp" + partSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the part file of the cancelled write to be removed, got %v", err)
+	}
+}
+
+func TestDialSSHContext(t *testing.T) {
+	// the server accepts the connection but never answers the SSH handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = dialSSH(ctx, listener.Addr().String(), &ssh.ClientConfig{
+		User:            "backup",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         sftpDialTimeout,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the handshake to stop with the context, it took %s", elapsed)
+	}
+}
+
+func TestPruneRemoteBackups(t *testing.T) {
+	sink := newMemorySFTPSink(t, "sftp://backup@host/backups")
+	ctx := context.Background()
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		name := BackupFileName("controller", now.Add(-time.Duration(i)*time.Hour))
+		for _, n := range []string{name, name + checksumSuffix, name + metadataSuffix} {
+			if err := sink.Write(ctx, n, strings.NewReader("backup"), 6); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	pruned, err := PruneBackups(ctx, sink, RetentionPolicy{KeepLast: 1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 || pruned[0].Path != "sftp://host/backups/"+pruned[0].Name {
+		t.Fatalf("expected 2 pruned backups, got %+v", pruned)
+	}
+	files, err := sink.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("expected the last backup with its checksum and metadata, got %+v", files)
+	}
+	if err := sink.Remove(ctx, pruned[0].Name); err != nil {
+		t.Errorf("expected no error for a removed file, got %s", err)
+	}
+}
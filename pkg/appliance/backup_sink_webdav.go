@@ -0,0 +1,219 @@
+package appliance
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// webDAVSink writes the backup files to a WebDAV server, over https for webdavs://host/path and http for webdav://host/path.
+// The collections of the path are created if they don't exist.
+type webDAVSink struct {
+	url      *url.URL
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+	mkcol    sync.Once
+	mkcolErr error
+}
+
+func newWebDAVSink(u *url.URL, credentials SinkCredentials) (*webDAVSink, error) {
+	base := &url.URL{Scheme: "http", Host: u.Host, Path: "/" + cleanPrefix(u.Path)}
+	if u.Scheme == "webdavs" {
+		base.Scheme = "https"
+	}
+	s := &webDAVSink{url: u, base: base, client: &http.Client{}}
+	var err error
+	if s.username, s.password, err = credentials(u); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *webDAVSink) do(ctx context.Context, method, u string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	req.SetBasicAuth(s.username, s.password)
+	return s.client.Do(req)
+}
+
+// makeCollections creates each collection of the destination path. A collection which already exists is answered
+// with 405 Method Not Allowed.
+func (s *webDAVSink) makeCollections(ctx context.Context) error {
+	u := *s.base
+	u.Path = ""
+	for _, segment := range strings.Split(strings.Trim(s.base.Path, "/"), "/") {
+		if len(segment) <= 0 {
+			continue
+		}
+		u.Path += "/" + segment
+		res, err := s.do(ctx, "MKCOL", u.String()+"/", nil, 0)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		switch res.StatusCode {
+		case http.StatusCreated, http.StatusOK, http.StatusMethodNotAllowed:
+		default:
+			return fmt.Errorf("could not create WebDAV collection %s: %s", u.Path, res.Status)
+		}
+	}
+	return nil
+}
+
+func (s *webDAVSink) Write(ctx context.Context, name string, r io.Reader, size int64) error {
+	s.mkcol.Do(func() { s.mkcolErr = s.makeCollections(ctx) })
+	if s.mkcolErr != nil {
+		return s.mkcolErr
+	}
+	u := *s.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + name
+	part := u
+	part.Path += partSuffix
+	res, err := s.do(ctx, http.MethodPut, part.String(), io.NopCloser(r), size)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+	default:
+		return fmt.Errorf("could not upload backup to %s: %s", s.Location(name), res.Status)
+	}
+	req, err := http.NewRequestWithContext(ctx, "MOVE", part.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.username, s.password)
+	req.Header.Set("Destination", u.String())
+	req.Header.Set("Overwrite", "T")
+	if res, err = s.client.Do(req); err != nil {
+		return err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusCreated, http.StatusNoContent:
+		return nil
+	}
+	return fmt.Errorf("could not move backup to %s: %s", s.Location(name), res.Status)
+}
+
+// webDAVMultistatus is the response of PROPFIND
+type webDAVMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ContentLength int64 `xml:"getcontentlength"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func (s *webDAVSink) List(ctx context.Context) ([]SinkFile, error) {
+	u := *s.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/"
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", u.String(), strings.NewReader(`<?xml version="1.0"?><propfind xmlns="DAV:"><prop><getcontentlength/><resourcetype/></prop></propfind>`))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(s.username, s.password)
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml")
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	files := []SinkFile{}
+	switch res.StatusCode {
+	case http.StatusMultiStatus:
+	case http.StatusNotFound:
+		return files, nil
+	default:
+		return nil, fmt.Errorf("could not list %s: %s", s.String(), res.Status)
+	}
+	var ms webDAVMultistatus
+	if err := xml.NewDecoder(res.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("could not list %s: %w", s.String(), err)
+	}
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil || len(r.Propstat) <= 0 {
+			continue
+		}
+		// the collection itself and the collections in it are not backup files
+		dir, name := path.Split(href.Path)
+		if strings.TrimSuffix(dir, "/") != strings.TrimSuffix(u.Path, "/") || len(name) <= 0 {
+			continue
+		}
+		var size int64
+		collection := false
+		for _, p := range r.Propstat {
+			size += p.Prop.ContentLength
+			collection = collection || p.Prop.ResourceType.Collection != nil
+		}
+		if !collection {
+			files = append(files, SinkFile{Name: name, Size: size})
+		}
+	}
+	return files, nil
+}
+
+func (s *webDAVSink) Remove(ctx context.Context, name string) error {
+	u := *s.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + name
+	res, err := s.do(ctx, http.MethodDelete, u.String(), nil, 0)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return fmt.Errorf("could not remove %s: %s", s.Location(name), res.Status)
+}
+
+func (s *webDAVSink) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	u := *s.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + name
+	res, err := s.do(ctx, http.MethodGet, u.String(), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("could not download %s: %s", s.Location(name), res.Status)
+	}
+	return res.Body, nil
+}
+
+func (s *webDAVSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *webDAVSink) Location(name string) string {
+	return remoteLocation(s.url, name)
+}
+
+func (s *webDAVSink) String() string {
+	return remoteLocation(s.url, "")
+}
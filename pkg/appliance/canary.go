@@ -0,0 +1,206 @@
+package appliance
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	"gopkg.in/yaml.v3"
+)
+
+// StageCanaryGates is the name of the journal step which verifies the canary batch
+const StageCanaryGates = "canary-gates"
+
+// CanaryLabel is the label of the canary batch in the upgrade plan
+const CanaryLabel = "canary"
+
+// ErrCanaryGateFailed is returned when the canary appliances do not pass the gates after the upgrade
+var ErrCanaryGateFailed = errors.New("canary gates failed")
+
+// CanaryGates are the checks run on the canary appliances before the rest of the appliances are upgraded.
+// The status of each canary must always be healthy, the metrics and resolve-names checks are optional.
+//
+//	wait: 5m
+//	metrics:
+//	  - name: vpn_active_sessions
+//	    function: gateway
+//	    min: 1
+//	resolve-names:
+//	  - dns://intranet.company.com
+type CanaryGates struct {
+	// Wait is the time to let the canaries run before the gates are checked
+	Wait         time.Duration `yaml:"wait" json:"wait,omitempty"`
+	Metrics      []MetricGate  `yaml:"metrics" json:"metrics,omitempty"`
+	ResolveNames []string      `yaml:"resolve-names" json:"resolve_names,omitempty"`
+}
+
+// MetricGate requires every sample of a metric to be within the thresholds.
+// If Function is set, the metric is only checked on appliances with that function.
+type MetricGate struct {
+	Name     string   `yaml:"name" json:"name"`
+	Function string   `yaml:"function" json:"function,omitempty"`
+	Min      *float64 `yaml:"min" json:"min,omitempty"`
+	Max      *float64 `yaml:"max" json:"max,omitempty"`
+}
+
+// ReadCanaryGates reads and validates a canary gates file in YAML or JSON format
+func ReadCanaryGates(path string) (*CanaryGates, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	g := &CanaryGates{}
+	if err := dec.Decode(g); err != nil {
+		return nil, fmt.Errorf("Could not read canary gates %s: %w", path, err)
+	}
+	if err := validateMetricGates(g.Metrics); err != nil {
+		return nil, fmt.Errorf("Invalid canary gates %s: %w", path, err)
+	}
+	return g, nil
+}
+
+func validFunction(function string) bool {
+	for _, f := range []string{FunctionController, FunctionGateway, FunctionPortal, FunctionConnector, FunctionLogServer, FunctionLogForwarder} {
+		if strings.EqualFold(f, function) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyCanary moves up to n appliances of each site and function group out of the batches and into a new first
+// batch. The canary batch is verified with the canary gates before the rest of the batches are upgraded.
+func (p *UpgradePlan) ApplyCanary(n int) error {
+	if n <= 0 {
+		return nil
+	}
+	all := []openapi.Appliance{}
+	for _, b := range p.Batches {
+		all = append(all, b...)
+	}
+	if len(all) <= 0 {
+		return errors.New("there are no additional appliances to use as canaries")
+	}
+	groups := SplitAppliancesByGroup(all)
+	keys := make([]int, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	canaries := []openapi.Appliance{}
+	isCanary := map[string]bool{}
+	for _, k := range keys {
+		group := groups[k]
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].GetName() < group[j].GetName()
+		})
+		for i := 0; i < n && i < len(group); i++ {
+			canaries = append(canaries, group[i])
+			isCanary[group[i].GetId()] = true
+		}
+	}
+
+	batches := [][]openapi.Appliance{canaries}
+	options := []BatchOptions{{Label: CanaryLabel, Canary: true}}
+	for i, b := range p.Batches {
+		rest := []openapi.Appliance{}
+		for _, a := range b {
+			if !isCanary[a.GetId()] {
+				rest = append(rest, a)
+			}
+		}
+		if len(rest) > 0 {
+			batches = append(batches, rest)
+			options = append(options, p.Batch(i))
+		}
+	}
+	p.Batches = batches
+	p.BatchOptions = options
+	return nil
+}
+
+// CheckCanaryGates runs the gates on each canary appliance and returns the checks which failed.
+// peerVersion is the peer API version used to read the metrics of the upgraded canaries.
+func CheckCanaryGates(ctx context.Context, a *Appliance, gates CanaryGates, canaries []openapi.Appliance, stats openapi.StatsAppliancesList, peerVersion int) []VerifyResult {
+	spec := VerifySpec{
+		Healthy:      true,
+		Metrics:      gates.Metrics,
+		ResolveNames: gates.ResolveNames,
+	}
+	return VerifyFailures(Verify(ctx, a, spec, canaries, stats, peerVersion))
+}
+
+func lowerAll(s []string) []string {
+	result := make([]string, 0, len(s))
+	for _, v := range s {
+		result = append(result, strings.ToLower(v))
+	}
+	return result
+}
+
+// check verifies that every sample of the metric in the Prometheus text exposition format is within the thresholds
+func (m MetricGate) check(text string) error {
+	values, err := metricValues(text, m.Name)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if m.Min != nil && v < *m.Min {
+			return fmt.Errorf("value %g is below the minimum %g", v, *m.Min)
+		}
+		if m.Max != nil && v > *m.Max {
+			return fmt.Errorf("value %g is above the maximum %g", v, *m.Max)
+		}
+	}
+	return nil
+}
+
+// metricValues returns the value of each sample of the metric in the Prometheus text exposition format
+func metricValues(text, name string) ([]float64, error) {
+	values := []float64{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) <= 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sample := line
+		if i := strings.IndexAny(line, "{ "); i >= 0 {
+			sample = line[:i]
+		}
+		if sample != name {
+			continue
+		}
+		rest := line[len(sample):]
+		if strings.HasPrefix(rest, "{") {
+			rest = rest[strings.LastIndex(rest, "}")+1:]
+		}
+		fields := strings.Fields(rest)
+		if len(fields) <= 0 {
+			return nil, fmt.Errorf("could not parse sample %q", line)
+		}
+		// the value is followed by an optional timestamp
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse sample %q: %w", line, err)
+		}
+		values = append(values, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(values) <= 0 {
+		return nil, fmt.Errorf("metric %s not found", name)
+	}
+	return values, nil
+}
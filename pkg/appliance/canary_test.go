@@ -0,0 +1,138 @@
+package appliance
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+)
+
+func TestUpgradePlanApplyCanary(t *testing.T) {
+	gateway := func(id, site string) openapi.Appliance {
+		return openapi.Appliance{
+			Id:      openapi.PtrString(id),
+			Name:    id,
+			Site:    openapi.PtrString(site),
+			Gateway: &openapi.ApplianceAllOfGateway{Enabled: openapi.PtrBool(true)},
+		}
+	}
+	portal := openapi.Appliance{
+		Id:     openapi.PtrString("p1"),
+		Name:   "p1",
+		Site:   openapi.PtrString("siteA"),
+		Portal: &openapi.Portal{Enabled: openapi.PtrBool(true)},
+	}
+	names := func(batches [][]openapi.Appliance) [][]string {
+		result := [][]string{}
+		for _, b := range batches {
+			n := []string{}
+			for _, a := range b {
+				n = append(n, a.GetName())
+			}
+			result = append(result, n)
+		}
+		return result
+	}
+
+	plan := &UpgradePlan{
+		Batches: [][]openapi.Appliance{
+			{gateway("g2", "siteA"), gateway("g3", "siteB"), portal},
+			{gateway("g1", "siteA"), gateway("g4", "siteB")},
+		},
+		BatchOptions: []BatchOptions{{}, {Label: "last", MaxParallel: 1}},
+	}
+	if err := plan.ApplyCanary(1); err != nil {
+		t.Fatalf("ApplyCanary() error = %s", err)
+	}
+	got := names(plan.Batches)
+	if len(got) != 3 || len(got[0]) != 3 {
+		t.Fatalf("expected one canary of each group and two remaining batches, got %v", got)
+	}
+	canaries := map[string]bool{}
+	for _, n := range got[0] {
+		canaries[n] = true
+	}
+	// the canary of each group is the first appliance by name
+	if !canaries["g1"] || !canaries["g3"] || !canaries["p1"] {
+		t.Errorf("unexpected canaries %v", got[0])
+	}
+	if want := [][]string{{"g2"}, {"g4"}}; !reflect.DeepEqual(got[1:], want) {
+		t.Errorf("want remaining batches %v, got %v", want, got[1:])
+	}
+	if b := plan.Batch(0); b.Label != CanaryLabel || !b.Canary {
+		t.Errorf("unexpected canary batch options %+v", b)
+	}
+	if b := plan.Batch(2); b.Label != "last" || b.MaxParallel != 1 || b.Canary {
+		t.Errorf("expected the options of the remaining batch to be kept, got %+v", b)
+	}
+
+	empty := &UpgradePlan{}
+	if err := empty.ApplyCanary(1); err == nil {
+		t.Error("expected error without additional appliances")
+	}
+	if err := empty.ApplyCanary(0); err != nil {
+		t.Errorf("expected no error when canaries are disabled, got %s", err)
+	}
+}
+
+func TestMetricGateCheck(t *testing.T) {
+	text := `# HELP vpn_active_sessions Active sessions
+# TYPE vpn_active_sessions gauge
+vpn_active_sessions{site="a"} 12
+vpn_active_sessions{site="b"} 3 1667610000000
+vpn_active_sessions_total 100
+`
+	min, max := 1.0, 10.0
+	tests := []struct {
+		name    string
+		gate    MetricGate
+		wantErr *regexp.Regexp
+	}{
+		{name: "within min", gate: MetricGate{Name: "vpn_active_sessions", Min: &min}},
+		{name: "above max", gate: MetricGate{Name: "vpn_active_sessions", Max: &max}, wantErr: regexp.MustCompile(`value 12 is above the maximum 10`)},
+		{name: "without labels", gate: MetricGate{Name: "vpn_active_sessions_total", Max: &max}, wantErr: regexp.MustCompile(`value 100 is above the maximum 10`)},
+		{name: "missing metric", gate: MetricGate{Name: "audit_events", Min: &min}, wantErr: regexp.MustCompile(`metric audit_events not found`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.gate.check(text)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("check() error = %s", err)
+				}
+				return
+			}
+			if err == nil || !tt.wantErr.MatchString(err.Error()) {
+				t.Fatalf("expected error matching %s, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReadCanaryGates(t *testing.T) {
+	gates, err := ReadCanaryGates(writePlanFile(t, `wait: 5m
+metrics:
+  - name: vpn_active_sessions
+    function: gateway
+    min: 1
+resolve-names:
+  - dns://intranet.company.com
+`))
+	if err != nil {
+		t.Fatalf("ReadCanaryGates() error = %s", err)
+	}
+	if gates.Wait.Minutes() != 5 || len(gates.Metrics) != 1 || *gates.Metrics[0].Min != 1 || len(gates.ResolveNames) != 1 {
+		t.Errorf("unexpected gates %+v", gates)
+	}
+
+	for content, want := range map[string]string{
+		"metrics:\n  - name: cpu\n":                              `metric "cpu" has neither min nor max`,
+		"metrics:\n  - name: cpu\n    function: x\n    max: 1\n": `unknown function "x"`,
+		"timeout: 1m\n": `field timeout not found`,
+	} {
+		if _, err := ReadCanaryGates(writePlanFile(t, content)); err == nil || !regexp.MustCompile(want).MatchString(err.Error()) {
+			t.Errorf("expected error matching %q, got %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package appliance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	"github.com/appgate/sdpctl/pkg/events"
+	"github.com/appgate/sdpctl/pkg/tui"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultDrainTimeout is how long to wait for the sessions on a gateway to drain, unless another timeout is given
+const DefaultDrainTimeout = 15 * time.Minute
+
+// DrainInterval is the time between each check of the number of sessions on a draining gateway
+var DrainInterval = 10 * time.Second
+
+// DrainOptions decides when a gateway is drained and can be upgraded
+type DrainOptions struct {
+	// Threshold is the number of sessions which may be left on the gateway
+	Threshold int
+	// Timeout is the time after which the gateway is upgraded even if it is not drained
+	Timeout time.Duration
+}
+
+// GatewaySessions returns the number of active sessions on the gateway according to the stats
+func GatewaySessions(stats openapi.StatsAppliancesList, id string) (int, bool) {
+	for _, s := range stats.GetData() {
+		if s.GetId() != id {
+			continue
+		}
+		if g, ok := s.GetGatewayOk(); ok && g.NumberOfSessions != nil {
+			return int(g.GetNumberOfSessions()), true
+		}
+		if n, ok := s.GetNumberOfSessionsOk(); ok {
+			return int(*n), true
+		}
+	}
+	return 0, false
+}
+
+// DrainGateway waits until the number of active sessions on the gateway is at or below the threshold.
+// If the sessions have not drained when the timeout expires, a warning is logged and nil is returned,
+// so that the upgrade can continue. The number of sessions left is shown in the tracker.
+func (a *Appliance) DrainGateway(ctx context.Context, gateway openapi.Appliance, opts DrainOptions, tracker *tui.Tracker) error {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+	logEntry := log.WithFields(log.Fields{
+		"appliance": gateway.GetName(),
+		"threshold": opts.Threshold,
+		"timeout":   timeout,
+	})
+	logEntry.Info("draining sessions")
+	deadline := time.After(timeout)
+	for {
+		stats, _, err := a.Stats(ctx)
+		if err != nil {
+			return err
+		}
+		sessions, ok := GatewaySessions(*stats, gateway.GetId())
+		if !ok {
+			logEntry.Warn("could not read the number of sessions, skipping drain")
+			return nil
+		}
+		status := fmt.Sprintf("draining %d sessions", sessions)
+		if tracker != nil {
+			tracker.Update(status)
+		}
+		events.FromContext(ctx).Status(gateway.GetName(), status)
+		if sessions <= opts.Threshold {
+			logEntry.WithField("sessions", sessions).Info("gateway drained")
+			return nil
+		}
+		logEntry.WithField("sessions", sessions).Debug("waiting for sessions to drain")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			logEntry.WithField("sessions", sessions).Warn("drain timeout expired, upgrading with sessions left")
+			return nil
+		case <-time.After(DrainInterval):
+		}
+	}
+}
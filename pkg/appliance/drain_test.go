@@ -0,0 +1,90 @@
+package appliance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	"github.com/appgate/sdpctl/pkg/httpmock"
+)
+
+func TestDrainGateway(t *testing.T) {
+	interval := DrainInterval
+	DrainInterval = time.Millisecond
+	defer func() { DrainInterval = interval }()
+
+	gateway := openapi.Appliance{Id: openapi.PtrString("g1"), Name: "gateway-site1"}
+	statsResponder := func(sessions ...int) (http.HandlerFunc, *int) {
+		calls := 0
+		return func(w http.ResponseWriter, r *http.Request) {
+			n := sessions[len(sessions)-1]
+			if calls < len(sessions) {
+				n = sessions[calls]
+			}
+			calls++
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"data": [{"id": "g1", "online": true, "gateway": {"status": "healthy", "numberOfSessions": %d}}]}`, n)
+		}, &calls
+	}
+
+	tests := []struct {
+		name      string
+		sessions  []int
+		opts      DrainOptions
+		wantCalls int
+	}{
+		{
+			name:      "drained",
+			sessions:  []int{12, 4, 0},
+			opts:      DrainOptions{Timeout: time.Minute},
+			wantCalls: 3,
+		},
+		{
+			name:      "below threshold",
+			sessions:  []int{12, 4, 0},
+			opts:      DrainOptions{Threshold: 5, Timeout: time.Minute},
+			wantCalls: 2,
+		},
+		{
+			name:     "timeout",
+			sessions: []int{12},
+			opts:     DrainOptions{Timeout: 20 * time.Millisecond},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := httpmock.NewRegistry(t)
+			defer registry.Teardown()
+			responder, calls := statsResponder(tt.sessions...)
+			registry.Register("/stats/appliances", responder)
+			registry.Serve()
+			a := &Appliance{APIClient: registry.Client}
+
+			if err := a.DrainGateway(context.Background(), gateway, tt.opts, nil); err != nil {
+				t.Fatalf("DrainGateway() error = %s", err)
+			}
+			if tt.wantCalls > 0 && *calls != tt.wantCalls {
+				t.Errorf("expected %d stats requests, got %d", tt.wantCalls, *calls)
+			}
+		})
+	}
+}
+
+func TestGatewaySessions(t *testing.T) {
+	stats := openapi.StatsAppliancesList{Data: []openapi.StatsAppliancesListAllOfData{
+		{Id: openapi.PtrString("g1"), Gateway: &openapi.ApplianceWithSessionsRole{NumberOfSessions: openapi.PtrInt32(7)}},
+		{Id: openapi.PtrString("g2"), NumberOfSessions: openapi.PtrInt32(3)},
+		{Id: openapi.PtrString("c1")},
+	}}
+	for id, want := range map[string]int{"g1": 7, "g2": 3} {
+		if got, ok := GatewaySessions(stats, id); !ok || got != want {
+			t.Errorf("GatewaySessions(%s) = %d, %t, want %d", id, got, ok, want)
+		}
+	}
+	if _, ok := GatewaySessions(stats, "c1"); ok {
+		t.Error("expected no sessions for c1")
+	}
+}
@@ -0,0 +1,179 @@
+package appliance
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	"github.com/appgate/sdpctl/pkg/eta"
+	"github.com/appgate/sdpctl/pkg/events"
+)
+
+// Phases of an appliance during 'upgrade prepare' and 'upgrade complete'
+const (
+	PhaseDownloading = "downloading"
+	PhaseVerifying   = "verifying"
+	PhaseInstalling  = "installing"
+	PhaseRebooting   = "rebooting"
+)
+
+// DefaultPhaseDurations are the expected durations of the phases when there is no upgrade history to learn from
+var DefaultPhaseDurations = map[string]time.Duration{
+	PhaseDownloading: 5 * time.Minute,
+	PhaseVerifying:   2 * time.Minute,
+	PhaseInstalling:  10 * time.Minute,
+	PhaseRebooting:   5 * time.Minute,
+}
+
+// upgradePhases are the phases an appliance goes through in each upgrade command, in order
+var upgradePhases = map[string][]string{
+	"prepare":  {PhaseDownloading, PhaseVerifying},
+	"complete": {PhaseInstalling, PhaseRebooting},
+}
+
+// historyEstimateRuns is the number of recent runs the phase durations are learned from
+const historyEstimateRuns = 10
+
+// UpgradePhase returns the phase of an upgrade status, or an empty string if it is not part of a phase
+func UpgradePhase(status string) string {
+	switch {
+	case status == UpgradeStatusDownloading:
+		return PhaseDownloading
+	case status == UpgradeStatusVerifying:
+		return PhaseVerifying
+	case status == UpgradeStatusInstalling:
+		return PhaseInstalling
+	case strings.HasPrefix(status, "rebooting"), status == "switching partition":
+		return PhaseRebooting
+	}
+	return ""
+}
+
+// NewUpgradeEstimator returns an estimator of the time left of an appliance in the upgrade command. The phase
+// durations are the median of the appliances which succeeded in the most recent runs of the command against host,
+// and DefaultPhaseDurations for phases without history.
+func NewUpgradeEstimator(command, host string, runs []*UpgradeRun) *eta.Estimator {
+	names, ok := upgradePhases[command]
+	if !ok {
+		return nil
+	}
+	samples := map[string][]time.Duration{}
+	n := 0
+	for _, r := range runs {
+		if r.Command != command || r.Host != host {
+			continue
+		}
+		if n++; n > historyEstimateRuns {
+			break
+		}
+		for _, a := range r.Appliances {
+			if a.Outcome != events.OutcomeSuccess {
+				continue
+			}
+			for phase, d := range a.phaseDurations() {
+				samples[phase] = append(samples[phase], d)
+			}
+		}
+	}
+	e := &eta.Estimator{PhaseOf: UpgradePhase}
+	for _, name := range names {
+		d := DefaultPhaseDurations[name]
+		if s := samples[name]; len(s) > 0 {
+			d = median(s)
+		}
+		e.Phases = append(e.Phases, eta.Phase{Name: name, Duration: d})
+	}
+	return e
+}
+
+// phaseDurations returns the time the appliance spent in each phase, from its status transitions
+func (a *UpgradeRunAppliance) phaseDurations() map[string]time.Duration {
+	durations := map[string]time.Duration{}
+	for i, s := range a.Statuses {
+		phase := UpgradePhase(s.Status)
+		if len(phase) <= 0 {
+			continue
+		}
+		var end time.Time
+		if i+1 < len(a.Statuses) {
+			end = a.Statuses[i+1].Time
+		} else if a.FinishedAt != nil {
+			end = *a.FinishedAt
+		} else {
+			continue
+		}
+		durations[phase] += end.Sub(s.Time)
+	}
+	return durations
+}
+
+func median(durations []time.Duration) time.Duration {
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	m := len(durations) / 2
+	if len(durations)%2 == 0 {
+		return (durations[m-1] + durations[m]) / 2
+	}
+	return durations[m]
+}
+
+// StepEstimate is the expected duration of a step of 'upgrade complete'
+type StepEstimate struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Estimate returns the expected duration of each step of the plan, given the expected time to upgrade one appliance.
+// Appliances which are upgraded at the same time, because of the batches and the max unavailable limit, count once.
+func (p *UpgradePlan) Estimate(perAppliance time.Duration) []StepEstimate {
+	steps := []StepEstimate{}
+	if p.UpgradePrimary {
+		steps = append(steps, StepEstimate{Name: StagePrimaryController, Duration: perAppliance})
+	}
+	if n := len(p.AdditionalControllers); n > 0 {
+		steps = append(steps, StepEstimate{Name: StageAdditionalControllers, Duration: time.Duration(n) * perAppliance})
+	}
+	if len(p.LogForwardersAndServers) > 0 {
+		steps = append(steps, StepEstimate{Name: StageLogForwardersServers, Duration: perAppliance})
+	}
+	slots := NewUnavailableSlots(p.MaxUnavailable, p.Appliances())
+	for i, batch := range p.Batches {
+		options := p.Batch(i)
+		rounds := 1
+		if options.MaxParallel > 0 {
+			rounds = int(math.Ceil(float64(len(batch)) / float64(options.MaxParallel)))
+		}
+		if r := slots.rounds(batch); r > rounds {
+			rounds = r
+		}
+		d := time.Duration(rounds) * perAppliance
+		if i+1 < len(p.Batches) {
+			d += options.Pause
+		}
+		steps = append(steps, StepEstimate{Name: BatchName(i), Duration: d})
+	}
+	return steps
+}
+
+// rounds returns how many appliances of the same site and function have to wait for each other, at most
+func (s *UnavailableSlots) rounds(appliances []openapi.Appliance) int {
+	if s == nil {
+		return 0
+	}
+	counts := map[string]int{}
+	for _, a := range appliances {
+		for _, key := range slotKeys(a) {
+			counts[key]++
+		}
+	}
+	rounds := 0
+	for key, count := range counts {
+		if limit := s.limits[key]; limit > 0 {
+			if r := int(math.Ceil(float64(count) / float64(limit))); r > rounds {
+				rounds = r
+			}
+		}
+	}
+	return rounds
+}
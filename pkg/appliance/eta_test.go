@@ -0,0 +1,95 @@
+package appliance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	"github.com/appgate/sdpctl/pkg/events"
+)
+
+func TestNewUpgradeEstimator(t *testing.T) {
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+	finished := at(20)
+	run := func(host string, installing int) *UpgradeRun {
+		return &UpgradeRun{
+			Command: "complete",
+			Host:    host,
+			Appliances: []*UpgradeRunAppliance{
+				{
+					Name:       "gateway",
+					Outcome:    events.OutcomeSuccess,
+					FinishedAt: &finished,
+					Statuses: []UpgradeStatusTransition{
+						{Status: UpgradeStatusInstalling, Time: at(0)},
+						{Status: "rebooting, waiting for appliance to come back online", Time: at(installing)},
+						{Status: "switching partition", Time: at(installing + 1)},
+						{Status: UpgradeStatusIdle, Time: at(installing + 3)},
+					},
+				},
+				{
+					Name:    "failed",
+					Outcome: events.OutcomeFailed,
+					Statuses: []UpgradeStatusTransition{
+						{Status: UpgradeStatusInstalling, Time: at(0)},
+						{Status: UpgradeStatusFailed, Time: at(60)},
+					},
+				},
+			},
+		}
+	}
+	runs := []*UpgradeRun{run("appgate.com", 4), run("appgate.com", 6), run("appgate.com", 8), run("other.com", 30)}
+
+	e := NewUpgradeEstimator("complete", "appgate.com", runs)
+	if len(e.Phases) != 2 || e.Phases[0].Duration != 6*time.Minute || e.Phases[1].Duration != 3*time.Minute {
+		t.Errorf("unexpected phases %+v", e.Phases)
+	}
+	e = NewUpgradeEstimator("prepare", "appgate.com", runs)
+	if e.Total() != DefaultPhaseDurations[PhaseDownloading]+DefaultPhaseDurations[PhaseVerifying] {
+		t.Errorf("expected the default durations without history, got %+v", e.Phases)
+	}
+	if NewUpgradeEstimator("cancel", "appgate.com", runs) != nil {
+		t.Error("expected no estimator for cancel")
+	}
+}
+
+func TestUpgradePlanEstimate(t *testing.T) {
+	gateway := func(id string) openapi.Appliance {
+		return openapi.Appliance{
+			Id:      openapi.PtrString(id),
+			Name:    id,
+			Site:    openapi.PtrString("site1"),
+			Gateway: &openapi.ApplianceAllOfGateway{Enabled: openapi.PtrBool(true)},
+		}
+	}
+	plan := &UpgradePlan{
+		UpgradePrimary:        true,
+		AdditionalControllers: []openapi.Appliance{{Name: "c2"}, {Name: "c3"}},
+		Batches:               [][]openapi.Appliance{{gateway("g1"), gateway("g2"), gateway("g3")}, {gateway("g4")}},
+		BatchOptions:          []BatchOptions{{MaxParallel: 2, Pause: time.Minute}, {}},
+	}
+	want := map[string]time.Duration{
+		StagePrimaryController:     10 * time.Minute,
+		StageAdditionalControllers: 20 * time.Minute,
+		BatchName(0):               21 * time.Minute,
+		BatchName(1):               10 * time.Minute,
+	}
+	steps := plan.Estimate(10 * time.Minute)
+	if len(steps) != len(want) {
+		t.Fatalf("unexpected steps %+v", steps)
+	}
+	for _, s := range steps {
+		if s.Duration != want[s.Name] {
+			t.Errorf("%s: got %s, want %s", s.Name, s.Duration, want[s.Name])
+		}
+	}
+
+	// one gateway of the site at a time
+	plan.MaxUnavailable = MaxUnavailable{Value: 1}
+	if s := plan.Estimate(10 * time.Minute)[2]; s.Duration != 31*time.Minute {
+		t.Errorf("expected three rounds with max unavailable, got %s", s.Duration)
+	}
+}
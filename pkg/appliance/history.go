@@ -0,0 +1,295 @@
+package appliance
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/events"
+	"github.com/appgate/sdpctl/pkg/filesystem"
+	"github.com/hashicorp/go-version"
+)
+
+// ErrHistoryNotFound is returned when there is no upgrade run with the given id in the history
+var ErrHistoryNotFound = errors.New("upgrade run not found in the history")
+
+// UpgradeRun is the record of one run of 'upgrade prepare', 'upgrade complete' or 'upgrade cancel'.
+// It is built from the event stream of the command while it runs, and saved in the history directory when it ends.
+type UpgradeRun struct {
+	mu sync.Mutex
+
+	ID          string                 `json:"id"`
+	Command     string                 `json:"command"`
+	Host        string                 `json:"host"`
+	User        string                 `json:"user,omitempty"`
+	StartedAt   time.Time              `json:"started_at"`
+	FinishedAt  *time.Time             `json:"finished_at,omitempty"`
+	Outcome     string                 `json:"outcome,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	FromVersion string                 `json:"from_version,omitempty"`
+	ToVersion   string                 `json:"to_version,omitempty"`
+	Steps       []*UpgradeRunStep      `json:"steps"`
+	Appliances  []*UpgradeRunAppliance `json:"appliances"`
+	Summary     string                 `json:"summary,omitempty"`
+}
+
+// UpgradeRunStep is a step of an upgrade run, such as a batch of additional appliances
+type UpgradeRunStep struct {
+	Name       string     `json:"name"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Outcome    string     `json:"outcome,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// UpgradeRunAppliance is the progress of a single appliance in an upgrade run
+type UpgradeRunAppliance struct {
+	Name       string                    `json:"name"`
+	Outcome    string                    `json:"outcome,omitempty"`
+	Reason     string                    `json:"reason,omitempty"`
+	StartedAt  *time.Time                `json:"started_at,omitempty"`
+	FinishedAt *time.Time                `json:"finished_at,omitempty"`
+	Statuses   []UpgradeStatusTransition `json:"statuses,omitempty"`
+}
+
+// UpgradeStatusTransition is a change of the upgrade status of an appliance
+type UpgradeStatusTransition struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+}
+
+// Duration is the time from the first status of the appliance until it finished, or zero if it is unknown
+func (a *UpgradeRunAppliance) Duration() time.Duration {
+	if a.StartedAt == nil || a.FinishedAt == nil {
+		return 0
+	}
+	return a.FinishedAt.Sub(*a.StartedAt)
+}
+
+// UpgradeHistoryDir returns the directory of the upgrade history in the sdpctl data directory
+func UpgradeHistoryDir() string {
+	return filepath.Join(filesystem.DataDir(), "upgrade_history")
+}
+
+// NewUpgradeRun returns the record of a new run of command against the collective host
+func NewUpgradeRun(command, host string) *UpgradeRun {
+	now := time.Now()
+	r := &UpgradeRun{
+		ID:         fmt.Sprintf("%s-%s", now.UTC().Format("20060102-150405"), randomSuffix()),
+		Command:    command,
+		Host:       host,
+		StartedAt:  now,
+		Steps:      []*UpgradeRunStep{},
+		Appliances: []*UpgradeRunAppliance{},
+	}
+	if u, err := user.Current(); err == nil {
+		r.User = u.Username
+	}
+	return r
+}
+
+func randomSuffix() string {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "000000"
+	}
+	return hex.EncodeToString(b)
+}
+
+// Duration is the time the run took, or zero if it has not finished
+func (r *UpgradeRun) Duration() time.Duration {
+	if r.FinishedAt == nil {
+		return 0
+	}
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// SetVersions records the versions the appliances are upgraded from and to, if they are known
+func (r *UpgradeRun) SetVersions(from, to *version.Version) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if from != nil {
+		r.FromVersion = from.String()
+	}
+	if to != nil {
+		r.ToVersion = to.String()
+	}
+}
+
+// SetSummary records the summary which is printed when the run is done
+func (r *UpgradeRun) SetSummary(summary string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Summary = strings.TrimSpace(summary)
+}
+
+// Record updates the run with an event from the event stream of the command
+func (r *UpgradeRun) Record(e events.Event) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := e.Time
+	switch e.Type {
+	case events.TypeStepStarted:
+		r.Steps = append(r.Steps, &UpgradeRunStep{Name: e.Step, StartedAt: t})
+	case events.TypeStepFinished:
+		for i := len(r.Steps) - 1; i >= 0; i-- {
+			if s := r.Steps[i]; s.Name == e.Step && s.FinishedAt == nil {
+				s.FinishedAt = &t
+				s.Outcome = e.Outcome
+				s.Error = e.Error
+				break
+			}
+		}
+	case events.TypeApplianceStatus:
+		a := r.appliance(e.Appliance)
+		if a.StartedAt == nil {
+			a.StartedAt = &t
+		}
+		a.Statuses = append(a.Statuses, UpgradeStatusTransition{Status: e.Status, Time: t})
+	case events.TypeApplianceFinished:
+		a := r.appliance(e.Appliance)
+		a.FinishedAt = &t
+		a.Outcome = e.Outcome
+		a.Reason = e.Error
+		if len(a.Reason) <= 0 {
+			a.Reason = e.Message
+		}
+	case events.TypeCommandFinished:
+		r.FinishedAt = &t
+		r.Outcome = e.Outcome
+		r.Error = e.Error
+	}
+}
+
+func (r *UpgradeRun) appliance(name string) *UpgradeRunAppliance {
+	for _, a := range r.Appliances {
+		if a.Name == name {
+			return a
+		}
+	}
+	a := &UpgradeRunAppliance{Name: name}
+	r.Appliances = append(r.Appliances, a)
+	return a
+}
+
+// Save writes the run to the history directory dir
+func (r *UpgradeRun) Save(dir string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, r.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ListUpgradeHistory returns the runs in the history directory dir, the most recent first
+func ListUpgradeHistory(dir string) ([]*UpgradeRun, error) {
+	runs := []*UpgradeRun{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return runs, nil
+		}
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		r, err := readUpgradeRun(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	return runs, nil
+}
+
+// ReadUpgradeHistory returns the run with the id from the history directory dir
+func ReadUpgradeHistory(dir, id string) (*UpgradeRun, error) {
+	if len(id) <= 0 || id != filepath.Base(id) {
+		return nil, fmt.Errorf("%w: %q", ErrHistoryNotFound, id)
+	}
+	r, err := readUpgradeRun(filepath.Join(dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %q", ErrHistoryNotFound, id)
+	}
+	return r, err
+}
+
+func readUpgradeRun(path string) (*UpgradeRun, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &UpgradeRun{}
+	if err := json.Unmarshal(content, r); err != nil {
+		return nil, fmt.Errorf("Could not read upgrade history %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// PreviousVersion returns the version which is left on the other partition of the appliance, according to the runs in the
+// history on host, or nil if it is unknown. This is the version the appliance was upgraded from, if the most recent run which
+// involved the appliance was an upgrade complete to current. Any other run, such as an upgrade prepare, may have overwritten
+// the other partition since. runs must be ordered with the most recent first, as returned by ListUpgradeHistory.
+func PreviousVersion(runs []*UpgradeRun, host, appliance string, current *version.Version) *version.Version {
+	for _, r := range runs {
+		if r.Host != host {
+			continue
+		}
+		var a *UpgradeRunAppliance
+		for _, ra := range r.Appliances {
+			if ra.Name == appliance {
+				a = ra
+				break
+			}
+		}
+		if a == nil {
+			continue
+		}
+		if r.Command != "complete" || a.Outcome != events.OutcomeSuccess {
+			return nil
+		}
+		to, err := ParseVersionString(r.ToVersion)
+		if err != nil || !to.Core().Equal(current.Core()) {
+			return nil
+		}
+		from, err := ParseVersionString(r.FromVersion)
+		if err != nil {
+			return nil
+		}
+		return from
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package appliance
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/events"
+	"github.com/hashicorp/go-version"
+)
+
+func TestUpgradeRun(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	run := NewUpgradeRun("complete", "appgate.com")
+	run.SetVersions(version.Must(version.NewVersion("6.1.0")), nil)
+	for _, e := range []events.Event{
+		{Type: events.TypeCommandStarted, Time: at(0)},
+		{Type: events.TypeStepStarted, Step: "primary-controller", Time: at(1)},
+		{Type: events.TypeApplianceStatus, Appliance: "controller", Status: "installing", Time: at(2)},
+		{Type: events.TypeApplianceStatus, Appliance: "controller", Status: "idle", Time: at(7)},
+		{Type: events.TypeApplianceFinished, Appliance: "controller", Outcome: events.OutcomeSuccess, Time: at(8)},
+		{Type: events.TypeStepFinished, Step: "primary-controller", Outcome: events.OutcomeSuccess, Time: at(8)},
+		{Type: events.TypeApplianceFinished, Appliance: "gateway", Outcome: events.OutcomeSkipped, Message: "appliance is offline", Time: at(9)},
+		{Type: events.TypeCommandFinished, Outcome: events.OutcomeSuccess, Time: at(10)},
+	} {
+		run.Record(e)
+	}
+	run.SetSummary("All appliances are running 6.1.0\n")
+	if err := run.Save(dir); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+
+	runs, err := ListUpgradeHistory(dir)
+	if err != nil {
+		t.Fatalf("ListUpgradeHistory() error = %s", err)
+	}
+	if len(runs) != 1 || runs[0].ID != run.ID {
+		t.Fatalf("expected the saved run, got %+v", runs)
+	}
+	got, err := ReadUpgradeHistory(dir, run.ID)
+	if err != nil {
+		t.Fatalf("ReadUpgradeHistory() error = %s", err)
+	}
+	if got.Command != "complete" || got.Host != "appgate.com" || got.FromVersion != "6.1.0" || got.ToVersion != "" {
+		t.Errorf("unexpected run header %+v", got)
+	}
+	if got.Outcome != events.OutcomeSuccess || got.FinishedAt == nil || !got.FinishedAt.Equal(at(10)) {
+		t.Errorf("unexpected outcome %+v", got)
+	}
+	if len(got.Steps) != 1 || got.Steps[0].Outcome != events.OutcomeSuccess || got.Steps[0].FinishedAt == nil {
+		t.Errorf("unexpected steps %+v", got.Steps)
+	}
+	if len(got.Appliances) != 2 {
+		t.Fatalf("expected two appliances, got %+v", got.Appliances)
+	}
+	controller, gateway := got.Appliances[0], got.Appliances[1]
+	if len(controller.Statuses) != 2 || controller.Duration() != 6*time.Minute {
+		t.Errorf("unexpected controller %+v", controller)
+	}
+	if gateway.Outcome != events.OutcomeSkipped || gateway.Reason != "appliance is offline" {
+		t.Errorf("unexpected gateway %+v", gateway)
+	}
+	if got.Summary != "All appliances are running 6.1.0" {
+		t.Errorf("unexpected summary %q", got.Summary)
+	}
+
+	if _, err := ReadUpgradeHistory(dir, "../"+run.ID); !errors.Is(err, ErrHistoryNotFound) {
+		t.Errorf("expected ErrHistoryNotFound, got %v", err)
+	}
+	if _, err := ReadUpgradeHistory(dir, "unknown"); !errors.Is(err, ErrHistoryNotFound) {
+		t.Errorf("expected ErrHistoryNotFound, got %v", err)
+	}
+}
+
+func TestPreviousVersion(t *testing.T) {
+	newRun := func(command, host, from, to, appliance, outcome string, started time.Time) *UpgradeRun {
+		r := NewUpgradeRun(command, host)
+		r.StartedAt = started
+		r.FromVersion = from
+		r.ToVersion = to
+		r.Record(events.Event{Type: events.TypeApplianceFinished, Appliance: appliance, Outcome: outcome, Time: started})
+		return r
+	}
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	current := version.Must(version.NewVersion("6.1.0+29000"))
+	tests := []struct {
+		name string
+		runs []*UpgradeRun
+		want string
+	}{
+		{
+			name: "upgraded from 6.0.2",
+			runs: []*UpgradeRun{
+				newRun("complete", "appgate.com", "6.0.2", "6.1.0", "gateway", events.OutcomeSuccess, start),
+			},
+			want: "6.0.2",
+		},
+		{
+			name: "other host and other appliance are ignored",
+			runs: []*UpgradeRun{
+				newRun("complete", "other.com", "5.5.0", "6.1.0", "gateway", events.OutcomeSuccess, start.Add(2*time.Hour)),
+				newRun("complete", "appgate.com", "5.5.0", "6.1.0", "controller", events.OutcomeSuccess, start.Add(time.Hour)),
+				newRun("complete", "appgate.com", "6.0.2", "6.1.0", "gateway", events.OutcomeSuccess, start),
+			},
+			want: "6.0.2",
+		},
+		{
+			name: "prepared since the upgrade",
+			runs: []*UpgradeRun{
+				newRun("prepare", "appgate.com", "6.1.0", "6.2.0", "gateway", events.OutcomeSuccess, start.Add(time.Hour)),
+				newRun("complete", "appgate.com", "6.0.2", "6.1.0", "gateway", events.OutcomeSuccess, start),
+			},
+		},
+		{
+			name: "upgrade failed",
+			runs: []*UpgradeRun{
+				newRun("complete", "appgate.com", "6.0.2", "6.1.0", "gateway", events.OutcomeFailed, start),
+			},
+		},
+		{
+			name: "upgraded to another version",
+			runs: []*UpgradeRun{
+				newRun("complete", "appgate.com", "6.0.2", "6.0.3", "gateway", events.OutcomeSuccess, start),
+			},
+		},
+		{
+			name: "no history",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PreviousVersion(tt.runs, "appgate.com", "gateway", current)
+			if len(tt.want) <= 0 {
+				if got != nil {
+					t.Fatalf("PreviousVersion() = %s, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.String() != tt.want {
+				t.Fatalf("PreviousVersion() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
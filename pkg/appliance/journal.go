@@ -0,0 +1,290 @@
+package appliance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	"github.com/appgate/sdpctl/pkg/filesystem"
+	"github.com/appgate/sdpctl/pkg/util"
+)
+
+const (
+	JournalPending = "pending"
+	JournalStarted = "started"
+	JournalDone    = "done"
+	JournalFailed  = "failed"
+)
+
+// ErrNoJournal is returned when there is no upgrade journal to resume from
+var ErrNoJournal = errors.New("No interrupted upgrade found")
+
+// UpgradeJournal records each step of 'upgrade complete' on disk while it runs.
+// If the command is interrupted, the journal holds what is needed to continue the upgrade
+// where it stopped, such as which controllers were disabled and which batches finished.
+type UpgradeJournal struct {
+	mu   sync.Mutex
+	path string
+
+	Host                   string         `json:"host"`
+	StartedAt              time.Time      `json:"started_at"`
+	UpdatedAt              time.Time      `json:"updated_at"`
+	FromVersion            string         `json:"from_version,omitempty"`
+	ToVersion              string         `json:"to_version,omitempty"`
+	PrimaryControllerID    string         `json:"primary_controller_id"`
+	DisableControllers     bool           `json:"disable_controllers"`
+	DisabledControllers    []string       `json:"disabled_controllers,omitempty"`
+	MaintenanceControllers []string       `json:"maintenance_controllers,omitempty"`
+	CanaryGates            *CanaryGates   `json:"canary_gates,omitempty"`
+	MaxUnavailable         string         `json:"max_unavailable,omitempty"`
+	Steps                  []*JournalStep `json:"steps"`
+}
+
+// JournalStep is one step of the upgrade, such as a batch of additional appliances
+type JournalStep struct {
+	Name        string              `json:"name"`
+	Status      string              `json:"status"`
+	Label       string              `json:"label,omitempty"`
+	MaxParallel int                 `json:"max_parallel,omitempty"`
+	Pause       time.Duration       `json:"pause,omitempty"`
+	Canary      bool                `json:"canary,omitempty"`
+	Appliances  []*JournalAppliance `json:"appliances,omitempty"`
+	StartedAt   *time.Time          `json:"started_at,omitempty"`
+	FinishedAt  *time.Time          `json:"finished_at,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// JournalAppliance is the progress of a single appliance within a step
+type JournalAppliance struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+var nonFilenameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// UpgradeJournalPath returns the location of the upgrade journal for the given collective host
+func UpgradeJournalPath(host string) string {
+	name := fmt.Sprintf("upgrade_complete_%s.journal.json", nonFilenameChars.ReplaceAllString(host, "_"))
+	return filepath.Join(filesystem.DataDir(), name)
+}
+
+// NewUpgradeJournal returns a new empty journal which will be written to path
+func NewUpgradeJournal(path, host string) *UpgradeJournal {
+	now := time.Now()
+	return &UpgradeJournal{
+		path:      path,
+		Host:      host,
+		StartedAt: now,
+		UpdatedAt: now,
+		Steps:     []*JournalStep{},
+	}
+}
+
+// ReadUpgradeJournal reads an existing journal from path
+func ReadUpgradeJournal(path string) (*UpgradeJournal, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNoJournal
+		}
+		return nil, err
+	}
+	j := &UpgradeJournal{}
+	if err := json.Unmarshal(content, j); err != nil {
+		return nil, fmt.Errorf("Could not read upgrade journal %s: %w", path, err)
+	}
+	j.path = path
+	return j, nil
+}
+
+// Path is the location of the journal on disk
+func (j *UpgradeJournal) Path() string {
+	return j.path
+}
+
+// Save writes the journal to disk. The file is replaced atomically, so that an interruption
+// while writing never leaves a truncated journal behind.
+func (j *UpgradeJournal) Save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.save()
+}
+
+func (j *UpgradeJournal) save() error {
+	j.UpdatedAt = time.Now()
+	content, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// Remove deletes the journal from disk once the upgrade has finished
+func (j *UpgradeJournal) Remove() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// AddStep appends a pending step with the appliances that are part of it.
+func (j *UpgradeJournal) AddStep(name string, appliances []openapi.Appliance) *JournalStep {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	step := &JournalStep{
+		Name:       name,
+		Status:     JournalPending,
+		Appliances: []*JournalAppliance{},
+	}
+	for _, a := range appliances {
+		step.Appliances = append(step.Appliances, &JournalAppliance{
+			ID:     a.GetId(),
+			Name:   a.GetName(),
+			Status: JournalPending,
+		})
+	}
+	j.Steps = append(j.Steps, step)
+	return step
+}
+
+// Step returns the step with the given name, or nil if there is none
+func (j *UpgradeJournal) Step(name string) *JournalStep {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.step(name)
+}
+
+func (j *UpgradeJournal) step(name string) *JournalStep {
+	for _, s := range j.Steps {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// StepDone reports if the step has been completed in a previous run
+func (j *UpgradeJournal) StepDone(name string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if s := j.step(name); s != nil {
+		return s.Status == JournalDone
+	}
+	return false
+}
+
+// StartStep marks the step as started and saves the journal
+func (j *UpgradeJournal) StartStep(name string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if s := j.step(name); s != nil {
+		now := time.Now()
+		s.Status = JournalStarted
+		s.StartedAt = &now
+		s.Error = ""
+	}
+	return j.save()
+}
+
+// FinishStep marks the step as done, or failed if err is not nil, and saves the journal
+func (j *UpgradeJournal) FinishStep(name string, err error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if s := j.step(name); s != nil {
+		now := time.Now()
+		s.FinishedAt = &now
+		s.Status = JournalDone
+		if err != nil {
+			s.Status = JournalFailed
+			s.Error = err.Error()
+		}
+	}
+	return j.save()
+}
+
+// ApplianceDone reports if the appliance has been upgraded in any step
+func (j *UpgradeJournal) ApplianceDone(id string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, s := range j.Steps {
+		for _, a := range s.Appliances {
+			if a.ID == id && a.Status == JournalDone {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetApplianceStatus updates the status of the appliance in every step it is part of and saves the journal
+func (j *UpgradeJournal) SetApplianceStatus(id, status string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, s := range j.Steps {
+		for _, a := range s.Appliances {
+			if a.ID == id {
+				a.Status = status
+			}
+		}
+	}
+	return j.save()
+}
+
+// SetControllerDisabled records if the controller function was disabled on the appliance and saves the journal
+func (j *UpgradeJournal) SetControllerDisabled(id string, disabled bool) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.DisabledControllers = toggleID(j.DisabledControllers, id, disabled)
+	return j.save()
+}
+
+// ControllerDisabled reports if the controller function was disabled on the appliance
+func (j *UpgradeJournal) ControllerDisabled(id string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return util.InSlice(id, j.DisabledControllers)
+}
+
+// SetMaintenanceMode records if maintenance mode was enabled on the controller and saves the journal
+func (j *UpgradeJournal) SetMaintenanceMode(id string, enabled bool) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.MaintenanceControllers = toggleID(j.MaintenanceControllers, id, enabled)
+	return j.save()
+}
+
+// InMaintenanceMode reports if maintenance mode was enabled on the controller
+func (j *UpgradeJournal) InMaintenanceMode(id string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return util.InSlice(id, j.MaintenanceControllers)
+}
+
+func toggleID(ids []string, id string, add bool) []string {
+	result := make([]string, 0, len(ids))
+	for _, v := range ids {
+		if v != id {
+			result = append(result, v)
+		}
+	}
+	if add {
+		result = append(result, id)
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package appliance
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+)
+
+func TestUpgradeJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upgrade.journal.json")
+	if _, err := ReadUpgradeJournal(path); !errors.Is(err, ErrNoJournal) {
+		t.Fatalf("expected ErrNoJournal, got %v", err)
+	}
+
+	controller := openapi.Appliance{Id: openapi.PtrString("c1"), Name: "controller"}
+	gateway := openapi.Appliance{Id: openapi.PtrString("g1"), Name: "gateway"}
+	j := NewUpgradeJournal(path, "appgate.com")
+	j.PrimaryControllerID = "primary"
+	j.AddStep("additional-controllers", []openapi.Appliance{controller})
+	j.AddStep("batch-1", []openapi.Appliance{gateway})
+	if err := j.Save(); err != nil {
+		t.Fatalf("Save() error = %s", err)
+	}
+	if err := j.SetControllerDisabled("c1", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.StartStep("additional-controllers"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.SetApplianceStatus("c1", JournalDone); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.FinishStep("batch-1", errors.New("gateway failed")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadUpgradeJournal(path)
+	if err != nil {
+		t.Fatalf("ReadUpgradeJournal() error = %s", err)
+	}
+	if got.Host != "appgate.com" || got.PrimaryControllerID != "primary" {
+		t.Errorf("unexpected journal header %+v", got)
+	}
+	if !got.ApplianceDone("c1") || got.ApplianceDone("g1") {
+		t.Error("expected only c1 to be done")
+	}
+	if !got.ControllerDisabled("c1") {
+		t.Error("expected c1 to be recorded as disabled")
+	}
+	if got.StepDone("additional-controllers") {
+		t.Error("expected started step not to be done")
+	}
+	if s := got.Step("batch-1"); s == nil || s.Status != JournalFailed || s.Error != "gateway failed" {
+		t.Errorf("expected failed step, got %+v", s)
+	}
+	if err := got.SetControllerDisabled("c1", false); err != nil {
+		t.Fatal(err)
+	}
+	if got.ControllerDisabled("c1") {
+		t.Error("expected c1 to be enabled")
+	}
+
+	if err := got.Remove(); err != nil {
+		t.Fatalf("Remove() error = %s", err)
+	}
+	if _, err := ReadUpgradeJournal(path); !errors.Is(err, ErrNoJournal) {
+		t.Fatalf("expected ErrNoJournal after remove, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package appliance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+)
+
+// MaxUnavailable is the maximum number of appliances of each site and function which are upgraded at the same time,
+// either as an absolute number or as a percentage of the appliances with that site and function.
+// The zero value means no limit.
+type MaxUnavailable struct {
+	Value   int
+	Percent bool
+}
+
+// ParseMaxUnavailable parses an absolute number such as 2, or a percentage such as 25%
+func ParseMaxUnavailable(s string) (MaxUnavailable, error) {
+	m := MaxUnavailable{}
+	if len(s) <= 0 {
+		return m, nil
+	}
+	value := s
+	if strings.HasSuffix(s, "%") {
+		m.Percent = true
+		value = strings.TrimSuffix(s, "%")
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v <= 0 || (m.Percent && v > 100) {
+		return m, fmt.Errorf("invalid max unavailable %q, must be a positive number or a percentage between 1%% and 100%%", s)
+	}
+	m.Value = v
+	return m, nil
+}
+
+// IsZero reports whether there is no limit
+func (m MaxUnavailable) IsZero() bool {
+	return m.Value <= 0
+}
+
+func (m MaxUnavailable) String() string {
+	if m.IsZero() {
+		return ""
+	}
+	if m.Percent {
+		return fmt.Sprintf("%d%%", m.Value)
+	}
+	return strconv.Itoa(m.Value)
+}
+
+// Limit returns the number of appliances out of size which may be unavailable at the same time.
+// Percentages are rounded down, but at least one appliance is always allowed.
+func (m MaxUnavailable) Limit(size int) int {
+	limit := m.Value
+	if m.Percent {
+		limit = size * m.Value / 100
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+// ApplyMaxUnavailable merges the batches computed by NewUpgradePlan into a single batch, since the appliances
+// are throttled per site and function instead. Stages from an upgrade plan file and canaries are kept as they are.
+func (p *UpgradePlan) ApplyMaxUnavailable(m MaxUnavailable) {
+	p.MaxUnavailable = m
+	if m.IsZero() || len(p.BatchOptions) > 0 || len(p.Batches) <= 1 {
+		return
+	}
+	merged := []openapi.Appliance{}
+	for _, b := range p.Batches {
+		merged = append(merged, b...)
+	}
+	p.Batches = [][]openapi.Appliance{merged}
+}
+
+// UnavailableSlots returns the slots for the max unavailable limit of the plan. The limits are computed from the online
+// appliances of the collective, so that a percentage is the share of a site and function that may be down, and not the
+// share of the appliances upgraded in this run. If the online appliances are unknown, the appliances in the plan are used.
+func (p *UpgradePlan) UnavailableSlots() *UnavailableSlots {
+	if len(p.Online) > 0 {
+		return NewUnavailableSlots(p.MaxUnavailable, p.Online)
+	}
+	return NewUnavailableSlots(p.MaxUnavailable, p.Appliances())
+}
+
+// UnavailableSlots keeps track of the appliances which are being upgraded, so that no more than
+// the max unavailable appliances of a site and function are down at the same time.
+// A nil UnavailableSlots does not limit anything.
+type UnavailableSlots struct {
+	mu      sync.Mutex
+	limits  map[string]int
+	used    map[string]int
+	changed chan struct{}
+}
+
+// NewUnavailableSlots returns the slots for the appliances, or nil if m has no limit.
+// The limit of each site and function is computed from the number of appliances with that site and function.
+func NewUnavailableSlots(m MaxUnavailable, appliances []openapi.Appliance) *UnavailableSlots {
+	if m.IsZero() {
+		return nil
+	}
+	sizes := map[string]int{}
+	for _, a := range appliances {
+		for _, key := range slotKeys(a) {
+			sizes[key]++
+		}
+	}
+	limits := make(map[string]int, len(sizes))
+	for key, size := range sizes {
+		limits[key] = m.Limit(size)
+	}
+	return &UnavailableSlots{
+		limits:  limits,
+		used:    map[string]int{},
+		changed: make(chan struct{}),
+	}
+}
+
+// slotKeys returns one key for each active function of the appliance on its site
+func slotKeys(a openapi.Appliance) []string {
+	functions := GetActiveFunctions(a)
+	sort.Strings(functions)
+	keys := make([]string, 0, len(functions))
+	for _, f := range functions {
+		keys = append(keys, fmt.Sprintf("%s/%s", a.GetSite(), f))
+	}
+	return keys
+}
+
+// Acquire waits until the appliance can be taken down without going above the limit of any of its functions on its site.
+// The returned function releases the slots again, and can be called more than once.
+func (s *UnavailableSlots) Acquire(ctx context.Context, a openapi.Appliance) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	keys := slotKeys(a)
+	for {
+		s.mu.Lock()
+		free := true
+		for _, key := range keys {
+			// appliances which were not known when the slots were created are limited to one at a time
+			limit, ok := s.limits[key]
+			if !ok {
+				limit = 1
+			}
+			if s.used[key] >= limit {
+				free = false
+				break
+			}
+		}
+		if free {
+			for _, key := range keys {
+				s.used[key]++
+			}
+			s.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(func() { s.release(keys) }) }, nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (s *UnavailableSlots) release(keys []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		s.used[key]--
+	}
+	// wake up everyone waiting for a slot
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
@@ -0,0 +1,170 @@
+package appliance
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+)
+
+func TestParseMaxUnavailable(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    MaxUnavailable
+		limit   int
+		wantErr bool
+	}{
+		{in: "", want: MaxUnavailable{}},
+		{in: "2", want: MaxUnavailable{Value: 2}, limit: 2},
+		{in: "50%", want: MaxUnavailable{Value: 50, Percent: true}, limit: 5},
+		{in: "5%", want: MaxUnavailable{Value: 5, Percent: true}, limit: 1},
+		{in: "0", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "101%", wantErr: true},
+		{in: "half", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMaxUnavailable(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMaxUnavailable(%q) error = %v, wantErr %t", tt.in, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMaxUnavailable(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if got.String() != tt.in {
+			t.Errorf("String() = %q, want %q", got.String(), tt.in)
+		}
+		// the limit out of ten appliances
+		if tt.limit > 0 && got.Limit(10) != tt.limit {
+			t.Errorf("%q Limit(10) = %d, want %d", tt.in, got.Limit(10), tt.limit)
+		}
+	}
+}
+
+func TestUpgradePlanApplyMaxUnavailable(t *testing.T) {
+	batches := func() [][]openapi.Appliance {
+		return [][]openapi.Appliance{
+			{{Name: "g1"}, {Name: "g3"}},
+			{{Name: "g2"}},
+		}
+	}
+	plan := &UpgradePlan{Batches: batches()}
+	plan.ApplyMaxUnavailable(MaxUnavailable{Value: 1})
+	if len(plan.Batches) != 1 || len(plan.Batches[0]) != 3 {
+		t.Errorf("expected the batches to be merged, got %v", plan.Batches)
+	}
+	if plan.MaxUnavailable.Value != 1 {
+		t.Errorf("expected max unavailable 1, got %s", plan.MaxUnavailable)
+	}
+
+	// stages from a plan file are kept
+	plan = &UpgradePlan{Batches: batches(), BatchOptions: []BatchOptions{{Label: "first"}, {Label: "second"}}}
+	plan.ApplyMaxUnavailable(MaxUnavailable{Value: 1})
+	if len(plan.Batches) != 2 {
+		t.Errorf("expected the stages to be kept, got %v", plan.Batches)
+	}
+}
+
+func TestUnavailableSlots(t *testing.T) {
+	gateway := func(id, site string) openapi.Appliance {
+		return openapi.Appliance{
+			Id:      openapi.PtrString(id),
+			Name:    id,
+			Site:    openapi.PtrString(site),
+			Gateway: &openapi.ApplianceAllOfGateway{Enabled: openapi.PtrBool(true)},
+		}
+	}
+	appliances := []openapi.Appliance{
+		gateway("a1", "siteA"), gateway("a2", "siteA"), gateway("a3", "siteA"), gateway("a4", "siteA"),
+		gateway("b1", "siteB"), gateway("b2", "siteB"),
+	}
+	ctx := context.Background()
+
+	var nilSlots *UnavailableSlots
+	if release, err := nilSlots.Acquire(ctx, appliances[0]); err != nil {
+		t.Fatalf("nil slots error = %s", err)
+	} else {
+		release()
+	}
+
+	slots := NewUnavailableSlots(MaxUnavailable{Value: 50, Percent: true}, appliances)
+	releaseA1, _ := slots.Acquire(ctx, appliances[0])
+	releaseA2, _ := slots.Acquire(ctx, appliances[1])
+	// siteB has a slot of its own
+	releaseB1, err := slots.Acquire(ctx, appliances[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseB1()
+
+	// both slots of siteA are taken, so a3 waits
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := slots.Acquire(timeout, appliances[2]); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a3 to wait for a slot, got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	acquired := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		release, err := slots.Acquire(ctx, appliances[2])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		close(acquired)
+		release()
+	}()
+	releaseA1()
+	// releasing twice does not free another slot
+	releaseA1()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("a3 did not get the released slot")
+	}
+	wg.Wait()
+	releaseA2()
+	if used := slots.used["siteA/Gateway"]; used != 0 {
+		t.Errorf("expected all slots to be released, %d are used", used)
+	}
+}
+
+func TestUpgradePlanUnavailableSlots(t *testing.T) {
+	gateway := func(id string) openapi.Appliance {
+		return openapi.Appliance{
+			Id:      openapi.PtrString(id),
+			Name:    id,
+			Site:    openapi.PtrString("siteA"),
+			Gateway: &openapi.ApplianceAllOfGateway{Enabled: openapi.PtrBool(true)},
+		}
+	}
+	online := []openapi.Appliance{gateway("g1"), gateway("g2"), gateway("g3"), gateway("g4")}
+	plan := &UpgradePlan{
+		Batches:        [][]openapi.Appliance{online[:2]},
+		MaxUnavailable: MaxUnavailable{Value: 50, Percent: true},
+	}
+	// without the online appliances, 50% of the two upgraded gateways is one at a time
+	if limit := plan.UnavailableSlots().limits["siteA/Gateway"]; limit != 1 {
+		t.Errorf("expected a limit of 1 from the plan, got %d", limit)
+	}
+	// 50% of the four online gateways on the site
+	plan.Online = online
+	if limit := plan.UnavailableSlots().limits["siteA/Gateway"]; limit != 2 {
+		t.Errorf("expected a limit of 2 from the online appliances, got %d", limit)
+	}
+
+	plan.MaxUnavailable = MaxUnavailable{}
+	if slots := plan.UnavailableSlots(); slots != nil {
+		t.Errorf("expected no slots without a limit, got %+v", slots)
+	}
+}
@@ -0,0 +1,172 @@
+package appliance
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+)
+
+const (
+	PreflightPass = "pass"
+	PreflightWarn = "warn"
+	PreflightFail = "fail"
+)
+
+var preflightSeverity = map[string]int{
+	PreflightPass: 0,
+	PreflightWarn: 1,
+	PreflightFail: 2,
+}
+
+// PreflightCheck is the result of a single upgrade readiness check
+type PreflightCheck struct {
+	Name       string   `json:"name"`
+	Status     string   `json:"status"`
+	Message    string   `json:"message"`
+	Appliances []string `json:"appliances,omitempty"`
+}
+
+// PreflightReport is the result of all upgrade readiness checks
+type PreflightReport struct {
+	Status string           `json:"status"`
+	Checks []PreflightCheck `json:"checks"`
+}
+
+func (r *PreflightReport) add(c PreflightCheck) {
+	r.Checks = append(r.Checks, c)
+	if preflightSeverity[c.Status] > preflightSeverity[r.Status] {
+		r.Status = c.Status
+	}
+}
+
+// Preflight runs the upgrade readiness checks without making any changes to the collective.
+// allAppliances is the complete list of appliances, used to find the primary controller, and
+// appliances is the filtered list of appliances which the remaining checks are run on.
+func Preflight(allAppliances, appliances []openapi.Appliance, stats []openapi.StatsAppliancesListAllOfData, hostname string) *PreflightReport {
+	report := &PreflightReport{Status: PreflightPass}
+	report.add(checkPrimaryController(allAppliances, hostname))
+
+	online, offline, err := FilterAvailable(appliances, stats)
+	report.add(checkOffline(offline, err))
+
+	filteredStats := make([]openapi.StatsAppliancesListAllOfData, 0, len(stats))
+	for _, s := range stats {
+		for _, a := range appliances {
+			if s.GetId() == a.GetId() {
+				filteredStats = append(filteredStats, s)
+			}
+		}
+	}
+	report.add(checkDiskSpace(filteredStats))
+	report.add(checkPeerInterface(online))
+	report.add(checkAutoscaling(online))
+	report.add(checkVersions(filteredStats))
+	return report
+}
+
+func checkPrimaryController(appliances []openapi.Appliance, hostname string) PreflightCheck {
+	c := PreflightCheck{Name: "Primary controller"}
+	primary, err := FindPrimaryController(appliances, hostname)
+	if err != nil {
+		c.Status = PreflightFail
+		c.Message = err.Error()
+		return c
+	}
+	c.Status = PreflightPass
+	c.Message = fmt.Sprintf("%s resolves to a unique IP", hostname)
+	c.Appliances = []string{primary.GetName()}
+	return c
+}
+
+// checkOffline fails when FilterAvailable reports an offline controller or LogServer, since the upgrade
+// can't start without them, and warns about the other offline appliances which are excluded from the upgrade.
+func checkOffline(offline []openapi.Appliance, err error) PreflightCheck {
+	c := PreflightCheck{Name: "Offline appliances", Status: PreflightPass, Message: "all appliances are online"}
+	if len(offline) <= 0 {
+		return c
+	}
+	for _, a := range offline {
+		c.Appliances = append(c.Appliances, a.GetName())
+	}
+	sort.Strings(c.Appliances)
+	if err != nil {
+		groups := GroupByFunctions(offline)
+		names := []string{}
+		for _, a := range unique(append(groups[FunctionController], groups[FunctionLogServer]...)) {
+			names = append(names, a.GetName())
+		}
+		sort.Strings(names)
+		c.Status = PreflightFail
+		c.Message = fmt.Sprintf("the upgrade can't start while controllers or LogServers are offline: %s", strings.Join(names, ", "))
+		return c
+	}
+	c.Status = PreflightWarn
+	c.Message = "offline appliances will be excluded from the upgrade"
+	return c
+}
+
+func checkDiskSpace(stats []openapi.StatsAppliancesListAllOfData) PreflightCheck {
+	c := PreflightCheck{Name: "Disk space", Status: PreflightPass, Message: "all appliances have enough disk space"}
+	low := HasLowDiskSpace(stats)
+	if len(low) <= 0 {
+		return c
+	}
+	c.Status = PreflightWarn
+	c.Message = "some appliances have very little space available for the upgrade image"
+	for _, s := range low {
+		c.Appliances = append(c.Appliances, fmt.Sprintf("%s (%v%%)", s.GetName(), s.GetDisk()))
+	}
+	return c
+}
+
+func checkPeerInterface(appliances []openapi.Appliance) PreflightCheck {
+	c := PreflightCheck{Name: "Admin interface", Status: PreflightPass, Message: "all controllers and LogServers use the admin interface"}
+	groups := GroupByFunctions(appliances)
+	peer := unique(WithAdminOnPeerInterface(append(groups[FunctionController], groups[FunctionLogServer]...)))
+	if len(peer) <= 0 {
+		return c
+	}
+	c.Status = PreflightWarn
+	c.Message = fmt.Sprintf("still using the deprecated peer port %s for the admin API", appliancePeerPorts(peer))
+	for _, a := range peer {
+		c.Appliances = append(c.Appliances, a.GetName())
+	}
+	return c
+}
+
+func checkAutoscaling(appliances []openapi.Appliance) PreflightCheck {
+	c := PreflightCheck{Name: "Auto-scaled gateways", Status: PreflightPass, Message: "no auto-scaled gateways found"}
+	template, gateways := AutoscalingGateways(appliances)
+	if len(gateways) <= 0 {
+		return c
+	}
+	c.Status = PreflightWarn
+	c.Message = "disable the health check on auto-scaled gateways before the upgrade"
+	if template != nil {
+		c.Message = fmt.Sprintf("%s, auto-scale template: %s", c.Message, template.GetName())
+	}
+	for _, a := range unique(gateways) {
+		c.Appliances = append(c.Appliances, a.GetName())
+	}
+	return c
+}
+
+func checkVersions(stats []openapi.StatsAppliancesListAllOfData) PreflightCheck {
+	c := PreflightCheck{Name: "Version consistency", Status: PreflightPass, Message: "all appliances run the same version"}
+	if len(stats) <= 0 {
+		return c
+	}
+	hasDiff, versions := HasDiffVersions(stats)
+	if !hasDiff {
+		return c
+	}
+	c.Status = PreflightWarn
+	c.Message = "appliances run different versions"
+	for name, v := range versions {
+		c.Appliances = append(c.Appliances, fmt.Sprintf("%s (%s)", name, v))
+	}
+	sort.Strings(c.Appliances)
+	return c
+}
@@ -0,0 +1,84 @@
+package appliance
+
+import (
+	"testing"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+)
+
+func TestPreflightChecks(t *testing.T) {
+	controller := openapi.Appliance{
+		Id:         openapi.PtrString("c1"),
+		Name:       "controller",
+		Controller: &openapi.ApplianceAllOfController{Enabled: openapi.PtrBool(true)},
+	}
+	gateway := openapi.Appliance{
+		Id:      openapi.PtrString("g1"),
+		Name:    "gateway",
+		Gateway: &openapi.ApplianceAllOfGateway{Enabled: openapi.PtrBool(true)},
+	}
+	stat := func(id, name, status, version string, disk float32) openapi.StatsAppliancesListAllOfData {
+		return openapi.StatsAppliancesListAllOfData{
+			Id:      openapi.PtrString(id),
+			Name:    openapi.PtrString(name),
+			Status:  openapi.PtrString(status),
+			Version: openapi.PtrString(version),
+			Disk:    openapi.PtrFloat32(disk),
+		}
+	}
+	tests := []struct {
+		name  string
+		stats []openapi.StatsAppliancesListAllOfData
+		want  map[string]string
+	}{
+		{
+			name: "offline gateway",
+			stats: []openapi.StatsAppliancesListAllOfData{
+				stat("c1", "controller", "healthy", "5.5.1-1234", 10),
+				stat("g1", "gateway", "offline", "5.5.1-1234", 10),
+			},
+			want: map[string]string{
+				"Offline appliances":  PreflightWarn,
+				"Disk space":          PreflightPass,
+				"Version consistency": PreflightPass,
+			},
+		},
+		{
+			name: "offline controller",
+			stats: []openapi.StatsAppliancesListAllOfData{
+				stat("c1", "controller", "offline", "5.5.1-1234", 10),
+				stat("g1", "gateway", "healthy", "5.5.1-1234", 10),
+			},
+			want: map[string]string{
+				"Offline appliances": PreflightFail,
+			},
+		},
+		{
+			name: "low disk space and different versions",
+			stats: []openapi.StatsAppliancesListAllOfData{
+				stat("c1", "controller", "healthy", "5.5.1-1234", 80),
+				stat("g1", "gateway", "healthy", "5.4.0-1000", 10),
+			},
+			want: map[string]string{
+				"Offline appliances":  PreflightPass,
+				"Disk space":          PreflightWarn,
+				"Version consistency": PreflightWarn,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appliances := []openapi.Appliance{controller, gateway}
+			report := Preflight(appliances, appliances, tt.stats, "appgate.com")
+			// the controller fixture has no admin interface, so the hostname check always fails
+			if report.Status != PreflightFail {
+				t.Errorf("expected report status %s, got %s", PreflightFail, report.Status)
+			}
+			for _, c := range report.Checks {
+				if want, ok := tt.want[c.Name]; ok && c.Status != want {
+					t.Errorf("check %q: want %s, got %s: %s", c.Name, want, c.Status, c.Message)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package appliance
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/appgate/sdpctl/pkg/events"
+	"github.com/appgate/sdpctl/pkg/util"
+)
+
+// ApplianceOutcome is the outcome of the upgrade of a single appliance
+type ApplianceOutcome struct {
+	Appliance string `json:"appliance"`
+	// Outcome is one of events.OutcomeSuccess, events.OutcomeFailed or events.OutcomeSkipped
+	Outcome string `json:"outcome"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// UpgradeReport collects the outcome of each appliance during 'upgrade complete'. It is safe for concurrent use,
+// and a nil UpgradeReport discards all outcomes.
+type UpgradeReport struct {
+	mu         sync.Mutex
+	Appliances []ApplianceOutcome `json:"appliances"`
+}
+
+// NewUpgradeReport returns an empty report
+func NewUpgradeReport() *UpgradeReport {
+	return &UpgradeReport{Appliances: []ApplianceOutcome{}}
+}
+
+// Finished records that the appliance was upgraded, or that it failed with err
+func (r *UpgradeReport) Finished(appliance string, err error) {
+	if err != nil {
+		r.add(appliance, events.OutcomeFailed, err.Error())
+		return
+	}
+	r.add(appliance, events.OutcomeSuccess, "")
+}
+
+// Skipped records that the appliance was not upgraded
+func (r *UpgradeReport) Skipped(appliance, reason string) {
+	r.add(appliance, events.OutcomeSkipped, reason)
+}
+
+// add records the outcome of the appliance, replacing any earlier outcome
+func (r *UpgradeReport) add(appliance, outcome, reason string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o := ApplianceOutcome{Appliance: appliance, Outcome: outcome, Reason: reason}
+	for i, existing := range r.Appliances {
+		if existing.Appliance == appliance {
+			r.Appliances[i] = o
+			return
+		}
+	}
+	r.Appliances = append(r.Appliances, o)
+}
+
+// Count returns the number of appliances with the outcome
+func (r *UpgradeReport) Count(outcome string) int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, o := range r.Appliances {
+		if o.Outcome == outcome {
+			n++
+		}
+	}
+	return n
+}
+
+// Print prints the outcome of each appliance, followed by the number of appliances with each outcome
+func (r *UpgradeReport) Print(out io.Writer) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	p := util.NewPrinter(out, 4)
+	p.AddHeader("Appliance", "Outcome", "Reason")
+	for _, o := range r.Appliances {
+		p.AddLine(o.Appliance, o.Outcome, o.Reason)
+	}
+	r.mu.Unlock()
+	p.Print()
+	fmt.Fprintf(out, "\n%d succeeded, %d failed, %d skipped\n", r.Count(events.OutcomeSuccess), r.Count(events.OutcomeFailed), r.Count(events.OutcomeSkipped))
+}
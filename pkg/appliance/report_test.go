@@ -0,0 +1,40 @@
+package appliance
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/appgate/sdpctl/pkg/events"
+)
+
+func TestUpgradeReport(t *testing.T) {
+	var nilReport *UpgradeReport
+	nilReport.Finished("primary", nil)
+	if nilReport.Count(events.OutcomeSuccess) != 0 {
+		t.Error("expected a nil report to discard outcomes")
+	}
+
+	report := NewUpgradeReport()
+	report.Finished("primary", nil)
+	report.Finished("gateway", errors.New("upgrade failed"))
+	report.Skipped("portal", SkipReasonOffline)
+	// a later outcome replaces the earlier one
+	report.Finished("gateway", errors.New("never reached idle"))
+
+	for outcome, want := range map[string]int{events.OutcomeSuccess: 1, events.OutcomeFailed: 1, events.OutcomeSkipped: 1} {
+		if got := report.Count(outcome); got != want {
+			t.Errorf("Count(%s) = %d, want %d", outcome, got, want)
+		}
+	}
+	if report.Appliances[1].Reason != "never reached idle" {
+		t.Errorf("expected the latest reason, got %q", report.Appliances[1].Reason)
+	}
+
+	var out bytes.Buffer
+	report.Print(&out)
+	if !strings.Contains(out.String(), "1 succeeded, 1 failed, 1 skipped") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
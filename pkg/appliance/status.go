@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	"github.com/appgate/sdpctl/pkg/events"
 	"github.com/appgate/sdpctl/pkg/tui"
 	"github.com/appgate/sdpctl/pkg/util"
 	"github.com/cenkalti/backoff/v4"
@@ -41,6 +42,7 @@ func (u *ApplianceStatus) WaitForApplianceStatus(ctx context.Context, appliance
 				if tracker != nil {
 					tracker.Update(current)
 				}
+				events.FromContext(ctx).Status(appliance.GetName(), current)
 				if !util.InSlice(current, want) {
 					return fmt.Errorf("Want status %s, got %s", want, current)
 				}
@@ -84,6 +86,7 @@ func (u *ApplianceStatus) WaitForApplianceState(ctx context.Context, appliance o
 				if tracker != nil {
 					tracker.Update(state)
 				}
+				events.FromContext(ctx).Status(appliance.GetName(), state)
 				if !util.InSlice(state, want) {
 					return fmt.Errorf("never reached desired state %s", want)
 				}
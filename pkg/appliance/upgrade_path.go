@@ -0,0 +1,137 @@
+package appliance
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// ErrNoUpgradePath is returned when there is no supported sequence of upgrades between two versions
+var ErrNoUpgradePath = errors.New("no supported upgrade path")
+
+// upgradeEdges are the supported direct upgrades from each minor release. An appliance can always be upgraded
+// to a newer patch release of the same minor release. Minor releases which are not listed are not restricted,
+// since sdpctl can't know the upgrade paths of releases newer than itself.
+//
+// The table is maintained by hand from the supported upgrade paths in the release notes of each Appgate SDP release,
+// and a new entry must be added for each minor release. Since an outdated entry would block a supported upgrade,
+// 'upgrade prepare' and 'upgrade complete' have --ignore-upgrade-path to continue with a warning instead.
+var upgradeEdges = map[string][]string{
+	"5.1": {"5.2", "5.3"},
+	"5.2": {"5.3", "5.4"},
+	"5.3": {"5.4", "5.5"},
+	"5.4": {"5.5", "6.0"},
+	"5.5": {"6.0", "6.1"},
+	"6.0": {"6.1"},
+}
+
+func minorRelease(v *version.Version) string {
+	s := v.Segments()
+	return fmt.Sprintf("%d.%d", s[0], s[1])
+}
+
+func knownRelease(release string) bool {
+	if _, ok := upgradeEdges[release]; ok {
+		return true
+	}
+	for _, edges := range upgradeEdges {
+		for _, e := range edges {
+			if e == release {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanUpgradeDirectly returns true if an appliance running from can be upgraded to version to in a single upgrade
+func CanUpgradeDirectly(from, to *version.Version) bool {
+	if !to.GreaterThan(from) {
+		return true
+	}
+	f, t := minorRelease(from), minorRelease(to)
+	if f == t || !knownRelease(f) || !knownRelease(t) {
+		return true
+	}
+	for _, e := range upgradeEdges[f] {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// shortestUpgradePath does a breadth first search over the supported upgrades between minor releases. hop returns the
+// version to upgrade to for a minor release, or false if it can't be used. The furthest upgrade from each release is
+// tried first, so the newest intermediate releases are preferred when there are several paths with the same length.
+func shortestUpgradePath(from, to *version.Version, hop func(release string) (*version.Version, bool)) []*version.Version {
+	type node struct {
+		version *version.Version
+		path    []*version.Version
+	}
+	queue := []node{{version: from}}
+	visited := map[string]bool{minorRelease(from): true}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if CanUpgradeDirectly(n.version, to) {
+			return append(n.path, to)
+		}
+		edges := upgradeEdges[minorRelease(n.version)]
+		for i := len(edges) - 1; i >= 0; i-- {
+			if visited[edges[i]] {
+				continue
+			}
+			v, ok := hop(edges[i])
+			if !ok {
+				continue
+			}
+			visited[edges[i]] = true
+			path := append(append([]*version.Version{}, n.path...), v)
+			queue = append(queue, node{version: v, path: path})
+		}
+	}
+	return nil
+}
+
+// PlanUpgradePath returns the versions to upgrade through, in order, to get from one version to another using only
+// supported direct upgrades. The intermediate hops are selected from the available versions, such as the images in the
+// image store, using the latest patch release of each minor release. The last hop is always the target version.
+func PlanUpgradePath(from, to *version.Version, available []*version.Version) ([]*version.Version, error) {
+	latest := map[string]*version.Version{}
+	for _, v := range available {
+		if len(v.Prerelease()) > 0 || !v.GreaterThan(from) || !v.LessThan(to) {
+			continue
+		}
+		release := minorRelease(v)
+		if release == minorRelease(from) || release == minorRelease(to) {
+			continue
+		}
+		if current, ok := latest[release]; !ok || v.GreaterThan(current) {
+			latest[release] = v
+		}
+	}
+	path := shortestUpgradePath(from, to, func(release string) (*version.Version, bool) {
+		v, ok := latest[release]
+		return v, ok
+	})
+	if path != nil {
+		return path, nil
+	}
+
+	// report which releases are needed, regardless of the available versions
+	required := shortestUpgradePath(from, to, func(release string) (*version.Version, bool) {
+		v, err := version.NewVersion(release)
+		return v, err == nil
+	})
+	if len(required) <= 1 {
+		return nil, fmt.Errorf("%w from %s to %s", ErrNoUpgradePath, from.String(), to.String())
+	}
+	releases := []string{}
+	for _, r := range required[:len(required)-1] {
+		releases = append(releases, minorRelease(r))
+	}
+	return nil, fmt.Errorf("%w from %s to %s, it requires an upgrade image for %s", ErrNoUpgradePath, from.String(), to.String(), strings.Join(releases, " and "))
+}
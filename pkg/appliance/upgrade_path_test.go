@@ -0,0 +1,97 @@
+package appliance
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+)
+
+func TestPlanUpgradePath(t *testing.T) {
+	versions := func(vs ...string) []*version.Version {
+		result := []*version.Version{}
+		for _, v := range vs {
+			result = append(result, version.Must(version.NewVersion(v)))
+		}
+		return result
+	}
+	tests := []struct {
+		name      string
+		from      string
+		to        string
+		available []*version.Version
+		want      []string
+		wantErr   string
+	}{
+		{
+			name: "patch release",
+			from: "5.5.1+1234",
+			to:   "5.5.4+2345",
+			want: []string{"5.5.4+2345"},
+		},
+		{
+			name: "direct upgrade",
+			from: "5.5.1+1234",
+			to:   "6.1.0+4000",
+			want: []string{"6.1.0+4000"},
+		},
+		{
+			name:      "one intermediate hop",
+			from:      "5.3.4+24950",
+			to:        "6.1.0+4000",
+			available: versions("5.4.2+1000", "5.5.2+2000", "5.5.4+2100", "5.5.5-beta+2200", "6.0.1+3000", "6.1.0+4000"),
+			want:      []string{"5.5.4+2100", "6.1.0+4000"},
+		},
+		{
+			name:      "two intermediate hops",
+			from:      "5.2.0+100",
+			to:        "6.1.0+4000",
+			available: versions("5.3.1+900", "5.4.2+1000", "5.5.2+2000", "6.0.1+3000"),
+			want:      []string{"5.4.2+1000", "6.0.1+3000", "6.1.0+4000"},
+		},
+		{
+			name:      "prefer available images",
+			from:      "5.3.4+24950",
+			to:        "6.0.1+3000",
+			available: versions("5.4.2+1000"),
+			want:      []string{"5.4.2+1000", "6.0.1+3000"},
+		},
+		{
+			name:    "missing intermediate image",
+			from:    "5.3.4+24950",
+			to:      "6.1.0+4000",
+			wantErr: "requires an upgrade image for 5.5",
+		},
+		{
+			name: "unknown release",
+			from: "6.1.0+4000",
+			to:   "6.3.0+5000",
+			want: []string{"6.3.0+5000"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := version.Must(version.NewVersion(tt.from))
+			to := version.Must(version.NewVersion(tt.to))
+			got, err := PlanUpgradePath(from, to, tt.available)
+			if len(tt.wantErr) > 0 {
+				if !errors.Is(err, ErrNoUpgradePath) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("PlanUpgradePath() expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PlanUpgradePath() error = %s", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("PlanUpgradePath() got %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i].Original() != tt.want[i] {
+					t.Errorf("PlanUpgradePath() got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package appliance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	"github.com/appgate/sdpctl/pkg/util"
+	"github.com/hashicorp/go-version"
+	log "github.com/sirupsen/logrus"
+)
+
+// Names of the stages in an upgrade plan. The same names are used for the steps in the upgrade journal.
+const (
+	StageBackup                = "backup"
+	StagePrimaryController     = "primary-controller"
+	StageAdditionalControllers = "additional-controllers"
+	StageLogForwardersServers  = "logforwarders-logservers"
+	StageBatchPrefix           = "batch-"
+)
+
+// Reasons for skipping an appliance in an upgrade plan
+const (
+	SkipReasonFiltered = "excluded by filter"
+	SkipReasonOffline  = "appliance is offline"
+	// SkipReasonStatusFailed is used when the upgrade status of the appliance could not be read
+	SkipReasonStatusFailed = "could not read the upgrade status"
+)
+
+// ErrNothingToUpgrade is returned when no appliance in the collective has a prepared upgrade
+var ErrNothingToUpgrade = errors.New("No appliances are ready to upgrade. Please run 'upgrade prepare' before trying to complete an upgrade")
+
+// UpgradePlan is the order in which 'upgrade complete' upgrades the appliances in the collective.
+// The primary controller is always upgraded first, followed by the additional controllers,
+// the LogForwarders and LogServers when upgrading from 5.x to 6.x, and finally the rest of the
+// appliances in batches.
+type UpgradePlan struct {
+	PrimaryController       *openapi.Appliance
+	UpgradePrimary          bool
+	AdditionalControllers   []openapi.Appliance
+	LogForwardersAndServers []openapi.Appliance
+	Batches                 [][]openapi.Appliance
+	BatchOptions            []BatchOptions
+	Skipped                 []SkippedAppliance
+	FromVersion             *version.Version
+	ToVersion               *version.Version
+	DisableControllers      bool
+	// StatusErr is the first error reading the upgrade status of the appliances which were skipped
+	// with SkipReasonStatusFailed. It is up to the caller whether the upgrade can continue without them.
+	StatusErr error
+	// MaxUnavailable limits how many appliances of each site and function are upgraded at the same time
+	MaxUnavailable MaxUnavailable
+	// Online are the online appliances of the collective, including those which are not upgraded,
+	// which the max unavailable percentages are computed from
+	Online []openapi.Appliance
+
+	currentVersions map[string]*version.Version
+	targetVersions  map[string]*version.Version
+}
+
+// SkippedAppliance is an appliance which is not part of the upgrade plan
+type SkippedAppliance struct {
+	Appliance openapi.Appliance
+	Reason    string
+}
+
+// NewUpgradePlan computes the upgrade plan for the given appliances, which are expected to be online.
+// Appliances without a prepared upgrade are added to the skipped appliances.
+func NewUpgradePlan(ctx context.Context, a *Appliance, appliances []openapi.Appliance, primaryController openapi.Appliance, stats openapi.StatsAppliancesList) (*UpgradePlan, error) {
+	plan := &UpgradePlan{
+		PrimaryController: &primaryController,
+		Skipped:           []SkippedAppliance{},
+		currentVersions:   make(map[string]*version.Version),
+		targetVersions:    make(map[string]*version.Version),
+	}
+	var err error
+	if plan.FromVersion, err = GetApplianceVersion(primaryController, stats); err != nil {
+		return nil, err
+	}
+	plan.currentVersions[primaryController.GetId()] = plan.FromVersion
+
+	// We will exclude the primary controller from the others controllers
+	// since the primary controller is a special case during the upgrade process.
+	others := make([]openapi.Appliance, 0, len(appliances))
+	for _, appliance := range appliances {
+		if appliance.GetId() != primaryController.GetId() {
+			others = append(others, appliance)
+		}
+	}
+
+	upgradeStatuses, err := a.UpgradeStatusMap(ctx, others)
+	if err != nil {
+		log.WithError(err).Warn("could not read the upgrade status of all appliances")
+		plan.StatusErr = err
+	}
+	ready := make([]openapi.Appliance, 0, len(others))
+	for _, appliance := range others {
+		result := upgradeStatuses[appliance.GetId()]
+		if current, err := GetApplianceVersion(appliance, stats); err == nil {
+			plan.currentVersions[appliance.GetId()] = current
+		}
+		if result.Err != nil {
+			plan.Skip(appliance, SkipReasonStatusFailed)
+			continue
+		}
+		if !util.InSlice(result.Status, []string{UpgradeStatusReady, UpgradeStatusSuccess}) {
+			log.WithField("appliance", appliance.GetName()).Infof("Excluding from upgrade")
+			plan.Skip(appliance, fmt.Sprintf("upgrade status is %s", result.Status))
+			continue
+		}
+		if target, err := ParseVersionString(result.Details); err == nil {
+			plan.targetVersions[appliance.GetId()] = target
+		}
+		ready = append(ready, appliance)
+	}
+	groups := GroupByFunctions(ready)
+
+	// isolate additional controllers
+	plan.AdditionalControllers = groups[FunctionController]
+	isolated := make(map[string]bool)
+	for _, ctrl := range plan.AdditionalControllers {
+		isolated[ctrl.GetId()] = true
+	}
+
+	// isolate log forwarders and log servers
+	// this is only needed when upgrading to version 6.0 from 5.x, so we need to check for this particular case
+	v6, err := version.NewConstraint(">= 6.0.0-beta")
+	if err != nil {
+		return nil, err
+	}
+	plan.LogForwardersAndServers = []openapi.Appliance{}
+	for _, lfs := range append(groups[FunctionLogServer], groups[FunctionLogForwarder]...) {
+		currentVersion, ok := plan.currentVersions[lfs.GetId()]
+		if !ok {
+			return nil, fmt.Errorf("could not determine appliance version %s", lfs.GetName())
+		}
+		upgradeVersion, err := ParseVersionString(upgradeStatuses[lfs.GetId()].Details)
+		if err != nil {
+			return nil, err
+		}
+		if v6.Check(upgradeVersion) && !v6.Check(currentVersion) && !isolated[lfs.GetId()] {
+			isolated[lfs.GetId()] = true
+			plan.LogForwardersAndServers = append(plan.LogForwardersAndServers, lfs)
+		}
+	}
+	additionalAppliances := []openapi.Appliance{}
+	for _, app := range ready {
+		if !isolated[app.GetId()] {
+			additionalAppliances = append(additionalAppliances, app)
+		}
+	}
+
+	primaryControllerUpgradeStatus, err := a.UpgradeStatus(ctx, primaryController.GetId())
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to get upgrade status")
+		return nil, err
+	}
+	plan.UpgradePrimary = primaryControllerUpgradeStatus.GetStatus() == UpgradeStatusReady
+	plan.ToVersion, err = ParseVersionString(primaryControllerUpgradeStatus.GetDetails())
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to determine upgrade version")
+	}
+	if plan.UpgradePrimary && plan.ToVersion != nil {
+		plan.targetVersions[primaryController.GetId()] = plan.ToVersion
+	} else if !plan.UpgradePrimary {
+		plan.Skip(primaryController, fmt.Sprintf("upgrade status is %s", primaryControllerUpgradeStatus.GetStatus()))
+	}
+
+	if !plan.UpgradePrimary && len(plan.AdditionalControllers) <= 0 && len(additionalAppliances) <= 0 {
+		return nil, ErrNothingToUpgrade
+	}
+	if plan.ToVersion != nil {
+		plan.DisableControllers = ShouldDisable(plan.FromVersion, plan.ToVersion)
+	}
+
+	// chunks include slices of slices, divided in chunkSize,
+	// the chunkSize represent the number of goroutines used
+	// for pararell upgrades, each chunk the slice has tried to split
+	// the appliances based on site and function to avoid downtime
+	// the chunkSize is determined by the number of active sites.
+	chunkSize := ActiveSitesInAppliances(additionalAppliances)
+	plan.Batches = ChunkApplianceGroup(chunkSize, SplitAppliancesByGroup(additionalAppliances))
+
+	return plan, nil
+}
+
+// Skip adds the appliance to the skipped appliances in the plan
+func (p *UpgradePlan) Skip(appliance openapi.Appliance, reason string) {
+	p.Skipped = append(p.Skipped, SkippedAppliance{Appliance: appliance, Reason: reason})
+}
+
+// SkippedBecause returns the skipped appliances with the given reason
+func (p *UpgradePlan) SkippedBecause(reason string) []openapi.Appliance {
+	result := []openapi.Appliance{}
+	for _, s := range p.Skipped {
+		if s.Reason == reason {
+			result = append(result, s.Appliance)
+		}
+	}
+	return result
+}
+
+// Appliances returns all appliances in the plan in upgrade order, except the primary controller
+func (p *UpgradePlan) Appliances() []openapi.Appliance {
+	result := []openapi.Appliance{}
+	result = append(result, p.AdditionalControllers...)
+	result = append(result, p.LogForwardersAndServers...)
+	for _, b := range p.Batches {
+		result = append(result, b...)
+	}
+	return result
+}
+
+// BatchName is the stage name of the batch with the given zero-based index
+func BatchName(index int) string {
+	return fmt.Sprintf("%s%d", StageBatchPrefix, index+1)
+}
+
+// UpgradePlanOutput is the machine readable form of an UpgradePlan
+type UpgradePlanOutput struct {
+	Host               string          `json:"host" yaml:"host"`
+	GeneratedAt        time.Time       `json:"generated_at" yaml:"generated_at"`
+	FromVersion        string          `json:"from_version,omitempty" yaml:"from_version,omitempty"`
+	ToVersion          string          `json:"to_version,omitempty" yaml:"to_version,omitempty"`
+	DisableControllers bool            `json:"disable_controllers" yaml:"disable_controllers"`
+	MaxUnavailable     string          `json:"max_unavailable,omitempty" yaml:"max_unavailable,omitempty"`
+	Stages             []PlanStage     `json:"stages" yaml:"stages"`
+	Skipped            []PlanAppliance `json:"skipped" yaml:"skipped"`
+}
+
+// PlanStage is a group of appliances which are upgraded together
+type PlanStage struct {
+	Name        string          `json:"name" yaml:"name"`
+	Label       string          `json:"label,omitempty" yaml:"label,omitempty"`
+	MaxParallel int             `json:"max_parallel,omitempty" yaml:"max_parallel,omitempty"`
+	Pause       string          `json:"pause,omitempty" yaml:"pause,omitempty"`
+	Canary      bool            `json:"canary,omitempty" yaml:"canary,omitempty"`
+	Appliances  []PlanAppliance `json:"appliances" yaml:"appliances"`
+}
+
+// PlanAppliance describes a single appliance in the upgrade plan
+type PlanAppliance struct {
+	ID             string   `json:"id" yaml:"id"`
+	Name           string   `json:"name" yaml:"name"`
+	Site           string   `json:"site,omitempty" yaml:"site,omitempty"`
+	Functions      []string `json:"functions" yaml:"functions"`
+	CurrentVersion string   `json:"current_version,omitempty" yaml:"current_version,omitempty"`
+	TargetVersion  string   `json:"target_version,omitempty" yaml:"target_version,omitempty"`
+	Reason         string   `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// Output returns the plan in a form suitable for JSON or YAML encoding
+func (p *UpgradePlan) Output(host string) UpgradePlanOutput {
+	out := UpgradePlanOutput{
+		Host:               host,
+		GeneratedAt:        time.Now(),
+		DisableControllers: p.DisableControllers,
+		MaxUnavailable:     p.MaxUnavailable.String(),
+		Stages:             []PlanStage{},
+		Skipped:            []PlanAppliance{},
+	}
+	if p.FromVersion != nil {
+		out.FromVersion = p.FromVersion.String()
+	}
+	if p.ToVersion != nil {
+		out.ToVersion = p.ToVersion.String()
+	}
+	addStage := func(name string, appliances []openapi.Appliance, opts BatchOptions) {
+		if len(appliances) <= 0 {
+			return
+		}
+		stage := PlanStage{
+			Name:        name,
+			Label:       opts.Label,
+			MaxParallel: opts.MaxParallel,
+			Canary:      opts.Canary,
+			Appliances:  []PlanAppliance{},
+		}
+		if opts.Pause > 0 {
+			stage.Pause = opts.Pause.String()
+		}
+		for _, a := range appliances {
+			stage.Appliances = append(stage.Appliances, p.planAppliance(a, ""))
+		}
+		out.Stages = append(out.Stages, stage)
+	}
+	if p.UpgradePrimary {
+		addStage(StagePrimaryController, []openapi.Appliance{*p.PrimaryController}, BatchOptions{})
+	}
+	addStage(StageAdditionalControllers, p.AdditionalControllers, BatchOptions{})
+	addStage(StageLogForwardersServers, p.LogForwardersAndServers, BatchOptions{})
+	for i, batch := range p.Batches {
+		addStage(BatchName(i), batch, p.Batch(i))
+	}
+	for _, s := range p.Skipped {
+		out.Skipped = append(out.Skipped, p.planAppliance(s.Appliance, s.Reason))
+	}
+	return out
+}
+
+// Describe returns the site, functions and versions of an appliance in the plan
+func (p *UpgradePlan) Describe(a openapi.Appliance) PlanAppliance {
+	return p.planAppliance(a, "")
+}
+
+func (p *UpgradePlan) planAppliance(a openapi.Appliance, reason string) PlanAppliance {
+	pa := PlanAppliance{
+		ID:        a.GetId(),
+		Name:      a.GetName(),
+		Site:      a.GetSiteName(),
+		Functions: GetActiveFunctions(a),
+		Reason:    reason,
+	}
+	if v, ok := p.currentVersions[a.GetId()]; ok && v != nil {
+		pa.CurrentVersion = v.String()
+	}
+	if v, ok := p.targetVersions[a.GetId()]; ok && v != nil {
+		pa.TargetVersion = v.String()
+	}
+	return pa
+}
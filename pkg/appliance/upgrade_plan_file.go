@@ -0,0 +1,192 @@
+package appliance
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// UpgradePlanFile is a user supplied list of ordered stages, which replaces the automatic
+// batching of the additional appliances in an upgrade plan. The primary controller, the additional
+// controllers and the LogForwarders/LogServers are always upgraded first, and can't be part of a stage.
+//
+//	stages:
+//	  - name: site-a-gateways
+//	    include:
+//	      site: 8a4add9e-0e99-4bb1-949c-c9faf9a49ad4
+//	      function: gateway
+//	    max-parallel: 1
+//	    pause: 10m
+type UpgradePlanFile struct {
+	Stages []UpgradePlanFileStage `yaml:"stages"`
+}
+
+// UpgradePlanFileStage selects the appliances of a stage, using the same keywords as the --include and --exclude flags.
+// All the include keywords must match for an appliance to be selected.
+type UpgradePlanFileStage struct {
+	Name        string            `yaml:"name"`
+	Include     map[string]string `yaml:"include"`
+	Exclude     map[string]string `yaml:"exclude"`
+	MaxParallel int               `yaml:"max-parallel"`
+	Pause       time.Duration     `yaml:"pause"`
+}
+
+// BatchOptions controls how a batch of additional appliances is upgraded
+type BatchOptions struct {
+	// Label is the name of the user defined stage, if any
+	Label string
+	// MaxParallel is the maximum number of appliances upgraded at the same time, 0 means no limit
+	MaxParallel int
+	// Pause is the time to wait after the batch before starting the next one
+	Pause time.Duration
+	// Canary is set on the batch of canary appliances, which is verified before the next batch starts
+	Canary bool
+}
+
+// ReadUpgradePlanFile reads and validates an upgrade plan file in YAML or JSON format
+func ReadUpgradePlanFile(path string) (*UpgradePlanFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	f := &UpgradePlanFile{}
+	if err := dec.Decode(f); err != nil {
+		return nil, fmt.Errorf("Could not read upgrade plan %s: %w", path, err)
+	}
+	if err := f.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid upgrade plan %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (f *UpgradePlanFile) validate() error {
+	if len(f.Stages) <= 0 {
+		return errors.New("no stages defined")
+	}
+	names := make(map[string]bool)
+	for i, s := range f.Stages {
+		if len(s.Name) <= 0 {
+			return fmt.Errorf("stage #%d has no name", i+1)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("stage name %q is used more than once", s.Name)
+		}
+		names[s.Name] = true
+		if len(s.Include) <= 0 {
+			return fmt.Errorf("stage %q has no include selector", s.Name)
+		}
+		if s.MaxParallel < 0 {
+			return fmt.Errorf("stage %q has a negative max-parallel", s.Name)
+		}
+		if s.Pause < 0 {
+			return fmt.Errorf("stage %q has a negative pause", s.Name)
+		}
+	}
+	return nil
+}
+
+// ApplyStages replaces the batches of the plan with the stages in the plan file.
+// Controllers, LogForwarders/LogServers and skipped appliances which are selected by a stage are left
+// where they are, and additional appliances which are not selected by any stage are added in automatic
+// batches after the last stage.
+func (p *UpgradePlan) ApplyStages(f *UpgradePlanFile) error {
+	pool := []openapi.Appliance{}
+	for _, b := range p.Batches {
+		pool = append(pool, b...)
+	}
+	// appliances which are part of the plan, but not in a batch
+	fixed := map[string]string{p.PrimaryController.GetId(): StagePrimaryController}
+	for _, a := range p.AdditionalControllers {
+		fixed[a.GetId()] = StageAdditionalControllers
+	}
+	for _, a := range p.LogForwardersAndServers {
+		fixed[a.GetId()] = StageLogForwardersServers
+	}
+	candidates := append([]openapi.Appliance{*p.PrimaryController}, p.AdditionalControllers...)
+	candidates = append(candidates, p.LogForwardersAndServers...)
+	candidates = append(candidates, pool...)
+	for _, s := range p.Skipped {
+		candidates = append(candidates, s.Appliance)
+	}
+
+	ready := make(map[string]bool, len(pool))
+	for _, a := range pool {
+		ready[a.GetId()] = true
+	}
+	assigned := make(map[string]string)
+	batches := [][]openapi.Appliance{}
+	options := []BatchOptions{}
+	for _, stage := range f.Stages {
+		batch := []openapi.Appliance{}
+		for _, a := range selectAppliances(candidates, stage.Include, stage.Exclude) {
+			logEntry := log.WithFields(log.Fields{"stage": stage.Name, "appliance": a.GetName()})
+			if name, ok := fixed[a.GetId()]; ok {
+				logEntry.Infof("appliance is upgraded in the %s stage", name)
+				continue
+			}
+			if !ready[a.GetId()] {
+				logEntry.Warn("appliance is not ready for upgrade and will be skipped")
+				continue
+			}
+			if other, ok := assigned[a.GetId()]; ok {
+				return fmt.Errorf("%s is selected by both stage %q and %q", a.GetName(), other, stage.Name)
+			}
+			assigned[a.GetId()] = stage.Name
+			batch = append(batch, a)
+		}
+		if len(batch) <= 0 {
+			return fmt.Errorf("stage %q does not select any appliance that is ready for upgrade", stage.Name)
+		}
+		batches = append(batches, batch)
+		options = append(options, BatchOptions{
+			Label:       stage.Name,
+			MaxParallel: stage.MaxParallel,
+			Pause:       stage.Pause,
+		})
+	}
+
+	remaining := []openapi.Appliance{}
+	for _, a := range pool {
+		if _, ok := assigned[a.GetId()]; !ok {
+			remaining = append(remaining, a)
+		}
+	}
+	if len(remaining) > 0 {
+		log.WithField("count", len(remaining)).Info("appliances not selected by any stage are upgraded in automatic batches")
+		for _, b := range ChunkApplianceGroup(ActiveSitesInAppliances(remaining), SplitAppliancesByGroup(remaining)) {
+			batches = append(batches, b)
+			options = append(options, BatchOptions{})
+		}
+	}
+	p.Batches = batches
+	p.BatchOptions = options
+	return nil
+}
+
+// Batch returns the options for the batch with the given zero-based index
+func (p *UpgradePlan) Batch(index int) BatchOptions {
+	if index < len(p.BatchOptions) {
+		return p.BatchOptions[index]
+	}
+	return BatchOptions{}
+}
+
+// selectAppliances returns the appliances matching all the include keywords and none of the exclude keywords
+func selectAppliances(appliances []openapi.Appliance, include, exclude map[string]string) []openapi.Appliance {
+	result := appliances
+	for k, v := range include {
+		result = applyApplianceFilter(result, map[string]string{k: v})
+	}
+	if len(exclude) > 0 {
+		return FilterAppliances(result, map[string]map[string]string{"exclude": exclude})
+	}
+	return result
+}
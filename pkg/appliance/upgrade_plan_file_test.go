@@ -0,0 +1,187 @@
+package appliance
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+)
+
+func writePlanFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plan.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("internal testing error: %s", err)
+	}
+	return path
+}
+
+func TestReadUpgradePlanFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr *regexp.Regexp
+	}{
+		{
+			name: "valid plan",
+			content: `
+stages:
+  - name: site-a
+    include:
+      site: siteA
+      function: gateway
+    max-parallel: 1
+    pause: 5m
+`,
+		},
+		{
+			name:    "no stages",
+			content: "stages: []\n",
+			wantErr: regexp.MustCompile(`no stages defined`),
+		},
+		{
+			name: "duplicate stage name",
+			content: `
+stages:
+  - name: a
+    include: {name: g1}
+  - name: a
+    include: {name: g2}
+`,
+			wantErr: regexp.MustCompile(`stage name "a" is used more than once`),
+		},
+		{
+			name: "missing selector",
+			content: `
+stages:
+  - name: a
+`,
+			wantErr: regexp.MustCompile(`stage "a" has no include selector`),
+		},
+		{
+			name: "unknown field",
+			content: `
+stages:
+  - name: a
+    include: {name: g1}
+    parallel: 2
+`,
+			wantErr: regexp.MustCompile(`field parallel not found`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ReadUpgradePlanFile(writePlanFile(t, tt.content))
+			if tt.wantErr != nil {
+				if err == nil || !tt.wantErr.MatchString(err.Error()) {
+					t.Fatalf("expected error matching %s, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadUpgradePlanFile() error = %s", err)
+			}
+			if f.Stages[0].Pause != 5*time.Minute || f.Stages[0].MaxParallel != 1 {
+				t.Errorf("unexpected stage %+v", f.Stages[0])
+			}
+		})
+	}
+}
+
+func TestUpgradePlanApplyStages(t *testing.T) {
+	gateway := func(id, site string) openapi.Appliance {
+		return openapi.Appliance{
+			Id:      openapi.PtrString(id),
+			Name:    id,
+			Site:    openapi.PtrString(site),
+			Gateway: &openapi.ApplianceAllOfGateway{Enabled: openapi.PtrBool(true)},
+		}
+	}
+	portal := openapi.Appliance{
+		Id:     openapi.PtrString("p1"),
+		Name:   "p1",
+		Site:   openapi.PtrString("siteA"),
+		Portal: &openapi.Portal{Enabled: openapi.PtrBool(true)},
+	}
+	primary := openapi.Appliance{
+		Id:         openapi.PtrString("c1"),
+		Name:       "c1",
+		Site:       openapi.PtrString("siteA"),
+		Controller: &openapi.ApplianceAllOfController{Enabled: openapi.PtrBool(true)},
+	}
+	newPlan := func() *UpgradePlan {
+		return &UpgradePlan{
+			PrimaryController: &primary,
+			Batches: [][]openapi.Appliance{
+				{gateway("g1", "siteA"), gateway("g2", "siteB"), portal},
+				{gateway("g3", "siteA")},
+			},
+			Skipped: []SkippedAppliance{{Appliance: gateway("g4", "siteA"), Reason: "upgrade status is idle"}},
+		}
+	}
+	names := func(batches [][]openapi.Appliance) [][]string {
+		result := [][]string{}
+		for _, b := range batches {
+			n := []string{}
+			for _, a := range b {
+				n = append(n, a.GetName())
+			}
+			result = append(result, n)
+		}
+		return result
+	}
+
+	t.Run("site stages with automatic remainder", func(t *testing.T) {
+		plan := newPlan()
+		err := plan.ApplyStages(&UpgradePlanFile{Stages: []UpgradePlanFileStage{
+			{Name: "site-a-gateways", Include: map[string]string{"site": "siteA", "function": "gateway"}, MaxParallel: 1, Pause: time.Minute},
+			{Name: "site-b", Include: map[string]string{"site": "siteB"}},
+		}})
+		if err != nil {
+			t.Fatalf("ApplyStages() error = %s", err)
+		}
+		got := names(plan.Batches)
+		want := [][]string{{"g1", "g3"}, {"g2"}, {"p1"}}
+		if len(got) != len(want) {
+			t.Fatalf("want %v, got %v", want, got)
+		}
+		for i := range want {
+			if len(got[i]) != len(want[i]) {
+				t.Fatalf("want %v, got %v", want, got)
+			}
+			for j := range want[i] {
+				if got[i][j] != want[i][j] {
+					t.Fatalf("want %v, got %v", want, got)
+				}
+			}
+		}
+		if b := plan.Batch(0); b.Label != "site-a-gateways" || b.MaxParallel != 1 || b.Pause != time.Minute {
+			t.Errorf("unexpected batch options %+v", b)
+		}
+		if b := plan.Batch(2); b.Label != "" {
+			t.Errorf("expected automatic batch, got %+v", b)
+		}
+	})
+
+	t.Run("overlapping stages", func(t *testing.T) {
+		err := newPlan().ApplyStages(&UpgradePlanFile{Stages: []UpgradePlanFileStage{
+			{Name: "first", Include: map[string]string{"name": "g1"}},
+			{Name: "second", Include: map[string]string{"site": "siteA"}},
+		}})
+		if err == nil || !regexp.MustCompile(`g1 is selected by both stage "first" and "second"`).MatchString(err.Error()) {
+			t.Fatalf("expected overlap error, got %v", err)
+		}
+	})
+
+	t.Run("stage with only controllers and skipped appliances", func(t *testing.T) {
+		err := newPlan().ApplyStages(&UpgradePlanFile{Stages: []UpgradePlanFileStage{
+			{Name: "nothing", Include: map[string]string{"name": "c1|g4"}},
+		}})
+		if err == nil || !regexp.MustCompile(`stage "nothing" does not select any appliance`).MatchString(err.Error()) {
+			t.Fatalf("expected empty stage error, got %v", err)
+		}
+	})
+}
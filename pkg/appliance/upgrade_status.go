@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	"github.com/appgate/sdpctl/pkg/events"
 	"github.com/appgate/sdpctl/pkg/tui"
 	"github.com/appgate/sdpctl/pkg/util"
 	"github.com/cenkalti/backoff/v4"
@@ -40,21 +41,23 @@ func (u *UpgradeStatus) upgradeStatus(ctx context.Context, appliance openapi.App
 	logEntry := log.WithField("appliance", name)
 	logEntry.WithField("want", desiredStatuses).Info("polling for upgrade status")
 	hasRebooted := false
+	stream := events.FromContext(ctx)
 	return func() error {
 		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 		defer cancel()
 		status, err := u.Appliance.UpgradeStatus(ctx, appliance.GetId())
 		if err != nil {
+			current := "installing"
+			if errors.Is(err, context.DeadlineExceeded) {
+				current = "rebooting, waiting for appliance to come back online"
+				hasRebooted = true
+			} else if hasRebooted {
+				current = "switching partition"
+			}
 			if tracker != nil {
-				if errors.Is(err, context.DeadlineExceeded) {
-					tracker.Update("rebooting, waiting for appliance to come back online")
-					hasRebooted = true
-				} else if hasRebooted {
-					tracker.Update("switching partition")
-				} else {
-					tracker.Update("installing")
-				}
+				tracker.Update(current)
 			}
+			stream.Status(name, current)
 			logEntry.WithError(err).Debug("appliance unreachable")
 			return err
 		}
@@ -66,6 +69,7 @@ func (u *UpgradeStatus) upgradeStatus(ctx context.Context, appliance openapi.App
 			if tracker != nil {
 				tracker.Update(s)
 			}
+			stream.Status(name, s)
 			if util.InSlice(s, undesiredStatuses) {
 				return backoff.Permanent(fmt.Errorf("Upgrade failed on %s - %s", name, details))
 			}
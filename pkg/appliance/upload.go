@@ -0,0 +1,87 @@
+package appliance
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"os"
+)
+
+// MultipartFile streams a file from disk as a multipart/form-data request body.
+// The file content is never buffered in memory, and the body can be recreated
+// any number of times, for example when an upload needs to be retried in full.
+type MultipartFile struct {
+	file          io.ReaderAt
+	name          string
+	size          int64
+	boundary      string
+	contentLength int64
+}
+
+// NewMultipartFile prepares the multipart envelope for file and computes the exact
+// Content-Length of the resulting request body.
+func NewMultipartFile(file *os.File) (*MultipartFile, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	m := &MultipartFile{
+		file: file,
+		name: stat.Name(),
+		size: stat.Size(),
+	}
+
+	// write the envelope without the file content to determine the overhead
+	// of the multipart headers and trailer, using the same boundary as the real body.
+	envelope := &bytes.Buffer{}
+	w := multipart.NewWriter(envelope)
+	m.boundary = w.Boundary()
+	if _, err := w.CreateFormFile("file", m.name); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	m.contentLength = int64(envelope.Len()) + m.size
+
+	return m, nil
+}
+
+// Name is the base name of the file being uploaded
+func (m *MultipartFile) Name() string {
+	return m.name
+}
+
+// ContentLength is the total size of the request body in bytes, including the multipart envelope
+func (m *MultipartFile) ContentLength() int64 {
+	return m.contentLength
+}
+
+// ContentType returns the multipart/form-data content type, including the boundary
+func (m *MultipartFile) ContentType() string {
+	return "multipart/form-data; boundary=" + m.boundary
+}
+
+// Reader returns a new streaming request body. The file is read from the beginning
+// through an io.Pipe, so only a small buffer is held in memory at any given time.
+func (m *MultipartFile) Reader() io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		w := multipart.NewWriter(pw)
+		if err := w.SetBoundary(m.boundary); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		part, err := w.CreateFormFile("file", m.name)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, io.NewSectionReader(m.file, 0, m.size)); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(w.Close())
+	}()
+	return pr
+}
@@ -0,0 +1,147 @@
+package appliance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appgate/sdpctl/pkg/httpmock"
+)
+
+func writeTestImage(t *testing.T, size int) (*os.File, []byte) {
+	t.Helper()
+	content := bytes.Repeat([]byte("appgate"), size/7+1)[:size]
+	path := filepath.Join(t.TempDir(), "appgate-5.5.1-9876.img.zip")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatalf("internal testing error: %s", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("internal testing error: %s", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f, content
+}
+
+func TestMultipartFileReader(t *testing.T) {
+	f, content := writeTestImage(t, 256*1024)
+	upload, err := NewMultipartFile(f)
+	if err != nil {
+		t.Fatalf("NewMultipartFile() error = %s", err)
+	}
+
+	// the body must be reproducible, since it is recreated on each retry
+	for i := 0; i < 2; i++ {
+		body, err := io.ReadAll(upload.Reader())
+		if err != nil {
+			t.Fatalf("failed to read body %s", err)
+		}
+		if int64(len(body)) != upload.ContentLength() {
+			t.Fatalf("content length mismatch, want %d got %d", upload.ContentLength(), len(body))
+		}
+		_, params, err := mime.ParseMediaType(upload.ContentType())
+		if err != nil {
+			t.Fatalf("invalid content type %s", err)
+		}
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("failed to read part %s", err)
+		}
+		if part.FileName() != "appgate-5.5.1-9876.img.zip" {
+			t.Errorf("wrong filename in part, got %q", part.FileName())
+		}
+		got, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("failed to read part content %s", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatal("uploaded content does not match file content")
+		}
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	f, _ := writeTestImage(t, 1024)
+	upload, err := NewMultipartFile(f)
+	if err != nil {
+		t.Fatalf("NewMultipartFile() error = %s", err)
+	}
+	tests := []struct {
+		name          string
+		status        int
+		wantErr       bool
+		wantTemporary bool
+	}{
+		{
+			name:   "upload ok",
+			status: http.StatusNoContent,
+		},
+		{
+			name:          "server error",
+			status:        http.StatusInternalServerError,
+			wantErr:       true,
+			wantTemporary: true,
+		},
+		{
+			name:    "unauthorized",
+			status:  http.StatusUnauthorized,
+			wantErr: true,
+		},
+		{
+			name:    "bad request",
+			status:  http.StatusBadRequest,
+			wantErr: true,
+		},
+		{
+			name:          "too many requests",
+			status:        http.StatusTooManyRequests,
+			wantErr:       true,
+			wantTemporary: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := httpmock.NewRegistry(t)
+			registry.Register("/files", func(rw http.ResponseWriter, r *http.Request) {
+				if r.ContentLength != upload.ContentLength() {
+					t.Errorf("expected Content-Length %d, got %d", upload.ContentLength(), r.ContentLength)
+				}
+				if len(r.TransferEncoding) > 0 {
+					t.Errorf("expected no transfer encoding, got %v", r.TransferEncoding)
+				}
+				io.Copy(io.Discard, r.Body)
+				rw.WriteHeader(tt.status)
+			})
+			defer registry.Teardown()
+			registry.Serve()
+
+			a := &Appliance{
+				APIClient:  registry.Client,
+				HTTPClient: registry.Client.GetConfig().HTTPClient,
+			}
+			if a.HTTPClient == nil {
+				a.HTTPClient = http.DefaultClient
+			}
+			headers := map[string]string{"Content-Type": upload.ContentType()}
+			err := a.UploadFile(context.Background(), upload.Reader(), upload.ContentLength(), headers)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UploadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+			var uploadErr *UploadError
+			if !errors.As(err, &uploadErr) || uploadErr.StatusCode != tt.status || uploadErr.Temporary() != tt.wantTemporary {
+				t.Errorf("UploadFile() expected upload error with status %d and temporary %t, got %#v", tt.status, tt.wantTemporary, err)
+			}
+		})
+	}
+}
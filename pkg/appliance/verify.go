@@ -0,0 +1,231 @@
+package appliance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+	"github.com/appgate/sdpctl/pkg/util"
+	"gopkg.in/yaml.v3"
+)
+
+// VerifySpec is a declarative list of checks which are run on the appliances after an upgrade,
+// or at any time with 'sdpctl appliance verify'.
+//
+//	version: 6.0.1
+//	appliances:
+//	  gateway-site1:
+//	    version: 6.0.1+29983
+//	healthy: true
+//	max-cpu: 80
+//	max-disk: 75
+//	metrics:
+//	  - name: vpn_active_sessions
+//	    function: gateway
+//	    min: 1
+//	resolve-names:
+//	  - dns://intranet.company.com
+type VerifySpec struct {
+	// Version is the version expected on all appliances, unless it is set for the appliance in Appliances
+	Version    string                     `yaml:"version"`
+	Appliances map[string]VerifyAppliance `yaml:"appliances"`
+	// Healthy requires the status of the appliances to be healthy
+	Healthy      bool         `yaml:"healthy"`
+	MaxCPU       *float64     `yaml:"max-cpu"`
+	MaxDisk      *float64     `yaml:"max-disk"`
+	Metrics      []MetricGate `yaml:"metrics"`
+	ResolveNames []string     `yaml:"resolve-names"`
+}
+
+// VerifyAppliance holds the checks for a single appliance, by name
+type VerifyAppliance struct {
+	Version string `yaml:"version"`
+}
+
+// VerifyResult is the result of one check on one appliance
+type VerifyResult struct {
+	Appliance string `json:"appliance"`
+	Check     string `json:"check"`
+	Passed    bool   `json:"passed"`
+	Message   string `json:"message,omitempty"`
+}
+
+// ReadVerifySpec reads and validates a verification file in YAML or JSON format
+func ReadVerifySpec(path string) (*VerifySpec, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	s := &VerifySpec{}
+	if err := dec.Decode(s); err != nil {
+		return nil, fmt.Errorf("Could not read verification file %s: %w", path, err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid verification file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *VerifySpec) validate() error {
+	if len(s.Version) > 0 {
+		if _, err := ParseVersionString(s.Version); err != nil {
+			return fmt.Errorf("invalid version %q", s.Version)
+		}
+	}
+	for name, a := range s.Appliances {
+		if len(a.Version) > 0 {
+			if _, err := ParseVersionString(a.Version); err != nil {
+				return fmt.Errorf("invalid version %q for %s", a.Version, name)
+			}
+		}
+	}
+	return validateMetricGates(s.Metrics)
+}
+
+func validateMetricGates(metrics []MetricGate) error {
+	for i, m := range metrics {
+		if len(m.Name) <= 0 {
+			return fmt.Errorf("metric #%d has no name", i+1)
+		}
+		if m.Min == nil && m.Max == nil {
+			return fmt.Errorf("metric %q has neither min nor max", m.Name)
+		}
+		if len(m.Function) > 0 && !validFunction(m.Function) {
+			return fmt.Errorf("unknown function %q for metric %q", m.Function, m.Name)
+		}
+	}
+	return nil
+}
+
+// Verify runs the checks of the spec on each appliance. Offline appliances fail without running any other check.
+// peerVersion is the peer API version used to read the metrics of the appliances.
+func Verify(ctx context.Context, a *Appliance, spec VerifySpec, appliances []openapi.Appliance, stats openapi.StatsAppliancesList, peerVersion int) []VerifyResult {
+	results := []VerifyResult{}
+	add := func(appliance openapi.Appliance, check string, err error) {
+		r := VerifyResult{Appliance: appliance.GetName(), Check: check, Passed: err == nil}
+		if err != nil {
+			r.Message = err.Error()
+		}
+		results = append(results, r)
+	}
+	for _, appliance := range appliances {
+		var stat *openapi.StatsAppliancesListAllOfData
+		for _, s := range stats.GetData() {
+			if s.GetId() == appliance.GetId() {
+				s := s
+				stat = &s
+			}
+		}
+		if stat == nil || !stat.GetOnline() {
+			add(appliance, "online", errors.New("appliance is offline"))
+			continue
+		}
+
+		expected := spec.Version
+		if o, ok := spec.Appliances[appliance.GetName()]; ok && len(o.Version) > 0 {
+			expected = o.Version
+		}
+		if len(expected) > 0 {
+			add(appliance, "version", checkVersion(expected, stat.GetVersion()))
+		}
+		if spec.Healthy {
+			var err error
+			if status := stat.GetStatus(); status != statusHealthy {
+				err = fmt.Errorf("status is %s", status)
+			}
+			add(appliance, "status", err)
+		}
+		if spec.MaxCPU != nil {
+			add(appliance, "cpu", checkCeiling(float64(stat.GetCpu()), *spec.MaxCPU))
+		}
+		if spec.MaxDisk != nil {
+			add(appliance, "disk", checkCeiling(float64(stat.GetDisk()), *spec.MaxDisk))
+		}
+
+		functions := GetActiveFunctions(appliance)
+		for _, m := range spec.Metrics {
+			if len(m.Function) > 0 && !util.InSlice(strings.ToLower(m.Function), lowerAll(functions)) {
+				continue
+			}
+			text, err := a.Metric(ctx, appliance.GetId(), m.Name, peerVersion)
+			if err == nil {
+				err = m.check(text)
+			}
+			add(appliance, fmt.Sprintf("metric %s", m.Name), err)
+		}
+
+		// names are resolved through the gateway function, so only gateways can run these checks
+		if !util.InSlice(FunctionGateway, functions) {
+			continue
+		}
+		for _, name := range spec.ResolveNames {
+			ips, err := a.ResolveName(ctx, appliance.GetId(), name)
+			if err == nil && len(ips) <= 0 {
+				err = errors.New("no IP addresses resolved")
+			}
+			add(appliance, fmt.Sprintf("resolve-name %s", name), err)
+		}
+	}
+	return results
+}
+
+func checkVersion(expected, actual string) error {
+	want, err := ParseVersionString(expected)
+	if err != nil {
+		return err
+	}
+	got, err := ParseVersionString(actual)
+	if err != nil {
+		return fmt.Errorf("could not parse version %q", actual)
+	}
+	// the build number is only compared if it is part of the expected version
+	equal := want.Equal(got)
+	if len(want.Metadata()) > 0 {
+		equal = CompareVersionsAndBuildNumber(want, got) == 0
+	}
+	if !equal {
+		return fmt.Errorf("running %s, expected %s", got.String(), want.String())
+	}
+	return nil
+}
+
+func checkCeiling(value, max float64) error {
+	if value > max {
+		return fmt.Errorf("%g%% is above the maximum %g%%", value, max)
+	}
+	return nil
+}
+
+// VerifyFailures returns the results of the checks which failed
+func VerifyFailures(results []VerifyResult) []VerifyResult {
+	failures := []VerifyResult{}
+	for _, r := range results {
+		if !r.Passed {
+			failures = append(failures, r)
+		}
+	}
+	return failures
+}
+
+// PrintVerifyReport prints the result of each check, followed by the number of checks that passed and failed
+func PrintVerifyReport(out io.Writer, results []VerifyResult) {
+	p := util.NewPrinter(out, 4)
+	p.AddHeader("Appliance", "Check", "Result", "Details")
+	for _, r := range results {
+		result := "PASS"
+		if !r.Passed {
+			result = "FAIL"
+		}
+		p.AddLine(r.Appliance, r.Check, result, r.Message)
+	}
+	p.Print()
+	failed := len(VerifyFailures(results))
+	fmt.Fprintf(out, "\n%d checks passed, %d failed\n", len(results)-failed, failed)
+}
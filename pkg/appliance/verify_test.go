@@ -0,0 +1,112 @@
+package appliance
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/appgate/sdp-api-client-go/api/v17/openapi"
+)
+
+func TestVerify(t *testing.T) {
+	appliance := func(id string) openapi.Appliance {
+		return openapi.Appliance{
+			Id:      openapi.PtrString(id),
+			Name:    id,
+			Gateway: &openapi.ApplianceAllOfGateway{Enabled: openapi.PtrBool(true)},
+		}
+	}
+	stat := func(id, version, status string, cpu, disk float32) openapi.StatsAppliancesListAllOfData {
+		return openapi.StatsAppliancesListAllOfData{
+			Id:      openapi.PtrString(id),
+			Online:  openapi.PtrBool(true),
+			Version: openapi.PtrString(version),
+			Status:  openapi.PtrString(status),
+			Cpu:     &cpu,
+			Disk:    &disk,
+		}
+	}
+	stats := openapi.StatsAppliancesList{Data: []openapi.StatsAppliancesListAllOfData{
+		stat("g1", "6.0.1-29983", "healthy", 10, 20),
+		stat("g2", "6.0.0-29000", "warning", 95, 20),
+	}}
+	maxCPU, maxDisk := 80.0, 50.0
+	spec := VerifySpec{
+		Version: "6.0.1",
+		Appliances: map[string]VerifyAppliance{
+			"g2": {Version: "6.0.0+29000"},
+		},
+		Healthy: true,
+		MaxCPU:  &maxCPU,
+		MaxDisk: &maxDisk,
+	}
+	results := Verify(context.Background(), &Appliance{}, spec, []openapi.Appliance{appliance("g1"), appliance("g2"), appliance("g3")}, stats, 17)
+	got := map[string]bool{}
+	for _, r := range results {
+		got[r.Appliance+" "+r.Check] = r.Passed
+	}
+	want := map[string]bool{
+		"g1 version": true,
+		"g1 status":  true,
+		"g1 cpu":     true,
+		"g1 disk":    true,
+		"g2 version": true,
+		"g2 status":  false,
+		"g2 cpu":     false,
+		"g2 disk":    true,
+		"g3 online":  false,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("want results %v, got %v", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: want passed %t, got %t", k, v, got[k])
+		}
+	}
+	if failures := VerifyFailures(results); len(failures) != 3 {
+		t.Errorf("expected 3 failures, got %v", failures)
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		expected, actual string
+		wantErr          *regexp.Regexp
+	}{
+		{expected: "6.0.1", actual: "6.0.1-29983"},
+		{expected: "6.0.1+29983", actual: "6.0.1-29983"},
+		{expected: "6.0.1+29984", actual: "6.0.1-29983", wantErr: regexp.MustCompile(`running 6.0.1\+29983, expected 6.0.1\+29984`)},
+		{expected: "6.0.2", actual: "6.0.1-29983", wantErr: regexp.MustCompile(`expected 6.0.2`)},
+	}
+	for _, tt := range tests {
+		err := checkVersion(tt.expected, tt.actual)
+		if tt.wantErr == nil && err != nil {
+			t.Errorf("checkVersion(%s, %s) error = %s", tt.expected, tt.actual, err)
+		}
+		if tt.wantErr != nil && (err == nil || !tt.wantErr.MatchString(err.Error())) {
+			t.Errorf("checkVersion(%s, %s) expected error matching %s, got %v", tt.expected, tt.actual, tt.wantErr, err)
+		}
+	}
+}
+
+func TestReadVerifySpec(t *testing.T) {
+	spec, err := ReadVerifySpec(writePlanFile(t, `version: 6.0.1
+appliances:
+  gateway-site1:
+    version: 6.0.1+29983
+healthy: true
+max-disk: 75
+resolve-names:
+  - dns://intranet.company.com
+`))
+	if err != nil {
+		t.Fatalf("ReadVerifySpec() error = %s", err)
+	}
+	if !spec.Healthy || spec.MaxCPU != nil || *spec.MaxDisk != 75 || spec.Appliances["gateway-site1"].Version != "6.0.1+29983" {
+		t.Errorf("unexpected spec %+v", spec)
+	}
+	if _, err := ReadVerifySpec(writePlanFile(t, "version: latest\n")); err == nil {
+		t.Error("expected error for invalid version")
+	}
+}
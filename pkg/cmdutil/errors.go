@@ -11,4 +11,12 @@ var (
 	ErrCommandTimeout = errors.New("Command timed out")
 	// ErrMissingTTY is used when no TTY is available
 	ErrMissingTTY = errors.New("no TTY present")
+	// ErrPreflightWarning is used when the upgrade preflight checks passed with warnings
+	ErrPreflightWarning = errors.New("upgrade preflight checks passed with warnings")
+	// ErrPreflightFailed is used when at least one of the upgrade preflight checks failed
+	ErrPreflightFailed = errors.New("upgrade preflight checks failed")
+	// ErrVerificationFailed is used when at least one of the verification checks failed
+	ErrVerificationFailed = errors.New("verification failed")
+	// ErrPartialFailure is used when some of the appliances failed to upgrade and the rest of the upgrade continued
+	ErrPartialFailure = errors.New("upgrade partially failed")
 )
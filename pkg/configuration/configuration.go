@@ -14,17 +14,49 @@ import (
 )
 
 type Config struct {
-	URL                      string `mapstructure:"url"`
-	Provider                 string `mapstructure:"provider"`
-	Insecure                 bool   `mapstructure:"insecure"`
-	Debug                    bool   `mapstructure:"debug"`       // http debug flag
-	Version                  int    `mapstructure:"api_version"` // api peer interface version
-	BearerToken              string `mapstructure:"bearer"`      // current logged in user token
-	ExpiresAt                string `mapstructure:"expires_at"`
-	DeviceID                 string `mapstructure:"device_id"`
-	PemFilePath              string `mapstructure:"pem_filepath"`
-	PrimaryControllerVersion string `mapstructure:"primary_controller_version"`
-	Timeout                  int    // HTTP timeout, not supported in the config file.
+	URL                      string          `mapstructure:"url"`
+	Provider                 string          `mapstructure:"provider"`
+	Insecure                 bool            `mapstructure:"insecure"`
+	Debug                    bool            `mapstructure:"debug"`       // http debug flag
+	Version                  int             `mapstructure:"api_version"` // api peer interface version
+	BearerToken              string          `mapstructure:"bearer"`      // current logged in user token
+	ExpiresAt                string          `mapstructure:"expires_at"`
+	DeviceID                 string          `mapstructure:"device_id"`
+	PemFilePath              string          `mapstructure:"pem_filepath"`
+	PrimaryControllerVersion string          `mapstructure:"primary_controller_version"`
+	Webhooks                 []Webhook       `mapstructure:"webhooks"`         // notified of upgrade and backup events
+	Hooks                    []Hook          `mapstructure:"hooks"`            // commands run before and after the upgrade steps
+	BackupRetention          BackupRetention `mapstructure:"backup_retention"` // backup files kept in the backup destination
+	Timeout                  int             // HTTP timeout, not supported in the config file.
+}
+
+// Webhook is a URL which is sent a JSON payload for each upgrade and backup event.
+// Format is one of slack, teams or generic, and Events optionally limits which event types are sent.
+type Webhook struct {
+	URL     string            `mapstructure:"url"`
+	Format  string            `mapstructure:"format"`
+	Events  []string          `mapstructure:"events"`
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+// Hook is a command which is run at an event of 'upgrade complete', such as before each appliance is upgraded.
+// OnFailure is one of abort, skip or ignore, and decides what happens when the command exits with a non-zero code.
+type Hook struct {
+	Event     string        `mapstructure:"event"`
+	Command   string        `mapstructure:"command"`
+	OnFailure string        `mapstructure:"on_failure"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+}
+
+// BackupRetention decides which backup files are kept in the backup destination after each backup.
+// MaxAge is a duration such as 720h or 30d, and MaxSize a size such as 500MB or 10GB. Zero values are not applied.
+type BackupRetention struct {
+	KeepLast    int    `mapstructure:"keep_last"`
+	KeepDaily   int    `mapstructure:"keep_daily"`
+	KeepWeekly  int    `mapstructure:"keep_weekly"`
+	KeepMonthly int    `mapstructure:"keep_monthly"`
+	MaxAge      string `mapstructure:"max_age"`
+	MaxSize     string `mapstructure:"max_size"`
 }
 
 type Credentials struct {
@@ -133,8 +165,7 @@ func (c *Config) CheckAuth() bool {
 }
 
 func (c *Config) ExpiredAtValid() bool {
-	layout := "2006-01-02 15:04:05.999999999 -0700 MST"
-	d, err := time.Parse(layout, c.ExpiresAt)
+	d, err := c.ExpiresAtTime()
 	if err != nil {
 		return false
 	}
@@ -142,6 +173,12 @@ func (c *Config) ExpiredAtValid() bool {
 	return t1.Before(d)
 }
 
+// ExpiresAtTime returns the time when the bearer token expires
+func (c *Config) ExpiresAtTime() (time.Time, error) {
+	layout := "2006-01-02 15:04:05.999999999 -0700 MST"
+	return time.Parse(layout, c.ExpiresAt)
+}
+
 func (c *Config) LoadCredentials() (*Credentials, error) {
 	creds := &Credentials{}
 	h, err := c.GetHost()
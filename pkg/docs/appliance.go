@@ -42,6 +42,25 @@ The default destination directory is set to be the users default downloads direc
 will be created there if it doesn't already exist and the backups will be downloaded to that. In case custom destination directory is specified by using the
 '--destination' flag, the extra 'appgate' directory will not be created. The user also has to have write privileges on the specified directory.
 
+Each backup is streamed from the appliance into a '.part' file in the destination, which is renamed when the download is complete.
+The SHA-256 checksum of the backup is written next to it, in a '.sha256' file in the format of sha256sum. The backup fails if its
+size or digest doesn't match what the appliance sent. A '.json' file with the metadata of the backup, such as the appliance version
+and the backup options, is also written next to it, and the backups in the destination are listed with 'sdpctl appliance backup list'.
+
+The destination can also be the URL of a remote destination, in which case the backups are uploaded without being written to the
+local filesystem:
+  - s3://bucket/prefix: Amazon S3, or S3 compatible storage such as MinIO with '?endpoint=https://minio.example.com:9000'.
+    The region is set with '?region=eu-west-1' or AWS_REGION, and defaults to us-east-1. Temporary credentials also need
+    AWS_SESSION_TOKEN. Large backups, and backups whose size the appliance doesn't send, are uploaded in 16MB parts.
+  - sftp://[user@]host[:port]/path: the host key must be in ~/.ssh/known_hosts. The keys of the SSH agent are tried before the password.
+  - webdav://host/path or webdavs://host/path: WebDAV over http or https.
+The username or access key and the password or secret key are read from the keyring, or from SDPCTL_BACKUP_USERNAME and
+SDPCTL_BACKUP_SECRET. You will be prompted for missing credentials, which are then stored in the keyring.
+
+A retention policy can be applied to the destination after each successful backup, using 'backup_retention' in the
+configuration file or the '--keep-last', '--keep-daily', '--keep-weekly', '--keep-monthly', '--max-age' and '--max-size' flags,
+which override the configuration file. See 'sdpctl appliance backup prune --help' for how the policy is applied.
+
 For more information on the backup process, go to: https://sdphelp.appgate.com/adminguide/v5.5/backup-script.html`,
 		Examples: []ExampleDoc{
 			{
@@ -70,13 +89,121 @@ For more information on the backup process, go to: https://sdphelp.appgate.com/a
 				Description: "backup using '--include' and '--exclude' flags",
 				Command:     "sdpctl appliance backup --include=function=controller --exclude=tag=secondary",
 			},
+			{
+				Description: "upload the backup of the primary controller to a MinIO bucket",
+				Command:     "sdpctl appliance backup --primary --destination='s3://backups/appgate?endpoint=https://minio.example.com:9000'",
+			},
+			{
+				Description: "backup all Appgate SDP Appliances and keep the last 7 daily and 4 weekly backups of each",
+				Command:     "sdpctl appliance backup --all --keep-daily=7 --keep-weekly=4",
+			},
+		},
+	}
+	ApplianceBackupPruneDoc = CommandDoc{
+		Short: "Remove old backups from the backup destination",
+		Long: `Remove the backup files in the backup destination which are not kept by the backup retention policy. This is the same
+policy which is applied after each successful backup, and it is set using 'backup_retention' in the configuration file or the
+flags, which override the configuration file:
+
+  backup_retention:
+    keep_last: 3
+    keep_daily: 7
+    keep_weekly: 4
+    keep_monthly: 6
+    max_age: 180d
+    max_size: 20GB
+
+The keep rules are counted per appliance, and a backup is kept if any rule keeps it: the last 'keep_last' backups, and the last
+backup of each of the last 'keep_daily' days, 'keep_weekly' weeks and 'keep_monthly' months which have backups. Without keep rules,
+all backups are kept by them. Backups older than 'max_age' are removed after that, and then the oldest backups until the total size
+of the destination is at most 'max_size'. The most recent backup of each appliance is never removed.
+
+Only files named like the backups written by sdpctl are considered. The destination can be a local directory, or the URL of a
+remote destination in the same form as for 'sdpctl appliance backup'.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "list the backups which the retention policy in the configuration file would remove",
+				Command:     "sdpctl appliance backup prune --dry-run",
+			},
+			{
+				Description: "keep the last 5 backups of each appliance in a custom directory",
+				Command:     "sdpctl appliance backup prune --destination=path/to/backup/destination --keep-last=5",
+			},
+			{
+				Description: "remove the backups older than 30 days from an SFTP server",
+				Command:     "sdpctl appliance backup prune --destination=sftp://backup@backup.example.com/appgate --max-age=30d",
+			},
+		},
+	}
+	ApplianceBackupListDoc = CommandDoc{
+		Short: "List the backups in the backup destination",
+		Long: `List the backup files in the backup destination, grouped per appliance with the most recent backup first.
+Each backup is written with a JSON metadata file next to it, with the appliance, its site, functions and version, the backup
+options and the sha256 checksum of the backup file.
+
+The status of a backup is one of:
+  ok            the backup file matches its metadata
+  no metadata   the backup file has no metadata, such as backups written by older versions of sdpctl
+  corrupt       the size or checksum of the backup file differs from its metadata, or the metadata is invalid
+  missing       the metadata exists, but the backup file does not
+  incomplete    the download of the backup did not complete
+
+The size of each backup file is always compared, and the checksum with the '--verify' flag, which reads every backup file.
+The command fails if any backup is corrupt, missing or incomplete.
+
+The destination can be a local directory, or the URL of a remote destination in the same form as for 'sdpctl appliance backup'.
+With '--verify', every backup is downloaded from a remote destination to compute its checksum.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "list the backups in the default backup destination",
+				Command:     "sdpctl appliance backup list",
+			},
+			{
+				Description: "verify the checksum of each backup in a custom directory, in JSON format",
+				Command:     "sdpctl appliance backup list --destination=path/to/backup/destination --verify --json",
+			},
+			{
+				Description: "list the backups in an S3 bucket",
+				Command:     "sdpctl appliance backup list --destination=s3://backups/appgate",
+			},
+		},
+	}
+	ApplianceBackupInspectDoc = CommandDoc{
+		Short: "Decrypt a backup file and list its content",
+		Long: `Decrypt a backup file with the backup passphrase of the collective and list the entries of the archive in it, without
+writing anything to disk. The whole backup is read, and its integrity checked, which shows that the backup can be restored.
+
+The passphrase is read from stdin with the '--passphrase-stdin' flag, or else from SDPCTL_BACKUP_PASSPHRASE or the keyring of the
+configured collective, where it is stored when the backup API is enabled with 'sdpctl appliance backup api'. Otherwise, it is
+prompted for, and stored in the keyring if the backup could be decrypted with it.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "list the content of a backup file",
+				Command:     "sdpctl appliance backup inspect path/to/appgate_backup_controller_20220331_120000.bkp",
+			},
+			{
+				Description: "read the passphrase from stdin and print the content in JSON format",
+				Command:     "cat passphrase.txt | sdpctl appliance backup inspect --passphrase-stdin --json path/to/backup.bkp",
+			},
+		},
+	}
+	ApplianceBackupDecryptDoc = CommandDoc{
+		Short: "Decrypt a backup file and extract its content",
+		Long: `Decrypt a backup file with the backup passphrase of the collective and extract the archive in it to a directory, which
+defaults to the name of the backup file without '.bkp'. Existing files are not overwritten, and only files and directories are
+extracted. The passphrase is read in the same way as by 'sdpctl appliance backup inspect'.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "extract a backup file",
+				Command:     "sdpctl appliance backup decrypt path/to/backup.bkp --out path/to/restore",
+			},
 		},
 	}
 	ApplianceBackupAPIDoc = CommandDoc{
 		Short: "Controls the state of the backup API.",
 		Long: `This command controls the state of the backup API on the Appgate SDP Collective.
 You will be prompted for a passphrase for the backups when enabling the backup API using this command.
-The passphrase is required.`,
+The passphrase is required, and it is stored in the keyring to decrypt backups with 'sdpctl appliance backup inspect'.`,
 		Examples: []ExampleDoc{
 			{
 				Description: "enable the backup API",
@@ -97,6 +224,23 @@ The passphrase is required.`,
 Additional subcommands included are:
   - status: view the current upgrade status on all appliances.
   - cancel: Cancel a prepared upgrade.
+  - history: view the record of past prepare, complete and cancel runs.
+
+The prepare, complete and cancel commands, as well as 'sdpctl appliance backup', can write a JSON lines event stream
+for CI pipelines and other tooling. Use '--output=events' to write the events to stdout, in which case the regular output
+is written to stderr, or '--events-file' to append them to a file. Each line is a JSON object with the fields 'version',
+'time', 'type' and 'command', and depending on the type 'step', 'appliance', 'status', 'outcome', 'message' and 'error'.
+The event types are:
+  - command.started and command.finished: the first and the last event, the outcome is success, failed or canceled.
+  - step.started and step.finished: the boundaries of each step, such as a batch of appliances.
+  - appliance.status: a change of the upgrade status or state of an appliance.
+  - appliance.finished: the outcome for an appliance, which is success, failed, canceled or skipped.
+  - command.estimate: the estimated time left of the command, at the start of each step.
+
+The progress of prepare and complete shows the estimated time left of each appliance and of the whole command, which is
+also written as 'remaining_seconds' in the appliance.status and command.estimate events. The estimates are based on how
+long the downloading, verifying, installing and rebooting phases took in the recent runs against the same collective,
+see 'sdpctl appliance upgrade history', or on default durations when there are no recent runs.
 `,
 	}
 	ApplianceUpgradeStatusDoc = CommandDoc{
@@ -137,8 +281,37 @@ A valid filename ends with '.img.zip' and also needs to have a semver included s
 in the name, eg. 'upgrade.img.zip' will not not be valid, but 'upgrade5.5.3.img.zip' is
 considered valid.
 
+A local upgrade image is verified before it is uploaded, in the same way as 'sdpctl image inspect'.
+Every file in the archive is checked for corruption, the image is verified against the '--sha256'
+checksum if it is used, and its detached signature is verified against the release or dev keyring.
+The signature is required when '--signature', '--keyring' or '--dev-keyring' is used, or when the keyring is
+installed in the sdpctl config directory, unless '--skip-signature' is used. Otherwise a warning is printed
+and the signature is only verified by the appliances.
+
+A local upgrade image is streamed from disk to the primary controller, without being held in memory.
+A failed upload is retried up to 3 times. The admin API can't resume a partial upload, so each retry
+reads and sends the whole image again, unless the primary controller already received all of it.
+
 Note that the '--image' flag also accepts URL:s. The Appliances will then attempt to download
-the upgrade image using the provided URL. It will fail if the Appliances cannot access the URL.`,
+the upgrade image using the provided URL. It will fail if the Appliances cannot access the URL.
+A remote image is only downloaded and verified by sdpctl when '--sha256' or '--signature' is used,
+otherwise a warning is printed and the image is only verified by the appliances.
+
+Instead of '--image', the upgrade image can be selected from the local image store, see 'sdpctl image'.
+Use '--version' to select an image by version, or '--latest-patch' to select the latest patch release
+for the major and minor version running on the primary controller.
+
+Some versions can't be upgraded to directly, such as 5.3 to 6.1, and the upgrade must go through
+one or more intermediate versions. The upgrade path is computed from the images in the image store,
+using the latest patch release of each intermediate version. With '--multi-hop', each intermediate
+upgrade is prepared and completed in order, before the appliances are prepared for the upgrade image.
+The final upgrade is completed with 'sdpctl appliance upgrade complete' as usual.
+The intermediate upgrades are completed with the default options of 'sdpctl appliance upgrade complete',
+which include a backup of the primary controller, and are recorded in the upgrade history.
+
+The supported upgrade paths are maintained in sdpctl from the release notes of each release. If a newer
+release supports an upgrade which sdpctl doesn't know about yet, '--ignore-upgrade-path' continues the
+upgrade with a warning instead of failing.`,
 		Examples: []ExampleDoc{
 			{
 				Description: "prepare an upgrade from a local upgrade image",
@@ -156,6 +329,22 @@ the upgrade image using the provided URL. It will fail if the Appliances cannot
 				Description: "prepare only certain appliances based on a filter",
 				Command:     "sdpctl appliance upgrade prepare --image=/path/to/image-5.5.3.img.zip --include function=controller",
 			},
+			{
+				Description: "verify the checksum of the upgrade image before it is uploaded",
+				Command:     "sdpctl appliance upgrade prepare --image=/path/to/upgrade-5.5.3.img.zip --sha256=<checksum>",
+			},
+			{
+				Description: "prepare an upgrade with an image from the image store",
+				Command:     "sdpctl appliance upgrade prepare --version 6.0.3",
+			},
+			{
+				Description: "prepare an upgrade to the latest patch release in the image store",
+				Command:     "sdpctl appliance upgrade prepare --latest-patch",
+			},
+			{
+				Description: "upgrade through the intermediate versions in the image store, and prepare the upgrade to 6.1.0",
+				Command:     "sdpctl appliance upgrade prepare --version 6.1.0 --multi-hop",
+			},
 		},
 	}
 	ApplianceUpgradeCancelDoc = CommandDoc{
@@ -187,7 +376,77 @@ Note that you can cancel upgrades on specific appliances by using the '--include
 		Short: "complete the upgrade on prepared appliances",
 		Long: `Complete a prepared upgrade.
 Install a prepared upgrade on the secondary partition
-and perform a reboot to make the second partition the primary.`,
+and perform a reboot to make the second partition the primary.
+
+The progress of the upgrade is recorded in a journal in the sdpctl data directory.
+If the command is interrupted, it can be continued from the last completed step using the '--resume' flag.
+
+By default, the additional appliances are upgraded in batches which are split by site and function.
+An upgrade plan file given with '--plan' replaces these batches with ordered stages. Each stage selects
+appliances using the same keywords as the '--include' flag, all of which must match, and can limit the
+number of appliances upgraded at the same time and pause before the next stage:
+
+    stages:
+      - name: site-a-gateways
+        include:
+          site: <site-id>
+          function: gateway
+        max-parallel: 1
+        pause: 10m
+
+The primary controller, additional controllers and LogForwarders/LogServers are always upgraded first.
+Additional appliances that are not selected by any stage are upgraded in batches after the last stage.
+
+The upgrade can be scheduled with '--start-at'. Everything is validated and confirmed when the command is run,
+including that the sign in token is still valid at the start time, and the command then waits until the start time.
+With '--window', no new batch of additional appliances is started once the maintenance window has closed. The
+controllers and LogForwarders/LogServers are always upgraded, so that the collective is left in a consistent state,
+and the appliances that remain can be upgraded later with '--resume'.
+
+With '--canary N', N appliances of each site and function group are upgraded first, in a batch of their own.
+Once the canaries are upgraded, the canary gates are checked before the rest of the batches are started. Every
+canary must report a healthy status, and the gates file given with '--canary-gates' can add metrics that must be
+within thresholds and names that must be resolved by the canary gateways:
+
+    wait: 5m
+    metrics:
+      - name: vpn_active_sessions
+        function: gateway
+        min: 1
+    resolve-names:
+      - dns://intranet.company.com
+
+If a gate fails, the upgrade stops and the canaries can be rolled back to their previous version by switching
+partition. Use '--canary-rollback' to roll back without asking. Otherwise the gates can be checked again with '--resume'.
+
+With '--max-unavailable', at most that many gateways, portals, connectors and other appliances of each site and function
+are upgraded at the same time, given as a number such as 1 or as a percentage such as 25%. A percentage is of all the
+online appliances of the site and function, including those which are not upgraded. Instead of waiting for a
+whole batch to finish, the next appliance of a site is started as soon as another one is ready again. The batches of
+the default plan are merged into one, while the stages of a plan file and the canary batch are kept.
+
+With '--drain', the upgrade of each gateway waits until the number of active sessions on it is at or below
+'--drain-threshold', or until '--drain-timeout' expires, after which the gateway is upgraded anyway. The sessions left
+are shown in the progress of the gateway. Combine it with '--max-unavailable 1' to keep the other gateways of each
+site available while a gateway drains.
+
+With '--continue-on-error', an appliance which fails to upgrade, or whose upgrade status cannot be read, is recorded
+as failed and excluded, while the other appliances and the remaining batches are still upgraded. A failure of the
+primary controller, of another controller or of a canary still stops the upgrade. The outcome of each appliance is
+printed as a table once the upgrade is done, and written as JSON to the file given with '--report'. If any appliance
+failed, the command exits with code 8 and the failed appliances can be retried with '--resume'.
+
+With '--verify', the checks in a verification file are run once the upgrade is complete, see
+'sdpctl appliance verify --help' for the format. The command fails if any of the checks fail.
+
+Hooks are commands which are run at the events pre-complete, pre-batch, pre-appliance-upgrade, post-appliance-upgrade,
+post-batch and post-complete, for example to drain a load balancer before a gateway is upgraded. Hooks are added to the
+configuration file, see 'sdpctl configure --help', or with '--hook event=command'. The commands are run by the shell with
+environment variables describing the upgrade, such as SDPCTL_HOOK, SDPCTL_FROM_VERSION and SDPCTL_TO_VERSION, and for
+appliance hooks SDPCTL_APPLIANCE_ID, SDPCTL_APPLIANCE_NAME, SDPCTL_APPLIANCE_HOSTNAME, SDPCTL_APPLIANCE_SITE,
+SDPCTL_APPLIANCE_SITE_NAME, SDPCTL_APPLIANCE_FUNCTIONS, SDPCTL_APPLIANCE_VERSION and SDPCTL_APPLIANCE_TARGET_VERSION.
+Batch hooks get SDPCTL_BATCH, SDPCTL_BATCH_COUNT, SDPCTL_BATCH_LABEL, SDPCTL_APPLIANCE_NAMES and SDPCTL_APPLIANCE_IDS.
+If a hook exits with a non-zero code, the upgrade is aborted unless another policy is configured for it.`,
 		Examples: []ExampleDoc{
 			{
 				Description: "complete all pending upgrades",
@@ -201,6 +460,167 @@ and perform a reboot to make the second partition the primary.`,
 				Description: "backup to custom directory when completing pending upgrade",
 				Command:     "sdpctl appliance upgrade complete --backup --backup-destination=/path/to/custom/destination",
 			},
+			{
+				Description: "resume an interrupted upgrade",
+				Command:     "sdpctl appliance upgrade complete --resume",
+			},
+			{
+				Description: "upgrade additional appliances in the stages defined in a plan file",
+				Command:     "sdpctl appliance upgrade complete --plan plan.yaml",
+			},
+			{
+				Description: "start the upgrade at 02:00 in a maintenance window of three hours",
+				Command:     "sdpctl appliance upgrade complete --start-at 2022-11-05T02:00:00+01:00 --window 3h",
+			},
+			{
+				Description: "complete the upgrade in a CI pipeline and write a JSON lines event stream to stdout",
+				Command:     "sdpctl appliance upgrade complete --no-interactive --output=events > events.jsonl",
+			},
+			{
+				Description: "upgrade one appliance of each site and function group first, and verify it before upgrading the rest",
+				Command:     "sdpctl appliance upgrade complete --canary 1 --canary-gates gates.yaml",
+			},
+			{
+				Description: "keep at least three quarters of the appliances of each site and function available during the upgrade",
+				Command:     "sdpctl appliance upgrade complete --max-unavailable 25%",
+			},
+			{
+				Description: "let the sessions on each gateway drain for up to 30 minutes before it is upgraded, one gateway per site at a time",
+				Command:     "sdpctl appliance upgrade complete --drain --drain-timeout 30m --max-unavailable 1",
+			},
+			{
+				Description: "upgrade as many appliances as possible, and write the outcome of each appliance to a file",
+				Command:     "sdpctl appliance upgrade complete --continue-on-error --report report.json",
+			},
+			{
+				Description: "verify the appliances once the upgrade is complete",
+				Command:     "sdpctl appliance upgrade complete --verify verify.yaml",
+			},
+			{
+				Description: "run a script before each appliance is upgraded, and abort the upgrade if it fails",
+				Command:     "sdpctl appliance upgrade complete --hook pre-appliance-upgrade=/path/to/drain.sh",
+			},
+		},
+	}
+	ApplianceUpgradePlanDoc = CommandDoc{
+		Short: "show the order in which prepared appliances will be upgraded",
+		Long: `Show the upgrade plan for the prepared appliances, without making any changes to the collective.
+The plan is computed in the same way as in 'sdpctl appliance upgrade complete', and lists each stage
+of the upgrade with the appliances in it, their current and target versions, and the appliances
+which will be skipped together with the reason.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "show the upgrade plan in JSON format",
+				Command:     "sdpctl appliance upgrade plan",
+			},
+			{
+				Description: "save the upgrade plan in YAML format",
+				Command:     "sdpctl appliance upgrade plan --output yaml > upgrade-plan.yaml",
+			},
+			{
+				Description: "preview the stages of an upgrade plan file, see 'sdpctl appliance upgrade complete --help' for the format",
+				Command:     "sdpctl appliance upgrade plan --plan plan.yaml",
+			},
+			{
+				Description: "preview which appliances will be upgraded as canaries",
+				Command:     "sdpctl appliance upgrade plan --canary 1",
+			},
+			{
+				Description: "preview the plan when one appliance of each site and function is upgraded at a time",
+				Command:     "sdpctl appliance upgrade plan --max-unavailable 1",
+			},
+		},
+	}
+	ApplianceUpgradePreflightDoc = CommandDoc{
+		Short: "check if the collective is ready to be upgraded",
+		Long: `Run the upgrade readiness checks without making any changes to the collective.
+The same checks are run during 'sdpctl appliance upgrade prepare' and 'sdpctl appliance upgrade complete',
+where they are shown as warnings that need to be confirmed:
+- the primary controller hostname matches and resolves to a unique IP
+- no controllers or LogServers are offline, other offline appliances are reported as a warning
+- the appliances have enough disk space for the upgrade image
+- controllers and LogServers use the admin interface instead of the deprecated peer port
+- auto-scaled gateways, which need their health check disabled during the upgrade
+- all appliances are running the same version
+
+Each check is reported as pass, warn or fail. The command exits with code 0 when all checks pass,
+5 when there are warnings and 6 when at least one check failed.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "check the collective before a maintenance window",
+				Command:     "sdpctl appliance upgrade preflight",
+			},
+			{
+				Description: "view the checks in JSON format",
+				Command:     "sdpctl appliance upgrade preflight --json",
+			},
+			{
+				Description: "only check the gateways",
+				Command:     "sdpctl appliance upgrade preflight --include function=gateway",
+			},
+		},
+	}
+	ApplianceUpgradeRollbackDoc = CommandDoc{
+		Short: "roll back a completed upgrade by switching partitions",
+		Long: `Roll back a completed upgrade on the collective.
+An upgrade installs the new version on the secondary partition and boots from it, which leaves the previous
+version on the other partition. The rollback switches the partition back on each appliance running the upgraded version,
+which defaults to the version of the primary controller.
+
+The admin API doesn't report which version is on the other partition, so it is looked up in the local upgrade history
+(see 'sdpctl appliance upgrade history'). An appliance is only rolled back if it was upgraded to its current version by
+sdpctl on this machine, and has not been prepared for another upgrade since. Appliances where the other partition holds
+a version which is not older are always skipped. Use --force to also roll back appliances which are not in the history.
+
+Controllers can't run different versions in the collective across some upgrades, such as from 5.3 to 5.4, so
+'upgrade complete' disables the controller function on the additional controllers for those upgrades. The rollback
+doesn't, and refuses to roll back additional controllers across such versions unless --force is given.
+
+Appliances are rolled back in the reverse order of the upgrade: additional appliances first in batches,
+then additional controllers one at a time, and the primary controller last. The command waits for each appliance
+to be ready before continuing, and updates the primary controller version in the sdpctl configuration afterwards.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "roll back all appliances running the same version as the primary controller",
+				Command:     "sdpctl appliance upgrade rollback",
+			},
+			{
+				Description: "roll back only the gateways running version 6.0.1",
+				Command:     "sdpctl appliance upgrade rollback --from-version 6.0.1 --include function=gateway",
+			},
+			{
+				Description: "roll back appliances which were upgraded outside of sdpctl on this machine",
+				Command:     "sdpctl appliance upgrade rollback --force",
+			},
+		},
+	}
+	ApplianceUpgradeHistoryDoc = CommandDoc{
+		Short: "list past upgrade runs",
+		Long: `List the upgrade prepare, complete and cancel runs made with sdpctl on this machine, the most recent first.
+Each run is recorded in the sdpctl data directory when the command ends, with the collective host, the user who ran it,
+the versions upgraded from and to, the outcome, and the time of each step and each status of the appliances.
+Use 'sdpctl appliance upgrade history show' to view a single run.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "list past upgrade runs",
+				Command:     "sdpctl appliance upgrade history",
+			},
+			{
+				Description: "list past upgrade runs in JSON format",
+				Command:     "sdpctl appliance upgrade history --json",
+			},
+		},
+	}
+	ApplianceUpgradeHistoryShowDoc = CommandDoc{
+		Short: "show a past upgrade run",
+		Long: `Show the record of a past upgrade run, given the ID from 'sdpctl appliance upgrade history'.
+The record shows the outcome and duration of each step and each appliance, how long each appliance spent in each upgrade
+status, and for 'upgrade complete' the summary of the appliance versions after the upgrade.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "show an upgrade run",
+				Command:     "sdpctl appliance upgrade history show 20261016-101500-a1b2c3",
+			},
 		},
 	}
 	ApplianceMetricsDoc = CommandDoc{
@@ -223,6 +643,41 @@ to get a specific metric name. This needs to be an exact match.`,
 			},
 		},
 	}
+	ApplianceVerifyDoc = CommandDoc{
+		Short: "verify the appliances against a verification file",
+		Long: `Run the checks in a verification file on the appliances and report each of them as pass or fail.
+The same checks can be run automatically after an upgrade with 'sdpctl appliance upgrade complete --verify'.
+The verification file can hold the expected version of all appliances or of single appliances by name, require
+a healthy status, set ceilings for the CPU and disk usage in percent, and check that metrics are within thresholds
+and that names are resolved by every gateway:
+
+    version: 6.0.1
+    appliances:
+      gateway-site1:
+        version: 6.0.1+29983
+    healthy: true
+    max-cpu: 80
+    max-disk: 75
+    metrics:
+      - name: vpn_active_sessions
+        function: gateway
+        min: 1
+    resolve-names:
+      - dns://intranet.company.com
+
+Offline appliances fail the verification. The command exits with code 0 when all checks pass and 7 when
+at least one check failed.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "verify all appliances",
+				Command:     "sdpctl appliance verify --file verify.yaml",
+			},
+			{
+				Description: "verify the gateways and view the results in JSON format",
+				Command:     "sdpctl appliance verify --file verify.yaml --include function=gateway --json",
+			},
+		},
+	}
 	ApplianceResolveNameDoc = CommandDoc{
 		Short: "Test a resolver name on a Gateway",
 		Long: `Test a resolver name on a Gateway. Name resolvers are used by the Gateways on a Site resolve
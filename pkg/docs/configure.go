@@ -5,7 +5,47 @@ var (
 		Short: "Configure your Appgate SDP Collective",
 		Long: `Setup a configuration file towards your Appgate SDP Collective to be able to interact with the collective. By default, the configuration file
 will be created in a default directory in depending on your system. This can be overridden by setting the 'SDPCTL_CONFIG_DIR' environment variable.
-See 'sdpctl help environment' for more information on using environment variables.`,
+See 'sdpctl help environment' for more information on using environment variables.
+
+Webhooks can be added to the configuration file to be notified of upgrade and backup events, such as when an upgrade is prepared,
+an appliance is ready, a batch of appliances is upgraded, a backup is written or something fails. Each webhook is sent a JSON payload
+in the slack, teams or generic format. The notifications are delivered in the background with retries and never block the command:
+
+  webhooks:
+    - url: https://hooks.slack.com/services/T000/B000/XXXX
+      format: slack
+      events: [upgrade.completed, failure]
+    - url: https://example.com/sdpctl-events
+      format: generic
+      headers:
+        Authorization: Bearer <token>
+
+The event types are prepare.started, appliance.ready, prepare.completed, controller.disabled, controller.enabled,
+upgrade.batch_done, upgrade.completed, backup.written and failure. All events are sent if 'events' is omitted.
+
+Hooks can be added to run commands at the events of 'sdpctl appliance upgrade complete'. The events are pre-complete,
+pre-batch, pre-appliance-upgrade, post-appliance-upgrade, post-batch and post-complete. 'on_failure' decides what happens
+when the command exits with a non-zero code: abort stops the upgrade, which is the default, skip leaves the appliance
+or batch to be upgraded later, and ignore continues the upgrade. Controllers are never skipped, and skipping the canary
+batch stops the upgrade, since the canary gates can't be checked. 'timeout' defaults to 10m:
+
+  hooks:
+    - event: pre-appliance-upgrade
+      command: /usr/local/bin/drain-lb.sh
+      on_failure: skip
+      timeout: 5m
+    - event: post-appliance-upgrade
+      command: /usr/local/bin/enable-lb.sh
+
+See 'sdpctl appliance upgrade complete --help' for the environment variables given to the commands.
+
+A backup retention policy can be added to remove old backups from the backup destination after each successful backup.
+See 'sdpctl appliance backup prune --help' for how the policy is applied:
+
+  backup_retention:
+    keep_daily: 7
+    keep_weekly: 4
+    max_size: 20GB`,
 		Examples: []ExampleDoc{
 			{
 				Description: "basic configuration command",
@@ -0,0 +1,121 @@
+package docs
+
+var (
+	ImageDoc = CommandDoc{
+		Short: "inspect and verify upgrade images",
+		Long: `The image command lets you inspect and verify Appgate SDP upgrade images on this machine,
+before they are uploaded to the collective, and manage a local store of upgrade images.
+
+The image store is located in the 'images' directory in the sdpctl data directory. Images in the store
+are indexed by version, so that they can be used with 'sdpctl appliance upgrade prepare --version'.`,
+		Examples: []ExampleDoc{},
+	}
+	ImageInspectDoc = CommandDoc{
+		Short: "show the contents of an upgrade image and verify it",
+		Long: `Read the archive of an upgrade image and show the files in it, the version and the build number.
+Each file in the archive is read to validate its checksum, which detects truncated and corrupt images.
+A remote image is downloaded to a temporary directory first.
+
+If the archive has a manifest at its root, named manifest.json, manifest or version, the version and build number are
+read from its "version" and "build" fields. The manifest is either a JSON object, or lines of key=value. Otherwise,
+the version is read from the filename of the image, or from the names of the files in the archive.
+
+The detached OpenPGP signature of the image, either passed with '--signature' or in a <image>.sig or <image>.asc
+file next to it, is verified against the release keyring, or the development keyring with '--dev-keyring'.
+The keyrings are read from the 'keyrings' directory in the sdpctl config directory, named release.gpg and dev.gpg,
+unless '--keyring' is used. The signature is required when '--signature', '--keyring' or '--dev-keyring' is used,
+or when the keyring is installed, unless '--skip-signature' is used. Otherwise a warning is printed for an image
+which is not verified.
+
+The same verification is done by 'sdpctl appliance upgrade prepare' before the image is uploaded.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "inspect a local upgrade image",
+				Command:     "sdpctl image inspect /path/to/appgate-5.5.1-12345-release.img.zip",
+			},
+			{
+				Description: "verify the checksum and signature of an image",
+				Command:     "sdpctl image inspect appgate-5.5.1-12345-release.img.zip --sha256 <checksum> --signature appgate-5.5.1-12345-release.img.zip.sig",
+			},
+			{
+				Description: "inspect an image which has no detached signature, with the release keyring installed",
+				Command:     "sdpctl image inspect appgate-5.5.1-12345-release.img.zip --skip-signature",
+			},
+			{
+				Description: "inspect a remote image in JSON format",
+				Command:     "sdpctl image inspect https://example.com/appgate-5.5.1-12345-release.img.zip --json",
+			},
+		},
+	}
+	ImageAddDoc = CommandDoc{
+		Short: "add upgrade images to the local image store",
+		Long: `Verify upgrade images, in the same way as 'sdpctl image inspect', and copy them into the local image store.
+The filename of the image must contain the version, such as appgate-6.0.3-31234-release.img.zip.
+The detached signature of the image is copied into the store with it, so that it is verified again when the
+image is used by 'sdpctl appliance upgrade prepare'. An image with the same filename that is already in the store is replaced.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "add an upgrade image to the image store",
+				Command:     "sdpctl image add /path/to/appgate-6.0.3-31234-release.img.zip",
+			},
+			{
+				Description: "add all upgrade images in a directory",
+				Command:     "sdpctl image add ~/Downloads/appgate-*.img.zip",
+			},
+		},
+	}
+	ImageListDoc = CommandDoc{
+		Short: "list the upgrade images in the local image store",
+		Long:  `List the upgrade images in the local image store, with the newest version first.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "list the images in the image store",
+				Command:     "sdpctl image list",
+			},
+			{
+				Description: "list the images in JSON format",
+				Command:     "sdpctl image list --json",
+			},
+		},
+	}
+	ImageRemoveDoc = CommandDoc{
+		Short: "remove upgrade images from the local image store",
+		Long: `Remove upgrade images from the local image store by filename or version. A version without a build number
+removes all the images with that version.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "remove all the images with version 6.0.1",
+				Command:     "sdpctl image remove 6.0.1",
+			},
+			{
+				Description: "remove an image by filename",
+				Command:     "sdpctl image remove appgate-6.0.1-30001-release.img.zip",
+			},
+		},
+	}
+	ImagePullDoc = CommandDoc{
+		Short: "pull upgrade images from a mirror into the local image store",
+		Long: `Download upgrade images from an HTTP mirror into the local image store. The mirror is a directory with the
+images and an index.json file, which lists the images, their sha256 checksum and their detached signature:
+
+  {"images": [{"filename": "appgate-6.0.3-31234-release.img.zip", "sha256": "<checksum>", "signature": "appgate-6.0.3-31234-release.img.zip.sig"}]}
+
+The URL of an image is the filename relative to the index file, unless the image has a "url" field.
+Each image is verified against the checksum in the index and its signature before it is added to the store.
+By default, only the latest version in the mirror is pulled.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "pull the latest image from an internal mirror",
+				Command:     "sdpctl image pull https://mirror.example.com/appgate/",
+			},
+			{
+				Description: "pull a specific version",
+				Command:     "sdpctl image pull https://mirror.example.com/appgate/index.json --version 6.0.3",
+			},
+			{
+				Description: "pull all images in the mirror",
+				Command:     "sdpctl image pull https://mirror.example.com/appgate/ --all",
+			},
+		},
+	}
+)
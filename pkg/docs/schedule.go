@@ -0,0 +1,27 @@
+package docs
+
+var (
+	ScheduleDoc = CommandDoc{
+		Short: "run a command on a cron schedule",
+		Long: `Run an sdpctl command each time a cron expression matches, such as an upgrade in a nightly maintenance window.
+The cron expression has the five standard fields, minute, hour, day of month, month and day of week, and is matched
+in the local time zone. The descriptors @yearly, @monthly, @weekly, @daily and @hourly can be used as well.
+
+The command is validated when the schedule is started. If the sign in token expires before the first run, the
+credentials must be stored in the keychain or set with SDPCTL_USERNAME and SDPCTL_PASSWORD, so that each run can
+sign in again. Each run is started without interactive prompts.
+
+With '--window', the length of the maintenance window is passed on to the command, which must support a '--window'
+flag, such as 'sdpctl appliance upgrade complete'.`,
+		Examples: []ExampleDoc{
+			{
+				Description: "complete a prepared upgrade at 02:00 next Saturday, in a maintenance window of three hours",
+				Command:     "sdpctl schedule \"0 2 * * 6\" --window 3h -- appliance upgrade complete --backup=false",
+			},
+			{
+				Description: "pull new upgrade images into the image store every night until stopped",
+				Command:     "sdpctl schedule @daily --runs 0 -- image pull https://mirror.example.com/appgate/",
+			},
+		},
+	}
+)
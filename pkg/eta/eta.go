@@ -0,0 +1,114 @@
+package eta
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Phase is a part of an operation with an expected duration
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Estimator estimates the time left of an operation from the phases it goes through, in order.
+// A nil Estimator gives no estimates.
+type Estimator struct {
+	Phases []Phase
+	// PhaseOf returns the name of the phase a status belongs to, or an empty string if the status is not part of
+	// any phase. If it is nil, a status belongs to the phase with the same name.
+	PhaseOf func(status string) string
+}
+
+// Total is the expected duration of the whole operation
+func (e *Estimator) Total() time.Duration {
+	if e == nil {
+		return 0
+	}
+	var total time.Duration
+	for _, p := range e.Phases {
+		total += p.Duration
+	}
+	return total
+}
+
+func (e *Estimator) phase(status string) int {
+	name := status
+	if e.PhaseOf != nil {
+		name = e.PhaseOf(status)
+	}
+	if len(name) <= 0 {
+		return -1
+	}
+	for i, p := range e.Phases {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Start returns a clock following one operation, or nil if e is nil
+func (e *Estimator) Start() *Clock {
+	if e == nil {
+		return nil
+	}
+	return &Clock{estimator: e, phase: -1}
+}
+
+// Clock follows the phase of one operation from its status updates. It is safe for concurrent use,
+// and a nil Clock gives no estimates.
+type Clock struct {
+	mu        sync.Mutex
+	estimator *Estimator
+	phase     int
+	since     time.Time
+}
+
+// Update moves the clock to the phase of status. Statuses which are not part of a phase, or which belong to an earlier
+// phase, keep the current phase.
+func (c *Clock) Update(status string, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := c.estimator.phase(status); i > c.phase {
+		c.phase = i
+		c.since = now
+	}
+}
+
+// Remaining returns the expected time left of the operation. A phase which takes longer than expected counts as
+// almost done, so the estimate never goes below the expected duration of the phases after it.
+func (c *Clock) Remaining(now time.Time) time.Duration {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.phase < 0 {
+		return c.estimator.Total()
+	}
+	var remaining time.Duration
+	if left := c.estimator.Phases[c.phase].Duration - now.Sub(c.since); left > 0 {
+		remaining = left
+	}
+	for _, p := range c.estimator.Phases[c.phase+1:] {
+		remaining += p.Duration
+	}
+	return remaining
+}
+
+// Format describes the time left d, such as "about 4m left"
+func Format(d time.Duration) string {
+	if d < time.Minute {
+		return "less than 1m left"
+	}
+	d = d.Round(time.Minute)
+	if h := d / time.Hour; h > 0 {
+		return fmt.Sprintf("about %dh%dm left", h, (d%time.Hour)/time.Minute)
+	}
+	return fmt.Sprintf("about %dm left", d/time.Minute)
+}
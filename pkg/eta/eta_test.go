@@ -0,0 +1,68 @@
+package eta
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	e := &Estimator{
+		Phases: []Phase{
+			{Name: "installing", Duration: 10 * time.Minute},
+			{Name: "rebooting", Duration: 5 * time.Minute},
+		},
+		PhaseOf: func(status string) string {
+			if strings.HasPrefix(status, "rebooting") || status == "switching partition" {
+				return "rebooting"
+			}
+			return status
+		},
+	}
+	start := time.Now()
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	c := e.Start()
+	if got := c.Remaining(start); got != 15*time.Minute {
+		t.Errorf("expected the total before the first phase, got %s", got)
+	}
+	c.Update("ready", at(0))
+	c.Update("installing", at(1))
+	if got := c.Remaining(at(4)); got != 12*time.Minute {
+		t.Errorf("expected 12m left while installing, got %s", got)
+	}
+	// installing takes longer than expected
+	if got := c.Remaining(at(20)); got != 5*time.Minute {
+		t.Errorf("expected the rebooting phase left, got %s", got)
+	}
+	c.Update("rebooting, waiting for appliance to come back online", at(20))
+	c.Update("installing", at(21))
+	if got := c.Remaining(at(22)); got != 3*time.Minute {
+		t.Errorf("expected an earlier phase not to move the clock back, got %s", got)
+	}
+	c.Update("idle", at(30))
+	if got := c.Remaining(at(30)); got != 0 {
+		t.Errorf("expected nothing left, got %s", got)
+	}
+
+	var nilEstimator *Estimator
+	if c := nilEstimator.Start(); c != nil || c.Remaining(start) != 0 || nilEstimator.Total() != 0 {
+		t.Error("expected no estimates from a nil estimator")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                              "less than 1m left",
+		40 * time.Second:               "less than 1m left",
+		4*time.Minute + 40*time.Second: "about 5m left",
+		90 * time.Minute:               "about 1h30m left",
+	}
+	for d, want := range tests {
+		if got := Format(d); got != want {
+			t.Errorf("Format(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/cmdutil"
+	"github.com/appgate/sdpctl/pkg/eta"
+)
+
+// Version is the version of the event format. It is increased when a field is removed or changes meaning,
+// new fields and event types may be added without changing the version.
+const Version = 1
+
+// Event types in the stream
+const (
+	TypeCommandStarted    = "command.started"
+	TypeCommandFinished   = "command.finished"
+	TypeStepStarted       = "step.started"
+	TypeStepFinished      = "step.finished"
+	TypeApplianceStatus   = "appliance.status"
+	TypeApplianceFinished = "appliance.finished"
+	TypeCommandEstimate   = "command.estimate"
+)
+
+// Outcomes of steps, appliances and commands
+const (
+	OutcomeSuccess  = "success"
+	OutcomeFailed   = "failed"
+	OutcomeCanceled = "canceled"
+	OutcomeSkipped  = "skipped"
+)
+
+// OutputEvents is the value of --output which writes the event stream to stdout
+const OutputEvents = "events"
+
+// Event is one line in the event stream
+type Event struct {
+	Version   int       `json:"version"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Command   string    `json:"command"`
+	Step      string    `json:"step,omitempty"`
+	Appliance string    `json:"appliance,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Outcome   string    `json:"outcome,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	// RemainingSeconds is the estimated time left of the appliance or of the command
+	RemainingSeconds int64 `json:"remaining_seconds,omitempty"`
+}
+
+// Stream writes events as JSON lines. It is safe for concurrent use, and a nil Stream discards all events.
+type Stream struct {
+	mu      sync.Mutex
+	w       io.Writer
+	closer  io.Closer
+	command string
+	status  map[string]string
+	step    string
+	// listeners receive each event after it is written, in the order of the stream
+	listeners []func(Event)
+	estimator *eta.Estimator
+	clocks    map[string]*eta.Clock
+}
+
+// NewStream returns a stream writing the events of command to w
+func NewStream(w io.Writer, command string) *Stream {
+	return &Stream{
+		w:       w,
+		command: command,
+		status:  map[string]string{},
+	}
+}
+
+// Open returns a stream for the --output and --events-file flags of a command. The events are written to stdout if
+// output is 'events', and appended to file if it is set. It returns nil if neither is used.
+func Open(stdout io.Writer, command, output, file string) (*Stream, error) {
+	writers := []io.Writer{}
+	switch output {
+	case "":
+	case OutputEvents:
+		writers = append(writers, stdout)
+	default:
+		return nil, fmt.Errorf("invalid output %q, the only supported output is %q", output, OutputEvents)
+	}
+	var closer io.Closer
+	if len(file) > 0 {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("could not open events file: %w", err)
+		}
+		writers = append(writers, f)
+		closer = f
+	}
+	if len(writers) <= 0 {
+		return nil, nil
+	}
+	s := NewStream(io.MultiWriter(writers...), command)
+	s.closer = closer
+	return s, nil
+}
+
+// Emit writes the event to the stream, setting the version, time and command
+func (s *Stream) Emit(e Event) {
+	if s == nil {
+		return
+	}
+	e.Version = Version
+	e.Command = s.command
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Write(append(b, '\n'))
+	for _, fn := range s.listeners {
+		fn(e)
+	}
+}
+
+// Listen calls fn with each event written to the stream. fn is called while the stream is locked, so it must not
+// write to the stream.
+func (s *Stream) Listen(fn func(Event)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// Started is the first event of a command
+func (s *Stream) Started(message string) {
+	s.Emit(Event{Type: TypeCommandStarted, Message: message})
+}
+
+// Finished is the last event of a command, with the outcome of err. A step which is still running is finished
+// with the same outcome first.
+func (s *Stream) Finished(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	step := s.step
+	s.mu.Unlock()
+	if len(step) > 0 {
+		s.StepFinished(step, err)
+	}
+	s.Emit(Event{Type: TypeCommandFinished, Outcome: outcome(err), Error: errorString(err)})
+}
+
+// StepStarted marks the start of a step in the command. Steps run one at a time, so a step which is still running
+// is finished before the next one starts.
+func (s *Stream) StepStarted(step string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	previous := s.step
+	s.mu.Unlock()
+	if len(previous) > 0 {
+		s.StepFinished(previous, nil)
+	}
+	s.mu.Lock()
+	s.step = step
+	s.mu.Unlock()
+	s.Emit(Event{Type: TypeStepStarted, Step: step})
+}
+
+// StepFinished marks the end of a step in the command, with the outcome of err
+func (s *Stream) StepFinished(step string, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.step == step {
+		s.step = ""
+	}
+	s.mu.Unlock()
+	s.Emit(Event{Type: TypeStepFinished, Step: step, Outcome: outcome(err), Error: errorString(err)})
+}
+
+// SetEstimator makes the status events include the estimated time left of each appliance
+func (s *Stream) SetEstimator(e *eta.Estimator) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.estimator = e
+	s.clocks = map[string]*eta.Clock{}
+}
+
+// Status reports the current status of an appliance. Only changes of the status are written to the stream.
+func (s *Stream) Status(appliance, status string) {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	s.mu.Lock()
+	previous, ok := s.status[appliance]
+	s.status[appliance] = status
+	var clock *eta.Clock
+	if s.estimator != nil {
+		if clock = s.clocks[appliance]; clock == nil {
+			clock = s.estimator.Start()
+			s.clocks[appliance] = clock
+		}
+		clock.Update(status, now)
+	}
+	s.mu.Unlock()
+	if ok && previous == status {
+		return
+	}
+	e := Event{Type: TypeApplianceStatus, Appliance: appliance, Status: status}
+	if clock != nil {
+		e.RemainingSeconds = int64(clock.Remaining(now).Seconds())
+	}
+	s.Emit(e)
+}
+
+// Estimate reports the estimated time left of the command
+func (s *Stream) Estimate(remaining time.Duration) {
+	s.Emit(Event{Type: TypeCommandEstimate, RemainingSeconds: int64(remaining.Seconds())})
+}
+
+// ApplianceFinished reports the outcome of err for an appliance
+func (s *Stream) ApplianceFinished(appliance string, err error) {
+	s.Emit(Event{Type: TypeApplianceFinished, Appliance: appliance, Outcome: outcome(err), Error: errorString(err)})
+}
+
+// ApplianceSkipped reports that an appliance is skipped by the command
+func (s *Stream) ApplianceSkipped(appliance, reason string) {
+	s.Emit(Event{Type: TypeApplianceFinished, Appliance: appliance, Outcome: OutcomeSkipped, Message: reason})
+}
+
+// Close closes the events file, if the stream writes to one
+func (s *Stream) Close() error {
+	if s == nil || s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, context.Canceled), errors.Is(err, cmdutil.ErrExecutionCanceledByUser):
+		return OutcomeCanceled
+	}
+	return OutcomeFailed
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the stream, so that functions deep in the call chain, like the status
+// pollers, can report to it
+func NewContext(ctx context.Context, s *Stream) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the stream in the context, or nil if there is none
+func FromContext(ctx context.Context) *Stream {
+	s, _ := ctx.Value(contextKey{}).(*Stream)
+	return s
+}
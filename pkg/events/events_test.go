@@ -0,0 +1,175 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/cmdutil"
+	"github.com/appgate/sdpctl/pkg/eta"
+)
+
+func decode(t *testing.T, b []byte) []Event {
+	t.Helper()
+	stream := []Event{}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid event line %q: %s", line, err)
+		}
+		stream = append(stream, e)
+	}
+	return stream
+}
+
+func TestStream(t *testing.T) {
+	buf := &bytes.Buffer{}
+	s := NewStream(buf, "sdpctl appliance upgrade complete")
+	s.Started("")
+	s.StepStarted("primary-controller")
+	s.Status("controller", "installing")
+	s.Status("controller", "installing")
+	s.Status("controller", "idle")
+	s.ApplianceFinished("controller", nil)
+	s.StepStarted("batch-1")
+	s.ApplianceSkipped("gateway", "appliance is offline")
+	s.Finished(errors.New("gateway failed"))
+
+	got := []string{}
+	for _, e := range decode(t, buf.Bytes()) {
+		if e.Version != Version || e.Command != "sdpctl appliance upgrade complete" || e.Time.IsZero() {
+			t.Errorf("missing common fields in %+v", e)
+		}
+		got = append(got, strings.TrimRight(strings.Join([]string{e.Type, e.Step, e.Appliance, e.Status, e.Outcome}, " "), " "))
+	}
+	want := []string{
+		"command.started",
+		"step.started primary-controller",
+		"appliance.status  controller installing",
+		"appliance.status  controller idle",
+		"appliance.finished  controller  success",
+		"step.finished primary-controller   success",
+		"step.started batch-1",
+		"appliance.finished  gateway  skipped",
+		"step.finished batch-1   failed",
+		"command.finished    failed",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got events\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStreamListen(t *testing.T) {
+	buf := &bytes.Buffer{}
+	s := NewStream(buf, "sdpctl appliance upgrade cancel")
+	listened := []string{}
+	s.Listen(func(e Event) {
+		listened = append(listened, e.Type)
+	})
+	s.Started("")
+	s.ApplianceFinished("gateway", nil)
+	s.Finished(nil)
+
+	written := []string{}
+	for _, e := range decode(t, buf.Bytes()) {
+		written = append(written, e.Type)
+	}
+	if strings.Join(listened, ",") != strings.Join(written, ",") {
+		t.Errorf("listened to %v, written %v", listened, written)
+	}
+
+	var nilStream *Stream
+	nilStream.Listen(func(e Event) {})
+}
+
+func TestStreamEstimates(t *testing.T) {
+	buf := &bytes.Buffer{}
+	s := NewStream(buf, "sdpctl appliance upgrade complete")
+	s.Status("gateway", "ready")
+	s.SetEstimator(&eta.Estimator{Phases: []eta.Phase{
+		{Name: "installing", Duration: 10 * time.Minute},
+		{Name: "rebooting", Duration: 5 * time.Minute},
+	}})
+	s.Status("controller", "ready")
+	s.Status("controller", "rebooting")
+	s.Estimate(time.Hour)
+
+	got := []int64{}
+	for _, e := range decode(t, buf.Bytes()) {
+		got = append(got, e.RemainingSeconds)
+	}
+	// no estimate before the estimator is set, the total before the first phase, and the last phase once it started
+	want := []int64{0, 900, 300, 3600}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got remaining seconds %v, want %v", got, want)
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	tests := map[error]string{
+		nil:                                OutcomeSuccess,
+		errors.New("failed"):               OutcomeFailed,
+		context.Canceled:                   OutcomeCanceled,
+		cmdutil.ErrExecutionCanceledByUser: OutcomeCanceled,
+	}
+	for err, want := range tests {
+		if got := outcome(err); got != want {
+			t.Errorf("outcome(%v) = %s, want %s", err, got, want)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	s, err := Open(&bytes.Buffer{}, "sdpctl appliance backup", "", "")
+	if err != nil || s != nil {
+		t.Fatalf("expected no stream, got %v %v", s, err)
+	}
+	// a nil stream discards all events
+	s.Started("")
+	s.Status("controller", "ready")
+	s.Finished(nil)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(&bytes.Buffer{}, "sdpctl appliance backup", "json", ""); err == nil {
+		t.Error("expected error for unsupported output")
+	}
+
+	stdout := &bytes.Buffer{}
+	file := filepath.Join(t.TempDir(), "events.jsonl")
+	for i := 0; i < 2; i++ {
+		s, err := Open(stdout, "sdpctl appliance backup", OutputEvents, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Started("")
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decode(t, b)) != 2 || len(decode(t, stdout.Bytes())) != 2 {
+		t.Errorf("expected the events to be appended to the file and written to stdout, got\n%s", b)
+	}
+}
+
+func TestContext(t *testing.T) {
+	if FromContext(context.Background()) != nil {
+		t.Error("expected no stream in the context")
+	}
+	s := NewStream(&bytes.Buffer{}, "sdpctl")
+	if FromContext(NewContext(context.Background(), s)) != s {
+		t.Error("expected the stream from the context")
+	}
+}
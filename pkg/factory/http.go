@@ -30,11 +30,13 @@ type Factory struct {
 	Stdin       io.ReadCloser
 	StdErr      io.Writer
 	SpinnerOut  io.Writer
+	Version     string
 }
 
 func New(appVersion string, config *configuration.Config) *Factory {
 	f := &Factory{}
 	f.Config = config
+	f.Version = appVersion
 	f.HTTPClient = httpClientFunc(f)           // depends on config
 	f.APIClient = apiClientFunc(f, appVersion) // depends on config
 	f.Appliance = applianceFunc(f, appVersion) // depends on config
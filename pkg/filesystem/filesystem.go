@@ -12,6 +12,7 @@ import (
 
 const (
 	AgConfigDir   = "SDPCTL_CONFIG_DIR"
+	AgDataDir     = "SDPCTL_DATA_DIR"
 	XdgConfigHome = "XDG_CONFIG_HOME"
 	AppData       = "AppData"
 )
@@ -42,6 +43,9 @@ func ConfigDir() string {
 
 func DataDir() string {
 	path := filepath.Join(xdg.DataHome, "sdpctl")
+	if v := os.Getenv(AgDataDir); len(v) > 0 {
+		path = v
+	}
 	// Create the directory if not exist
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		os.MkdirAll(path, 0700)
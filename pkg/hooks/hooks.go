@@ -0,0 +1,211 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// Events at which hooks are run during 'upgrade complete'
+const (
+	PreComplete          = "pre-complete"
+	PostComplete         = "post-complete"
+	PreBatch             = "pre-batch"
+	PostBatch            = "post-batch"
+	PreApplianceUpgrade  = "pre-appliance-upgrade"
+	PostApplianceUpgrade = "post-appliance-upgrade"
+)
+
+// Events is the list of all hook events
+var Events = []string{PreComplete, PostComplete, PreBatch, PostBatch, PreApplianceUpgrade, PostApplianceUpgrade}
+
+// Policies for a hook which exits with a non-zero code
+const (
+	// PolicyAbort stops the upgrade, it is the default policy
+	PolicyAbort = "abort"
+	// PolicySkip skips the appliance or batch in the pre-appliance-upgrade and pre-batch hooks.
+	// Controllers are never skipped, a skipped canary batch stops the upgrade, and for the other events it is the same as abort.
+	PolicySkip = "skip"
+	// PolicyIgnore logs a warning and continues
+	PolicyIgnore = "ignore"
+)
+
+// DefaultTimeout is how long a hook can run, unless another timeout is configured
+const DefaultTimeout = 10 * time.Minute
+
+// outputLines is the number of lines of the hook output included in the error when it fails
+const outputLines = 10
+
+// ErrSkip is returned when a hook with the skip policy fails
+var ErrSkip = errors.New("skipped by hook")
+
+// Runner runs the hooks for each event. A nil Runner runs nothing.
+type Runner struct {
+	hooks []configuration.Hook
+}
+
+// New returns a runner for the hooks in the config and the hooks given as flags in the form 'event=command',
+// or nil if there are none. Hooks given as flags use the abort policy.
+func New(hooks []configuration.Hook, flags []string) (*Runner, error) {
+	all := append([]configuration.Hook{}, hooks...)
+	for _, f := range flags {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid hook %q, must be in the form event=command", f)
+		}
+		all = append(all, configuration.Hook{Event: parts[0], Command: parts[1]})
+	}
+	if len(all) <= 0 {
+		return nil, nil
+	}
+	for _, h := range all {
+		if err := validate(h); err != nil {
+			return nil, err
+		}
+	}
+	return &Runner{hooks: all}, nil
+}
+
+func validate(h configuration.Hook) error {
+	if !util.InSlice(h.Event, Events) {
+		return fmt.Errorf("unknown hook event %q, must be one of %s", h.Event, strings.Join(Events, ", "))
+	}
+	if len(strings.TrimSpace(h.Command)) <= 0 {
+		return fmt.Errorf("the %s hook has no command", h.Event)
+	}
+	if len(h.OnFailure) > 0 && !util.InSlice(h.OnFailure, []string{PolicyAbort, PolicySkip, PolicyIgnore}) {
+		return fmt.Errorf("unknown on_failure policy %q for the %s hook, must be one of %s, %s or %s", h.OnFailure, h.Event, PolicyAbort, PolicySkip, PolicyIgnore)
+	}
+	return nil
+}
+
+// Run runs the hooks for the event in order, with env added to the environment of the command.
+// It returns an error wrapping ErrSkip if a hook with the skip policy fails, and stops at the first
+// hook which fails unless its policy is ignore.
+func (r *Runner) Run(ctx context.Context, event string, env map[string]string) error {
+	if r == nil {
+		return nil
+	}
+	for _, h := range r.hooks {
+		if h.Event != event {
+			continue
+		}
+		err := run(ctx, h, env)
+		if err == nil {
+			continue
+		}
+		switch h.OnFailure {
+		case PolicyIgnore:
+			log.WithError(err).WithField("hook", event).Warn("hook failed, continuing")
+		case PolicySkip:
+			return fmt.Errorf("%w: %s", ErrSkip, err)
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func run(ctx context.Context, h configuration.Hook, env map[string]string) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := shell(h.Command)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("SDPCTL_HOOK=%s", h.Event))
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, env[k]))
+	}
+	// The output is written to a file instead of a pipe, since waiting for a pipe would block
+	// until every process started by the hook has exited, including those left in the background.
+	output, err := os.CreateTemp("", "sdpctl-hook-*.log")
+	if err != nil {
+		return fmt.Errorf("%s hook %q failed: %w", h.Event, h.Command, err)
+	}
+	defer func() {
+		output.Close()
+		os.Remove(output.Name())
+	}()
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	logEntry := log.WithFields(log.Fields{"hook": h.Event, "command": h.Command})
+	logEntry.Info("running hook")
+	err = wait(ctx, cmd)
+	content, readErr := os.ReadFile(output.Name())
+	if readErr != nil {
+		logEntry.WithError(readErr).Warn("failed to read the hook output")
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		if len(line) > 0 {
+			logEntry.Info(line)
+		}
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		msg := fmt.Sprintf("%s hook %q failed: %s", h.Event, h.Command, err)
+		if tail := lastLines(string(content), outputLines); len(tail) > 0 {
+			msg = fmt.Sprintf("%s\n%s", msg, tail)
+		}
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// wait runs the command in its own process group, and kills the whole group if the context
+// is done before the command exits, so that no child process of the hook keeps running.
+func wait(ctx context.Context, cmd *exec.Cmd) error {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if err := killProcessGroup(cmd); err != nil {
+			log.WithError(err).WithField("pid", cmd.Process.Pid).Warn("failed to kill the hook")
+		}
+		<-done
+		return ctx.Err()
+	}
+}
+
+func shell(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
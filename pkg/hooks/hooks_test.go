@@ -0,0 +1,164 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/configuration"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		hooks   []configuration.Hook
+		flags   []string
+		want    int
+		wantErr *regexp.Regexp
+	}{
+		{
+			name: "no hooks",
+		},
+		{
+			name:  "config and flags",
+			hooks: []configuration.Hook{{Event: PreBatch, Command: "drain.sh", OnFailure: PolicySkip}},
+			flags: []string{"post-complete=echo done"},
+			want:  2,
+		},
+		{
+			name:    "invalid flag",
+			flags:   []string{"pre-batch"},
+			wantErr: regexp.MustCompile(`must be in the form event=command`),
+		},
+		{
+			name:    "unknown event",
+			hooks:   []configuration.Hook{{Event: "pre-upgrade", Command: "true"}},
+			wantErr: regexp.MustCompile(`unknown hook event "pre-upgrade"`),
+		},
+		{
+			name:    "unknown policy",
+			hooks:   []configuration.Hook{{Event: PreBatch, Command: "true", OnFailure: "retry"}},
+			wantErr: regexp.MustCompile(`unknown on_failure policy "retry"`),
+		},
+		{
+			name:    "no command",
+			flags:   []string{"pre-batch= "},
+			wantErr: regexp.MustCompile(`the pre-batch hook has no command`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(tt.hooks, tt.flags)
+			if tt.wantErr != nil {
+				if err == nil || !tt.wantErr.MatchString(err.Error()) {
+					t.Fatalf("New() expected error matching %s, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() error = %s", err)
+			}
+			if tt.want == 0 && r != nil {
+				t.Fatalf("New() expected nil runner, got %+v", r)
+			}
+			if tt.want > 0 && len(r.hooks) != tt.want {
+				t.Fatalf("New() expected %d hooks, got %+v", tt.want, r)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook commands are written for sh")
+	}
+	ctx := context.Background()
+
+	var nilRunner *Runner
+	if err := nilRunner.Run(ctx, PreBatch, nil); err != nil {
+		t.Fatalf("nil runner error = %s", err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	r, err := New([]configuration.Hook{
+		{Event: PreApplianceUpgrade, Command: `echo "$SDPCTL_HOOK $SDPCTL_APPLIANCE_NAME" > ` + out},
+		{Event: PostApplianceUpgrade, Command: "exit 1", OnFailure: PolicyIgnore},
+		{Event: PreBatch, Command: "echo draining failed; exit 3", OnFailure: PolicySkip},
+		{Event: PostBatch, Command: "exit 2"},
+		{Event: PostComplete, Command: "exec sleep 5", Timeout: 10 * time.Millisecond},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Run(ctx, PreApplianceUpgrade, map[string]string{"SDPCTL_APPLIANCE_NAME": "gateway-site1"}); err != nil {
+		t.Fatalf("Run() error = %s", err)
+	}
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(content); got != "pre-appliance-upgrade gateway-site1\n" {
+		t.Errorf("unexpected hook output %q", got)
+	}
+
+	if err := r.Run(ctx, PostApplianceUpgrade, nil); err != nil {
+		t.Errorf("expected ignored failure, got %s", err)
+	}
+
+	err = r.Run(ctx, PreBatch, nil)
+	if !errors.Is(err, ErrSkip) {
+		t.Errorf("expected skip, got %v", err)
+	}
+	if err == nil || !regexp.MustCompile(`exit status 3\ndraining failed`).MatchString(err.Error()) {
+		t.Errorf("expected the exit code and output in the error, got %v", err)
+	}
+
+	err = r.Run(ctx, PostBatch, nil)
+	if err == nil || errors.Is(err, ErrSkip) {
+		t.Errorf("expected abort, got %v", err)
+	}
+
+	err = r.Run(ctx, PostComplete, nil)
+	if err == nil || !regexp.MustCompile(`timed out after 10ms`).MatchString(err.Error()) {
+		t.Errorf("expected timeout, got %v", err)
+	}
+
+	if err := r.Run(ctx, PreComplete, nil); err != nil {
+		t.Errorf("expected no hooks for %s, got %s", PreComplete, err)
+	}
+}
+
+func TestRunTimeoutWithBackgroundChild(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook commands are written for sh")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	// the background child inherits the output of the hook and would keep a pipe open after the hook is killed
+	r, err := New([]configuration.Hook{
+		{Event: PreBatch, Command: `echo started; (sleep 2; echo late > ` + out + `) & sleep 5`, Timeout: 100 * time.Millisecond},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = r.Run(context.Background(), PreBatch, nil)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the hook to be stopped at the timeout, it took %s", elapsed)
+	}
+	if err == nil || !regexp.MustCompile(`timed out after 100ms\nstarted`).MatchString(err.Error()) {
+		t.Errorf("expected timeout with the hook output, got %v", err)
+	}
+
+	// the background child is killed with the hook
+	time.Sleep(3 * time.Second)
+	if _, err := os.Stat(out); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the background child to be killed, got %v", err)
+	}
+}
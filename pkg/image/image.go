@@ -0,0 +1,388 @@
+package image
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/filesystem"
+	"github.com/appgate/sdpctl/pkg/util"
+	"github.com/hashicorp/go-version"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ReleaseKeyring is the filename of the keyring used to verify release images
+	ReleaseKeyring = "release.gpg"
+	// DevKeyring is the filename of the keyring used to verify development images
+	DevKeyring = "dev.gpg"
+)
+
+var (
+	// ErrChecksumMismatch is returned when the image doesn't match the expected sha256 checksum
+	ErrChecksumMismatch = errors.New("sha256 checksum mismatch")
+	// ErrKeyringNotFound is returned when a signature needs to be verified, but there is no keyring
+	ErrKeyringNotFound = errors.New("keyring not found")
+	// ErrSignatureNotFound is returned when the image has no detached signature, and the signature check is not skipped
+	ErrSignatureNotFound = errors.New("no detached signature found")
+)
+
+// manifestNames are the names of the manifest in the archive, which describes the image
+var manifestNames = []string{"manifest.json", "manifest", "version"}
+
+// maxManifestSize is the largest manifest which is read, anything bigger is not a manifest
+const maxManifestSize = 1 << 20
+
+// Entry is a file in the upgrade image archive
+type Entry struct {
+	Name  string `json:"name"`
+	Size  uint64 `json:"size"`
+	CRC32 string `json:"crc32"`
+}
+
+// Signature is the result of the detached signature verification
+type Signature struct {
+	File     string `json:"file"`
+	Keyring  string `json:"keyring"`
+	SignedBy string `json:"signed_by"`
+}
+
+// Info describes an upgrade image
+type Info struct {
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	Version     string `json:"version,omitempty"`
+	BuildNumber string `json:"build_number,omitempty"`
+	// Manifest holds the fields of the manifest in the archive, if there is one
+	Manifest  map[string]string `json:"manifest,omitempty"`
+	Entries   []Entry           `json:"entries"`
+	Signature *Signature        `json:"signature,omitempty"`
+}
+
+// VerifyOptions controls the verification of an upgrade image
+type VerifyOptions struct {
+	// SHA256 is the expected checksum of the image, empty to skip the check
+	SHA256 string
+	// Signature is the path to the detached signature. If empty, <image>.sig and <image>.asc are used if they exist.
+	Signature string
+	// Keyring is the path to the keyring. If empty, the release or dev keyring in the sdpctl config directory is used.
+	Keyring string
+	// DevKeyring selects the development keyring instead of the release keyring
+	DevKeyring bool
+	// SkipSignature accepts an image without a detached signature even if the keyring is installed.
+	// The image is then only verified by its checksum, and by the appliances after it has been uploaded.
+	SkipSignature bool
+}
+
+// explicit reports if the user asked for signature verification, which makes a missing signature or keyring an error
+func (o VerifyOptions) explicit() bool {
+	return len(o.Signature) > 0 || len(o.Keyring) > 0 || o.DevKeyring
+}
+
+// KeyringPath returns the path to the default release or dev keyring
+func KeyringPath(dev bool) string {
+	name := ReleaseKeyring
+	if dev {
+		name = DevKeyring
+	}
+	return filepath.Join(filesystem.ConfigDir(), "keyrings", name)
+}
+
+// Inspect reads the archive of a local upgrade image and verifies it. Every file in the archive
+// is read to validate its CRC32, so truncated or corrupt images are detected before they are uploaded.
+// A detached signature is verified against the keyring. The signature is required if a signature, keyring or the dev
+// keyring is selected in opts, or if the keyring is installed, unless opts.SkipSignature is set. Otherwise an image without
+// a signature is accepted, and Info.Signature is nil.
+func Inspect(imagePath string, opts VerifyOptions) (*Info, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{
+		Filename: filepath.Base(imagePath),
+		Size:     stat.Size(),
+		Entries:  []Entry{},
+	}
+
+	archive, err := zip.NewReader(f, stat.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid upgrade image: %w", info.Filename, err)
+	}
+	for _, zf := range archive.File {
+		var manifest bytes.Buffer
+		var w io.Writer
+		if isManifest(zf) {
+			w = &manifest
+		}
+		if err := checkEntry(zf, w); err != nil {
+			return nil, fmt.Errorf("%s is corrupt: %w", info.Filename, err)
+		}
+		if w != nil && info.Manifest == nil {
+			info.Manifest = parseManifest(manifest.Bytes())
+		}
+		info.Entries = append(info.Entries, Entry{
+			Name:  zf.Name,
+			Size:  zf.UncompressedSize64,
+			CRC32: fmt.Sprintf("%08x", zf.CRC32),
+		})
+	}
+	if len(info.Entries) <= 0 {
+		return nil, fmt.Errorf("%s is not a valid upgrade image: the archive is empty", info.Filename)
+	}
+	setVersion(info)
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	signature, err := verifySignature(io.TeeReader(f, hash), imagePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	// read whatever the signature check left behind, or the whole file if there was no signature
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, err
+	}
+	info.Signature = signature
+	info.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	if len(opts.SHA256) > 0 && !strings.EqualFold(opts.SHA256, info.SHA256) {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, opts.SHA256, info.SHA256)
+	}
+	return info, nil
+}
+
+// checkEntry reads a file in the archive, which makes archive/zip validate the checksum at the end.
+// The content is written to w, unless it is nil.
+func checkEntry(zf *zip.File, w io.Writer) error {
+	rc, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %w", zf.Name, err)
+	}
+	defer rc.Close()
+	if w == nil {
+		w = io.Discard
+	}
+	if _, err := io.Copy(w, rc); err != nil {
+		if errors.Is(err, zip.ErrChecksum) {
+			return fmt.Errorf("%s: crc32 %08x does not match", zf.Name, zf.CRC32)
+		}
+		return fmt.Errorf("%s: %w", zf.Name, err)
+	}
+	return nil
+}
+
+// isManifest reports if the file is the manifest of the image, which is at the root of the archive
+func isManifest(zf *zip.File) bool {
+	if zf.UncompressedSize64 > maxManifestSize || strings.Contains(strings.Trim(zf.Name, "/"), "/") {
+		return false
+	}
+	return util.InSlice(strings.ToLower(zf.Name), manifestNames)
+}
+
+// parseManifest reads the manifest, which is either a JSON object or lines of key=value or key: value
+func parseManifest(content []byte) map[string]string {
+	manifest := map[string]string{}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(content, &fields); err == nil {
+		for k, v := range fields {
+			switch v := v.(type) {
+			case string:
+				manifest[k] = v
+			case float64:
+				manifest[k] = strconv.FormatFloat(v, 'f', -1, 64)
+			case bool:
+				manifest[k] = strconv.FormatBool(v)
+			}
+		}
+		return manifest
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) <= 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i <= 0 {
+			// a version file with only the version string in it
+			manifest["version"] = line
+			continue
+		}
+		manifest[strings.TrimSpace(line[:i])] = strings.Trim(strings.TrimSpace(line[i+1:]), `"'`)
+	}
+	return manifest
+}
+
+// manifestValue returns the first non-empty field of the manifest with one of the keys, ignoring case
+func manifestValue(manifest map[string]string, keys ...string) string {
+	for _, key := range keys {
+		for k, v := range manifest {
+			if strings.EqualFold(k, key) && len(v) > 0 {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// setVersion reads the version and build number from the manifest in the archive. If there is no manifest, or it
+// doesn't have a version, the version is parsed from the image filename, or from the files in the archive if the image
+// has been renamed.
+func setVersion(info *Info) {
+	if v := manifestValue(info.Manifest, "version"); len(v) > 0 {
+		build := manifestValue(info.Manifest, "build", "build_number", "buildNumber")
+		if len(build) > 0 && !strings.Contains(v, build) {
+			v = fmt.Sprintf("%s-%s", v, build)
+		}
+		if parsed, err := appliancepkg.ParseVersionString(v); err == nil {
+			setParsedVersion(info, parsed)
+			return
+		}
+		log.WithFields(log.Fields{"image": info.Filename, "version": v}).Warn("could not parse the version in the image manifest")
+	}
+	candidates := []string{info.Filename}
+	for _, e := range info.Entries {
+		candidates = append(candidates, path.Base(e.Name))
+	}
+	for _, c := range candidates {
+		v, err := appliancepkg.ParseVersionString(c)
+		if err != nil {
+			continue
+		}
+		setParsedVersion(info, v)
+		return
+	}
+	log.WithField("image", info.Filename).Warn("could not determine the version of the upgrade image")
+}
+
+func setParsedVersion(info *Info, v *version.Version) {
+	info.Version = v.Core().String()
+	if len(v.Prerelease()) > 0 {
+		info.Version = fmt.Sprintf("%s-%s", info.Version, v.Prerelease())
+	}
+	info.BuildNumber = v.Metadata()
+}
+
+func verifySignature(image io.Reader, imagePath string, opts VerifyOptions) (*Signature, error) {
+	keyringPath := opts.Keyring
+	if len(keyringPath) <= 0 {
+		keyringPath = KeyringPath(opts.DevKeyring)
+	}
+	// the signature is only required if the user asked for it, or has installed the keyring to verify it with
+	required := opts.explicit()
+	if ok, _ := util.FileExists(keyringPath); ok {
+		required = true
+	}
+	sigPath := opts.Signature
+	if len(sigPath) <= 0 {
+		for _, ext := range []string{".sig", ".asc"} {
+			if ok, _ := util.FileExists(imagePath + ext); ok {
+				sigPath = imagePath + ext
+				break
+			}
+		}
+	}
+	logEntry := log.WithField("image", filepath.Base(imagePath))
+	if len(sigPath) <= 0 {
+		if opts.SkipSignature || !required {
+			logEntry.Warn("no detached signature found, skipping the signature check")
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w for %s, expected %s.sig or %s.asc, use --skip-signature to accept the image without verifying its signature", ErrSignatureNotFound, filepath.Base(imagePath), imagePath, imagePath)
+	}
+	keyring, err := readKeyring(keyringPath)
+	if err != nil {
+		if errors.Is(err, ErrKeyringNotFound) && !opts.explicit() {
+			logEntry.WithField("keyring", keyringPath).Warn("found a detached signature, but no keyring to verify it with")
+			return nil, nil
+		}
+		return nil, err
+	}
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		return nil, err
+	}
+	var signer *openpgp.Entity
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN")) {
+		signer, err = openpgp.CheckArmoredDetachedSignature(keyring, image, bytes.NewReader(sig), nil)
+	} else {
+		signer, err = openpgp.CheckDetachedSignature(keyring, image, bytes.NewReader(sig), nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signature verification failed with %s: %w", keyringPath, err)
+	}
+	result := &Signature{File: sigPath, Keyring: keyringPath}
+	for name := range signer.Identities {
+		result.SignedBy = name
+		break
+	}
+	logEntry.WithField("signed_by", result.SignedBy).Info("verified image signature")
+	return result, nil
+}
+
+func readKeyring(keyringPath string) (openpgp.EntityList, error) {
+	content, err := os.ReadFile(keyringPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrKeyringNotFound, keyringPath)
+		}
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("-----BEGIN")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(content))
+}
+
+// Download fetches a remote upgrade image into dir, so that it can be inspected. The caller is responsible
+// for removing the file.
+func Download(ctx context.Context, client *http.Client, url, dir string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	// the client timeout is meant for API requests, and is too short for downloading an image
+	c := *client
+	c.Timeout = 0
+	res, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not download %s: %s", url, res.Status)
+	}
+	name := path.Base(req.URL.Path)
+	if err := checkFilename(name); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, name)
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, res.Body); err != nil {
+		return "", err
+	}
+	return dst, f.Close()
+}
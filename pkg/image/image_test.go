@@ -0,0 +1,283 @@
+package image
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+func writeImage(t *testing.T, dir, name string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("appgate.img")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(bytes.Repeat([]byte("appgate"), 1024)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func writeKeyring(t *testing.T, dir string) (string, *openpgp.Entity) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Appgate Test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := entity.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "keyring.gpg")
+	if err := os.WriteFile(p, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p, entity
+}
+
+func sign(t *testing.T, entity *openpgp.Entity, image string) {
+	t.Helper()
+	content, err := os.ReadFile(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, entity, bytes.NewReader(content), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(image+".sig", sig.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SDPCTL_CONFIG_DIR", dir)
+	image := writeImage(t, dir, "appgate-5.5.1-12345-release.img.zip")
+	content, _ := os.ReadFile(image)
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	t.Run("version and checksum", func(t *testing.T) {
+		info, err := Inspect(image, VerifyOptions{SHA256: checksum, SkipSignature: true})
+		if err != nil {
+			t.Fatalf("Inspect() error = %s", err)
+		}
+		if info.Version != "5.5.1" || info.BuildNumber != "12345" {
+			t.Errorf("wrong version, got %s build %s", info.Version, info.BuildNumber)
+		}
+		if info.SHA256 != checksum {
+			t.Errorf("wrong checksum, want %s, got %s", checksum, info.SHA256)
+		}
+		if len(info.Entries) != 1 || info.Entries[0].Name != "appgate.img" {
+			t.Errorf("unexpected entries %+v", info.Entries)
+		}
+		if info.Signature != nil {
+			t.Errorf("expected no signature, got %+v", info.Signature)
+		}
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		_, err := Inspect(image, VerifyOptions{SHA256: "abc", SkipSignature: true})
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("expected checksum mismatch, got %v", err)
+		}
+	})
+
+	t.Run("corrupt image", func(t *testing.T) {
+		corrupt := append([]byte{}, content...)
+		// flip a byte in the compressed data of the first entry, after the 30 byte local header and file name
+		corrupt[30+len("appgate.img")+2] ^= 0xff
+		p := filepath.Join(t.TempDir(), "appgate-5.5.1-12345-release.img.zip")
+		if err := os.WriteFile(p, corrupt, 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Inspect(p, VerifyOptions{})
+		if err == nil || !regexp.MustCompile(`is corrupt`).MatchString(err.Error()) {
+			t.Fatalf("expected corrupt image error, got %v", err)
+		}
+	})
+
+	t.Run("truncated image", func(t *testing.T) {
+		p := filepath.Join(t.TempDir(), "appgate-5.5.1-12345-release.img.zip")
+		if err := os.WriteFile(p, content[:len(content)/2], 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Inspect(p, VerifyOptions{}); err == nil {
+			t.Fatal("expected error for truncated image")
+		}
+	})
+
+	t.Run("signature", func(t *testing.T) {
+		sigDir := t.TempDir()
+		signed := writeImage(t, sigDir, "appgate-5.5.1-12345-release.img.zip")
+		keyring, entity := writeKeyring(t, sigDir)
+		sign(t, entity, signed)
+
+		info, err := Inspect(signed, VerifyOptions{Keyring: keyring})
+		if err != nil {
+			t.Fatalf("Inspect() error = %s", err)
+		}
+		if info.Signature == nil || info.Signature.SignedBy != "Appgate Test <test@example.com>" {
+			t.Errorf("unexpected signature %+v", info.Signature)
+		}
+
+		other, _ := writeKeyring(t, t.TempDir())
+		if _, err := Inspect(signed, VerifyOptions{Keyring: other}); err == nil {
+			t.Fatal("expected signature verification to fail with another keyring")
+		}
+	})
+
+	t.Run("signature without keyring", func(t *testing.T) {
+		sigDir := t.TempDir()
+		signed := writeImage(t, sigDir, "appgate-5.5.1-12345-release.img.zip")
+		_, entity := writeKeyring(t, sigDir)
+		sign(t, entity, signed)
+
+		// the default keyring isn't installed, so the signature is only verified if it is asked for
+		info, err := Inspect(signed, VerifyOptions{})
+		if err != nil {
+			t.Fatalf("Inspect() error = %s", err)
+		}
+		if info.Signature != nil {
+			t.Errorf("expected no signature, got %+v", info.Signature)
+		}
+		if _, err := Inspect(signed, VerifyOptions{Signature: signed + ".sig", SkipSignature: true}); !errors.Is(err, ErrKeyringNotFound) {
+			t.Fatalf("expected keyring not found, got %v", err)
+		}
+		if _, err := Inspect(signed, VerifyOptions{DevKeyring: true}); !errors.Is(err, ErrKeyringNotFound) {
+			t.Fatalf("expected keyring not found, got %v", err)
+		}
+	})
+
+	t.Run("no signature", func(t *testing.T) {
+		info, err := Inspect(image, VerifyOptions{})
+		if err != nil {
+			t.Fatalf("Inspect() error = %s", err)
+		}
+		if info.Signature != nil {
+			t.Errorf("expected no signature, got %+v", info.Signature)
+		}
+		keyring, _ := writeKeyring(t, t.TempDir())
+		if _, err := Inspect(image, VerifyOptions{Keyring: keyring}); !errors.Is(err, ErrSignatureNotFound) {
+			t.Fatalf("expected signature not found, got %v", err)
+		}
+		if _, err := Inspect(image, VerifyOptions{Keyring: keyring, SkipSignature: true}); err != nil {
+			t.Fatalf("Inspect() error = %s", err)
+		}
+	})
+
+	t.Run("installed keyring", func(t *testing.T) {
+		t.Setenv("SDPCTL_CONFIG_DIR", t.TempDir())
+		keyring, entity := writeKeyring(t, t.TempDir())
+		if err := os.MkdirAll(filepath.Dir(KeyringPath(false)), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(keyring, KeyringPath(false)); err != nil {
+			t.Fatal(err)
+		}
+
+		// an installed keyring makes the signature required
+		if _, err := Inspect(image, VerifyOptions{}); !errors.Is(err, ErrSignatureNotFound) {
+			t.Fatalf("expected signature not found, got %v", err)
+		}
+		signed := writeImage(t, t.TempDir(), "appgate-5.5.1-12345-release.img.zip")
+		sign(t, entity, signed)
+		info, err := Inspect(signed, VerifyOptions{})
+		if err != nil {
+			t.Fatalf("Inspect() error = %s", err)
+		}
+		if info.Signature == nil || info.Signature.Keyring != KeyringPath(false) {
+			t.Errorf("unexpected signature %+v", info.Signature)
+		}
+	})
+}
+
+func TestInspectManifest(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifest  string
+		content   string
+		wantVer   string
+		wantBuild string
+	}{
+		{
+			name:      "json manifest",
+			manifest:  "manifest.json",
+			content:   `{"version": "6.0.3", "build": 31234, "channel": "release"}`,
+			wantVer:   "6.0.3",
+			wantBuild: "31234",
+		},
+		{
+			name:      "key value manifest",
+			manifest:  "MANIFEST",
+			content:   "# upgrade image\nversion=6.0.3\nbuild_number: 31234\n",
+			wantVer:   "6.0.3",
+			wantBuild: "31234",
+		},
+		{
+			name:      "version file",
+			manifest:  "version",
+			content:   "6.0.3-31234-release\n",
+			wantVer:   "6.0.3",
+			wantBuild: "31234",
+		},
+		{
+			name:      "no version in manifest",
+			manifest:  "manifest.json",
+			content:   `{"channel": "release"}`,
+			wantVer:   "5.5.1",
+			wantBuild: "12345",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := zip.NewWriter(&buf)
+			for name, content := range map[string]string{tt.manifest: tt.content, "appgate.img": "appgate"} {
+				f, err := w.Create(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.Write([]byte(content)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// the filename has another version, which is only used if the manifest doesn't have one
+			p := filepath.Join(t.TempDir(), "appgate-5.5.1-12345-release.img.zip")
+			if err := os.WriteFile(p, buf.Bytes(), 0600); err != nil {
+				t.Fatal(err)
+			}
+			info, err := Inspect(p, VerifyOptions{SkipSignature: true})
+			if err != nil {
+				t.Fatalf("Inspect() error = %s", err)
+			}
+			if info.Version != tt.wantVer || info.BuildNumber != tt.wantBuild {
+				t.Errorf("got version %s build %s, want %s build %s", info.Version, info.BuildNumber, tt.wantVer, tt.wantBuild)
+			}
+			if len(info.Manifest) <= 0 {
+				t.Error("expected the manifest to be read")
+			}
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appliancepkg "github.com/appgate/sdpctl/pkg/appliance"
+	"github.com/appgate/sdpctl/pkg/filesystem"
+	"github.com/hashicorp/go-version"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	storeIndex  = "index.json"
+	mirrorIndex = "index.json"
+)
+
+var (
+	// ErrImageNotFound is returned when there is no matching image in the store
+	ErrImageNotFound = errors.New("image not found in the image store")
+	// ErrInvalidFilename is returned when the filename of an image is not a plain file name, such as ../image.img.zip
+	ErrInvalidFilename = errors.New("invalid image filename")
+)
+
+// checkFilename makes sure that the filename from an index can't be used to read or write outside of a directory
+func checkFilename(name string) error {
+	if len(name) <= 0 || name == "." || name == ".." || filepath.Base(name) != name || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%w: %q", ErrInvalidFilename, name)
+	}
+	return nil
+}
+
+// StoreImage is an upgrade image in the local image store
+type StoreImage struct {
+	Filename    string    `json:"filename"`
+	Version     string    `json:"version"`
+	BuildNumber string    `json:"build_number,omitempty"`
+	SHA256      string    `json:"sha256"`
+	Size        int64     `json:"size"`
+	Added       time.Time `json:"added"`
+	// Signed is true if the signature of the image was verified, and is kept in the store next to the image
+	Signed bool `json:"signed"`
+}
+
+// ParsedVersion returns the version of the image including the build number
+func (i StoreImage) ParsedVersion() (*version.Version, error) {
+	return appliancepkg.ParseVersionString(i.Filename)
+}
+
+// Store is a directory of upgrade images, indexed by version
+type Store struct {
+	Dir string
+}
+
+// DefaultStoreDir returns the image store directory in the sdpctl data directory
+func DefaultStoreDir() string {
+	return filepath.Join(filesystem.DataDir(), "images")
+}
+
+// NewStore returns the image store in dir, which is created if it doesn't exist
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{Dir: dir}, nil
+}
+
+// Path returns the path to the image file in the store
+func (s *Store) Path(i StoreImage) string {
+	return filepath.Join(s.Dir, i.Filename)
+}
+
+// List returns the images in the store, sorted by version
+func (s *Store) List() ([]StoreImage, error) {
+	images := []StoreImage{}
+	content, err := os.ReadFile(filepath.Join(s.Dir, storeIndex))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return images, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &images); err != nil {
+		return nil, fmt.Errorf("could not read image store index: %w", err)
+	}
+	valid := make([]StoreImage, 0, len(images))
+	for _, i := range images {
+		if err := checkFilename(i.Filename); err != nil {
+			log.WithError(err).Warn("ignoring image in the image store index")
+			continue
+		}
+		valid = append(valid, i)
+	}
+	sortImages(valid)
+	return valid, nil
+}
+
+func (s *Store) save(images []StoreImage) error {
+	sortImages(images)
+	content, err := json.MarshalIndent(images, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.Dir, storeIndex+".tmp")
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.Dir, storeIndex))
+}
+
+func sortImages(images []StoreImage) {
+	sort.SliceStable(images, func(i, j int) bool {
+		vi, erri := images[i].ParsedVersion()
+		vj, errj := images[j].ParsedVersion()
+		if erri != nil || errj != nil {
+			return images[i].Filename < images[j].Filename
+		}
+		return CompareVersions(vi, vj) > 0
+	})
+}
+
+// CompareVersions compares the versions and then the build numbers, like appliancepkg.CompareVersionsAndBuildNumber,
+// but also works for images without a build number in the filename. It returns 1 if x is greater than y.
+func CompareVersions(x, y *version.Version) int {
+	if res := x.Compare(y); res != 0 {
+		return res
+	}
+	bx, _ := strconv.Atoi(x.Metadata())
+	by, _ := strconv.Atoi(y.Metadata())
+	switch {
+	case bx > by:
+		return 1
+	case bx < by:
+		return -1
+	}
+	return 0
+}
+
+// Add verifies an upgrade image and copies it into the store, together with its detached signature.
+// An image with the same filename is replaced.
+func (s *Store) Add(imagePath string, opts VerifyOptions) (*StoreImage, error) {
+	return s.add(imagePath, opts, false)
+}
+
+func (s *Store) add(imagePath string, opts VerifyOptions, move bool) (*StoreImage, error) {
+	filename := filepath.Base(imagePath)
+	if err := checkFilename(filename); err != nil {
+		return nil, err
+	}
+	if _, err := appliancepkg.ParseVersionString(filename); err != nil {
+		return nil, fmt.Errorf("could not determine the version of %s: %w", filename, err)
+	}
+	info, err := Inspect(imagePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	dst := filepath.Join(s.Dir, filename)
+	if move {
+		if err := os.Rename(imagePath, dst); err != nil {
+			return nil, err
+		}
+	} else if abs, _ := filepath.Abs(imagePath); abs != dst {
+		if err := copyFile(imagePath, dst); err != nil {
+			return nil, err
+		}
+	}
+	// the signature is kept as <image>.sig, where it is found when the image is verified again before it is uploaded
+	sigDst := dst + ".sig"
+	if info.Signature != nil {
+		if abs, _ := filepath.Abs(info.Signature.File); abs != sigDst {
+			if err := copyFile(info.Signature.File, sigDst); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := os.Remove(sigDst); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	images, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	image := StoreImage{
+		Filename:    filename,
+		Version:     info.Version,
+		BuildNumber: info.BuildNumber,
+		SHA256:      info.SHA256,
+		Size:        info.Size,
+		Added:       time.Now().UTC(),
+		Signed:      info.Signature != nil,
+	}
+	result := []StoreImage{image}
+	for _, i := range images {
+		if i.Filename != filename {
+			result = append(result, i)
+		}
+	}
+	if err := s.save(result); err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{"image": filename, "version": image.Version}).Info("added image to the image store")
+	return &image, nil
+}
+
+// copyFile copies src to a temporary file next to dst, which is renamed when the copy is complete
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	part := dst + ".part"
+	out, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(part)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(part)
+		return err
+	}
+	return os.Rename(part, dst)
+}
+
+// Remove deletes the images matching the filename or version from the store, and returns the removed images
+func (s *Store) Remove(nameOrVersion string) ([]StoreImage, error) {
+	images, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	keep := []StoreImage{}
+	removed := []StoreImage{}
+	for _, i := range images {
+		if i.Filename == nameOrVersion || i.Version == nameOrVersion || fmt.Sprintf("%s-%s", i.Version, i.BuildNumber) == nameOrVersion {
+			removed = append(removed, i)
+			continue
+		}
+		keep = append(keep, i)
+	}
+	if len(removed) <= 0 {
+		return nil, fmt.Errorf("%w: %s", ErrImageNotFound, nameOrVersion)
+	}
+	for _, i := range removed {
+		for _, p := range []string{s.Path(i), s.Path(i) + ".sig"} {
+			if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+	return removed, s.save(keep)
+}
+
+// Find returns the image with the given version. If the version doesn't have a build number,
+// the image with the highest build number is returned.
+func (s *Store) Find(v *version.Version) (*StoreImage, error) {
+	images, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range images {
+		iv, err := i.ParsedVersion()
+		if err != nil {
+			continue
+		}
+		if !iv.Core().Equal(v.Core()) || iv.Prerelease() != v.Prerelease() {
+			continue
+		}
+		if len(v.Metadata()) > 0 && v.Metadata() != iv.Metadata() {
+			continue
+		}
+		// images are sorted with the highest version first
+		return &i, nil
+	}
+	return nil, fmt.Errorf("%w: version %s", ErrImageNotFound, v.String())
+}
+
+// LatestPatch returns the image with the highest patch version for the same major and minor version as current,
+// if it's newer than current. Prereleases are ignored.
+func (s *Store) LatestPatch(current *version.Version) (*StoreImage, error) {
+	images, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	segments := current.Segments()
+	for _, i := range images {
+		iv, err := i.ParsedVersion()
+		if err != nil || len(iv.Prerelease()) > 0 {
+			continue
+		}
+		is := iv.Segments()
+		if is[0] != segments[0] || is[1] != segments[1] {
+			continue
+		}
+		if CompareVersions(iv, current) <= 0 {
+			break
+		}
+		return &i, nil
+	}
+	return nil, fmt.Errorf("%w: no patch release newer than %s", ErrImageNotFound, current.String())
+}
+
+// MirrorIndex is the index file of an image mirror, which is an HTTP server with the images and an index.json file
+//
+//	{"images": [{"filename": "appgate-6.0.3-31234-release.img.zip", "sha256": "...", "signature": "appgate-6.0.3-31234-release.img.zip.sig"}]}
+type MirrorIndex struct {
+	Images []MirrorImage `json:"images"`
+}
+
+// MirrorImage is an image in the mirror index. The URL and the URL of the detached signature are optional,
+// and are resolved relative to the index file.
+type MirrorImage struct {
+	Filename  string `json:"filename"`
+	SHA256    string `json:"sha256"`
+	URL       string `json:"url,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// ReadMirrorIndex fetches the index of an image mirror. mirror is either the URL of the index file, or the
+// URL of the directory containing an index.json file.
+func ReadMirrorIndex(ctx context.Context, client *http.Client, mirror string) (*MirrorIndex, *url.URL, error) {
+	u, err := url.Parse(mirror)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasSuffix(u.Path, ".json") {
+		u.Path = path.Join(u.Path, mirrorIndex)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("could not read mirror index %s: %s", u.String(), res.Status)
+	}
+	index := &MirrorIndex{}
+	if err := json.NewDecoder(res.Body).Decode(index); err != nil {
+		return nil, nil, fmt.Errorf("could not read mirror index %s: %w", u.String(), err)
+	}
+	return index, u, nil
+}
+
+// Pull downloads an image from a mirror into the store, and verifies it against the checksum in the mirror index
+func (s *Store) Pull(ctx context.Context, client *http.Client, indexURL *url.URL, image MirrorImage, opts VerifyOptions) (*StoreImage, error) {
+	if err := checkFilename(image.Filename); err != nil {
+		return nil, err
+	}
+	ref := image.URL
+	if len(ref) <= 0 {
+		ref = url.PathEscape(image.Filename)
+	}
+	u, err := indexURL.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(s.Dir, ".pull-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	downloaded, err := Download(ctx, client, u.String(), dir)
+	if err != nil {
+		return nil, err
+	}
+	// keep the filename from the index, in case the URL doesn't end with it
+	p := filepath.Join(dir, image.Filename)
+	if downloaded != p {
+		if err := os.Rename(downloaded, p); err != nil {
+			return nil, err
+		}
+	}
+	if len(image.Signature) > 0 {
+		su, err := indexURL.Parse(image.Signature)
+		if err != nil {
+			return nil, err
+		}
+		sig, err := Download(ctx, client, su.String(), dir)
+		if err != nil {
+			return nil, err
+		}
+		if sig != p+".sig" {
+			if err := os.Rename(sig, p+".sig"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(opts.SHA256) <= 0 {
+		opts.SHA256 = image.SHA256
+	}
+	// the download is in the store directory, so it can be moved instead of copied
+	return s.add(p, opts, true)
+}
@@ -0,0 +1,231 @@
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+)
+
+func newTestStore(t *testing.T, images ...string) *Store {
+	t.Helper()
+	t.Setenv("SDPCTL_CONFIG_DIR", t.TempDir())
+	store, err := NewStore(filepath.Join(t.TempDir(), "images"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := t.TempDir()
+	for _, name := range images {
+		if _, err := store.Add(writeImage(t, src, name), VerifyOptions{SkipSignature: true}); err != nil {
+			t.Fatalf("Add() error = %s", err)
+		}
+	}
+	return store
+}
+
+func filenames(images []StoreImage) []string {
+	names := []string{}
+	for _, i := range images {
+		names = append(names, i.Filename)
+	}
+	return names
+}
+
+func TestStore(t *testing.T) {
+	store := newTestStore(t,
+		"appgate-6.0.1-9876-release.img.zip",
+		"appgate-6.0.3-31234-release.img.zip",
+		"appgate-6.0.3-12345-release.img.zip",
+		"appgate-6.1.0-40000-release.img.zip",
+		"appgate-6.0.4-50000-beta.img.zip",
+	)
+
+	images, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"appgate-6.1.0-40000-release.img.zip",
+		"appgate-6.0.4-50000-beta.img.zip",
+		"appgate-6.0.3-31234-release.img.zip",
+		"appgate-6.0.3-12345-release.img.zip",
+		"appgate-6.0.1-9876-release.img.zip",
+	}
+	if got := filenames(images); len(got) != len(want) {
+		t.Fatalf("want %v, got %v", want, got)
+	} else {
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("want %v, got %v", want, got)
+			}
+		}
+	}
+	if images[0].SHA256 == "" || images[0].Version != "6.1.0" || images[0].BuildNumber != "40000" {
+		t.Errorf("unexpected image %+v", images[0])
+	}
+
+	t.Run("find", func(t *testing.T) {
+		tests := map[string]string{
+			"6.0.3":       "appgate-6.0.3-31234-release.img.zip",
+			"6.0.3+12345": "appgate-6.0.3-12345-release.img.zip",
+			"6.1.0":       "appgate-6.1.0-40000-release.img.zip",
+		}
+		for v, want := range tests {
+			image, err := store.Find(version.Must(version.NewVersion(v)))
+			if err != nil {
+				t.Fatalf("Find(%s) error = %s", v, err)
+			}
+			if image.Filename != want {
+				t.Errorf("Find(%s) want %s, got %s", v, want, image.Filename)
+			}
+		}
+		if _, err := store.Find(version.Must(version.NewVersion("6.0.2"))); !errors.Is(err, ErrImageNotFound) {
+			t.Errorf("expected image not found, got %v", err)
+		}
+	})
+
+	t.Run("latest patch", func(t *testing.T) {
+		image, err := store.LatestPatch(version.Must(version.NewVersion("6.0.1+9876")))
+		if err != nil {
+			t.Fatalf("LatestPatch() error = %s", err)
+		}
+		// the beta is ignored
+		if image.Filename != "appgate-6.0.3-31234-release.img.zip" {
+			t.Errorf("unexpected latest patch %s", image.Filename)
+		}
+		if _, err := store.LatestPatch(version.Must(version.NewVersion("6.1.0+40000"))); !errors.Is(err, ErrImageNotFound) {
+			t.Errorf("expected image not found, got %v", err)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		removed, err := store.Remove("6.0.3")
+		if err != nil {
+			t.Fatalf("Remove() error = %s", err)
+		}
+		if len(removed) != 2 {
+			t.Errorf("expected 2 removed images, got %v", filenames(removed))
+		}
+		for _, i := range removed {
+			if _, err := os.Stat(store.Path(i)); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected %s to be deleted", i.Filename)
+			}
+		}
+		images, _ := store.List()
+		if len(images) != 3 {
+			t.Errorf("expected 3 images left, got %v", filenames(images))
+		}
+		if _, err := store.Remove("6.0.3"); !errors.Is(err, ErrImageNotFound) {
+			t.Errorf("expected image not found, got %v", err)
+		}
+	})
+}
+
+func TestStorePull(t *testing.T) {
+	store := newTestStore(t)
+	mirror := t.TempDir()
+	image := writeImage(t, mirror, "appgate-6.0.3-31234-release.img.zip")
+	keyring, entity := writeKeyring(t, t.TempDir())
+	sign(t, entity, image)
+	content, _ := os.ReadFile(image)
+	sum := sha256.Sum256(content)
+	index := MirrorIndex{Images: []MirrorImage{
+		{Filename: "appgate-6.0.3-31234-release.img.zip", SHA256: hex.EncodeToString(sum[:]), Signature: "appgate-6.0.3-31234-release.img.zip.sig"},
+		{Filename: "appgate-6.0.4-40000-release.img.zip", SHA256: "0000"},
+	}}
+	writeImage(t, mirror, "appgate-6.0.4-40000-release.img.zip")
+	indexContent, _ := json.Marshal(index)
+	if err := os.WriteFile(filepath.Join(mirror, "index.json"), indexContent, 0600); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(mirror)))
+	defer server.Close()
+
+	ctx := context.Background()
+	got, indexURL, err := ReadMirrorIndex(ctx, server.Client(), server.URL+"/")
+	if err != nil {
+		t.Fatalf("ReadMirrorIndex() error = %s", err)
+	}
+	if len(got.Images) != 2 {
+		t.Fatalf("unexpected index %+v", got)
+	}
+
+	pulled, err := store.Pull(ctx, server.Client(), indexURL, got.Images[0], VerifyOptions{Keyring: keyring})
+	if err != nil {
+		t.Fatalf("Pull() error = %s", err)
+	}
+	if pulled.Version != "6.0.3" || !pulled.Signed {
+		t.Errorf("unexpected image %+v", pulled)
+	}
+	for _, p := range []string{store.Path(*pulled), store.Path(*pulled) + ".sig"} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("expected %s in store: %s", filepath.Base(p), err)
+		}
+	}
+	// the signature in the store is found when the image is verified again before an upgrade
+	if _, err := Inspect(store.Path(*pulled), VerifyOptions{Keyring: keyring}); err != nil {
+		t.Errorf("Inspect() error = %s", err)
+	}
+
+	// the checksum in the index doesn't match the image
+	if _, err := store.Pull(ctx, server.Client(), indexURL, got.Images[1], VerifyOptions{SkipSignature: true}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+	images, _ := store.List()
+	if len(images) != 1 {
+		t.Errorf("expected only the verified image in the store, got %v", filenames(images))
+	}
+	entries, _ := os.ReadDir(store.Dir)
+	for _, e := range entries {
+		if e.IsDir() {
+			t.Errorf("temporary directory %s was not removed", e.Name())
+		}
+	}
+}
+
+func TestStoreInvalidFilename(t *testing.T) {
+	store := newTestStore(t)
+	mirror := t.TempDir()
+	writeImage(t, mirror, "appgate-6.0.3-31234-release.img.zip")
+	server := httptest.NewServer(http.FileServer(http.Dir(mirror)))
+	defer server.Close()
+	indexURL, _ := url.Parse(server.URL + "/index.json")
+
+	// a malicious mirror index which would move the download out of the image store
+	target := filepath.Join(filepath.Dir(store.Dir), "appgate-6.0.3-31234-release.img.zip")
+	for _, name := range []string{"../appgate-6.0.3-31234-release.img.zip", "..", ".", "", `..\appgate-6.0.3-31234-release.img.zip`} {
+		mi := MirrorImage{Filename: name, URL: "appgate-6.0.3-31234-release.img.zip"}
+		if _, err := store.Pull(context.Background(), server.Client(), indexURL, mi, VerifyOptions{SkipSignature: true}); !errors.Is(err, ErrInvalidFilename) {
+			t.Errorf("Pull(%q) expected invalid filename, got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(target); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected nothing to be written outside of the image store, got %v", err)
+	}
+
+	// entries of the store index with an invalid filename are ignored, so they are never removed or uploaded
+	index := []StoreImage{
+		{Filename: "../../etc/appgate-6.0.3-31234-release.img.zip", Version: "6.0.3"},
+		{Filename: "appgate-6.0.1-9876-release.img.zip", Version: "6.0.1"},
+	}
+	content, _ := json.Marshal(index)
+	if err := os.WriteFile(filepath.Join(store.Dir, "index.json"), content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	images, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %s", err)
+	}
+	if got := filenames(images); len(got) != 1 || got[0] != "appgate-6.0.1-9876-release.img.zip" {
+		t.Errorf("expected only the valid image, got %v", got)
+	}
+}
@@ -8,11 +8,14 @@ import (
 )
 
 const (
-	keyringService = "sdpctl"
-	password       = "password"
-	username       = "username"
-	bearer         = "bearer"
-	refreshToken   = "refreshToken"
+	keyringService   = "sdpctl"
+	password         = "password"
+	username         = "username"
+	bearer           = "bearer"
+	refreshToken     = "refreshToken"
+	backupUsername   = "backupUsername"
+	backupSecret     = "backupSecret"
+	backupPassphrase = "backupPassphrase"
 )
 
 func format(prefix, value string) string {
@@ -89,3 +89,39 @@ func GetUsername(prefix string) (string, error) {
 	}
 	return getSecret(format(prefix, username))
 }
+
+// GetBackupUsername returns the username of the remote backup destination prefix
+func GetBackupUsername(prefix string) (string, error) {
+	if v, ok := os.LookupEnv("SDPCTL_BACKUP_USERNAME"); ok {
+		return v, nil
+	}
+	return getSecret(format(prefix, backupUsername))
+}
+
+func SetBackupUsername(prefix, secret string) error {
+	return setSecret(format(prefix, backupUsername), secret)
+}
+
+// GetBackupSecret returns the password or secret key of the remote backup destination prefix
+func GetBackupSecret(prefix string) (string, error) {
+	if v, ok := os.LookupEnv("SDPCTL_BACKUP_SECRET"); ok {
+		return v, nil
+	}
+	return getSecret(format(prefix, backupSecret))
+}
+
+func SetBackupSecret(prefix, secret string) error {
+	return setSecret(format(prefix, backupSecret), secret)
+}
+
+// GetBackupPassphrase returns the passphrase of the backups of the collective prefix
+func GetBackupPassphrase(prefix string) (string, error) {
+	if v, ok := os.LookupEnv("SDPCTL_BACKUP_PASSPHRASE"); ok {
+		return v, nil
+	}
+	return getSecret(format(prefix, backupPassphrase))
+}
+
+func SetBackupPassphrase(prefix, secret string) error {
+	return setSecret(format(prefix, backupPassphrase), secret)
+}
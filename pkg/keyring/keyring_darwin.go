@@ -161,3 +161,48 @@ func SetRefreshToken(prefix, secret string) error {
 	}
 	return nil
 }
+
+func GetBackupUsername(prefix string) (string, error) {
+	if v, ok := os.LookupEnv("SDPCTL_BACKUP_USERNAME"); ok {
+		return v, nil
+	}
+	user, err := QueryKeychain(format(prefix, backupUsername))
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("failed to get backup username from keychain: %s", err))
+	}
+	return user, nil
+}
+
+func SetBackupUsername(prefix, secret string) error {
+	return AddKeychain(format(prefix, backupUsername), secret)
+}
+
+func GetBackupSecret(prefix string) (string, error) {
+	if v, ok := os.LookupEnv("SDPCTL_BACKUP_SECRET"); ok {
+		return v, nil
+	}
+	secret, err := QueryKeychain(format(prefix, backupSecret))
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("failed to get backup secret from keychain: %s", err))
+	}
+	return secret, nil
+}
+
+func SetBackupSecret(prefix, secret string) error {
+	return AddKeychain(format(prefix, backupSecret), secret)
+}
+
+func GetBackupPassphrase(prefix string) (string, error) {
+	if v, ok := os.LookupEnv("SDPCTL_BACKUP_PASSPHRASE"); ok {
+		return v, nil
+	}
+	passphrase, err := QueryKeychain(format(prefix, backupPassphrase))
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("failed to get backup passphrase from keychain: %s", err))
+	}
+	return passphrase, nil
+}
+
+func SetBackupPassphrase(prefix, secret string) error {
+	return AddKeychain(format(prefix, backupPassphrase), secret)
+}
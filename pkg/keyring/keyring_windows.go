@@ -126,3 +126,36 @@ func GetRefreshToken(prefix string) (string, error) {
 func SetRefreshToken(prefix, secret string) error {
 	return saveEncryptedFile(refreshToken, prefix, secret)
 }
+
+func GetBackupUsername(prefix string) (string, error) {
+	if v, ok := os.LookupEnv("SDPCTL_BACKUP_USERNAME"); ok {
+		return v, nil
+	}
+	return getSecret(format(prefix, backupUsername))
+}
+
+func SetBackupUsername(prefix, secret string) error {
+	return setSecret(format(prefix, backupUsername), secret)
+}
+
+func GetBackupSecret(prefix string) (string, error) {
+	if v, ok := os.LookupEnv("SDPCTL_BACKUP_SECRET"); ok {
+		return v, nil
+	}
+	return getSecretFile(backupSecret, prefix)
+}
+
+func SetBackupSecret(prefix, secret string) error {
+	return saveEncryptedFile(backupSecret, prefix, secret)
+}
+
+func GetBackupPassphrase(prefix string) (string, error) {
+	if v, ok := os.LookupEnv("SDPCTL_BACKUP_PASSPHRASE"); ok {
+		return v, nil
+	}
+	return getSecretFile(backupPassphrase, prefix)
+}
+
+func SetBackupPassphrase(prefix, secret string) error {
+	return saveEncryptedFile(backupPassphrase, prefix, secret)
+}
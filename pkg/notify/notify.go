@@ -0,0 +1,228 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/appgate/sdpctl/pkg/util"
+	"github.com/cenkalti/backoff/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// Event types sent to the webhooks
+const (
+	EventPrepareStarted     = "prepare.started"
+	EventPrepareCompleted   = "prepare.completed"
+	EventApplianceReady     = "appliance.ready"
+	EventControllerDisabled = "controller.disabled"
+	EventControllerEnabled  = "controller.enabled"
+	EventBatchDone          = "upgrade.batch_done"
+	EventUpgradeCompleted   = "upgrade.completed"
+	EventBackupWritten      = "backup.written"
+	EventFailure            = "failure"
+)
+
+// Payload formats for the webhooks
+const (
+	FormatGeneric = "generic"
+	FormatSlack   = "slack"
+	FormatTeams   = "teams"
+)
+
+const (
+	// queueSize is the number of events which can wait for delivery before new events are dropped
+	queueSize = 100
+	// closeTimeout is how long Close waits for the queued events to be delivered
+	closeTimeout = 15 * time.Second
+)
+
+// Event is an upgrade or backup lifecycle event
+type Event struct {
+	Type      string            `json:"type"`
+	Time      time.Time         `json:"time"`
+	Host      string            `json:"host,omitempty"`
+	Appliance string            `json:"appliance,omitempty"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// Notifier delivers events to the webhooks in the config. Events are queued and delivered in the background with
+// retries, so that a slow or unavailable webhook never blocks the caller. A nil Notifier discards all events.
+type Notifier struct {
+	hooks   []configuration.Webhook
+	client  *http.Client
+	host    string
+	queue   chan Event
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	mu      sync.Mutex
+	closed  bool
+	backoff func() backoff.BackOff
+}
+
+// New returns a notifier for the webhooks, or nil if there are none. host is the collective the events are about.
+func New(hooks []configuration.Webhook, host string) *Notifier {
+	if len(hooks) <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{
+		hooks:  hooks,
+		client: &http.Client{Timeout: 10 * time.Second},
+		host:   host,
+		queue:  make(chan Event, queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		backoff: func() backoff.BackOff {
+			b := backoff.NewExponentialBackOff()
+			b.InitialInterval = time.Second
+			b.MaxElapsedTime = time.Minute
+			return b
+		},
+	}
+	go n.run()
+	return n
+}
+
+// Notify queues the event for delivery. It never blocks, and the event is dropped if the queue is full.
+func (n *Notifier) Notify(e Event) {
+	if n == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if len(e.Host) <= 0 {
+		e.Host = n.host
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	select {
+	case n.queue <- e:
+	default:
+		log.WithField("event", e.Type).Warn("webhook queue is full, dropping event")
+	}
+}
+
+// Failure queues a failure event with the error
+func (n *Notifier) Failure(message string, err error) {
+	if n == nil || err == nil {
+		return
+	}
+	n.Notify(Event{Type: EventFailure, Message: message, Error: err.Error()})
+}
+
+// Close stops accepting events and waits for the queued events to be delivered, or until the timeout is reached
+func (n *Notifier) Close() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+	select {
+	case <-n.done:
+	case <-time.After(closeTimeout):
+		log.Warn("timed out delivering webhook notifications")
+		n.cancel()
+		<-n.done
+	}
+	n.cancel()
+}
+
+func (n *Notifier) run() {
+	defer close(n.done)
+	for e := range n.queue {
+		for _, hook := range n.hooks {
+			if len(hook.Events) > 0 && !util.InSlice(e.Type, hook.Events) {
+				continue
+			}
+			if err := n.deliver(hook, e); err != nil {
+				log.WithError(err).WithFields(log.Fields{"event": e.Type, "url": hook.URL}).Warn("failed to deliver webhook notification")
+			}
+		}
+	}
+}
+
+func (n *Notifier) deliver(hook configuration.Webhook, e Event) error {
+	body, err := Payload(hook.Format, e)
+	if err != nil {
+		return err
+	}
+	return backoff.Retry(func() error {
+		req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range hook.Headers {
+			req.Header.Set(k, v)
+		}
+		res, err := n.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		io.Copy(io.Discard, res.Body)
+		if res.StatusCode >= 200 && res.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("webhook responded %s", res.Status)
+		// client errors won't succeed on retry, except rate limiting
+		if res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(n.backoff(), n.ctx))
+}
+
+// Payload returns the JSON body of the event for the format of the webhook
+func Payload(format string, e Event) ([]byte, error) {
+	switch format {
+	case FormatSlack:
+		return json.Marshal(map[string]string{"text": text(e)})
+	case FormatTeams:
+		color := "2EB886"
+		if e.Type == EventFailure {
+			color = "D40E0D"
+		}
+		return json.Marshal(map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    e.Message,
+			"themeColor": color,
+			"title":      fmt.Sprintf("sdpctl: %s", e.Type),
+			"text":       text(e),
+		})
+	case FormatGeneric, "":
+		return json.Marshal(e)
+	}
+	return nil, fmt.Errorf("unknown webhook format %q, expected %s, %s or %s", format, FormatSlack, FormatTeams, FormatGeneric)
+}
+
+func text(e Event) string {
+	s := e.Message
+	if len(e.Host) > 0 {
+		s = fmt.Sprintf("[%s] %s", e.Host, s)
+	}
+	if len(e.Error) > 0 {
+		s = fmt.Sprintf("%s: %s", s, e.Error)
+	}
+	return s
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/configuration"
+	"github.com/cenkalti/backoff/v4"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	bodies   [][]byte
+	headers  []http.Header
+	failures int
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	r.bodies = append(r.bodies, body)
+	r.headers = append(r.headers, req.Header.Clone())
+}
+
+func newTestNotifier(hooks []configuration.Webhook) *Notifier {
+	n := New(hooks, "appgate.com")
+	n.backoff = func() backoff.BackOff {
+		return backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Millisecond), 3)
+	}
+	return n
+}
+
+func TestNotifierDelivery(t *testing.T) {
+	slack := &recorder{failures: 2}
+	generic := &recorder{}
+	slackServer := httptest.NewServer(slack)
+	defer slackServer.Close()
+	genericServer := httptest.NewServer(generic)
+	defer genericServer.Close()
+
+	n := newTestNotifier([]configuration.Webhook{
+		{URL: slackServer.URL, Format: FormatSlack, Events: []string{EventFailure}},
+		{URL: genericServer.URL, Headers: map[string]string{"Authorization": "Bearer abc"}},
+	})
+	n.Notify(Event{Type: EventBatchDone, Message: "Batch 1 / 2 done"})
+	n.Failure("Upgrade complete failed", errors.New("gateway did not reach ready"))
+	n.Close()
+	// events after close are dropped
+	n.Notify(Event{Type: EventUpgradeCompleted})
+
+	if len(slack.bodies) != 1 {
+		t.Fatalf("expected 1 slack notification after retries, got %d", len(slack.bodies))
+	}
+	var text map[string]string
+	if err := json.Unmarshal(slack.bodies[0], &text); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[appgate.com] Upgrade complete failed: gateway did not reach ready"; text["text"] != want {
+		t.Errorf("got slack text %q, want %q", text["text"], want)
+	}
+
+	if len(generic.bodies) != 2 {
+		t.Fatalf("expected 2 generic notifications, got %d", len(generic.bodies))
+	}
+	var e Event
+	if err := json.Unmarshal(generic.bodies[0], &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != EventBatchDone || e.Host != "appgate.com" || e.Time.IsZero() {
+		t.Errorf("unexpected generic event %+v", e)
+	}
+	if got := generic.headers[0].Get("Authorization"); got != "Bearer abc" {
+		t.Errorf("expected custom header, got %q", got)
+	}
+}
+
+func TestNotifierClientErrorIsNotRetried(t *testing.T) {
+	var calls int
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	n := newTestNotifier([]configuration.Webhook{{URL: server.URL}})
+	n.Notify(Event{Type: EventPrepareStarted})
+	n.Close()
+	if calls != 1 {
+		t.Errorf("expected 1 request, got %d", calls)
+	}
+}
+
+func TestNilNotifier(t *testing.T) {
+	n := New(nil, "appgate.com")
+	if n != nil {
+		t.Fatal("expected nil notifier without webhooks")
+	}
+	n.Notify(Event{Type: EventPrepareStarted})
+	n.Failure("failed", errors.New("error"))
+	n.Close()
+}
+
+func TestPayload(t *testing.T) {
+	e := Event{Type: EventFailure, Host: "appgate.com", Message: "Backup failed", Error: "timeout"}
+	body, err := Payload(FormatTeams, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var card map[string]string
+	if err := json.Unmarshal(body, &card); err != nil {
+		t.Fatal(err)
+	}
+	if card["@type"] != "MessageCard" || card["themeColor"] != "D40E0D" || card["text"] != "[appgate.com] Backup failed: timeout" {
+		t.Errorf("unexpected teams payload %s", body)
+	}
+	if _, err := Payload("email", e); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -0,0 +1,82 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/configuration"
+)
+
+func TestCronNext(t *testing.T) {
+	// Saturday 5 November 2022
+	now := time.Date(2022, 11, 5, 10, 30, 15, 0, time.Local)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 2 * * *", time.Date(2022, 11, 6, 2, 0, 0, 0, time.Local)},
+		{"45 10 * * *", time.Date(2022, 11, 5, 10, 45, 0, 0, time.Local)},
+		{"*/15 * * * *", time.Date(2022, 11, 5, 10, 45, 0, 0, time.Local)},
+		{"0 2 * * 1-5", time.Date(2022, 11, 7, 2, 0, 0, 0, time.Local)},
+		{"0 2 * * 7", time.Date(2022, 11, 6, 2, 0, 0, 0, time.Local)},
+		{"0 0 1 1 *", time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local)},
+		{"30 3 15 * 6", time.Date(2022, 11, 12, 3, 30, 0, 0, time.Local)},
+		{"0 22,23 * * *", time.Date(2022, 11, 5, 22, 0, 0, 0, time.Local)},
+		{"@monthly", time.Date(2022, 12, 1, 0, 0, 0, 0, time.Local)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron() error = %s", err)
+			}
+			got, err := c.Next(now)
+			if err != nil {
+				t.Fatalf("Next() error = %s", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Next() got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@reboot"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) expected error", expr)
+		}
+	}
+	c, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Next(time.Now()); !errors.Is(err, ErrNoNextRun) {
+		t.Errorf("expected ErrNoNextRun, got %v", err)
+	}
+}
+
+func TestWindowAndTokenLifetime(t *testing.T) {
+	start := time.Now().Add(time.Hour)
+	w := Window{Start: start, Duration: time.Hour}
+	if w.Closed(start.Add(59 * time.Minute)) {
+		t.Error("expected window to be open")
+	}
+	if !w.Closed(start.Add(time.Hour)) {
+		t.Error("expected window to be closed")
+	}
+	if (Window{Start: start}).Closed(start.Add(24 * time.Hour)) {
+		t.Error("a window without duration should never close")
+	}
+
+	cfg := &configuration.Config{ExpiresAt: start.Add(-time.Minute).UTC().String()}
+	if err := CheckTokenLifetime(cfg, start); !errors.Is(err, ErrTokenExpires) {
+		t.Errorf("expected ErrTokenExpires, got %v", err)
+	}
+	cfg.ExpiresAt = start.Add(time.Minute).UTC().String()
+	if err := CheckTokenLifetime(cfg, start); err != nil {
+		t.Errorf("expected token to be valid, got %s", err)
+	}
+}
@@ -0,0 +1,67 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/appgate/sdpctl/pkg/configuration"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrTokenExpires is returned when the sign in token expires before a scheduled start
+var ErrTokenExpires = errors.New("the sign in token expires before the scheduled start")
+
+// ErrWindowClosed is returned when the maintenance window closes before all the work is done
+var ErrWindowClosed = errors.New("the maintenance window has closed")
+
+// Window is a maintenance window. A zero Duration means that the window never closes.
+type Window struct {
+	Start    time.Time
+	Duration time.Duration
+}
+
+// End returns the time when the window closes, or the zero time if it never closes
+func (w Window) End() time.Time {
+	if w.Duration <= 0 {
+		return time.Time{}
+	}
+	return w.Start.Add(w.Duration)
+}
+
+// Closed returns true if the window has closed at t
+func (w Window) Closed(t time.Time) bool {
+	end := w.End()
+	return !end.IsZero() && !t.Before(end)
+}
+
+// Wait blocks until t, or until the context is cancelled
+func Wait(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// CheckTokenLifetime returns ErrTokenExpires if the bearer token in the config expires before start.
+// The check is skipped if the expiry time of the token is unknown.
+func CheckTokenLifetime(cfg *configuration.Config, start time.Time) error {
+	expires, err := cfg.ExpiresAtTime()
+	if err != nil {
+		log.WithError(err).Debug("could not determine when the token expires")
+		return nil
+	}
+	if expires.Before(start) {
+		return fmt.Errorf("%w: the token expires %s, and the start is %s", ErrTokenExpires, expires.Local().Format(time.RFC3339), start.Local().Format(time.RFC3339))
+	}
+	return nil
+}
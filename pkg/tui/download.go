@@ -0,0 +1,30 @@
+package tui
+
+import (
+	"github.com/vbauerster/mpb/v7"
+	"github.com/vbauerster/mpb/v7/decor"
+)
+
+// AddDownloadBar adds a bar which shows the bytes downloaded of name, and is removed when it completes.
+// total is the size of the download, or -1 if it is unknown, in which case the bar must be completed with SetTotal.
+func AddDownloadBar(p *mpb.Progress, name string, total int64, opts ...mpb.BarOption) *mpb.Bar {
+	if total < 0 {
+		total = 0
+	}
+	options := []mpb.BarOption{
+		mpb.BarWidth(30),
+		mpb.BarRemoveOnComplete(),
+		mpb.PrependDecorators(
+			decor.Name(name, decor.WCSyncWidthR),
+			decor.Name(":", decor.WC{W: 2, C: decor.DidentRight}),
+		),
+		mpb.AppendDecorators(
+			decor.CountersKibiByte("% .2f / % .2f"),
+			decor.Name(" | "),
+			decor.AverageSpeed(decor.UnitKiB, "% .2f"),
+		),
+	}
+	options = append(options, opts...)
+
+	return p.New(total, mpb.BarStyle(), options...)
+}
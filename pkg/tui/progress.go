@@ -2,16 +2,21 @@ package tui
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"time"
 
+	"github.com/appgate/sdpctl/pkg/eta"
 	"github.com/vbauerster/mpb/v7"
+	"github.com/vbauerster/mpb/v7/decor"
 )
 
 type Progress struct {
-	ctx      context.Context
-	pc       *mpb.Progress
-	trackers []*Tracker
+	ctx        context.Context
+	pc         *mpb.Progress
+	trackers   []*Tracker
+	estimator  *eta.Estimator
+	countdowns []*mpb.Bar
 }
 
 var (
@@ -37,6 +42,7 @@ func (p *Progress) AddTracker(name, endMsg string) *Tracker {
 		current:      "waiting",
 		endMsg:       endMsg,
 		statusReport: make(chan string, 1),
+		clock:        p.estimator.Start(),
 	}
 
 	t.mu.Lock()
@@ -51,11 +57,36 @@ func (p *Progress) AddTracker(name, endMsg string) *Tracker {
 	return &t
 }
 
+// SetEstimator makes the trackers added after it show the estimated time left of each appliance
+func (p *Progress) SetEstimator(e *eta.Estimator) {
+	p.estimator = e
+}
+
+// AddCountdown adds a line with the estimated time left until end, such as the end of the whole upgrade.
+// The line is removed when the trackers are completed.
+func (p *Progress) AddCountdown(name string, end time.Time) {
+	bar := p.pc.New(1,
+		mpb.NopStyle(),
+		mpb.BarRemoveOnComplete(),
+		mpb.AppendDecorators(decor.Any(func(s decor.Statistics) string {
+			return fmt.Sprintf("%s: %s", name, eta.Format(time.Until(end)))
+		})),
+	)
+	p.countdowns = append(p.countdowns, bar)
+}
+
 // Complete will complete all currently active trackers and wait for them to finish before returning
 func (p *Progress) Complete() {
 	for _, t := range p.trackers {
 		t.complete()
 	}
+	p.completeCountdowns()
+}
+
+func (p *Progress) completeCountdowns() {
+	for _, c := range p.countdowns {
+		c.Increment()
+	}
 }
 
 // Abort will abort all currently active trackers and wait for them to finish before returning
@@ -69,6 +100,7 @@ func (p *Progress) Abort() {
 // If deadline is reached before the bars are complete, it will abort
 // all bars remaining and return
 func (p *Progress) Wait() {
+	p.completeCountdowns()
 	done := make(chan bool)
 	ctx, cancel := context.WithTimeout(p.ctx, 2*defaultRefreshRate)
 	defer cancel()
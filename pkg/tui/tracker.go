@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/appgate/sdpctl/pkg/eta"
 	"github.com/appgate/sdpctl/pkg/util"
 	"github.com/vbauerster/mpb/v7"
 	"github.com/vbauerster/mpb/v7/decor"
@@ -22,6 +23,8 @@ type Tracker struct {
 	success      bool
 	done         bool
 	statusReport chan string
+	// clock estimates the time left of the appliance, if the progress has an estimator
+	clock *eta.Clock
 }
 
 // Watch initiates the progress tracking for each appliance update
@@ -64,6 +67,7 @@ func (t *Tracker) Watch(until, failOn []string) {
 			break
 		}
 		t.current = msg
+		t.clock.Update(msg, time.Now())
 	}
 }
 
@@ -79,7 +83,11 @@ func (t *Tracker) decoratorFunc(name string) decor.Decorator {
 	return decor.Any(func(s decor.Statistics) string {
 		t.mu.Lock()
 		defer t.mu.Unlock()
-		return fmt.Sprintf("%s: %s", name, strings.ReplaceAll(t.current, "_", " "))
+		status := strings.ReplaceAll(t.current, "_", " ")
+		if t.clock != nil && !t.done {
+			return fmt.Sprintf("%s: %s (%s)", name, status, eta.Format(t.clock.Remaining(time.Now())))
+		}
+		return fmt.Sprintf("%s: %s", name, status)
 	})
 }
 
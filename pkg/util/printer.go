@@ -7,6 +7,7 @@ import (
 	"text/tabwriter"
 
 	"github.com/cheynewallace/tabby"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -31,3 +32,12 @@ func PrintJSON(output io.Writer, v interface{}) error {
 	}
 	return nil
 }
+
+func PrintYAML(output io.Writer, v interface{}) error {
+	enc := yaml.NewEncoder(output)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}